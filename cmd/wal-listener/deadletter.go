@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+const (
+	defaultDeadLetterRetryInterval = 10 * time.Second
+	deadLetterPublisherName        = "dead_letter"
+)
+
+var errPublisherNotReady = errors.New("publisher is not connected yet")
+
+// deadLetterSink stores the dead-letter records.
+type deadLetterSink interface {
+	PublishDeadLetter(ctx context.Context, topic string, dl *publisher.DeadLetter) error
+	Close() error
+}
+
+// readinessMonitor records whether a non-critical publisher is connected.
+type readinessMonitor interface {
+	SetPublisherReady(name string, ready bool)
+}
+
+// initDeadLetter connects to the dead-letter cluster. Returns nil if the dead letters go through the publisher.
+func initDeadLetter(
+	ctx context.Context,
+	cfg *config.PublisherCfg,
+	logger *slog.Logger,
+	monitor readinessMonitor,
+) (deadLetterSink, error) {
+	if cfg.DeadLetter.Address == "" {
+		return nil, nil
+	}
+
+	connect := func() (deadLetterSink, error) {
+		dlCfg := *cfg
+		dlCfg.Address = cfg.DeadLetter.Address
+
+		producer, err := publisher.NewProducer(&dlCfg)
+		if err != nil {
+			return nil, fmt.Errorf("kafka producer: %w", err)
+		}
+
+		// dead letters are always JSON, the marshaler is not used.
+		return publisher.NewKafkaPublisher(producer, publisher.JSONMarshaler{}), nil
+	}
+
+	return connectDeadLetter(ctx, cfg.DeadLetter, connect, logger, monitor)
+}
+
+// connectDeadLetter fails fast unless the dead-letter cluster is non-critical,
+// then the connection is retried in the background.
+func connectDeadLetter(
+	ctx context.Context,
+	cfg config.DeadLetterCfg,
+	connect func() (deadLetterSink, error),
+	logger *slog.Logger,
+	monitor readinessMonitor,
+) (deadLetterSink, error) {
+	sink, err := connect()
+	if err == nil {
+		monitor.SetPublisherReady(deadLetterPublisherName, true)
+		return sink, nil
+	}
+
+	if !cfg.NonCritical {
+		return nil, err
+	}
+
+	logger.Warn("dead-letter cluster is not available, starting degraded", "err", err.Error())
+	monitor.SetPublisherReady(deadLetterPublisherName, false)
+
+	interval := cfg.RetryInterval
+	if interval <= 0 {
+		interval = defaultDeadLetterRetryInterval
+	}
+
+	bp := new(backgroundPublisher)
+
+	go bp.connect(ctx, connect, interval, logger, func() {
+		monitor.SetPublisherReady(deadLetterPublisherName, true)
+	})
+
+	return bp, nil
+}
+
+// backgroundPublisher is a non-critical publisher connected in the background,
+// it fails with errPublisherNotReady until the connection is established.
+type backgroundPublisher struct {
+	mu   sync.RWMutex
+	sink deadLetterSink
+}
+
+func (p *backgroundPublisher) connect(
+	ctx context.Context,
+	connect func() (deadLetterSink, error),
+	interval time.Duration,
+	logger *slog.Logger,
+	ready func(),
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sink, err := connect()
+		if err != nil {
+			logger.Debug("dead-letter cluster is still not available", "err", err.Error())
+			continue
+		}
+
+		p.mu.Lock()
+		p.sink = sink
+		p.mu.Unlock()
+
+		ready()
+		logger.Info("dead-letter cluster connected")
+
+		return
+	}
+}
+
+// PublishDeadLetter stores the record once the publisher is connected.
+func (p *backgroundPublisher) PublishDeadLetter(ctx context.Context, topic string, dl *publisher.DeadLetter) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.sink == nil {
+		return errPublisherNotReady
+	}
+
+	return p.sink.PublishDeadLetter(ctx, topic, dl)
+}
+
+// Close closes the publisher if it is connected.
+func (p *backgroundPublisher) Close() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.sink == nil {
+		return nil
+	}
+
+	return p.sink.Close()
+}
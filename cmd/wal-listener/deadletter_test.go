@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+type deadLetterSinkMock struct {
+	published []*publisher.DeadLetter
+}
+
+func (s *deadLetterSinkMock) PublishDeadLetter(_ context.Context, _ string, dl *publisher.DeadLetter) error {
+	s.published = append(s.published, dl)
+	return nil
+}
+
+func (s *deadLetterSinkMock) Close() error {
+	return nil
+}
+
+type readinessMonitorMock struct {
+	mu    sync.Mutex
+	ready []bool
+}
+
+func (m *readinessMonitorMock) SetPublisherReady(_ string, ready bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ready = append(m.ready, ready)
+}
+
+func (m *readinessMonitorMock) states() []bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]bool(nil), m.ready...)
+}
+
+func TestConnectDeadLetter(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	errDown := errors.New("kafka: client has run out of available brokers")
+
+	// the cluster is down for the first attempts.
+	newConnect := func(failures int) (func() (deadLetterSink, error), *deadLetterSinkMock) {
+		sink := new(deadLetterSinkMock)
+		var mu sync.Mutex
+
+		return func() (deadLetterSink, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if failures > 0 {
+				failures--
+				return nil, errDown
+			}
+
+			return sink, nil
+		}, sink
+	}
+
+	t.Run("critical fails fast", func(t *testing.T) {
+		connect, _ := newConnect(1)
+
+		_, err := connectDeadLetter(context.Background(), config.DeadLetterCfg{}, connect, logger, new(readinessMonitorMock))
+		assert.ErrorIs(t, err, errDown)
+	})
+
+	t.Run("non-critical starts degraded", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		connect, sink := newConnect(2)
+		monitor := new(readinessMonitorMock)
+		cfg := config.DeadLetterCfg{NonCritical: true, RetryInterval: time.Millisecond}
+
+		dl, err := connectDeadLetter(ctx, cfg, connect, logger, monitor)
+		require.NoError(t, err)
+
+		record := &publisher.DeadLetter{Topic: "wal.public_users"}
+
+		// the listener boots, the dead letters fail until the cluster is connected.
+		assert.False(t, monitor.states()[0])
+
+		require.Eventually(t, func() bool {
+			return dl.PublishDeadLetter(ctx, "wal.dlq", record) == nil
+		}, time.Second, time.Millisecond)
+
+		assert.Equal(t, []*publisher.DeadLetter{record}, sink.published)
+		assert.Eventually(t, func() bool {
+			return len(monitor.states()) == 2 && monitor.states()[1]
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		err := new(backgroundPublisher).PublishDeadLetter(context.Background(), "wal.dlq", &publisher.DeadLetter{})
+		assert.ErrorIs(t, err, errPublisherNotReady)
+	})
+}
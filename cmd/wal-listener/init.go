@@ -2,18 +2,71 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"time"
 
 	"github.com/jackc/pgx"
-	"github.com/nats-io/nats.go"
 
 	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/listener"
 	"github.com/ihippik/wal-listener/v2/internal/publisher"
 )
 
 // initPgxConnections initialise db and replication connections.
 func initPgxConnections(cfg *config.DatabaseCfg, logger *slog.Logger) (*pgx.Conn, *pgx.ReplicationConn, error) {
+	pgxConf := newPgxConfig(cfg, logger)
+
+	pgConn, err := pgx.Connect(pgxConf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("db connection: %w", err)
+	}
+
+	rConnection, err := connectReplication(pgConn, pgxConf, cfg.RejectPooler, logger)
+	if err != nil {
+		if closeErr := pgConn.Close(); closeErr != nil {
+			logger.Error("close db connection failed", "err", closeErr)
+		}
+
+		return nil, nil, err
+	}
+
+	return pgConn, rConnection, nil
+}
+
+// connectReplication checks the db connection doesn't go through a pooler and opens the replication connection.
+func connectReplication(
+	pgConn *pgx.Conn,
+	pgxConf pgx.ConnConfig,
+	rejectPooler bool,
+	logger *slog.Logger,
+) (*pgx.ReplicationConn, error) {
+	pooled, err := detectPooler(pgConn)
+	if err != nil {
+		return nil, fmt.Errorf("detect pooler: %w", err)
+	}
+
+	if pooled {
+		if rejectPooler {
+			return nil, errPooler
+		}
+
+		logger.Warn("database connection seems to go through a transaction-pooling proxy, " +
+			"logical replication requires a direct connection")
+	}
+
+	rConnection, err := pgx.ReplicationConnect(pgxConf)
+	if err != nil {
+		return nil, fmt.Errorf("replication connect: %w", err)
+	}
+
+	return rConnection, nil
+}
+
+// newPgxConfig returns connection config shared by db and replication connections.
+func newPgxConfig(cfg *config.DatabaseCfg, logger *slog.Logger) pgx.ConnConfig {
 	pgxConf := pgx.ConnConfig{
 		LogLevel: pgx.LogLevelInfo,
 		Logger:   pgxLogger{logger},
@@ -24,17 +77,52 @@ func initPgxConnections(cfg *config.DatabaseCfg, logger *slog.Logger) (*pgx.Conn
 		Password: cfg.Password,
 	}
 
-	pgConn, err := pgx.Connect(pgxConf)
-	if err != nil {
-		return nil, nil, fmt.Errorf("db connection: %w", err)
+	if cfg.Keepalive.Enabled() {
+		pgxConf.Dial = newDialer(cfg.Keepalive).Dial
 	}
 
-	rConnection, err := pgx.ReplicationConnect(pgxConf)
-	if err != nil {
-		return nil, nil, fmt.Errorf("replication connect: %w", err)
+	return pgxConf
+}
+
+// newDialer returns a dialer with tuned TCP keepalive.
+func newDialer(cfg config.KeepaliveCfg) *net.Dialer {
+	return &net.Dialer{
+		KeepAliveConfig: net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     cfg.Idle,
+			Interval: cfg.Interval,
+			Count:    cfg.Count,
+		},
 	}
+}
 
-	return pgConn, rConnection, nil
+var errPooler = errors.New("transaction-pooling proxy detected, connect to postgres directly")
+
+// poolerProbes number of transactions compared by the pooler detection.
+const poolerProbes = 3
+
+// detectPooler reports whether the connection appears to go through a transaction-pooling proxy (e.g. PgBouncer):
+// consecutive transactions of one client connection are served by different server backends.
+func detectPooler(conn *pgx.Conn) (bool, error) {
+	var first int32
+
+	if err := conn.QueryRow("SELECT pg_backend_pid()").Scan(&first); err != nil {
+		return false, fmt.Errorf("backend pid: %w", err)
+	}
+
+	for i := 1; i < poolerProbes; i++ {
+		var pid int32
+
+		if err := conn.QueryRow("SELECT pg_backend_pid()").Scan(&pid); err != nil {
+			return false, fmt.Errorf("backend pid: %w", err)
+		}
+
+		if pid != first {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
 
 type pgxLogger struct {
@@ -53,6 +141,11 @@ type eventPublisher interface {
 
 // factoryPublisher represents a factory function for creating a eventPublisher.
 func factoryPublisher(ctx context.Context, cfg *config.PublisherCfg, logger *slog.Logger) (eventPublisher, error) {
+	marshaler, err := publisher.NewPublisherMarshaler(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new marshaler: %w", err)
+	}
+
 	switch cfg.Type {
 	case config.PublisherTypeKafka:
 		producer, err := publisher.NewProducer(cfg)
@@ -60,22 +153,24 @@ func factoryPublisher(ctx context.Context, cfg *config.PublisherCfg, logger *slo
 			return nil, fmt.Errorf("kafka producer: %w", err)
 		}
 
-		return publisher.NewKafkaPublisher(producer), nil
+		return publisher.NewKafkaPublisher(producer, marshaler), nil
 	case config.PublisherTypeNats:
-		conn, err := nats.Connect(cfg.Address)
+		conn, err := publisher.NewNatsConnection(cfg)
 		if err != nil {
 			return nil, fmt.Errorf("nats connection: %w", err)
 		}
 
-		pub, err := publisher.NewNatsPublisher(conn, logger)
+		pub, err := publisher.NewNatsPublisher(conn, logger, marshaler)
 		if err != nil {
 			return nil, fmt.Errorf("new nats publisher: %w", err)
 		}
 
-		if err := pub.CreateStream(cfg.Topic); err != nil {
+		if err := pub.CreateStream(cfg.Topic, cfg.EnvPrefix); err != nil {
 			return nil, fmt.Errorf("create stream: %w", err)
 		}
 
+		go pub.WatchCredentials(ctx, cfg.NatsAuth)
+
 		return pub, nil
 	case config.PublisherTypeRabbitMQ:
 		conn, err := publisher.NewConnection(cfg)
@@ -83,25 +178,132 @@ func factoryPublisher(ctx context.Context, cfg *config.PublisherCfg, logger *slo
 			return nil, fmt.Errorf("new connection: %w", err)
 		}
 
-		p, err := publisher.NewPublisher(cfg.Topic, conn)
+		p, err := publisher.NewPublisher(cfg.Topic, cfg.RabbitMQ, conn)
 		if err != nil {
 			return nil, fmt.Errorf("new publisher: %w", err)
 		}
 
-		pub, err := publisher.NewRabbitPublisher(cfg.Topic, conn, p)
+		pub, err := publisher.NewRabbitPublisher(cfg.Topic, conn, p, marshaler)
 		if err != nil {
 			return nil, fmt.Errorf("new rabbit publisher: %w", err)
 		}
 
 		return pub, nil
 	case config.PublisherTypeGooglePubSub:
-		pubSubConn, err := publisher.NewPubSubConnection(ctx, logger, cfg.PubSubProjectID)
+		pubSubConn, err := publisher.NewPubSubConnection(ctx, logger, cfg.PubSubProjectID, cfg.PubSubOrdering)
 		if err != nil {
 			return nil, fmt.Errorf("could not create pubsub connection: %w", err)
 		}
 
-		return publisher.NewGooglePubSubPublisher(pubSubConn), nil
+		return publisher.NewGooglePubSubPublisher(pubSubConn, marshaler), nil
+	case config.PublisherTypeSQL:
+		db, err := publisher.NewSQLConnection(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("sql connection: %w", err)
+		}
+
+		return publisher.NewSQLPublisher(db, cfg.SQL), nil
+	case config.PublisherTypeWebhook:
+		return publisher.NewWebhookPublisher(
+			cfg.Address, publisher.NewWebhookClient(cfg.Webhook), cfg.Webhook, marshaler,
+		), nil
+	case config.PublisherTypeNDJSON:
+		target, err := publisher.NewNDJSONTarget(cfg.Address, cfg.NDJSON)
+		if err != nil {
+			return nil, fmt.Errorf("ndjson target: %w", err)
+		}
+
+		return publisher.NewNDJSONPublisher(target, cfg.NDJSON, marshaler), nil
+	case config.PublisherTypeSQS:
+		client, err := publisher.NewSQSClient(ctx, cfg.AWS)
+		if err != nil {
+			return nil, fmt.Errorf("sqs client: %w", err)
+		}
+
+		return publisher.NewSQSPublisher(client, marshaler), nil
+	case config.PublisherTypeSNS:
+		client, err := publisher.NewSNSClient(ctx, cfg.AWS)
+		if err != nil {
+			return nil, fmt.Errorf("sns client: %w", err)
+		}
+
+		return publisher.NewSNSPublisher(client, marshaler), nil
 	default:
 		return nil, fmt.Errorf("unknown publisher type: %s", cfg.Type)
 	}
 }
+
+const defaultSelfTestTimeout = 10 * time.Second
+
+// prober is implemented by publishers that can check the broker without publishing.
+type prober interface {
+	Probe(ctx context.Context) error
+}
+
+// selfTest probes the configured broker, so a misconfigured publisher fails before the replication starts.
+// RabbitMQ is checked implicitly: the connection is dialed and the exchange declared on startup.
+func selfTest(ctx context.Context, cfg *config.PublisherCfg, pub eventPublisher) error {
+	timeout := cfg.SelfTest.Timeout
+	if timeout <= 0 {
+		timeout = defaultSelfTestTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if cfg.Type == config.PublisherTypeKafka {
+		return publisher.ProbeKafka(ctx, cfg)
+	}
+
+	if p, ok := pub.(prober); ok {
+		return p.Probe(ctx)
+	}
+
+	return nil
+}
+
+// initTopicRouter loads the topic map from the configured source and keeps refreshing it in the background.
+// Returns nil if the topic map is static. Routed Kafka topics are checked to exist.
+func initTopicRouter(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*listener.TopicRouter, error) {
+	src := cfg.Listener.TopicsMapSource
+	if !src.Enabled() {
+		return nil, nil
+	}
+
+	var router *listener.TopicRouter
+
+	if cfg.Publisher.Type == config.PublisherTypeKafka {
+		checker, err := publisher.NewKafkaTopicChecker(cfg.Publisher)
+		if err != nil {
+			return nil, fmt.Errorf("kafka topic checker: %w", err)
+		}
+
+		go func() {
+			<-ctx.Done()
+
+			if err := checker.Close(); err != nil {
+				logger.Error("close kafka topic checker failed", "err", err)
+			}
+		}()
+
+		router = listener.NewTopicRouter(cfg, logger, newRouteLoader(cfg, logger), checker)
+	} else {
+		router = listener.NewTopicRouter(cfg, logger, newRouteLoader(cfg, logger), nil)
+	}
+
+	if err := router.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("refresh: %w", err)
+	}
+
+	go router.Run(ctx)
+
+	return router, nil
+}
+
+func newRouteLoader(cfg *config.Config, logger *slog.Logger) listener.RouteLoader {
+	if src := cfg.Listener.TopicsMapSource; src.Table != "" {
+		return listener.TableRoutes{Conn: newPgxConfig(cfg.Database, logger), Table: src.Table}
+	}
+
+	return listener.FileRoutes(cfg.Listener.TopicsMapSource.File)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestNewPgxConfig_Keepalive(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	t.Run("pgx default", func(t *testing.T) {
+		pgxConf := newPgxConfig(&config.DatabaseCfg{Host: "localhost", Port: 5432}, logger)
+		assert.Nil(t, pgxConf.Dial)
+	})
+
+	t.Run("tuned", func(t *testing.T) {
+		keepalive := config.KeepaliveCfg{Idle: 30 * time.Second, Interval: 10 * time.Second, Count: 3}
+
+		assert.Equal(t, net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     30 * time.Second,
+			Interval: 10 * time.Second,
+			Count:    3,
+		}, newDialer(keepalive).KeepAliveConfig)
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		defer l.Close()
+
+		pgxConf := newPgxConfig(&config.DatabaseCfg{Keepalive: keepalive}, logger)
+		require.NotNil(t, pgxConf.Dial)
+
+		conn, err := pgxConf.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		assert.NoError(t, conn.Close())
+	})
+}
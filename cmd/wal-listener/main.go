@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	scfg "github.com/ihippik/config"
 	"github.com/urfave/cli/v2"
@@ -14,6 +16,7 @@ import (
 	"github.com/ihippik/wal-listener/v2/internal/config"
 	"github.com/ihippik/wal-listener/v2/internal/listener"
 	"github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
 )
 
 func main() {
@@ -37,6 +40,9 @@ func main() {
 				Usage:   "path to config file",
 			},
 		},
+		Commands: []*cli.Command{
+			replayCommand(version),
+		},
 		Action: func(c *cli.Context) error {
 			ctx, cancel := signal.NotifyContext(c.Context, syscall.SIGINT, syscall.SIGTERM)
 			defer cancel()
@@ -58,10 +64,7 @@ func main() {
 
 			go scfg.InitMetrics(cfg.Monitoring.PromAddr, logger)
 
-			conn, rConn, err := initPgxConnections(cfg.Database, logger)
-			if err != nil {
-				return fmt.Errorf("pgx connection: %w", err)
-			}
+			metrics := config.NewMetrics()
 
 			pub, err := factoryPublisher(ctx, cfg.Publisher, logger)
 			if err != nil {
@@ -74,20 +77,62 @@ func main() {
 				}
 			}()
 
-			svc := listener.NewWalListener(
-				cfg,
-				logger,
-				listener.NewRepository(conn),
-				rConn,
-				pub,
-				transaction.NewBinaryParser(logger, binary.BigEndian),
-				config.NewMetrics(),
-			)
+			if cfg.Publisher.SelfTest.Enabled {
+				if err := selfTest(ctx, cfg.Publisher, pub); err != nil {
+					return fmt.Errorf("publisher self-test: %w", err)
+				}
+
+				logger.Info("publisher self-test passed")
+			}
 
-			go svc.InitHandlers(ctx)
+			deadLetter, err := initDeadLetter(ctx, cfg.Publisher, logger, metrics)
+			if err != nil {
+				return fmt.Errorf("dead-letter cluster: %w", err)
+			}
+
+			if deadLetter != nil {
+				defer func() {
+					if err := deadLetter.Close(); err != nil {
+						slog.Error("close dead-letter publisher failed", "err", err.Error())
+					}
+				}()
+			}
+
+			protector, err := publisher.NewColumnProtector(cfg.Listener.Protection)
+			if err != nil {
+				return fmt.Errorf("column protector: %w", err)
+			}
+
+			router, err := initTopicRouter(ctx, cfg, logger)
+			if err != nil {
+				return fmt.Errorf("topic router: %w", err)
+			}
+
+			reconnector := listener.NewReconnector(cfg.Listener.Reconnect)
+			state := listener.NewStreamState()
+
+			// the first attempt starts immediately, reconnects are spaced by the reconnector.
+			for {
+				if err := reconnector.Wait(ctx); err != nil {
+					break
+				}
+
+				started := time.Now()
+
+				err := runListener(ctx, cfg, logger, pub, deadLetter, protector, router, metrics, state)
+				if err == nil || ctx.Err() != nil {
+					break
+				}
 
-			if err = svc.Process(ctx); err != nil {
 				slog.Error("service process failed", "err", err.Error())
+
+				if !cfg.Listener.Reconnect.Enabled() {
+					break
+				}
+
+				reconnector.Done(time.Since(started))
+
+				logger.Info("reconnecting to postgres")
 			}
 
 			return nil
@@ -98,3 +143,67 @@ func main() {
 		slog.Error("service error", "err", err)
 	}
 }
+
+// runListener connects to Postgres and processes the replication stream until the connection is lost.
+func runListener(
+	ctx context.Context,
+	cfg *config.Config,
+	logger *slog.Logger,
+	pub eventPublisher,
+	deadLetter deadLetterSink,
+	protector *publisher.ColumnProtector,
+	router *listener.TopicRouter,
+	metrics *config.Metrics,
+	state *listener.StreamState,
+) error {
+	conn, rConn, err := initPgxConnections(cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("pgx connection: %w", err)
+	}
+
+	svc := listener.NewWalListener(
+		cfg,
+		logger,
+		listener.NewRepository(conn),
+		rConn,
+		pub,
+		transaction.NewBinaryParser(logger, binary.BigEndian),
+		metrics,
+		protector,
+		router,
+		deadLetter,
+		state,
+	)
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	handlersDone := make(chan struct{})
+
+	go func() {
+		svc.InitHandlers(sessionCtx)
+		close(handlersDone)
+	}()
+
+	if cfg.Listener.SlotLag.Interval > 0 {
+		go func() {
+			wal := listener.NewServerWAL(newPgxConfig(cfg.Database, logger))
+			svc.PollAppliedLag(sessionCtx, wal)
+
+			if err := wal.Close(); err != nil {
+				logger.Debug("close server wal connection", "err", err)
+			}
+		}()
+	}
+
+	err = svc.Process(sessionCtx)
+
+	if err != nil {
+		if stopErr := svc.Stop(); stopErr != nil {
+			logger.Debug("stop service after failure", "err", stopErr)
+		}
+	}
+
+	cancel()
+	<-handlersDone
+
+	return err
+}
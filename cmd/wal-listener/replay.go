@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	scfg "github.com/ihippik/config"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// replayCommand re-publishes dead-letter records to their original topics.
+func replayCommand(version string) *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "replay events from the dead-letter topic",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "table",
+				Usage: "replay only events of the table (repeatable)",
+			},
+			&cli.TimestampFlag{
+				Name:   "from",
+				Layout: time.RFC3339,
+				Usage:  "replay records dead-lettered at or after the time (RFC3339)",
+			},
+			&cli.TimestampFlag{
+				Name:   "to",
+				Layout: time.RFC3339,
+				Usage:  "replay records dead-lettered before the time (RFC3339)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			ctx, cancel := signal.NotifyContext(c.Context, syscall.SIGINT, syscall.SIGTERM)
+			defer cancel()
+
+			cfg, err := config.InitConfig(c.String("config"))
+			if err != nil {
+				return fmt.Errorf("get config: %w", err)
+			}
+
+			if err = cfg.Validate(); err != nil {
+				return fmt.Errorf("validate config: %w", err)
+			}
+
+			if cfg.Publisher.Type != config.PublisherTypeKafka {
+				return fmt.Errorf("replay is not supported for publisher type: %s", cfg.Publisher.Type)
+			}
+
+			if cfg.Publisher.DeadLetterTopic == "" {
+				return fmt.Errorf("dead-letter topic is not configured")
+			}
+
+			logger := scfg.InitSlog(cfg.Logger, version, false)
+
+			source, err := publisher.NewKafkaDeadLetterSource(cfg.Publisher)
+			if err != nil {
+				return fmt.Errorf("new dead-letter source: %w", err)
+			}
+
+			defer func() {
+				if err := source.Close(); err != nil {
+					logger.Error("close dead-letter source failed", "err", err.Error())
+				}
+			}()
+
+			pub, err := factoryPublisher(ctx, cfg.Publisher, logger)
+			if err != nil {
+				return fmt.Errorf("factory publisher: %w", err)
+			}
+
+			defer func() {
+				if err := pub.Close(); err != nil {
+					logger.Error("close publisher failed", "err", err.Error())
+				}
+			}()
+
+			filter := publisher.ReplayFilter{Tables: c.StringSlice("table")}
+
+			if from := c.Timestamp("from"); from != nil {
+				filter.From = *from
+			}
+
+			if to := c.Timestamp("to"); to != nil {
+				filter.To = *to
+			}
+
+			replayed, err := publisher.NewReplayer(logger, source, pub).Replay(ctx, filter)
+			if err != nil {
+				return fmt.Errorf("replay: %w", err)
+			}
+
+			logger.Info("replay completed", slog.Int("events", replayed))
+
+			return nil
+		},
+	}
+}
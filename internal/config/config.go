@@ -1,7 +1,14 @@
 package config
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,11 +20,101 @@ import (
 
 type PublisherType string
 
+// FormatType represents the event serialization format.
+type FormatType string
+
+const (
+	FormatJSON    FormatType = "json"
+	FormatMsgPack FormatType = "msgpack"
+	FormatFlat    FormatType = "flat" // JSON object with the prefixed new and old columns at the top level
+	// FormatCloudEvents wraps the JSON event into a CloudEvents envelope (structured mode).
+	FormatCloudEvents FormatType = "cloudevents"
+	// FormatDebezium maps the event to the before/after/source/op envelope of Debezium.
+	FormatDebezium FormatType = "debezium"
+	// FormatAvro encodes the event as Avro with the schema registered in the Confluent Schema Registry, Kafka only.
+	FormatAvro FormatType = "avro"
+)
+
+// TimeFormat represents the serialization of the time values of the event.
+type TimeFormat string
+
+const (
+	TimeFormatRFC3339     TimeFormat = "rfc3339"
+	TimeFormatEpochMillis TimeFormat = "epoch_millis" // integer milliseconds since the Unix epoch
+)
+
+// FlattenOrder is the order of the new and old column groups in the flat format.
+type FlattenOrder string
+
+const (
+	FlattenNewFirst FlattenOrder = "new-old"
+	FlattenOldFirst FlattenOrder = "old-new"
+)
+
+// FlattenCollision is the naming of the columns present in both the new and old rows in the flat format.
+type FlattenCollision string
+
+const (
+	FlattenCollisionPrefix FlattenCollision = "prefix" // new_status and old_status
+	FlattenCollisionSuffix FlattenCollision = "suffix" // status_new and status_old
+	FlattenCollisionDrop   FlattenCollision = "drop"   // new_status only, the old value is dropped
+)
+
+// FlattenCfg configuration of the flat format.
+type FlattenCfg struct {
+	Order     FlattenOrder     // new columns first by default
+	Collision FlattenCollision // prefix by default
+}
+
+// CloudEventsCfg attributes of the CloudEvents envelope.
+type CloudEventsCfg struct {
+	Source     string // prefix of the source attribute, followed by the schema and table; wal-listener by default
+	TypePrefix string // prefix of the type attribute, followed by the action; wal-listener by default
+}
+
+// SchemaRegistryCfg Confluent Schema Registry of the Avro format.
+type SchemaRegistryCfg struct {
+	URL      string
+	Username string        // basic auth, e.g. the API key of Confluent Cloud
+	Password string        // basic auth, e.g. the API secret of Confluent Cloud
+	Timeout  time.Duration // request timeout, 10s by default
+}
+
+// DebeziumCfg source block of the Debezium envelope.
+type DebeziumCfg struct {
+	Name     string // logical name of the source (Debezium topic prefix), wal-listener by default
+	Database string // database name of the source, omitted when empty
+}
+
+// CompressionType represents the event payload compression.
+type CompressionType string
+
+const (
+	CompressionNone   CompressionType = ""
+	CompressionGzip   CompressionType = "gzip"
+	CompressionSnappy CompressionType = "snappy"
+	CompressionZstd   CompressionType = "zstd"
+)
+
 const (
 	PublisherTypeNats         PublisherType = "nats"
 	PublisherTypeKafka        PublisherType = "kafka"
 	PublisherTypeRabbitMQ     PublisherType = "rabbitmq"
 	PublisherTypeGooglePubSub PublisherType = "google_pubsub"
+	PublisherTypeSQL          PublisherType = "sql"
+	PublisherTypeChannel      PublisherType = "channel" // in-process subscribers, embedded use only
+	PublisherTypeWebhook      PublisherType = "webhook" // HTTP POST per event
+	PublisherTypeNDJSON       PublisherType = "ndjson"  // newline-delimited JSON batches to files or an HTTP bulk endpoint
+	PublisherTypeSQS          PublisherType = "sqs"     // Amazon SQS queues
+	PublisherTypeSNS          PublisherType = "sns"     // Amazon SNS topics
+)
+
+// ChannelMode represents the delivery of the channel publisher to its subscribers.
+type ChannelMode string
+
+const (
+	ChannelBroadcast ChannelMode = "broadcast"  // every subscriber receives every event
+	ChannelWorkQueue ChannelMode = "work_queue" // every event is received by one of the subscribers
 )
 
 // Config for wal-listener.
@@ -38,19 +135,515 @@ type ListenerCfg struct {
 	HeartbeatInterval time.Duration `valid:"required"`
 	Filter            FilterStruct
 	TopicsMap         map[string]string
+	// TopicTemplate names the topic of the tables missing from the topic map, e.g. "cdc.{schema}.{table}".
+	// The {schema}, {table} and {action} placeholders are also expanded in the topic map values.
+	TopicTemplate string // schema_table when empty
+	// FeedbackInterval coalesces the standby statuses acknowledging messages, so at most one is sent per interval;
+	// replies requested by the server and heartbeats are always sent. Zero acknowledges every message.
+	FeedbackInterval time.Duration
+	// AckMode selects the positions acknowledged to the server: of every received message by default,
+	// or only of the commits whose events were all published.
+	AckMode AckMode
+	// ShutdownTimeout bounds the publishing of the transaction in progress when the listener stops,
+	// it's completed and acknowledged before the connections are closed. 10s by default.
+	ShutdownTimeout time.Duration
+	// TopicsMapSource loads the topic map from a file or a database table and reloads it periodically.
+	TopicsMapSource TopicsMapSourceCfg
+	EventKey        EventKeyCfg
+	BusinessKey     BusinessKeyCfg
+	// MessageID takes the event ID and message key from a column, e.g. the message ID of an outbox table.
+	MessageID     map[string]string // table -> column
+	RelationCache RelationCacheCfg
+	Protection    ProtectionCfg
+	// Streaming receives large in-progress transactions in chunks (protocol version 2, PostgreSQL 14+).
+	// Changes are buffered until the transaction commits, aborted transactions are discarded.
+	Streaming bool
+	// OpField adds the normalized op code (c, u, d, t) of the action to the event, alongside or instead of the action.
+	OpField OpFieldMode // disabled when empty
+	// SoftDelete adds the _deleted flag to the updates of the table, the action is kept.
+	SoftDelete map[string]SoftDeleteCfg // table -> marker
+	// DecodeWorkers decodes the column values of a transaction on commit with this many workers in parallel,
+	// instead of while parsing. The event order is kept. Zero or one disables it.
+	DecodeWorkers int
+	// TxBuffer reports transactions buffered longer than the limit without commit.
+	TxBuffer TxBufferCfg
+	// LogicalMessages publishes the messages emitted by pg_logical_emit_message (PostgreSQL 14+).
+	LogicalMessages LogicalMessagesCfg
+	// SlotLag alerts when the replication falls behind the server and optionally drops the backlog of some tables.
+	SlotLag SlotLagCfg
+	// WarmUp prepares the pipeline before the replication starts, so the first events aren't delayed.
+	WarmUp WarmUpCfg
+	// Snapshot publishes the current rows of the tables as inserts when the replication slot is created.
+	Snapshot SnapshotCfg
+	// RequiredColumns checks that the events of the table carry the columns consumers depend on.
+	RequiredColumns RequiredColumnsCfg
+	// AnnotateTypes adds the Postgres type name of every column to the event.
+	AnnotateTypes bool
+	// SchemaFingerprint adds the hash of the column names and types of the table to the event.
+	SchemaFingerprint bool
+	// Sequence adds the position of the event among the events of its transaction published to the topic (from 0)
+	// and their count, so consumers can detect missing events.
+	Sequence bool
+	// Changes adds the changed columns of updates with their old and new values.
+	// The old row is complete only with REPLICA IDENTITY FULL.
+	Changes bool
+	// OnlyChangedColumns publishes only the changed and key columns in the data of updates.
+	// Columns missing from the old row are kept, so without REPLICA IDENTITY FULL updates stay complete.
+	OnlyChangedColumns bool
+	// OrderedColumns writes the columns of the data in the table order instead of alphabetically (JSON format).
+	OrderedColumns bool
+	// Nulls keeps the NULL columns in the data as null values (default) or omits them, the same for all actions.
+	Nulls NullsMode
+	// ByteDelta adds the size difference between the new and old serialized row to updates.
+	// The old row is complete only with REPLICA IDENTITY FULL.
+	ByteDelta  bool
+	Reconnect  ReconnectCfg
+	Source     SourceCfg
+	Projection ProjectionCfg
+	LSNGuard   LSNGuardCfg
+	// Enrichment adds values looked up in reference tables to the events of the table.
+	Enrichment      map[string][]EnrichmentCfg // table -> lookups
+	EnrichmentCache EnrichmentCacheCfg
+	// Fanout publishes the events of the table to additional topics too, e.g. for downstreams with different needs.
+	Fanout map[string][]string // schema_table -> additional topics
+	// Topics shapes the events per topic (a topic map value, a fanout topic or schema_table).
+	Topics map[string]TopicCfg // topic -> settings
+	// DeleteOldColumns narrows the old row data of deletes per topic (a topic map value or schema_table).
+	DeleteOldColumns map[string]OldColumnsMode // topic -> mode
+	// OldColumns limits the old row data per action (update, delete), within what the WAL provides.
+	OldColumns map[string]OldColumnsMode // action -> mode
+	// Destinations publishes the events of the table to named destinations instead of its topic,
+	// e.g. the current state to a compacted topic and the change log to another one.
+	Destinations map[string]map[string]DestinationCfg // schema_table -> name -> destination
+}
+
+// TopicsMapSourceCfg external topic map, its entries take precedence over the static TopicsMap.
+type TopicsMapSourceCfg struct {
+	File            string        // yaml (or json) file with the schema_table: topic mapping
+	Table           string        // database table with the table_name and topic columns
+	RefreshInterval time.Duration // 1m by default
+}
+
+// Enabled reports whether the topic map is loaded from an external source.
+func (t TopicsMapSourceCfg) Enabled() bool {
+	return t.File != "" || t.Table != ""
+}
+
+// ProjectionCfg limits the allocations for wide tables.
+type ProjectionCfg struct {
+	// Columns decoded for the table, other columns are skipped before their values are decoded.
+	Columns map[string][]string // table -> columns
+	// MapCapacity caps the initial capacity of the event data maps, the number of columns by default.
+	MapCapacity int
+}
+
+// EnrichmentCfg looks up a value in a reference table by a column value of the event.
+type EnrichmentCfg struct {
+	Column      string // event column holding the reference key, e.g. a foreign key
+	Table       string // reference table, optionally schema-qualified
+	KeyColumn   string // key column of the reference table
+	ValueColumn string // looked up column of the reference table
+	Field       string // name of the value in the event enrichment
+}
+
+// EnrichmentCacheCfg bounds the cache of the looked up values.
+type EnrichmentCacheCfg struct {
+	Size int           // maximum number of cached values, 10000 by default
+	TTL  time.Duration // lifetime of a cached value, 5m by default
+}
+
+// LSNPolicy the reaction to an anomalous commit LSN.
+type LSNPolicy string
+
+const (
+	LSNPolicyError    LSNPolicy = "error"    // stop processing, the service is reconnected or exits
+	LSNPolicyResync   LSNPolicy = "resync"   // restart the stream from the position of the replication slot
+	LSNPolicyContinue LSNPolicy = "continue" // accept the new LSN and continue
+)
+
+// LSNGuardCfg detects commit LSNs going backwards or jumping ahead, e.g. after a failover.
+type LSNGuardCfg struct {
+	Policy  LSNPolicy // disabled when empty
+	MaxJump uint64    // forward distance in bytes treated as a jump, zero disables jump detection
+}
+
+// ContractAction is the handling of an event violating the required columns contract.
+type ContractAction string
+
+const (
+	ContractActionLog ContractAction = "log" // the event is published anyway
+	ContractActionDLQ ContractAction = "dlq" // the event is stored in the dead-letter topic instead
+)
+
+// RequiredColumnsCfg the columns every insert and update of the table must carry.
+type RequiredColumnsCfg struct {
+	Tables map[string][]string // table -> columns
+	Action ContractAction      // log by default
+}
+
+// topicActions the actions of the topic settings.
+var topicActions = []string{"insert", "update", "delete", "truncate"}
+
+// TopicCfg the events published to the topic.
+type TopicCfg struct {
+	Actions []string // published actions (insert, update, delete, truncate), all by default
+	// Compacted publishes keyed upserts and a tombstone per delete, so a compacted topic keeps the current state.
+	// Truncates are not published. Kafka only.
+	Compacted bool
+}
+
+// DestinationCfg a destination of the table events with its own topic, format and shape.
+type DestinationCfg struct {
+	Topic   string     // the topic prefix and environment prefix are applied like to the fanout topics
+	Format  FormatType // the publisher format by default, the publisher compression applies
+	Actions []string   // published actions (insert, update, delete, truncate), all by default
+	// Compacted publishes keyed upserts and a tombstone per delete, truncates are not published. Kafka only.
+	Compacted        bool
+	DeleteOldColumns OldColumnsMode // old row data of deletes, full by default
+}
+
+// AckMode selects the acknowledged WAL positions.
+type AckMode string
+
+const (
+	AckModeMessage AckMode = "message" // every received message
+	AckModeCommit  AckMode = "commit"  // the published transactions only
+)
+
+// OpFieldMode controls the normalized op field of the event.
+type OpFieldMode string
+
+const (
+	OpFieldAlongside OpFieldMode = "alongside"
+	OpFieldInstead   OpFieldMode = "instead"
+)
+
+// NullsMode controls the NULL columns of the event data.
+type NullsMode string
+
+const (
+	NullsKeep NullsMode = "keep" // null values
+	NullsOmit NullsMode = "omit" // left out of the data
+)
+
+// SoftDeleteMode decides when an update is flagged as a soft delete.
+type SoftDeleteMode string
+
+const (
+	SoftDeleteValue      SoftDeleteMode = "value"      // the column is not null
+	SoftDeleteTransition SoftDeleteMode = "transition" // the column was null in the old row and is not null now
+)
+
+// SoftDeleteCfg the column marking the row as soft-deleted, e.g. deleted_at.
+type SoftDeleteCfg struct {
+	Column string
+	Mode   SoftDeleteMode // value by default
+}
+
+// SnapshotCfg the tables read by the initial snapshot.
+type SnapshotCfg struct {
+	Tables    []string // optionally schema-qualified, public by default
+	BatchSize int      // rows published at once, 1000 by default
+}
+
+// WarmUpCfg probes the publisher and preloads the relations of the tables before the replication starts.
+type WarmUpCfg struct {
+	Enabled bool
+	Tables  []string // optionally schema-qualified, the tables of the filter by default
+}
+
+// LogicalMessagesCfg the logical decoding messages published as events with their prefix and content.
+type LogicalMessagesCfg struct {
+	Enabled  bool
+	Topic    string   // the topic prefix and environment prefix are applied like to the fanout topics
+	Prefixes []string // published message prefixes, all by default
+}
+
+// TxBufferCfg limits the time a streamed transaction is buffered without commit.
+type TxBufferCfg struct {
+	MaxTime time.Duration // buffering time after which the transaction is reported, zero disables it
+	// EarlyEmit publishes the buffered changes of the reported transaction before its commit (streaming only).
+	// Early emitted changes are published even if the transaction is aborted later.
+	EarlyEmit bool
+}
+
+// SlotLagCfg the reaction to the WAL not yet received from the server (the server WAL end minus the received position).
+type SlotLagCfg struct {
+	Threshold uint64 // lag in bytes raising the alert, zero disables it
+	// FastForward drops the changes of the skippable tables while the lag is above the threshold,
+	// so the slot advances past their backlog. The changes of the other tables are never dropped.
+	FastForward     bool
+	SkippableTables []string // schema_table
+	// Interval polls the current WAL position of the server to export the WAL not yet applied by the listener,
+	// independent of the received messages. Zero disables it.
+	Interval time.Duration
+}
+
+// OldColumnsMode selects the old row columns included in the event.
+type OldColumnsMode string
+
+const (
+	OldColumnsFull OldColumnsMode = "full" // every column the WAL provides
+	OldColumnsKeys OldColumnsMode = "keys" // replica identity key columns only
+	OldColumnsNone OldColumnsMode = "none"
+)
+
+// SourceCfg adds the listener instance metadata to every event.
+type SourceCfg struct {
+	Enabled  bool
+	Version  string // build revision by default
+	Hostname string // POD_NAME environment variable or the host name by default
+}
+
+// ReconnectCfg limits reconnect attempts after the connection to Postgres is lost.
+type ReconnectCfg struct {
+	MinInterval time.Duration // minimum interval between attempts, zero disables reconnecting
+	MaxInterval time.Duration // backoff cap, zero means no cap
+	Jitter      float64       // random extra delay as a fraction of the backoff, 0..1
+	MaxAttempts int           // maximum attempts within Window, zero means unlimited
+	Window      time.Duration
+}
+
+// Enabled reports whether the listener reconnects instead of exiting.
+func (r ReconnectCfg) Enabled() bool {
+	return r.MinInterval > 0
+}
+
+// ProtectionCfg masking and encryption of sensitive columns.
+// A column can be either masked or encrypted, not both.
+type ProtectionCfg struct {
+	Mask       map[string][]string // table -> columns replaced with MaskValue
+	MaskValue  string              // replacement for masked values, "***" by default
+	Encrypt    map[string][]string // table -> columns encrypted with AES-GCM
+	Encryption EncryptionKeyCfg
+	// Classification derives the masked and excluded columns from their tags in the database catalog.
+	Classification ClassificationCfg
+}
+
+// ClassificationSource is the catalog object holding the classification tags of the columns.
+type ClassificationSource string
+
+const (
+	ClassificationComment       ClassificationSource = "comment"        // COMMENT ON COLUMN
+	ClassificationSecurityLabel ClassificationSource = "security_label" // SECURITY LABEL ON COLUMN
+)
+
+// ClassificationCfg the tags of the sensitive columns. A comment or label holds one or more tags
+// separated by commas or spaces, matched case-insensitively.
+type ClassificationCfg struct {
+	Source   ClassificationSource // disabled when empty
+	Provider string               // security label provider, any provider when empty
+	Mask     []string             // tags of the columns replaced with MaskValue, e.g. pii
+	Exclude  []string             // tags of the columns removed from the event
+}
+
+// Enabled reports whether the columns are classified by the catalog tags.
+func (c ClassificationCfg) Enabled() bool {
+	return c.Source != ""
+}
+
+// EncryptionKeyCfg AES key used for column encryption.
+type EncryptionKeyCfg struct {
+	KeyID   string // emitted with every ciphertext so consumers can pick the key
+	Key     string // base64-encoded 16, 24 or 32 bytes
+	KeyFile string // file with the base64-encoded key, e.g. mounted from a KMS/secret store
+}
+
+// RelationCacheCfg bounds the memory used by cached relation metadata.
+// Evicted relations are fetched from the database catalog when they appear again.
+type RelationCacheCfg struct {
+	Size int           // maximum number of cached relations, zero means unlimited
+	TTL  time.Duration // relations not seen within this window are evicted, zero disables
 }
 
 // PublisherCfg represent configuration for any publisher types.
 type PublisherCfg struct {
-	Type            PublisherType `valid:"required"`
+	Type            PublisherType   `valid:"required"`
+	Format          FormatType      // event serialization format, json by default
+	Compression     CompressionType // payload compression, none by default
+	Flatten         FlattenCfg
+	CloudEvents     CloudEventsCfg
+	Debezium        DebeziumCfg
+	SchemaRegistry  SchemaRegistryCfg
 	Address         string
 	Topic           string `valid:"required"`
 	TopicPrefix     string
+	EnvPrefix       string // prepended to every resolved topic name, e.g. "prod."
 	EnableTLS       bool   `json:"enable_tls"`
 	ClientCert      string `json:"client_cert"`
 	ClientKey       string `json:"client_key"`
 	CACert          string `json:"ca_cert"`
 	PubSubProjectID string `json:"pubsub_project_id"`
+	PubSubOrdering  bool   `json:"pubsub_ordering"` // ordered delivery of the events of a row
+	NatsAuth        NatsAuthCfg
+	SASL            SASLCfg
+	DeadLetterTopic string // topic for events that could not be delivered
+	Partitioner     string // registered Kafka partitioner name, key hash by default
+	Batch           BatchCfg
+	Retry           RetryCfg
+	SelfTest        SelfTestCfg
+	SQL             SQLSinkCfg
+	// Workers publishes the events of a transaction in parallel, the events of a row keep their order.
+	// One (the default) publishes them one by one.
+	Workers int
+	// DisableHTMLEscape writes JSON string values verbatim; <, > and & are escaped by default.
+	DisableHTMLEscape bool
+	// TimeFormat of the commit time and the time column values in JSON formats, rfc3339 by default.
+	TimeFormat TimeFormat
+	// DeadLetter sends the dead letters to a separate Kafka cluster instead of the publisher.
+	DeadLetter DeadLetterCfg
+	// ClientID identifies the listener in the Kafka broker metrics and quotas, wal-listener-<hostname> by default.
+	ClientID string
+	RackID   string // Kafka rack of the listener, the replay reads from the closest replica
+	Channel  ChannelCfg
+	Webhook  WebhookCfg
+	NDJSON   NDJSONCfg
+	AWS      AWSCfg
+	RabbitMQ RabbitMQCfg
+	// ProducerCompression compresses the Kafka record batches; unlike the payload compression
+	// it's transparent to the consumers.
+	ProducerCompression ProducerCompressionCfg
+}
+
+// NDJSONCfg batches of the NDJSON sink, the publisher address is the target:
+// a directory of rotated files or the URL of an HTTP bulk endpoint.
+type NDJSONCfg struct {
+	FlushSize int               // buffered bytes that trigger a flush, 1MiB by default
+	FileSize  int64             // size at which the file is rotated, 100MiB by default
+	Timeout   time.Duration     // request timeout of the bulk endpoint, 10s by default
+	Headers   map[string]string // additional request headers of the bulk endpoint, e.g. an API key
+}
+
+// RabbitMQCfg the exchange of the RabbitMQ publisher, named by the publisher topic.
+type RabbitMQCfg struct {
+	ExchangeKind string // direct, fanout, topic or headers; topic by default
+}
+
+// AWSCfg the client of the SQS and SNS publishers, the credentials come from the default chain
+// (environment, shared configuration, instance role).
+type AWSCfg struct {
+	Region   string // of the queues and topics, from the default chain when empty
+	Endpoint string // custom service endpoint, e.g. LocalStack
+}
+
+// WebhookCfg requests of the webhook publisher, the publisher address is the endpoint URL.
+type WebhookCfg struct {
+	Timeout     time.Duration     // request timeout, 10s by default
+	Token       string            // bearer token of the Authorization header
+	Headers     map[string]string // additional request headers, e.g. an API key
+	TopicHeader string            // header carrying the topic, the topic is appended to the URL path when empty
+}
+
+// ChannelCfg delivery of the channel publisher, broadcast by default.
+type ChannelCfg struct {
+	Mode   ChannelMode
+	Buffer int // events buffered per subscriber (broadcast) or shared by the subscribers (work queue)
+}
+
+// DeadLetterCfg a separate Kafka cluster for the dead-letter topic, the TLS settings are shared with the publisher.
+type DeadLetterCfg struct {
+	Address string // Kafka brokers, the dead letters go through the publisher when empty
+	// NonCritical starts the listener even if the cluster is down at startup, the connection is retried
+	// in the background and dead letters fail until it is established. The publisher always fails fast.
+	NonCritical   bool
+	RetryInterval time.Duration // 10s by default
+}
+
+// SQLSinkCfg applies events to tables of another SQL database, the publisher address is the DSN.
+type SQLSinkCfg struct {
+	Driver string                 // database/sql driver name, pgx by default
+	Tables map[string]SQLTableCfg // source schema.table, or table of any schema -> target table
+}
+
+// SQLTableCfg maps the source table to the target table.
+type SQLTableCfg struct {
+	Target      string            // target table, optionally schema-qualified
+	Columns     map[string]string // source column -> target column, all columns with the same names by default
+	ConflictKey []string          // target columns of the unique key used for upserts and deletes
+}
+
+// SelfTestCfg probes the broker on startup, before the replication starts.
+type SelfTestCfg struct {
+	Enabled bool
+	Timeout time.Duration // probe timeout, 10s by default
+}
+
+// BatchCfg groups events of a transaction into batched sends.
+// A batch is flushed when it is full, when it is older than Linger, or on commit.
+type BatchCfg struct {
+	Size   int           // maximum number of events per batch, zero or one disables batching
+	Linger time.Duration // maximum batch age, zero means flush only by size or on commit
+}
+
+// RetryCfg retries the failed publishes with an exponential backoff and jitter.
+type RetryCfg struct {
+	MaxAttempts int           // attempts including the first one, zero or one disables retries
+	BaseDelay   time.Duration // delay of the first retry, doubled for every next one, 100ms by default
+	MaxDelay    time.Duration // backoff cap, zero means no cap
+	Jitter      float64       // random extra delay as a fraction of the backoff, 0..1
+	// DeadLetter sends the events still failing after the retries to the dead-letter topic, the listener goes on.
+	DeadLetter bool
+}
+
+// Validate retry settings.
+func (r RetryCfg) Validate() error {
+	if r.MaxAttempts < 0 || r.BaseDelay < 0 || r.MaxDelay < 0 {
+		return errors.New("negative max attempts, base delay or max delay")
+	}
+
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return errors.New("jitter is out of the 0..1 range")
+	}
+
+	return nil
+}
+
+// Enabled reports whether events are published in batches.
+func (b BatchCfg) Enabled() bool {
+	return b.Size > 1
+}
+
+// KafkaCodec represents the compression codec of the Kafka producer.
+type KafkaCodec string
+
+const (
+	KafkaCodecNone   KafkaCodec = "none"
+	KafkaCodecGzip   KafkaCodec = "gzip"
+	KafkaCodecSnappy KafkaCodec = "snappy"
+	KafkaCodecLZ4    KafkaCodec = "lz4"
+	KafkaCodecZstd   KafkaCodec = "zstd"
+)
+
+// ProducerCompressionCfg compression of the Kafka record batches by the producer.
+type ProducerCompressionCfg struct {
+	Codec KafkaCodec // none by default
+	Level int        // codec compression level, the codec default when zero
+}
+
+// SASLMechanism represents the SASL mechanism of the Kafka authentication.
+type SASLMechanism string
+
+const (
+	SASLPlain       SASLMechanism = "PLAIN"
+	SASLScramSHA256 SASLMechanism = "SCRAM-SHA-256"
+	SASLScramSHA512 SASLMechanism = "SCRAM-SHA-512"
+)
+
+// SASLCfg SASL authentication of the Kafka clients, combinable with TLS.
+type SASLCfg struct {
+	Mechanism SASLMechanism // disabled when empty
+	Username  string
+	Password  string
+}
+
+// NatsAuthCfg authentication settings for the NATS connection.
+type NatsAuthCfg struct {
+	CredsFile string // user JWT and NKey seed (chained credentials file)
+	NKeyFile  string // NKey seed file
+	Token     string
+	TokenFile string
+	// RefreshInterval checks the credential files for changes and reconnects with the rotated credentials.
+	RefreshInterval time.Duration
 }
 
 // DatabaseCfg path of the PostgreSQL DB config.
@@ -60,18 +653,790 @@ type DatabaseCfg struct {
 	Name     string `valid:"required"`
 	User     string `valid:"required"`
 	Password string `valid:"required"`
+	// Keepalive tunes TCP keepalive of the connections, the pgx default (5m) is used when unset.
+	Keepalive KeepaliveCfg
+	// RejectPooler fails on startup instead of warning when a transaction-pooling proxy is detected.
+	RejectPooler bool
+}
+
+// KeepaliveCfg TCP keepalive settings, zero values use the Go defaults (15s idle and interval, 9 probes).
+type KeepaliveCfg struct {
+	Idle     time.Duration // idle time before the first probe
+	Interval time.Duration // time between unacknowledged probes
+	Count    int           // unacknowledged probes before the connection is dropped
+}
+
+// Enabled reports whether keepalive is tuned.
+func (k KeepaliveCfg) Enabled() bool {
+	return k.Idle != 0 || k.Interval != 0 || k.Count != 0
 }
 
 // FilterStruct incoming WAL message filter.
 type FilterStruct struct {
-	Tables       map[string][]string            `yaml:"tables"`
-	ColumnFilter map[string]map[string][]string `yaml:"columnFilters"` // table -> column -> allowed values
+	// Schemas limits the events to the tables of the schemas, all schemas by default.
+	Schemas []string `yaml:"schemas"`
+	// ExcludeSchemas are skipped even if listed in Schemas.
+	ExcludeSchemas []string `yaml:"excludeSchemas"`
+	// Tables are the table names, or regular expressions matching the whole name when prefixed with ~.
+	Tables map[string][]string `yaml:"tables"` // table -> actions
+	// ExcludeTables are skipped even if listed in Tables, the names may be patterns like in Tables.
+	// Without Tables all other tables pass with the insert, update and delete actions.
+	ExcludeTables []string                       `yaml:"excludeTables"`
+	ColumnFilter  map[string]map[string][]string `yaml:"columnFilters"` // table -> column -> allowed values
+	// ExcludeColumnFilter drops the rows whose column value is one of the listed values.
+	ExcludeColumnFilter map[string]map[string][]string `yaml:"excludeColumnFilters"` // table -> column -> values
+	// OldColumnFilter publishes only the updates whose old column value is one of the listed values,
+	// the old value is present only with REPLICA IDENTITY FULL.
+	OldColumnFilter map[string]map[string][]string `yaml:"oldColumnFilters"` // table -> column -> allowed old values
+	// ColumnConditions compares the column values with thresholds, all conditions of the table must hold.
+	ColumnConditions map[string]map[string][]ColumnCondition `yaml:"columnConditions"` // table -> column -> conditions
+	// ColumnPatterns matches column values by regular expression; a column with allowed values too
+	// passes if either matches.
+	ColumnPatterns map[string]map[string]string `yaml:"columnPatterns"` // table -> column -> regexp
+	// NullTransitions publishes only updates that switch one of the columns between NULL and a value.
+	NullTransitions map[string]NullTransitionRule `yaml:"nullTransitions"` // table -> rule
+	// SignificantColumns publishes a transaction only if one of its actions changed one of the columns,
+	// otherwise all its events are dropped.
+	SignificantColumns map[string][]string `yaml:"significantColumns"` // table -> columns
+	// InternalColumns are column names or glob patterns (e.g. "_audit_*") stripped from the events of all tables.
+	InternalColumns []string `yaml:"internalColumns"`
+	// KeepColumns overrides InternalColumns; the listed columns are published for the table.
+	KeepColumns map[string][]string `yaml:"keepColumns"` // table -> columns
+}
+
+// tablePatternMarker prefixes the table filter keys holding a regular expression.
+const tablePatternMarker = "~"
+
+// TablePattern returns the anchored regular expression of a table filter key with the pattern marker.
+func TablePattern(key string) (string, bool) {
+	pattern, ok := strings.CutPrefix(key, tablePatternMarker)
+	if !ok {
+		return "", false
+	}
+
+	return "^(?:" + pattern + ")$", true
+}
+
+// NullTransitionDirection direction of the NULL transition.
+type NullTransitionDirection string
+
+const (
+	NullToValue NullTransitionDirection = "nullToValue"
+	ValueToNull NullTransitionDirection = "valueToNull"
+	NullBoth    NullTransitionDirection = "both"
+)
+
+// NullTransitionRule matches updates by NULL transitions of the columns.
+type NullTransitionRule struct {
+	Columns   []string
+	Direction NullTransitionDirection // both by default
+}
+
+// Match checks whether the column transition from old to new value matches the direction.
+func (d NullTransitionDirection) Match(oldIsNull, newIsNull bool) bool {
+	switch d {
+	case NullToValue:
+		return oldIsNull && !newIsNull
+	case ValueToNull:
+		return !oldIsNull && newIsNull
+	default:
+		return oldIsNull != newIsNull
+	}
+}
+
+// CompareOp operator of the column condition.
+type CompareOp string
+
+const (
+	CompareEq  CompareOp = "eq"
+	CompareNe  CompareOp = "ne"
+	CompareGt  CompareOp = "gt"
+	CompareGte CompareOp = "gte"
+	CompareLt  CompareOp = "lt"
+	CompareLte CompareOp = "lte"
+)
+
+// ColumnCondition compares the column value with the value: as numbers if both are numeric,
+// otherwise as strings, equality is case-insensitive like the allowed values of the column filters.
+type ColumnCondition struct {
+	Op    CompareOp
+	Value string
+}
+
+// Match checks whether the column value satisfies the condition.
+func (c ColumnCondition) Match(value any) bool {
+	actual := fmt.Sprint(value)
+
+	var res int
+
+	a, errA := strconv.ParseFloat(actual, 64)
+	b, errB := strconv.ParseFloat(c.Value, 64)
+
+	switch {
+	case errA == nil && errB == nil:
+		res = cmp.Compare(a, b)
+	case strings.EqualFold(actual, c.Value):
+		res = 0
+	default:
+		res = strings.Compare(actual, c.Value)
+	}
+
+	switch c.Op {
+	case CompareEq:
+		return res == 0
+	case CompareNe:
+		return res != 0
+	case CompareGt:
+		return res > 0
+	case CompareGte:
+		return res >= 0
+	case CompareLt:
+		return res < 0
+	case CompareLte:
+		return res <= 0
+	default:
+		return false
+	}
+}
+
+// KeyHashType represents the hash algorithm used for the message key.
+type KeyHashType string
+
+const (
+	KeyHashNone   KeyHashType = ""
+	KeyHashSHA256 KeyHashType = "sha256"
+	KeyHashSHA1   KeyHashType = "sha1"
+	KeyHashMD5    KeyHashType = "md5"
+	KeyHashFNV    KeyHashType = "fnv"
+)
+
+// EventKeyCfg message key derivation settings.
+type EventKeyCfg struct {
+	Columns    map[string][]string // table -> columns used for the key
+	Hash       KeyHashType
+	HashLength int // length of the hex-encoded hash, zero means the full hash
+	// RowKey keys the events of the tables without key columns by the replica identity key of the row,
+	// so the changes of a row go to the same partition in order.
+	RowKey bool
+}
+
+// BusinessKeyCfg natural key of the rows, published for deduplication downstream.
+type BusinessKeyCfg struct {
+	Columns    map[string][]string // table -> business key columns
+	MessageKey bool                // use the business key as the message key instead of the event key
 }
 
 // Validate config data.
 func (c Config) Validate() error {
-	_, err := govalidator.ValidateStruct(c)
-	return err
+	if _, err := govalidator.ValidateStruct(c); err != nil {
+		return err
+	}
+
+	if c.Listener != nil {
+		if err := c.Listener.EventKey.Validate(); err != nil {
+			return fmt.Errorf("event key: %w", err)
+		}
+
+		if err := c.Listener.Protection.Validate(); err != nil {
+			return fmt.Errorf("protection: %w", err)
+		}
+
+		if r := c.Listener.Reconnect; r.Jitter < 0 || r.Jitter > 1 {
+			return fmt.Errorf("reconnect jitter must be within 0..1: %v", r.Jitter)
+		}
+
+		if src := c.Listener.TopicsMapSource; src.File != "" && src.Table != "" {
+			return errors.New("topics map source: only one of file and table is allowed")
+		}
+
+		for table, lookups := range c.Listener.Enrichment {
+			for _, e := range lookups {
+				if e.Column == "" || e.Table == "" || e.KeyColumn == "" || e.ValueColumn == "" || e.Field == "" {
+					return fmt.Errorf("enrichment %s: column, table, key column, value column and field are required", table)
+				}
+			}
+		}
+
+		switch c.Listener.LSNGuard.Policy {
+		case "", LSNPolicyError, LSNPolicyResync, LSNPolicyContinue:
+		default:
+			return fmt.Errorf("unknown lsn policy: %s", c.Listener.LSNGuard.Policy)
+		}
+
+		switch c.Listener.AckMode {
+		case "", AckModeMessage, AckModeCommit:
+		default:
+			return fmt.Errorf("unknown ack mode: %s", c.Listener.AckMode)
+		}
+
+		switch c.Listener.OpField {
+		case "", OpFieldAlongside:
+		case OpFieldInstead:
+			if c.Publisher != nil && c.Publisher.Type == PublisherTypeSQL {
+				return errors.New("op field: instead mode is not supported by the sql publisher")
+			}
+		default:
+			return fmt.Errorf("unknown op field mode: %s", c.Listener.OpField)
+		}
+
+		switch c.Listener.Nulls {
+		case "", NullsKeep:
+		case NullsOmit:
+			if c.Publisher != nil && c.Publisher.Type == PublisherTypeSQL {
+				return errors.New("nulls: omit mode is not supported by the sql publisher")
+			}
+		default:
+			return fmt.Errorf("unknown nulls mode: %s", c.Listener.Nulls)
+		}
+
+		if c.Publisher != nil && c.Publisher.Format == FormatAvro && !c.Listener.AnnotateTypes {
+			return errors.New("avro format requires type annotations, the schema is derived from the column types")
+		}
+
+		for table, sd := range c.Listener.SoftDelete {
+			if sd.Column == "" {
+				return fmt.Errorf("soft delete %s: column is required", table)
+			}
+
+			switch sd.Mode {
+			case "", SoftDeleteValue, SoftDeleteTransition:
+			default:
+				return fmt.Errorf("soft delete %s: unknown mode: %s", table, sd.Mode)
+			}
+		}
+
+		if b := c.Listener.TxBuffer; b.EarlyEmit && (b.MaxTime <= 0 || !c.Listener.Streaming) {
+			return errors.New("tx buffer: early emit requires streaming and max time")
+		}
+
+		if m := c.Listener.LogicalMessages; m.Enabled && m.Topic == "" {
+			return errors.New("logical messages: topic is required")
+		}
+
+		if l := c.Listener.SlotLag; l.FastForward && (l.Threshold == 0 || len(l.SkippableTables) == 0) {
+			return errors.New("slot lag: fast forward requires threshold and skippable tables")
+		}
+
+		switch c.Listener.RequiredColumns.Action {
+		case "", ContractActionLog:
+		case ContractActionDLQ:
+			if c.Publisher == nil || !c.Publisher.hasDeadLetters() {
+				return errors.New("required columns: dlq action requires kafka publisher or dead letter cluster with dead letter topic")
+			}
+		default:
+			return fmt.Errorf("required columns: unknown action: %s", c.Listener.RequiredColumns.Action)
+		}
+
+		if c.Listener.Snapshot.BatchSize < 0 {
+			return fmt.Errorf("negative snapshot batch size: %d", c.Listener.Snapshot.BatchSize)
+		}
+
+		if c.Listener.DecodeWorkers < 0 {
+			return fmt.Errorf("negative decode workers: %d", c.Listener.DecodeWorkers)
+		}
+
+		if c.Listener.Projection.MapCapacity < 0 {
+			return fmt.Errorf("negative projection map capacity: %d", c.Listener.Projection.MapCapacity)
+		}
+
+		for table := range c.Listener.Filter.Tables {
+			if pattern, ok := TablePattern(table); ok {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return fmt.Errorf("table pattern %s: %w", table, err)
+				}
+			}
+		}
+
+		for _, table := range c.Listener.Filter.ExcludeTables {
+			if pattern, ok := TablePattern(table); ok {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return fmt.Errorf("exclude table pattern %s: %w", table, err)
+				}
+			}
+		}
+
+		for table, patterns := range c.Listener.Filter.ColumnPatterns {
+			for column, pattern := range patterns {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return fmt.Errorf("column pattern %s.%s: %w", table, column, err)
+				}
+			}
+		}
+
+		for table, columns := range c.Listener.Filter.ColumnConditions {
+			for column, conditions := range columns {
+				for _, cond := range conditions {
+					switch cond.Op {
+					case CompareEq, CompareNe, CompareGt, CompareGte, CompareLt, CompareLte:
+					default:
+						return fmt.Errorf("column condition %s.%s: unknown operator: %s", table, column, cond.Op)
+					}
+				}
+			}
+		}
+
+		for _, pattern := range c.Listener.Filter.InternalColumns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("internal columns %s: %w", pattern, err)
+			}
+		}
+
+		for action, mode := range c.Listener.OldColumns {
+			switch mode {
+			case OldColumnsFull, OldColumnsKeys, OldColumnsNone:
+			default:
+				return fmt.Errorf("old columns %s: unknown mode: %s", action, mode)
+			}
+		}
+
+		for topic, t := range c.Listener.Topics {
+			if t.Compacted && (c.Publisher == nil || c.Publisher.Type != PublisherTypeKafka) {
+				return fmt.Errorf("topic %s: compacted topics require kafka publisher", topic)
+			}
+
+			for _, action := range t.Actions {
+				if !slices.Contains(topicActions, action) {
+					return fmt.Errorf("topic %s: unknown action: %s", topic, action)
+				}
+			}
+		}
+
+		for topic, mode := range c.Listener.DeleteOldColumns {
+			switch mode {
+			case OldColumnsFull, OldColumnsKeys, OldColumnsNone:
+			default:
+				return fmt.Errorf("delete old columns %s: unknown mode: %s", topic, mode)
+			}
+		}
+
+		for table, destinations := range c.Listener.Destinations {
+			if err := c.validateDestinations(table, destinations); err != nil {
+				return err
+			}
+		}
+
+		for table, rule := range c.Listener.Filter.NullTransitions {
+			switch rule.Direction {
+			case "", NullToValue, ValueToNull, NullBoth:
+			default:
+				return fmt.Errorf("null transition %s: unknown direction: %s", table, rule.Direction)
+			}
+		}
+
+		for table, columns := range c.Listener.Filter.SignificantColumns {
+			if len(columns) == 0 {
+				return fmt.Errorf("significant columns %s: no columns", table)
+			}
+		}
+	}
+
+	if c.Publisher != nil {
+		if err := c.Publisher.validateType(); err != nil {
+			return err
+		}
+
+		if err := c.Publisher.validateEncoding(); err != nil {
+			return err
+		}
+
+		if err := c.Publisher.NatsAuth.Validate(); err != nil {
+			return fmt.Errorf("nats auth: %w", err)
+		}
+
+		if err := c.Publisher.SASL.Validate(); err != nil {
+			return fmt.Errorf("sasl: %w", err)
+		}
+
+		if err := c.Publisher.ProducerCompression.Validate(); err != nil {
+			return fmt.Errorf("producer compression: %w", err)
+		}
+
+		if err := c.Publisher.Retry.Validate(); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+
+		if c.Publisher.Workers < 0 {
+			return fmt.Errorf("negative publish workers: %d", c.Publisher.Workers)
+		}
+
+		if c.Publisher.Workers > 1 && c.Publisher.Batch.Enabled() {
+			return errors.New("publish workers are not supported with batching")
+		}
+
+		if c.Publisher.Retry.DeadLetter && !c.Publisher.hasDeadLetters() {
+			return errors.New("retry: dead letter requires kafka publisher or dead letter cluster with dead letter topic")
+		}
+
+		if c.Publisher.Type == PublisherTypeSQL {
+			if err := c.Publisher.SQL.Validate(); err != nil {
+				return fmt.Errorf("sql sink: %w", err)
+			}
+		}
+
+		if c.Publisher.Type == PublisherTypeWebhook {
+			if err := c.Publisher.Webhook.Validate(c.Publisher.Address); err != nil {
+				return fmt.Errorf("webhook: %w", err)
+			}
+		}
+
+		if c.Publisher.Type == PublisherTypeNDJSON {
+			if err := c.Publisher.NDJSON.Validate(*c.Publisher); err != nil {
+				return fmt.Errorf("ndjson: %w", err)
+			}
+		}
+
+		if c.Publisher.Type == PublisherTypeRabbitMQ {
+			switch c.Publisher.RabbitMQ.ExchangeKind {
+			case "", "direct", "fanout", "topic", "headers":
+			default:
+				return fmt.Errorf("rabbitmq: unknown exchange kind: %s", c.Publisher.RabbitMQ.ExchangeKind)
+			}
+		}
+
+		if c.Publisher.Type == PublisherTypeSQS || c.Publisher.Type == PublisherTypeSNS {
+			if err := c.Publisher.AWS.Validate(*c.Publisher); err != nil {
+				return fmt.Errorf("%s: %w", c.Publisher.Type, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateDestinations checks the destinations of the table.
+func (c *Config) validateDestinations(table string, destinations map[string]DestinationCfg) error {
+	if len(c.Listener.Fanout[table]) > 0 {
+		return fmt.Errorf("destinations %s: the table has fanout topics too", table)
+	}
+
+	for name, d := range destinations {
+		if d.Topic == "" {
+			return fmt.Errorf("destination %s.%s: topic is required", table, name)
+		}
+
+		if d.Compacted && (c.Publisher == nil || c.Publisher.Type != PublisherTypeKafka) {
+			return fmt.Errorf("destination %s.%s: compacted topics require kafka publisher", table, name)
+		}
+
+		for _, action := range d.Actions {
+			if !slices.Contains(topicActions, action) {
+				return fmt.Errorf("destination %s.%s: unknown action: %s", table, name, action)
+			}
+		}
+
+		switch d.DeleteOldColumns {
+		case "", OldColumnsFull, OldColumnsKeys, OldColumnsNone:
+		default:
+			return fmt.Errorf("destination %s.%s: unknown delete old columns mode: %s", table, name, d.DeleteOldColumns)
+		}
+
+		if d.Format == FormatAvro && !c.Listener.AnnotateTypes {
+			return fmt.Errorf("destination %s.%s: avro format requires type annotations", table, name)
+		}
+
+		if d.Format != "" && c.Publisher != nil {
+			pCfg := *c.Publisher
+			pCfg.Format = d.Format
+
+			if err := pCfg.validateEncoding(); err != nil {
+				return fmt.Errorf("destination %s.%s: %w", table, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasDeadLetters reports whether the dead letters can be sent: by the Kafka publisher or to the dead-letter cluster.
+func (p PublisherCfg) hasDeadLetters() bool {
+	return p.DeadLetterTopic != "" && (p.Type == PublisherTypeKafka || p.DeadLetter.Address != "")
+}
+
+// validateType checks the publisher type and the connection settings it requires,
+// the settings of the other publishers are checked with their own config.
+func (p PublisherCfg) validateType() error {
+	switch p.Type {
+	case PublisherTypeKafka, PublisherTypeNats, PublisherTypeRabbitMQ, PublisherTypeSQL:
+		if p.Address == "" {
+			return fmt.Errorf("%s: address is required", p.Type)
+		}
+	case PublisherTypeGooglePubSub:
+		if p.PubSubProjectID == "" {
+			return fmt.Errorf("%s: project id is required", p.Type)
+		}
+	case PublisherTypeWebhook, PublisherTypeNDJSON, PublisherTypeSQS, PublisherTypeSNS:
+	case PublisherTypeChannel:
+		// the subscribers are in-process, the publisher is created by the code embedding the listener.
+		return fmt.Errorf("%s: the publisher is for embedded use only", p.Type)
+	default:
+		return fmt.Errorf("unknown publisher type: %s", p.Type)
+	}
+
+	// the rows aren't serialized.
+	if p.Compression != CompressionNone && p.Type == PublisherTypeSQL {
+		return fmt.Errorf("%s: compression is not supported", p.Type)
+	}
+
+	if p.PubSubOrdering && p.Type != PublisherTypeGooglePubSub {
+		return fmt.Errorf("%s: ordering is supported by the google_pubsub publisher only", p.Type)
+	}
+
+	return nil
+}
+
+// validateEncoding checks the serialization format and compression of the publisher.
+func (p PublisherCfg) validateEncoding() error {
+	switch p.Format {
+	case "", FormatJSON, FormatMsgPack, FormatFlat, FormatCloudEvents, FormatDebezium:
+	case FormatAvro:
+		if p.Type != PublisherTypeKafka {
+			return errors.New("avro format requires kafka publisher")
+		}
+
+		if p.SchemaRegistry.URL == "" {
+			return errors.New("avro format requires schema registry url")
+		}
+
+		if p.Compression != CompressionNone {
+			return errors.New("avro format doesn't support compression")
+		}
+	default:
+		return fmt.Errorf("unknown publisher format: %s", p.Format)
+	}
+
+	switch p.Flatten.Order {
+	case "", FlattenNewFirst, FlattenOldFirst:
+	default:
+		return fmt.Errorf("unknown flatten order: %s", p.Flatten.Order)
+	}
+
+	switch p.Flatten.Collision {
+	case "", FlattenCollisionPrefix, FlattenCollisionSuffix, FlattenCollisionDrop:
+	default:
+		return fmt.Errorf("unknown flatten collision: %s", p.Flatten.Collision)
+	}
+
+	switch p.TimeFormat {
+	case "", TimeFormatRFC3339:
+	case TimeFormatEpochMillis:
+		if p.Format == FormatMsgPack {
+			return errors.New("epoch millis time format is not supported by msgpack format")
+		}
+	default:
+		return fmt.Errorf("unknown publisher time format: %s", p.TimeFormat)
+	}
+
+	switch p.Compression {
+	case CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd:
+	default:
+		return fmt.Errorf("unknown publisher compression: %s", p.Compression)
+	}
+
+	return nil
+}
+
+// Validate channel publisher settings, called by the embedding code before it creates the publisher.
+func (c ChannelCfg) Validate() error {
+	switch c.Mode {
+	case "", ChannelBroadcast, ChannelWorkQueue:
+	default:
+		return fmt.Errorf("unknown mode: %s", c.Mode)
+	}
+
+	if c.Buffer < 0 {
+		return errors.New("negative buffer")
+	}
+
+	return nil
+}
+
+// Validate webhook publisher settings with the endpoint URL.
+func (w WebhookCfg) Validate(address string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("address: %w", err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("address is not an http(s) URL: %s", address)
+	}
+
+	if w.Timeout < 0 {
+		return errors.New("negative timeout")
+	}
+
+	return nil
+}
+
+// Validate the codec of the producer compression.
+func (p ProducerCompressionCfg) Validate() error {
+	switch p.Codec {
+	case "", KafkaCodecNone, KafkaCodecGzip, KafkaCodecSnappy, KafkaCodecLZ4, KafkaCodecZstd:
+		return nil
+	default:
+		return fmt.Errorf("unknown codec: %s", p.Codec)
+	}
+}
+
+// Validate NDJSON sink settings with the target and the format of the publisher.
+func (n NDJSONCfg) Validate(p PublisherCfg) error {
+	if p.Address == "" {
+		return errors.New("address is required")
+	}
+
+	if err := validateTextFormat(p); err != nil {
+		return err
+	}
+
+	if n.FlushSize < 0 || n.FileSize < 0 || n.Timeout < 0 {
+		return errors.New("negative flush size, file size or timeout")
+	}
+
+	return nil
+}
+
+// Validate the publisher format, SQS and SNS message bodies are text.
+func (a AWSCfg) Validate(p PublisherCfg) error {
+	return validateTextFormat(p)
+}
+
+// validateTextFormat checks the events are serialized as uncompressed JSON.
+func validateTextFormat(p PublisherCfg) error {
+	switch p.Format {
+	case "", FormatJSON, FormatFlat, FormatCloudEvents, FormatDebezium:
+	default:
+		return fmt.Errorf("format %s is not JSON", p.Format)
+	}
+
+	if p.Compression != CompressionNone {
+		return errors.New("compression is not supported")
+	}
+
+	return nil
+}
+
+// Validate SQL sink settings.
+func (s SQLSinkCfg) Validate() error {
+	if len(s.Tables) == 0 {
+		return errors.New("no tables configured")
+	}
+
+	for table, t := range s.Tables {
+		if t.Target == "" {
+			return fmt.Errorf("table %s: target is required", table)
+		}
+
+		if len(t.ConflictKey) == 0 {
+			return fmt.Errorf("table %s: conflict key is required", table)
+		}
+	}
+
+	return nil
+}
+
+// Validate SASL authentication settings.
+func (s SASLCfg) Validate() error {
+	switch s.Mechanism {
+	case "":
+		return nil
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+	default:
+		return fmt.Errorf("unknown mechanism: %s", s.Mechanism)
+	}
+
+	if s.Username == "" || s.Password == "" {
+		return errors.New("username and password are required")
+	}
+
+	return nil
+}
+
+// Validate NATS authentication settings.
+func (a NatsAuthCfg) Validate() error {
+	if a.CredsFile != "" && a.NKeyFile != "" {
+		return errors.New("creds file and nkey file are mutually exclusive")
+	}
+
+	if a.Token != "" && a.TokenFile != "" {
+		return errors.New("token and token file are mutually exclusive")
+	}
+
+	if a.CredsFile != "" && (a.Token != "" || a.TokenFile != "") {
+		return errors.New("creds file and token are mutually exclusive")
+	}
+
+	return nil
+}
+
+// Validate column protection settings.
+func (p ProtectionCfg) Validate() error {
+	for table, columns := range p.Encrypt {
+		for _, column := range columns {
+			if slices.Contains(p.Mask[table], column) {
+				return fmt.Errorf("column %s.%s is both masked and encrypted", table, column)
+			}
+		}
+	}
+
+	if err := p.Classification.Validate(); err != nil {
+		return fmt.Errorf("classification: %w", err)
+	}
+
+	if len(p.Encrypt) == 0 {
+		return nil
+	}
+
+	if p.Encryption.KeyID == "" {
+		return errors.New("encryption key id is required")
+	}
+
+	if (p.Encryption.Key == "") == (p.Encryption.KeyFile == "") {
+		return errors.New("exactly one of encryption key and key file is required")
+	}
+
+	return nil
+}
+
+// Validate classification settings.
+func (c ClassificationCfg) Validate() error {
+	switch c.Source {
+	case "":
+		return nil
+	case ClassificationComment:
+		if c.Provider != "" {
+			return errors.New("provider is only allowed with security labels")
+		}
+	case ClassificationSecurityLabel:
+	default:
+		return fmt.Errorf("unknown source: %s", c.Source)
+	}
+
+	if len(c.Mask) == 0 && len(c.Exclude) == 0 {
+		return errors.New("mask or exclude tags are required")
+	}
+
+	for _, tag := range c.Mask {
+		if slices.ContainsFunc(c.Exclude, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			return fmt.Errorf("tag %s is both masked and excluded", tag)
+		}
+	}
+
+	return nil
+}
+
+// Validate event key settings.
+func (k EventKeyCfg) Validate() error {
+	switch k.Hash {
+	case KeyHashNone, KeyHashSHA256, KeyHashSHA1, KeyHashMD5, KeyHashFNV:
+	default:
+		return fmt.Errorf("unknown hash type: %s", k.Hash)
+	}
+
+	if k.HashLength < 0 {
+		return fmt.Errorf("negative hash length: %d", k.HashLength)
+	}
+
+	return nil
 }
 
 // InitConfig load config from file.
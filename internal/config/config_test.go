@@ -126,6 +126,903 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: errors.New("Publisher.Type: non zero value required"),
 		},
+		{
+			name: "unknown event key hash",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					EventKey: EventKeyCfg{
+						Columns: map[string][]string{"users": {"id"}},
+						Hash:    "crc32",
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:        "kafka",
+					Address:     "addr",
+					Topic:       "stream",
+					TopicPrefix: "prefix",
+				},
+			},
+			wantErr: errors.New("event key: unknown hash type: crc32"),
+		},
+		{
+			name: "column both masked and encrypted",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Protection: ProtectionCfg{
+						Mask:       map[string][]string{"users": {"email"}},
+						Encrypt:    map[string][]string{"users": {"email"}},
+						Encryption: EncryptionKeyCfg{KeyID: "k1", Key: "a2V5"},
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:        "kafka",
+					Address:     "addr",
+					Topic:       "stream",
+					TopicPrefix: "prefix",
+				},
+			},
+			wantErr: errors.New("protection: column users.email is both masked and encrypted"),
+		},
+		{
+			name: "invalid table pattern",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Filter: FilterStruct{
+						Tables: map[string][]string{"~events_(": {"insert"}},
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:        "kafka",
+					Address:     "addr",
+					Topic:       "stream",
+					TopicPrefix: "prefix",
+				},
+			},
+			wantErr: errors.New("table pattern ~events_(: error parsing regexp: missing closing ): `^(?:events_()$`"),
+		},
+		{
+			name: "tag both masked and excluded",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Protection: ProtectionCfg{
+						Classification: ClassificationCfg{
+							Source:  ClassificationComment,
+							Mask:    []string{"pii"},
+							Exclude: []string{"PII", "secret"},
+						},
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:        "kafka",
+					Address:     "addr",
+					Topic:       "stream",
+					TopicPrefix: "prefix",
+				},
+			},
+			wantErr: errors.New("protection: classification: tag pii is both masked and excluded"),
+		},
+		{
+			name: "unknown compression",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:        "kafka",
+					Address:     "addr",
+					Topic:       "stream",
+					Format:      FormatMsgPack,
+					Compression: "brotli",
+				},
+			},
+			wantErr: errors.New("unknown publisher compression: brotli"),
+		},
+		{
+			name: "bad internal column pattern",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Filter: FilterStruct{
+						InternalColumns: []string{"_audit_["},
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("internal columns _audit_[: syntax error in pattern"),
+		},
+		{
+			name: "bad column pattern",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Filter: FilterStruct{
+						ColumnPatterns: map[string]map[string]string{"users": {"email": "(corp"}},
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("column pattern users.email: error parsing regexp: missing closing ): `(corp`"),
+		},
+		{
+			name: "required columns dlq without dead letter topic",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					RequiredColumns: RequiredColumnsCfg{
+						Tables: map[string][]string{"users": {"email"}},
+						Action: ContractActionDLQ,
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("required columns: dlq action requires kafka publisher or dead letter cluster with dead letter topic"),
+		},
+		{
+			name: "logical messages without topic",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					LogicalMessages:   LogicalMessagesCfg{Enabled: true},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("logical messages: topic is required"),
+		},
+		{
+			name: "destination with unknown format",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Destinations: map[string]map[string]DestinationCfg{
+						"public_orders": {"changelog": {Topic: "orders_changelog", Format: "protobuf"}},
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("destination public_orders.changelog: unknown publisher format: protobuf"),
+		},
+		{
+			name: "slot lag fast forward without skippable tables",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					SlotLag:           SlotLagCfg{Threshold: 1 << 30, FastForward: true},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("slot lag: fast forward requires threshold and skippable tables"),
+		},
+		{
+			name: "sasl without password",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+					SASL:    SASLCfg{Mechanism: SASLScramSHA256, Username: "listener"},
+				},
+			},
+			wantErr: errors.New("sasl: username and password are required"),
+		},
+		{
+			name: "webhook address without scheme",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "webhook",
+					Address: "hooks.example.com/wal",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("webhook: address is not an http(s) URL: hooks.example.com/wal"),
+		},
+		{
+			name: "ndjson with msgpack format",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "ndjson",
+					Format:  FormatMsgPack,
+					Address: "/var/lib/wal-listener/events",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("ndjson: format msgpack is not JSON"),
+		},
+		{
+			name: "retry jitter out of range",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+					Retry:   RetryCfg{MaxAttempts: 3, Jitter: 1.5},
+				},
+			},
+			wantErr: errors.New("retry: jitter is out of the 0..1 range"),
+		},
+		{
+			name: "retry dead letter without dead letter topic",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+					Retry:   RetryCfg{MaxAttempts: 3, DeadLetter: true},
+				},
+			},
+			wantErr: errors.New("retry: dead letter requires kafka publisher or dead letter cluster with dead letter topic"),
+		},
+		{
+			name: "avro without schema registry",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					AnnotateTypes:     true,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:           "kafka",
+					Address:        "addr",
+					Topic:          "stream",
+					Format:         FormatAvro,
+					SchemaRegistry: SchemaRegistryCfg{URL: ""},
+				},
+			},
+			wantErr: errors.New("avro format requires schema registry url"),
+		},
+		{
+			name: "avro without type annotations",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					AnnotateTypes:     false,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:           "kafka",
+					Address:        "addr",
+					Topic:          "stream",
+					Format:         FormatAvro,
+					SchemaRegistry: SchemaRegistryCfg{URL: "http://registry:8081"},
+				},
+			},
+			wantErr: errors.New("avro format requires type annotations, the schema is derived from the column types"),
+		},
+		{
+			name: "column condition with unknown operator",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Filter: FilterStruct{
+						ColumnConditions: map[string]map[string][]ColumnCondition{
+							"payments": {"amount": {{Op: "between", Value: "1"}}},
+						},
+					},
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("column condition payments.amount: unknown operator: between"),
+		},
+		{
+			name: "unknown ack mode",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					AckMode:           "transaction",
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("unknown ack mode: transaction"),
+		},
+		{
+			name: "publish workers with batching",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+					Batch:   BatchCfg{Size: 100},
+					Workers: 4,
+				},
+			},
+			wantErr: errors.New("publish workers are not supported with batching"),
+		},
+		{
+			name: "unknown nulls mode",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Nulls:             "skip",
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "kafka",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("unknown nulls mode: skip"),
+		},
+		{
+			name: "omitted nulls with sql sink",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+					Nulls:             "omit",
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "sql",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("nulls: omit mode is not supported by the sql publisher"),
+		},
+		{
+			name: "sqs with binary format",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:   "sqs",
+					Topic:  "stream",
+					Format: FormatMsgPack,
+				},
+			},
+			wantErr: errors.New("sqs: format msgpack is not JSON"),
+		},
+		{
+			name: "unknown rabbitmq exchange kind",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:     "rabbitmq",
+					Address:  "addr",
+					Topic:    "stream",
+					RabbitMQ: RabbitMQCfg{ExchangeKind: "x-delayed"},
+				},
+			},
+			wantErr: errors.New("rabbitmq: unknown exchange kind: x-delayed"),
+		},
+		{
+			name: "nats creds file with token",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:     "nats",
+					Address:  "addr",
+					Topic:    "stream",
+					NatsAuth: NatsAuthCfg{CredsFile: "user.creds", Token: "secret"},
+				},
+			},
+			wantErr: errors.New("nats auth: creds file and token are mutually exclusive"),
+		},
+		{
+			name: "unknown publisher type",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:    "redis",
+					Address: "addr",
+					Topic:   "stream",
+				},
+			},
+			wantErr: errors.New("unknown publisher type: redis"),
+		},
+		{
+			name: "kafka without address",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:  "kafka",
+					Topic: "stream",
+				},
+			},
+			wantErr: errors.New("kafka: address is required"),
+		},
+		{
+			name: "pubsub without project id",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:  "google_pubsub",
+					Topic: "stream",
+				},
+			},
+			wantErr: errors.New("google_pubsub: project id is required"),
+		},
+		{
+			name: "sql with compression",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:        "sql",
+					Address:     "postgres://localhost/db",
+					Topic:       "stream",
+					Compression: CompressionGzip,
+				},
+			},
+			wantErr: errors.New("sql: compression is not supported"),
+		},
+		{
+			name: "channel publisher",
+			fields: fields{
+				Logger: &scfg.Logger{
+					Level: "info",
+				},
+				Listener: &ListenerCfg{
+					SlotName:          "slot",
+					AckTimeout:        10,
+					RefreshConnection: 10,
+					HeartbeatInterval: 10,
+				},
+				Database: &DatabaseCfg{
+					Host:     "host",
+					Port:     10,
+					Name:     "db",
+					User:     "usr",
+					Password: "pass",
+				},
+				Publisher: &PublisherCfg{
+					Type:  "channel",
+					Topic: "stream",
+				},
+			},
+			wantErr: errors.New("channel: the publisher is for embedded use only"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -8,13 +10,23 @@ import (
 // Metrics Prometheus metrics.
 type Metrics struct {
 	filterSkippedEvents, publishedEvents, problematicEvents *prometheus.CounterVec
+	transitionSkippedEvents, publishErrors                  *prometheus.CounterVec
+	relationCacheSize, publisherReady, replicationLag       *prometheus.GaugeVec
+	appliedLag                                              *prometheus.GaugeVec
+	batchFlushes, longTransactions, eventPool               *prometheus.CounterVec
+	slotLagAlerts                                           *prometheus.CounterVec
+	batchSize, batchPublishDuration, publishLatency         *prometheus.HistogramVec
 }
 
 const (
-	labelApp     = "app"
-	labelTable   = "table"
-	labelSubject = "subject"
-	labelKind    = "kind"
+	labelApp       = "app"
+	labelTable     = "table"
+	labelSubject   = "subject"
+	labelAction    = "action"
+	labelKind      = "kind"
+	labelReason    = "reason"
+	labelOp        = "op"
+	labelPublisher = "publisher"
 )
 
 // NewMetrics create and initialize new Prometheus metrics.
@@ -24,7 +36,13 @@ func NewMetrics() *Metrics {
 			Name: "published_events_total",
 			Help: "The total number of published events",
 		},
-			[]string{labelApp, labelSubject, labelTable},
+			[]string{labelApp, labelSubject, labelTable, labelAction},
+		),
+		publishErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "publish_errors_total",
+			Help: "The total number of failed event publish attempts",
+		},
+			[]string{labelApp, labelTable},
 		),
 		problematicEvents: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "problematic_events_total",
@@ -38,14 +56,99 @@ func NewMetrics() *Metrics {
 		},
 			[]string{labelApp, labelTable},
 		),
+		transitionSkippedEvents: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "transition_skipped_events_total",
+			Help: "The total number of updates skipped by the null transition filter",
+		},
+			[]string{labelApp, labelTable},
+		),
+		relationCacheSize: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "relation_cache_size",
+			Help: "The current number of cached relations",
+		},
+			[]string{labelApp},
+		),
+		publisherReady: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "publisher_ready",
+			Help: "Whether the non-critical publisher is connected (1) or still retried in the background (0)",
+		},
+			[]string{labelApp, labelPublisher},
+		),
+		replicationLag: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "replication_lag_bytes",
+			Help: "The WAL not yet received from the server: the server WAL end minus the received position",
+		},
+			[]string{labelApp},
+		),
+		appliedLag: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "applied_lag_bytes",
+			Help: "The WAL not yet applied: the current server WAL position minus the acknowledged position",
+		},
+			[]string{labelApp},
+		),
+		slotLagAlerts: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "slot_lag_alerts_total",
+			Help: "The total number of times the replication lag exceeded the threshold",
+		},
+			[]string{labelApp},
+		),
+		batchFlushes: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "batch_flushes_total",
+			Help: "The total number of flushed batches by reason",
+		},
+			[]string{labelApp, labelReason},
+		),
+		longTransactions: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "long_transactions_total",
+			Help: "The total number of transactions buffered longer than the limit without commit",
+		},
+			[]string{labelApp},
+		),
+		eventPool: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "event_pool_operations_total",
+			Help: "The total number of event pool operations: get, put and new (a get the pool couldn't serve)",
+		},
+			[]string{labelApp, labelOp},
+		),
+		batchSize: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "batch_size",
+			Help:    "The number of events in the flushed batch",
+			Buckets: []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000},
+		},
+			[]string{labelApp},
+		),
+		batchPublishDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "batch_publish_duration_seconds",
+			Help:    "The time spent publishing the batch",
+			Buckets: prometheus.DefBuckets,
+		},
+			[]string{labelApp},
+		),
+		publishLatency: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "publish_latency_seconds",
+			Help:    "The time from the transaction commit to the publish of the event",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+			[]string{labelApp, labelTable},
+		),
 	}
 }
 
 const appName = "wal-listener"
 
 // IncPublishedEvents increment published events counter.
-func (m Metrics) IncPublishedEvents(subject, table string) {
-	m.publishedEvents.With(prometheus.Labels{labelApp: appName, labelSubject: subject, labelTable: table}).Inc()
+func (m Metrics) IncPublishedEvents(subject, table, action string) {
+	m.publishedEvents.With(prometheus.Labels{
+		labelApp:     appName,
+		labelSubject: subject,
+		labelTable:   table,
+		labelAction:  action,
+	}).Inc()
+}
+
+// IncPublishErrors increment failed publish attempts counter.
+func (m Metrics) IncPublishErrors(table string) {
+	m.publishErrors.With(prometheus.Labels{labelApp: appName, labelTable: table}).Inc()
 }
 
 // IncFilterSkippedEvents increment skipped by filter events counter.
@@ -57,3 +160,60 @@ func (m Metrics) IncFilterSkippedEvents(table string) {
 func (m Metrics) IncProblematicEvents(kind string) {
 	m.problematicEvents.With(prometheus.Labels{labelApp: appName, labelKind: kind}).Inc()
 }
+
+// IncTransitionSkippedEvents increment skipped by null transition filter events counter.
+func (m Metrics) IncTransitionSkippedEvents(table string) {
+	m.transitionSkippedEvents.With(prometheus.Labels{labelApp: appName, labelTable: table}).Inc()
+}
+
+// SetRelationCacheSize set the current number of cached relations.
+func (m Metrics) SetRelationCacheSize(size int) {
+	m.relationCacheSize.With(prometheus.Labels{labelApp: appName}).Set(float64(size))
+}
+
+// ObserveBatchFlush record the flush reason, size and publish latency of the batch.
+func (m Metrics) ObserveBatchFlush(reason string, size int, duration time.Duration) {
+	m.batchFlushes.With(prometheus.Labels{labelApp: appName, labelReason: reason}).Inc()
+	m.batchSize.With(prometheus.Labels{labelApp: appName}).Observe(float64(size))
+	m.batchPublishDuration.With(prometheus.Labels{labelApp: appName}).Observe(duration.Seconds())
+}
+
+// ObservePublishLatency record the time from the commit to the publish of the event.
+func (m Metrics) ObservePublishLatency(table string, latency time.Duration) {
+	m.publishLatency.With(prometheus.Labels{labelApp: appName, labelTable: table}).Observe(latency.Seconds())
+}
+
+// IncLongTransactions increment buffered longer than the limit transactions counter.
+func (m Metrics) IncLongTransactions() {
+	m.longTransactions.With(prometheus.Labels{labelApp: appName}).Inc()
+}
+
+// IncEventPool increment event pool operations counter.
+func (m Metrics) IncEventPool(op string) {
+	m.eventPool.With(prometheus.Labels{labelApp: appName, labelOp: op}).Inc()
+}
+
+// SetReplicationLag set the current replication lag.
+func (m Metrics) SetReplicationLag(lag uint64) {
+	m.replicationLag.With(prometheus.Labels{labelApp: appName}).Set(float64(lag))
+}
+
+// SetAppliedLag set the current applied lag.
+func (m Metrics) SetAppliedLag(lag uint64) {
+	m.appliedLag.With(prometheus.Labels{labelApp: appName}).Set(float64(lag))
+}
+
+// IncSlotLagAlerts increment replication lag exceeding the threshold counter.
+func (m Metrics) IncSlotLagAlerts() {
+	m.slotLagAlerts.With(prometheus.Labels{labelApp: appName}).Inc()
+}
+
+// SetPublisherReady set the readiness of the non-critical publisher.
+func (m Metrics) SetPublisherReady(name string, ready bool) {
+	var v float64
+	if ready {
+		v = 1
+	}
+
+	m.publisherReady.With(prometheus.Labels{labelApp: appName, labelPublisher: name}).Set(v)
+}
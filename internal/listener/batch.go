@@ -0,0 +1,146 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// batchPublisher is implemented by publishers that can send several messages at once.
+type batchPublisher interface {
+	PublishBatch(ctx context.Context, messages []publisher.Message) error
+}
+
+// batch flush reasons.
+const (
+	flushReasonSize   = "size"
+	flushReasonLinger = "linger"
+	flushReasonCommit = "commit"
+)
+
+// eventBatch accumulates events of the transaction until one of the flush conditions is met.
+type eventBatch struct {
+	cfg      config.BatchCfg
+	messages []publisher.Message
+	events   []*publisher.Event // pooled events of the messages, a fanout event has several messages
+	started  time.Time
+}
+
+func newEventBatch(cfg config.BatchCfg) *eventBatch {
+	return &eventBatch{cfg: cfg, messages: make([]publisher.Message, 0, cfg.Size)}
+}
+
+func (b *eventBatch) add(topic string, event *publisher.Event, now time.Time) {
+	if len(b.messages) == 0 {
+		b.started = now
+	}
+
+	b.messages = append(b.messages, publisher.Message{Topic: topic, Event: event})
+}
+
+// flushReason returns the reason the batch must be flushed before the commit, if any.
+func (b *eventBatch) flushReason(now time.Time) (string, bool) {
+	switch {
+	case len(b.messages) >= b.cfg.Size:
+		return flushReasonSize, true
+	case b.cfg.Linger > 0 && len(b.messages) > 0 && now.Sub(b.started) >= b.cfg.Linger:
+		return flushReasonLinger, true
+	default:
+		return "", false
+	}
+}
+
+func (b *eventBatch) reset() {
+	b.messages = b.messages[:0]
+	b.events = b.events[:0]
+}
+
+// publishBatched publishes the events of the transaction in batches, the last one is flushed on commit.
+func (l *Listener) publishBatched(ctx context.Context, txWAL *tx.WAL, jobs <-chan publishJob) error {
+	batch := newEventBatch(l.cfg.Publisher.Batch)
+
+	for job := range jobs {
+		for _, msg := range job.messages {
+			batch.add(msg.Topic, msg.Event, time.Now())
+		}
+
+		batch.events = append(batch.events, job.event)
+
+		if reason, ok := batch.flushReason(time.Now()); ok {
+			if err := l.flushBatch(ctx, batch, reason, txWAL); err != nil {
+				return err
+			}
+		}
+	}
+
+	return l.flushBatch(ctx, batch, flushReasonCommit, txWAL)
+}
+
+// flushBatch publishes the batched events and records the batch metrics.
+func (l *Listener) flushBatch(ctx context.Context, batch *eventBatch, reason string, txWAL *tx.WAL) error {
+	if len(batch.messages) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	if err := l.sendBatch(ctx, batch.messages); err != nil {
+		l.monitor.IncProblematicEvents(problemKindPublish)
+		return fmt.Errorf("publish batch: %w", err)
+	}
+
+	l.monitor.ObserveBatchFlush(reason, len(batch.messages), time.Since(start))
+
+	for _, msg := range batch.messages {
+		l.eventSent(msg.Topic, msg.Event)
+	}
+
+	for _, event := range batch.events {
+		txWAL.RetrieveEvent(event)
+	}
+
+	batch.reset()
+
+	return nil
+}
+
+// sendBatch falls back to sequential publishing if the publisher has no batch support.
+// A partially delivered batch is retried from its failed messages, see failedMessages.
+func (l *Listener) sendBatch(ctx context.Context, messages []publisher.Message) error {
+	if bp, ok := l.publisher.(batchPublisher); ok {
+		pending := messages
+
+		attempts, err := l.retry(ctx, func() error {
+			err := bp.PublishBatch(ctx, pending)
+			l.publishFailed(pending, err)
+			pending = failedMessages(pending, err)
+
+			return err
+		})
+		if err != nil {
+			return l.deadLetterUndelivered(ctx, pending, attempts, err)
+		}
+
+		return nil
+	}
+
+	for _, msg := range messages {
+		attempts, err := l.retry(ctx, func() error {
+			err := l.publisher.Publish(ctx, msg.Topic, msg.Event)
+			l.publishFailed([]publisher.Message{msg}, err)
+
+			return err
+		})
+		if err != nil {
+			if err := l.deadLetterUndelivered(ctx, []publisher.Message{msg}, attempts, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+func newBatchWAL(logger *slog.Logger, monitor *monitorMock, events int) *tx.WAL {
+	pool := &sync.Pool{
+		New: func() any {
+			return &publisher.Event{}
+		},
+	}
+
+	txWAL := tx.NewWAL(logger, pool, monitor, &config.ListenerCfg{}, nil)
+	now := time.Now()
+	txWAL.CommitTime = &now
+
+	for i := 0; i < events; i++ {
+		txWAL.Actions = append(txWAL.Actions, tx.ActionData{
+			Schema:     "public",
+			Table:      "users",
+			Kind:       tx.ActionKindInsert,
+			NewColumns: []tx.Column{tx.InitColumn(logger, "id", i, 23, true)},
+		})
+	}
+
+	return txWAL
+}
+
+func TestListener_publishBatched(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			Filter: config.FilterStruct{
+				Tables: map[string][]string{"users": {"insert"}},
+			},
+		},
+		Publisher: &config.PublisherCfg{
+			Topic: "wal",
+			Batch: config.BatchCfg{Size: 2},
+		},
+	}
+
+	t.Run("size and commit", func(t *testing.T) {
+		monitor := new(monitorMock)
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Return(nil).Times(3)
+
+		l := &Listener{cfg: cfg, log: logger, monitor: monitor, publisher: pub}
+
+		require.NoError(t, l.publishEvents(context.Background(), newBatchWAL(logger, monitor, 3)))
+		assert.Equal(t, []string{flushReasonSize, flushReasonCommit}, monitor.flushReasons)
+		assert.Equal(t, []int{2, 1}, monitor.flushSizes)
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		monitor := new(monitorMock)
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Return(errSimple).Once()
+
+		l := &Listener{cfg: cfg, log: logger, monitor: monitor, publisher: pub}
+
+		err := l.publishEvents(context.Background(), newBatchWAL(logger, monitor, 1))
+		assert.EqualError(t, err, "publish batch: some err")
+		assert.Empty(t, monitor.flushReasons)
+	})
+}
+
+func TestEventBatch_flushReason(t *testing.T) {
+	now := time.Now()
+	batch := newEventBatch(config.BatchCfg{Size: 3, Linger: time.Second})
+
+	_, ok := batch.flushReason(now)
+	assert.False(t, ok)
+
+	batch.add("topic", &publisher.Event{}, now)
+
+	_, ok = batch.flushReason(now.Add(500 * time.Millisecond))
+	assert.False(t, ok)
+
+	reason, ok := batch.flushReason(now.Add(time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, flushReasonLinger, reason)
+}
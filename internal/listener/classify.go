@@ -0,0 +1,123 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+type tagger interface {
+	ColumnTags(ctx context.Context, schema, table string, cfg config.ClassificationCfg) (map[string]string, error)
+}
+
+// classifier derives the masked and excluded columns of the tables from their tags in the database catalog.
+// The columns are cached per table until the relation metadata is received again, e.g. after a schema change.
+type classifier struct {
+	cfg    config.ClassificationCfg
+	tagger tagger
+	tables map[string]classifiedColumns // schema.table -> columns
+}
+
+type classifiedColumns struct {
+	mask, exclude []string
+}
+
+// newClassifier returns nil if the classification is disabled.
+func newClassifier(cfg config.ClassificationCfg, t tagger) *classifier {
+	if !cfg.Enabled() {
+		return nil
+	}
+
+	return &classifier{
+		cfg:    cfg,
+		tagger: t,
+		tables: make(map[string]classifiedColumns),
+	}
+}
+
+// Invalidate drops the cached columns of the table, they are loaded again with its next event.
+func (c *classifier) Invalidate(schema, table string) {
+	if c == nil {
+		return
+	}
+
+	delete(c.tables, schema+"."+table)
+}
+
+// Apply masks and removes the classified columns of the event.
+// A failed catalog lookup stops the event, so sensitive values are never published unprotected.
+func (c *classifier) Apply(ctx context.Context, log *slog.Logger, p *publisher.ColumnProtector, event *publisher.Event) error {
+	if c == nil {
+		return nil
+	}
+
+	name := event.Schema + "." + event.Table
+
+	if _, ok := c.tables[name]; !ok {
+		if err := c.load(ctx, event.Schema, event.Table); err != nil {
+			return err
+		}
+
+		log.Debug(
+			"columns were classified",
+			slog.String("table", name),
+			slog.Any("mask", c.tables[name].mask),
+			slog.Any("exclude", c.tables[name].exclude),
+		)
+	}
+
+	columns := c.tables[name]
+	p.ApplyClassified(event, columns.mask, columns.exclude)
+
+	return nil
+}
+
+// load reads the tags of the table columns from the catalog and caches the classified columns.
+func (c *classifier) load(ctx context.Context, schema, table string) error {
+	if c == nil {
+		return nil
+	}
+
+	tags, err := c.tagger.ColumnTags(ctx, schema, table, c.cfg)
+	if err != nil {
+		return fmt.Errorf("column tags %s.%s: %w", schema, table, err)
+	}
+
+	c.tables[schema+"."+table] = c.classify(tags)
+
+	return nil
+}
+
+// classify matches the tags of the columns with the masked and excluded tags, the exclusion wins.
+func (c *classifier) classify(tags map[string]string) classifiedColumns {
+	var columns classifiedColumns
+
+	for column, value := range tags {
+		fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+
+		switch {
+		case slices.ContainsFunc(fields, matchesTag(c.cfg.Exclude)):
+			columns.exclude = append(columns.exclude, column)
+		case slices.ContainsFunc(fields, matchesTag(c.cfg.Mask)):
+			columns.mask = append(columns.mask, column)
+		}
+	}
+
+	slices.Sort(columns.mask)
+	slices.Sort(columns.exclude)
+
+	return columns
+}
+
+// matchesTag returns a function reporting whether the tag is one of the tags.
+func matchesTag(tags []string) func(string) bool {
+	return func(tag string) bool {
+		return slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) })
+	}
+}
@@ -0,0 +1,87 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+func TestListener_prepareEvent_Classification(t *testing.T) {
+	protection := config.ProtectionCfg{
+		Classification: config.ClassificationCfg{
+			Source:  config.ClassificationComment,
+			Mask:    []string{"pii"},
+			Exclude: []string{"secret"},
+		},
+	}
+
+	repo := new(repositoryMock)
+	repo.On("ColumnTags", mock.Anything, "public", "users", protection.Classification).
+		Return(map[string]string{"email": "PII", "password": "pii, secret", "name": "display name"}, nil).Once()
+
+	protector, err := publisher.NewColumnProtector(protection)
+	require.NoError(t, err)
+
+	l := &Listener{
+		cfg: &config.Config{
+			Listener:  &config.ListenerCfg{Protection: protection},
+			Publisher: &config.PublisherCfg{Topic: "wal"},
+		},
+		log:        slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		monitor:    new(monitorMock),
+		protector:  protector,
+		classifier: newClassifier(protection.Classification, repo),
+	}
+
+	user := func() *publisher.Event {
+		return &publisher.Event{
+			Schema:  "public",
+			Table:   "users",
+			Data:    map[string]any{"id": 1, "email": "john@example.com", "password": "hash", "name": "John"},
+			DataOld: map[string]any{"id": 1, "email": nil},
+		}
+	}
+
+	for _, name := range []string{"pii column is masked", "cached"} {
+		t.Run(name, func(t *testing.T) {
+			event := user()
+			_, err := l.prepareEvent(context.Background(), event)
+			require.NoError(t, err)
+
+			assert.Equal(t, map[string]any{"id": 1, "email": "***", "name": "John"}, event.Data)
+			assert.Equal(t, map[string]any{"id": 1, "email": nil}, event.DataOld)
+		})
+	}
+
+	t.Run("refreshed on schema change", func(t *testing.T) {
+		repo.On("ColumnTags", mock.Anything, "public", "users", protection.Classification).
+			Return(map[string]string{"name": "pii"}, nil).Once()
+
+		l.classifier.Invalidate("public", "users")
+
+		event := user()
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]any{"id": 1, "email": "john@example.com", "password": "hash", "name": "***"}, event.Data)
+	})
+
+	t.Run("lookup error", func(t *testing.T) {
+		repo.On("ColumnTags", mock.Anything, "public", "orders", protection.Classification).
+			Return(map[string]string(nil), errors.New("conn is busy")).Once()
+
+		_, err := l.prepareEvent(context.Background(), &publisher.Event{Schema: "public", Table: "orders"})
+		require.ErrorContains(t, err, "conn is busy")
+	})
+
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,91 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// deadLetterPublisher is implemented by publishers that can store dead-letter records.
+type deadLetterPublisher interface {
+	PublishDeadLetter(ctx context.Context, topic string, dl *publisher.DeadLetter) error
+}
+
+const problemKindContract = "contract"
+
+// deadLetterPublisher returns the publisher of the dead-letter cluster, or the publisher if it has dead-letter support.
+func (l *Listener) deadLetterPublisher() (deadLetterPublisher, bool) {
+	if l.deadLetter != nil {
+		return l.deadLetter, true
+	}
+
+	dlp, ok := l.publisher.(deadLetterPublisher)
+
+	return dlp, ok
+}
+
+// missingColumns returns the required columns absent from the insert or update event.
+func missingColumns(cfg config.RequiredColumnsCfg, event *publisher.Event) []string {
+	if event.Action != "INSERT" && event.Action != "UPDATE" {
+		return nil
+	}
+
+	var missing []string
+
+	for _, col := range cfg.Tables[event.Table] {
+		if _, ok := event.Data[col]; !ok {
+			missing = append(missing, col)
+		}
+	}
+
+	return missing
+}
+
+// checkContract validates the event against the required columns contract.
+// Returns false if the violating event was dead-lettered and must not be published.
+func (l *Listener) checkContract(ctx context.Context, subjectName string, event *publisher.Event) (bool, error) {
+	cfg := l.cfg.Listener.RequiredColumns
+
+	missing := missingColumns(cfg, event)
+	if len(missing) == 0 {
+		return true, nil
+	}
+
+	l.monitor.IncProblematicEvents(problemKindContract)
+
+	reason := "missing required columns: " + strings.Join(missing, ", ")
+
+	l.log.Warn(
+		"event violates the required columns contract",
+		slog.String("table", event.Table),
+		slog.String("action", event.Action),
+		slog.String("reason", reason),
+	)
+
+	if cfg.Action != config.ContractActionDLQ {
+		return true, nil
+	}
+
+	dlp, ok := l.deadLetterPublisher()
+	if !ok {
+		return false, errors.New("contract: publisher has no dead-letter support")
+	}
+
+	if err := dlp.PublishDeadLetter(ctx, l.cfg.Publisher.DeadLetterTopic, &publisher.DeadLetter{
+		Event:     event,
+		Topic:     subjectName,
+		Key:       event.Key,
+		Error:     reason,
+		Timestamp: time.Now(),
+	}); err != nil {
+		return false, fmt.Errorf("contract: publish dead letter: %w", err)
+	}
+
+	return false, nil
+}
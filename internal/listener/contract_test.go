@@ -0,0 +1,92 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+type deadLetterPublisherMock struct {
+	publisherMock
+}
+
+func (p *deadLetterPublisherMock) PublishDeadLetter(ctx context.Context, topic string, dl *publisher.DeadLetter) error {
+	args := p.Called(ctx, topic, dl)
+	return args.Error(0)
+}
+
+func TestListener_checkContract(t *testing.T) {
+	newListener := func(action config.ContractAction, pub eventPublisher) *Listener {
+		return &Listener{
+			cfg: &config.Config{
+				Listener: &config.ListenerCfg{RequiredColumns: config.RequiredColumnsCfg{
+					Tables: map[string][]string{"users": {"id", "email"}},
+					Action: action,
+				}},
+				Publisher: &config.PublisherCfg{DeadLetterTopic: "wal.dlq"},
+			},
+			log:       slog.New(slog.NewJSONHandler(io.Discard, nil)),
+			monitor:   new(monitorMock),
+			publisher: pub,
+		}
+	}
+
+	complete := &publisher.Event{Table: "users", Action: "INSERT", Data: map[string]any{"id": 1, "email": nil}}
+	missing := &publisher.Event{Table: "users", Action: "UPDATE", Data: map[string]any{"id": 1}}
+
+	t.Run("complete event", func(t *testing.T) {
+		ok, err := newListener(config.ContractActionDLQ, new(deadLetterPublisherMock)).
+			checkContract(context.Background(), "wal.public_users", complete)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("violation is logged", func(t *testing.T) {
+		ok, err := newListener(config.ContractActionLog, new(publisherMock)).
+			checkContract(context.Background(), "wal.public_users", missing)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("violation is dead-lettered", func(t *testing.T) {
+		pub := new(deadLetterPublisherMock)
+		pub.On("PublishDeadLetter", mock.Anything, "wal.dlq", mock.MatchedBy(func(dl *publisher.DeadLetter) bool {
+			return dl.Topic == "wal.public_users" && dl.Event == missing &&
+				dl.Error == "missing required columns: email"
+		})).Return(nil).Once()
+
+		ok, err := newListener(config.ContractActionDLQ, pub).
+			checkContract(context.Background(), "wal.public_users", missing)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("violation is dead-lettered to the cluster", func(t *testing.T) {
+		dlp := new(deadLetterPublisherMock)
+		dlp.On("PublishDeadLetter", mock.Anything, "wal.dlq", mock.Anything).Return(nil).Once()
+
+		l := newListener(config.ContractActionDLQ, new(publisherMock))
+		l.deadLetter = dlp
+
+		ok, err := l.checkContract(context.Background(), "wal.public_users", missing)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		dlp.AssertExpectations(t)
+	})
+
+	t.Run("deletes are not checked", func(t *testing.T) {
+		assert.Empty(t, missingColumns(
+			config.RequiredColumnsCfg{Tables: map[string][]string{"users": {"email"}}},
+			&publisher.Event{Table: "users", Action: "DELETE", DataOld: map[string]any{"id": 1}},
+		))
+	})
+}
@@ -0,0 +1,151 @@
+package listener
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+const (
+	defaultEnrichmentCacheSize = 10000
+	defaultEnrichmentCacheTTL  = 5 * time.Minute
+	problemKindEnrich          = "enrich"
+)
+
+type lookuper interface {
+	LookupValue(ctx context.Context, table, keyColumn, valueColumn string, key any) (any, bool, error)
+}
+
+// enricher adds values looked up in reference tables to the events.
+// Looked up values, including missing ones, are kept in a bounded LRU cache with TTL.
+type enricher struct {
+	lookups  map[string][]config.EnrichmentCfg
+	lookuper lookuper
+	size     int
+	ttl      time.Duration
+	now      func() time.Time
+	entries  map[lookupKey]*list.Element
+	lru      *list.List // front is the most recently used
+}
+
+type lookupKey struct {
+	table, keyColumn, valueColumn, key string
+}
+
+type lookupEntry struct {
+	key     lookupKey
+	value   any
+	found   bool
+	expires time.Time
+}
+
+// newEnricher returns nil if no enrichment is configured.
+func newEnricher(lookups map[string][]config.EnrichmentCfg, cfg config.EnrichmentCacheCfg, l lookuper) *enricher {
+	if len(lookups) == 0 {
+		return nil
+	}
+
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultEnrichmentCacheSize
+	}
+
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultEnrichmentCacheTTL
+	}
+
+	return &enricher{
+		lookups:  lookups,
+		lookuper: l,
+		size:     size,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[lookupKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Enrich adds the looked up values to the event. Events without the reference key or with a missing
+// reference are published without the value; lookup errors are logged and don't stop the event.
+func (e *enricher) Enrich(ctx context.Context, log *slog.Logger, m monitor, event *publisher.Event) {
+	if e == nil {
+		return
+	}
+
+	for _, cfg := range e.lookups[event.Table] {
+		ref, ok := event.Data[cfg.Column]
+		if !ok || ref == nil {
+			continue
+		}
+
+		value, found, err := e.lookup(ctx, cfg, ref)
+		if err != nil {
+			m.IncProblematicEvents(problemKindEnrich)
+			log.Warn(
+				"enrichment lookup failed",
+				slog.String("table", event.Table),
+				slog.String("field", cfg.Field),
+				"err", err,
+			)
+
+			continue
+		}
+
+		if !found {
+			log.Debug(
+				"enrichment reference not found",
+				slog.String("table", event.Table),
+				slog.String("field", cfg.Field),
+				slog.Any("key", ref),
+			)
+
+			continue
+		}
+
+		if event.Enrichment == nil {
+			event.Enrichment = make(map[string]any)
+		}
+
+		event.Enrichment[cfg.Field] = value
+	}
+}
+
+func (e *enricher) lookup(ctx context.Context, cfg config.EnrichmentCfg, ref any) (any, bool, error) {
+	key := lookupKey{table: cfg.Table, keyColumn: cfg.KeyColumn, valueColumn: cfg.ValueColumn, key: fmt.Sprintf("%v", ref)}
+	now := e.now()
+
+	if elem, ok := e.entries[key]; ok {
+		entry := elem.Value.(*lookupEntry)
+
+		if now.Before(entry.expires) {
+			e.lru.MoveToFront(elem)
+			return entry.value, entry.found, nil
+		}
+
+		e.remove(elem)
+	}
+
+	value, found, err := e.lookuper.LookupValue(ctx, cfg.Table, cfg.KeyColumn, cfg.ValueColumn, ref)
+	if err != nil {
+		return nil, false, err
+	}
+
+	e.entries[key] = e.lru.PushFront(&lookupEntry{key: key, value: value, found: found, expires: now.Add(e.ttl)})
+
+	for e.lru.Len() > e.size {
+		e.remove(e.lru.Back())
+	}
+
+	return value, found, nil
+}
+
+func (e *enricher) remove(elem *list.Element) {
+	e.lru.Remove(elem)
+	delete(e.entries, elem.Value.(*lookupEntry).key)
+}
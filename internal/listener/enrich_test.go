@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+func TestListener_prepareEvent_Enrichment(t *testing.T) {
+	lookups := map[string][]config.EnrichmentCfg{
+		"orders": {{
+			Column:      "customer_id",
+			Table:       "public.customers",
+			KeyColumn:   "id",
+			ValueColumn: "display_name",
+			Field:       "customer_name",
+		}},
+	}
+
+	repo := new(repositoryMock)
+	repo.On("LookupValue", mock.Anything, "public.customers", "id", "display_name", 42).
+		Return("John Doe", true, nil).Once()
+	repo.On("LookupValue", mock.Anything, "public.customers", "id", "display_name", 43).
+		Return(nil, false, nil).Once()
+	repo.On("LookupValue", mock.Anything, "public.customers", "id", "display_name", 44).
+		Return(nil, false, errors.New("conn is busy")).Once()
+
+	l := &Listener{
+		cfg: &config.Config{
+			Listener:  &config.ListenerCfg{Enrichment: lookups},
+			Publisher: &config.PublisherCfg{Topic: "wal"},
+		},
+		log:      slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		monitor:  new(monitorMock),
+		enricher: newEnricher(lookups, config.EnrichmentCacheCfg{}, repo),
+	}
+
+	order := func(customerID any) *publisher.Event {
+		return &publisher.Event{Table: "orders", Data: map[string]any{"id": 1, "customer_id": customerID}}
+	}
+
+	t.Run("enriched", func(t *testing.T) {
+		event := order(42)
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]any{"customer_name": "John Doe"}, event.Enrichment)
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		event := order(42)
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]any{"customer_name": "John Doe"}, event.Enrichment)
+	})
+
+	t.Run("missing reference", func(t *testing.T) {
+		event := order(43)
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Nil(t, event.Enrichment)
+	})
+
+	t.Run("lookup error", func(t *testing.T) {
+		event := order(44)
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Nil(t, event.Enrichment)
+	})
+
+	t.Run("null reference", func(t *testing.T) {
+		event := order(nil)
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Nil(t, event.Enrichment)
+	})
+
+	repo.AssertExpectations(t)
+}
+
+func TestEnricher_lookup_Cache(t *testing.T) {
+	cfg := config.EnrichmentCfg{Table: "customers", KeyColumn: "id", ValueColumn: "name"}
+
+	repo := new(repositoryMock)
+	repo.On("LookupValue", mock.Anything, "customers", "id", "name", mock.Anything).Return("name", true, nil)
+
+	now := time.Now()
+	e := newEnricher(map[string][]config.EnrichmentCfg{"orders": {cfg}}, config.EnrichmentCacheCfg{Size: 2, TTL: time.Minute}, repo)
+	e.now = func() time.Time { return now }
+
+	for _, key := range []int{1, 2, 1, 3} {
+		_, _, err := e.lookup(context.Background(), cfg, key)
+		require.NoError(t, err)
+	}
+
+	// 2 is the least recently used and evicted once 3 is cached.
+	assert.Equal(t, 2, e.lru.Len())
+	assert.Contains(t, e.entries, lookupKey{table: "customers", keyColumn: "id", valueColumn: "name", key: "1"})
+	assert.NotContains(t, e.entries, lookupKey{table: "customers", keyColumn: "id", valueColumn: "name", key: "2"})
+	repo.AssertNumberOfCalls(t, "LookupValue", 3)
+
+	now = now.Add(2 * time.Minute)
+
+	_, _, err := e.lookup(context.Background(), cfg, 1)
+	require.NoError(t, err)
+	repo.AssertNumberOfCalls(t, "LookupValue", 4)
+}
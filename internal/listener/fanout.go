@@ -0,0 +1,208 @@
+package listener
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+const (
+	actionDelete   = "DELETE"
+	actionTruncate = "TRUNCATE"
+	actionMessage  = "MESSAGE"
+)
+
+const problemKindCompactKey = "compact_key"
+
+// eventShape how the events are shaped for a topic.
+type eventShape struct {
+	actions   []string              // published actions, all when empty
+	compacted bool                  // keyed upserts and tombstones
+	deleteOld config.OldColumnsMode // old row data of deletes, full when empty
+	marshaler publisher.Marshaler   // format of the topic, the publisher format when nil
+}
+
+// destination a named destination of the table events.
+type destination struct {
+	topic string
+	shape eventShape
+}
+
+// newDestinations returns the destinations per schema_table, sorted by name.
+// A destination format is serialized by its own marshaler with the other publisher settings.
+func newDestinations(cfg *config.Config) map[string][]destination {
+	if len(cfg.Listener.Destinations) == 0 {
+		return nil
+	}
+
+	destinations := make(map[string][]destination, len(cfg.Listener.Destinations))
+
+	for table, named := range cfg.Listener.Destinations {
+		for _, name := range slices.Sorted(maps.Keys(named)) {
+			d := named[name]
+			shape := eventShape{actions: d.Actions, compacted: d.Compacted, deleteOld: d.DeleteOldColumns}
+
+			if d.Format != "" && cfg.Publisher != nil {
+				pCfg := *cfg.Publisher
+				pCfg.Format = d.Format
+
+				// the format is validated by the config.
+				shape.marshaler, _ = publisher.NewPublisherMarshaler(&pCfg)
+			}
+
+			destinations[table] = append(destinations[table], destination{topic: d.Topic, shape: shape})
+		}
+	}
+
+	return destinations
+}
+
+// messages returns the messages of the prepared event: the event on its topic and on the fanout topics
+// of the table, or on the destinations of the table. The event is shaped per topic; it's copied only when
+// it's reshaped, so all returned events can be published concurrently. A logical message goes to its topic only.
+func (l *Listener) messages(subjectName string, event *publisher.Event) []publisher.Message {
+	if event.Action == actionMessage {
+		msg := event
+
+		if l.cfg.Listener.OpField == config.OpFieldInstead {
+			msg = ownCopy(event, event)
+			msg.Action = ""
+		}
+
+		return []publisher.Message{{Topic: subjectName, Event: msg}}
+	}
+
+	if destinations, ok := l.destinations[event.Schema+"_"+event.Table]; ok {
+		msgs := make([]publisher.Message, 0, len(destinations))
+
+		for _, d := range destinations {
+			if shaped := l.shapeEvent(d.topic, d.shape, event); shaped != nil {
+				msgs = append(msgs, publisher.Message{Topic: publisher.TopicName(l.cfg, d.topic), Event: shaped})
+			}
+		}
+
+		return msgs
+	}
+
+	route := event.Route(l.topicsMap(), l.cfg.Listener.TopicTemplate)
+	fanout := l.cfg.Listener.Fanout[event.Schema+"_"+event.Table]
+
+	msgs := make([]publisher.Message, 0, 1+len(fanout))
+
+	if shaped := l.shapeEvent(route, l.topicShape(route), event); shaped != nil {
+		msgs = append(msgs, publisher.Message{Topic: subjectName, Event: shaped})
+	}
+
+	for _, topic := range fanout {
+		if shaped := l.shapeEvent(topic, l.topicShape(topic), event); shaped != nil {
+			msgs = append(msgs, publisher.Message{Topic: publisher.TopicName(l.cfg, topic), Event: shaped})
+		}
+	}
+
+	return msgs
+}
+
+// topicShape returns the shape of the events published to the topic.
+func (l *Listener) topicShape(topic string) eventShape {
+	topicCfg := l.cfg.Listener.Topics[topic]
+
+	return eventShape{
+		actions:   topicCfg.Actions,
+		compacted: topicCfg.Compacted,
+		deleteOld: l.cfg.Listener.DeleteOldColumns[topic],
+	}
+}
+
+// shapeEvent returns the event as published to the topic, nil if the topic doesn't take it.
+func (l *Listener) shapeEvent(topic string, shape eventShape, event *publisher.Event) *publisher.Event {
+	if len(shape.actions) > 0 && !slices.ContainsFunc(shape.actions, func(action string) bool {
+		return strings.EqualFold(action, event.Action)
+	}) {
+		return nil
+	}
+
+	shaped := shapeDelete(shape.deleteOld, event)
+
+	if shape.compacted {
+		if shaped = l.compact(topic, shaped); shaped == nil {
+			return nil
+		}
+	}
+
+	if l.cfg.Listener.OpField == config.OpFieldInstead {
+		shaped = ownCopy(shaped, event)
+		shaped.Action = ""
+	}
+
+	if shape.marshaler != nil {
+		shaped = ownCopy(shaped, event)
+		shaped.Marshaler = shape.marshaler
+	}
+
+	return shaped
+}
+
+// compact returns the keyed event for the compacted topic: a tombstone for a delete, nil for a truncate
+// or an event without a key. The row key columns are the key if no message key is configured.
+func (l *Listener) compact(topic string, event *publisher.Event) *publisher.Event {
+	if event.Action == actionTruncate {
+		return nil
+	}
+
+	key := event.Key
+	if key == "" {
+		key = event.RowKey()
+	}
+
+	if key == "" {
+		l.monitor.IncProblematicEvents(problemKindCompactKey)
+		l.log.Warn(
+			"event without key was skipped for the compacted topic",
+			slog.String("topic", topic),
+			slog.String("table", event.Table),
+		)
+
+		return nil
+	}
+
+	compacted := *event
+	compacted.Key = key
+	compacted.Tombstone = event.Action == actionDelete
+
+	return &compacted
+}
+
+// ownCopy returns the shaped event if it's already a copy of the prepared event, a copy otherwise.
+func ownCopy(shaped, event *publisher.Event) *publisher.Event {
+	if shaped != event {
+		return shaped
+	}
+
+	cp := *event
+
+	return &cp
+}
+
+// shapeDelete narrows the old data of the delete event.
+func shapeDelete(mode config.OldColumnsMode, event *publisher.Event) *publisher.Event {
+	if event.Action != actionDelete || mode == "" || mode == config.OldColumnsFull {
+		return event
+	}
+
+	shaped := *event
+	shaped.DataOld = make(map[string]any)
+
+	if mode == config.OldColumnsKeys {
+		for _, key := range event.KeyColumns {
+			if val, ok := event.DataOld[key]; ok {
+				shaped.DataOld[key] = val
+			}
+		}
+	}
+
+	return &shaped
+}
@@ -0,0 +1,232 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+func TestListener_publishEvents_DeleteShapePerTopic(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	newWAL := func() *tx.WAL {
+		pool := &sync.Pool{New: func() any { return &publisher.Event{} }}
+		txWAL := tx.NewWAL(logger, pool, new(monitorMock), &config.ListenerCfg{}, nil)
+		now := time.Now()
+		txWAL.CommitTime = &now
+		txWAL.Actions = []tx.ActionData{{
+			Schema: "public",
+			Table:  "users",
+			Kind:   tx.ActionKindDelete,
+			OldColumns: []tx.Column{
+				tx.InitColumn(logger, "id", 1, 23, true),
+				tx.InitColumn(logger, "email", "a@b.c", 25, false),
+			},
+		}}
+
+		return txWAL
+	}
+
+	for _, size := range []int{0, 10} {
+		cfg := &config.Config{
+			Listener: &config.ListenerCfg{
+				Filter: config.FilterStruct{
+					Tables: map[string][]string{"users": {"delete"}},
+				},
+				Fanout: map[string][]string{"public_users": {"search"}},
+				DeleteOldColumns: map[string]config.OldColumnsMode{
+					"public_users": config.OldColumnsKeys,
+				},
+			},
+			Publisher: &config.PublisherCfg{Topic: "wal", Batch: config.BatchCfg{Size: size}},
+		}
+
+		got := make(map[string]map[string]any)
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			got[args.String(1)] = args.Get(2).(*publisher.Event).DataOld
+		}).Return(nil).Twice()
+
+		l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub}
+
+		require.NoError(t, l.publishEvents(context.Background(), newWAL()))
+		assert.Equal(t, map[string]map[string]any{
+			"wal.public_users": {"id": 1},
+			"wal.search":       {"id": 1, "email": "a@b.c"},
+		}, got, "batch size %d", size)
+		pub.AssertExpectations(t)
+	}
+}
+
+func TestListener_messages_OpInstead(t *testing.T) {
+	l := &Listener{cfg: &config.Config{
+		Listener:  &config.ListenerCfg{OpField: config.OpFieldInstead},
+		Publisher: &config.PublisherCfg{Topic: "wal"},
+	}}
+
+	event := &publisher.Event{Schema: "public", Table: "users", Action: "INSERT", Op: "c"}
+
+	msgs := l.messages("wal.public_users", event)
+	require.Len(t, msgs, 1)
+	assert.Empty(t, msgs[0].Event.Action)
+	assert.Equal(t, "c", msgs[0].Event.Op)
+	assert.Equal(t, "INSERT", event.Action, "the prepared event is not changed")
+}
+
+func TestListener_publishEvents_CompactedAndAudit(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	pool := &sync.Pool{New: func() any { return &publisher.Event{} }}
+	txWAL := tx.NewWAL(logger, pool, new(monitorMock), &config.ListenerCfg{}, nil)
+	now := time.Now()
+	txWAL.CommitTime = &now
+
+	row := func(status string) []tx.Column {
+		return []tx.Column{
+			tx.InitColumn(logger, "id", 7, 23, true),
+			tx.InitColumn(logger, "status", status, 25, false),
+		}
+	}
+
+	txWAL.Actions = []tx.ActionData{
+		{Schema: "public", Table: "orders", Kind: tx.ActionKindUpdate, NewColumns: row("paid")},
+		{Schema: "public", Table: "orders", Kind: tx.ActionKindDelete, OldColumns: row("paid")},
+	}
+
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			Filter: config.FilterStruct{
+				Tables: map[string][]string{"orders": {"update", "delete"}},
+			},
+			Fanout: map[string][]string{"public_orders": {"orders_audit"}},
+			Topics: map[string]config.TopicCfg{
+				"public_orders": {Actions: []string{"insert", "update", "delete"}, Compacted: true},
+			},
+		},
+		Publisher: &config.PublisherCfg{Topic: "wal"},
+	}
+
+	type message struct {
+		topic, action, key string
+		tombstone          bool
+	}
+
+	var got []message
+
+	pub := new(publisherMock)
+	pub.On("Publish", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		event := args.Get(2).(*publisher.Event)
+		got = append(got, message{args.String(1), event.Action, event.Key, event.Tombstone})
+	}).Return(nil)
+
+	l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub}
+
+	require.NoError(t, l.publishEvents(context.Background(), txWAL))
+	assert.Equal(t, []message{
+		{topic: "wal.public_orders", action: "UPDATE", key: "7"},
+		{topic: "wal.orders_audit", action: "UPDATE"},
+		{topic: "wal.public_orders", action: "DELETE", key: "7", tombstone: true},
+		{topic: "wal.orders_audit", action: "DELETE"},
+	}, got)
+}
+
+func TestListener_publishEvents_LogicalMessage(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	pool := &sync.Pool{New: func() any { return &publisher.Event{} }}
+	txWAL := tx.NewWAL(logger, pool, new(monitorMock), &config.ListenerCfg{}, nil)
+	txWAL.AddMessage(0, tx.Message{LSN: 9, Prefix: "audit", Content: []byte("ping")}, time.Now())
+
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			Fanout:          map[string][]string{"public_users": {"search"}},
+			LogicalMessages: config.LogicalMessagesCfg{Enabled: true, Topic: "messages"},
+		},
+		Publisher: &config.PublisherCfg{Topic: "wal"},
+	}
+
+	pub := new(publisherMock)
+	pub.On("Publish", mock.Anything, "wal.messages", mock.MatchedBy(func(event *publisher.Event) bool {
+		return event.Action == "MESSAGE" && event.Data["prefix"] == "audit" && event.Data["content"] == "ping"
+	})).Return(nil).Once()
+
+	l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub}
+
+	require.NoError(t, l.publishEvents(context.Background(), txWAL))
+	pub.AssertExpectations(t)
+}
+
+func TestListener_publishEvents_Destinations(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	pool := &sync.Pool{New: func() any { return &publisher.Event{} }}
+	txWAL := tx.NewWAL(logger, pool, new(monitorMock), &config.ListenerCfg{}, nil)
+	now := time.Now()
+	txWAL.CommitTime = &now
+
+	row := []tx.Column{
+		tx.InitColumn(logger, "id", 7, 23, true),
+		tx.InitColumn(logger, "status", "paid", 25, false),
+	}
+
+	txWAL.Actions = []tx.ActionData{
+		{Schema: "public", Table: "orders", Kind: tx.ActionKindInsert, NewColumns: row},
+		{Schema: "public", Table: "orders", Kind: tx.ActionKindDelete, OldColumns: row},
+	}
+
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			Filter: config.FilterStruct{
+				Tables: map[string][]string{"orders": {"insert", "delete"}},
+			},
+			Destinations: map[string]map[string]config.DestinationCfg{
+				"public_orders": {
+					"state":     {Topic: "orders_state", Compacted: true},
+					"changelog": {Topic: "orders_log", Format: config.FormatMsgPack, DeleteOldColumns: config.OldColumnsKeys},
+				},
+			},
+		},
+		Publisher: &config.PublisherCfg{Type: config.PublisherTypeKafka, Topic: "wal"},
+	}
+
+	type message struct {
+		topic, contentType string
+		tombstone          bool
+		dataOld            map[string]any
+	}
+
+	var got []message
+
+	pub := new(publisherMock)
+	pub.On("Publish", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		event := args.Get(2).(*publisher.Event)
+
+		var contentType string
+		if event.Marshaler != nil {
+			contentType = event.Marshaler.ContentType()
+		}
+
+		got = append(got, message{args.String(1), contentType, event.Tombstone, event.DataOld})
+	}).Return(nil)
+
+	l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub, destinations: newDestinations(cfg)}
+
+	require.NoError(t, l.publishEvents(context.Background(), txWAL))
+	assert.Equal(t, []message{
+		{topic: "wal.orders_log", contentType: "application/msgpack", dataOld: map[string]any{}},
+		{topic: "wal.orders_state", dataOld: map[string]any{}},
+		{topic: "wal.orders_log", contentType: "application/msgpack", dataOld: map[string]any{"id": 7}},
+		{topic: "wal.orders_state", tombstone: true, dataOld: map[string]any{"id": 7, "status": "paid"}},
+	}, got, "the table topic is replaced by the destinations")
+}
@@ -0,0 +1,205 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx"
+
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+)
+
+// lagState the replication lag crossing the threshold and the backlog dropped meanwhile.
+type lagState struct {
+	behind  bool
+	fromLSN uint64         // commit LSN of the first fast-forwarded transaction
+	toLSN   uint64         // commit LSN of the last fast-forwarded transaction
+	skipped map[string]int // schema_table -> dropped changes
+}
+
+// checkLag records the replication lag of the received WAL message. The alert is raised when the lag exceeds
+// the threshold; when it falls below again, the backlog dropped by the fast-forward is summarized.
+// The server WAL end is zero in messages that don't report it, the lag is not known then.
+func (l *Listener) checkLag(walStart, serverWalEnd uint64) {
+	cfg := l.cfg.Listener.SlotLag
+	if cfg.Threshold == 0 || serverWalEnd == 0 {
+		return
+	}
+
+	var lag uint64
+	if serverWalEnd > walStart {
+		lag = serverWalEnd - walStart
+	}
+
+	l.monitor.SetReplicationLag(lag)
+
+	switch behind := lag > cfg.Threshold; {
+	case behind && !l.lag.behind:
+		l.lag.behind = true
+		l.monitor.IncSlotLagAlerts()
+		l.log.Warn(
+			"replication lag exceeds the threshold",
+			slog.Uint64("lag", lag),
+			slog.Uint64("threshold", cfg.Threshold),
+			slog.Bool("fast_forward", cfg.FastForward),
+		)
+	case !behind && l.lag.behind:
+		l.lag.behind = false
+		l.log.Info("replication lag is below the threshold again", slog.Uint64("lag", lag))
+		l.summarizeFastForward()
+	}
+}
+
+// fastForward drops the changes of the skippable tables from the committed transaction while the replication
+// is behind, the slot is acknowledged past them without publishing. Other tables are never dropped.
+func (l *Listener) fastForward(txWAL *tx.WAL) {
+	cfg := l.cfg.Listener.SlotLag
+	if !cfg.FastForward || !l.lag.behind {
+		return
+	}
+
+	kept := txWAL.Actions[:0]
+
+	for _, action := range txWAL.Actions {
+		table := action.Schema + "_" + action.Table
+
+		if !slices.Contains(cfg.SkippableTables, table) {
+			kept = append(kept, action)
+			continue
+		}
+
+		if l.lag.skipped == nil {
+			l.lag.skipped = make(map[string]int)
+		}
+
+		l.lag.skipped[table]++
+		l.monitor.IncFilterSkippedEvents(action.Table)
+	}
+
+	if len(kept) < len(txWAL.Actions) {
+		if l.lag.fromLSN == 0 {
+			l.lag.fromLSN = uint64(txWAL.LSN)
+		}
+
+		l.lag.toLSN = uint64(txWAL.LSN)
+	}
+
+	txWAL.Actions = kept
+}
+
+// summarizeFastForward logs the dropped backlog per table and resets it.
+func (l *Listener) summarizeFastForward() {
+	if len(l.lag.skipped) == 0 {
+		return
+	}
+
+	dropped := make([]any, 0, len(l.lag.skipped))
+
+	for _, table := range slices.Sorted(maps.Keys(l.lag.skipped)) {
+		dropped = append(dropped, slog.Int(table, l.lag.skipped[table]))
+	}
+
+	l.log.Warn(
+		"backlog of skippable tables was dropped by the fast-forward",
+		slog.String("from_lsn", pgx.FormatLSN(l.lag.fromLSN)),
+		slog.String("to_lsn", pgx.FormatLSN(l.lag.toLSN)),
+		slog.Group("dropped", dropped...),
+	)
+
+	l.lag = lagState{}
+}
+
+type serverWAL interface {
+	CurrentLSN(ctx context.Context) (uint64, error)
+}
+
+// ServerWAL reads the current WAL position of the server on its own connection, so the polls don't compete
+// with the replication for the connection of the repository. The connection is reopened after a failure.
+type ServerWAL struct {
+	cfg  pgx.ConnConfig
+	conn *pgx.Conn
+}
+
+// NewServerWAL returns a ServerWAL connecting on the first read.
+func NewServerWAL(cfg pgx.ConnConfig) *ServerWAL {
+	return &ServerWAL{cfg: cfg}
+}
+
+// CurrentLSN returns the current WAL write position of the server, implements serverWAL.
+func (s *ServerWAL) CurrentLSN(ctx context.Context) (uint64, error) {
+	if s.conn == nil {
+		conn, err := pgx.Connect(s.cfg)
+		if err != nil {
+			return 0, fmt.Errorf("db connection: %w", err)
+		}
+
+		s.conn = conn
+	}
+
+	var lsn string
+
+	if err := s.conn.QueryRowEx(ctx, "SELECT pg_current_wal_lsn()::text", nil).Scan(&lsn); err != nil {
+		_ = s.Close()
+		return 0, fmt.Errorf("current wal lsn: %w", err)
+	}
+
+	return pgx.ParseLSN(lsn)
+}
+
+// Close closes the connection.
+func (s *ServerWAL) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// PollAppliedLag exports the WAL not yet applied (the current server WAL position minus the acknowledged one)
+// every slot lag interval until the context is done. Unlike the replication lag it's updated while no messages arrive.
+func (l *Listener) PollAppliedLag(ctx context.Context, wal serverWAL) {
+	interval := l.cfg.Listener.SlotLag.Interval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.updateAppliedLag(ctx, wal)
+		}
+	}
+}
+
+// updateAppliedLag exports the applied lag, it's unknown until the listener has a position.
+func (l *Listener) updateAppliedLag(ctx context.Context, wal serverWAL) {
+	current, err := wal.CurrentLSN(ctx)
+	if err != nil {
+		l.log.Warn("read server wal position", "err", err)
+		return
+	}
+
+	applied := l.readLSN()
+	if applied == 0 {
+		return
+	}
+
+	var lag uint64
+	if current > applied {
+		lag = current - applied
+	}
+
+	l.monitor.SetAppliedLag(lag)
+}
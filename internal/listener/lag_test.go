@@ -0,0 +1,127 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+)
+
+func TestListener_fastForward(t *testing.T) {
+	newWAL := func(lsn int64) *tx.WAL {
+		txWAL := tx.NewWAL(slog.New(slog.NewJSONHandler(io.Discard, nil)), nil, new(monitorMock), &config.ListenerCfg{}, nil)
+		txWAL.LSN = lsn
+		txWAL.Actions = []tx.ActionData{
+			{Schema: "public", Table: "orders", Kind: tx.ActionKindInsert},
+			{Schema: "public", Table: "audit_log", Kind: tx.ActionKindInsert},
+			{Schema: "public", Table: "audit_log", Kind: tx.ActionKindInsert},
+		}
+
+		return txWAL
+	}
+	tables := func(txWAL *tx.WAL) []string {
+		var got []string
+
+		for _, action := range txWAL.Actions {
+			got = append(got, action.Table)
+		}
+
+		return got
+	}
+
+	t.Run("high lag", func(t *testing.T) {
+		var logs bytes.Buffer
+
+		monitor := new(monitorMock)
+		l := &Listener{
+			cfg: &config.Config{Listener: &config.ListenerCfg{SlotLag: config.SlotLagCfg{
+				Threshold:       1 << 20,
+				FastForward:     true,
+				SkippableTables: []string{"public_audit_log"},
+			}}},
+			log:     slog.New(slog.NewJSONHandler(&logs, nil)),
+			monitor: monitor,
+		}
+
+		l.checkLag(1000, 1000+1<<30)
+		assert.Equal(t, uint64(1<<30), monitor.replicationLag)
+		assert.Equal(t, 1, monitor.slotLagAlerts)
+
+		txWAL := newWAL(2000)
+		l.fastForward(txWAL)
+		assert.Equal(t, []string{"orders"}, tables(txWAL), "critical tables are never skipped")
+
+		l.checkLag(3000, 3000+1<<30)
+		assert.Equal(t, 1, monitor.slotLagAlerts, "alerted once while behind")
+
+		txWAL = newWAL(4000)
+		l.fastForward(txWAL)
+		assert.Equal(t, []string{"orders"}, tables(txWAL))
+		assert.Equal(t, map[string]int{"audit_log": 4}, monitor.filterSkipped)
+
+		l.checkLag(5000, 5100)
+		assert.Equal(t, uint64(100), monitor.replicationLag)
+		assert.Contains(t, logs.String(), `"from_lsn":"0/7D0","to_lsn":"0/FA0","dropped":{"public_audit_log":4}`)
+
+		txWAL = newWAL(6000)
+		l.fastForward(txWAL)
+		assert.Equal(t, []string{"orders", "audit_log", "audit_log"}, tables(txWAL), "caught up")
+	})
+
+	t.Run("alert only", func(t *testing.T) {
+		monitor := new(monitorMock)
+		l := &Listener{
+			cfg: &config.Config{Listener: &config.ListenerCfg{SlotLag: config.SlotLagCfg{
+				Threshold:       1 << 20,
+				SkippableTables: []string{"public_audit_log"},
+			}}},
+			log:     slog.New(slog.NewJSONHandler(io.Discard, nil)),
+			monitor: monitor,
+		}
+
+		l.checkLag(1000, 1000+1<<30)
+		assert.Equal(t, 1, monitor.slotLagAlerts)
+
+		txWAL := newWAL(2000)
+		l.fastForward(txWAL)
+		assert.Len(t, txWAL.Actions, 3)
+	})
+}
+
+type serverWALFunc func(ctx context.Context) (uint64, error)
+
+func (f serverWALFunc) CurrentLSN(ctx context.Context) (uint64, error) {
+	return f(ctx)
+}
+
+func TestListener_updateAppliedLag(t *testing.T) {
+	monitor := new(monitorMock)
+	l := &Listener{
+		cfg:     &config.Config{Listener: &config.ListenerCfg{}},
+		log:     slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		monitor: monitor,
+	}
+
+	current := serverWALFunc(func(context.Context) (uint64, error) { return 5000, nil })
+
+	l.updateAppliedLag(context.Background(), current)
+	assert.Empty(t, monitor.appliedLag, "unknown before the listener has a position")
+
+	l.setLSN(3000)
+	l.updateAppliedLag(context.Background(), current)
+
+	l.setLSN(6000)
+	l.updateAppliedLag(context.Background(), current)
+
+	l.updateAppliedLag(context.Background(), serverWALFunc(func(context.Context) (uint64, error) {
+		return 0, errors.New("connection refused")
+	}))
+	assert.Equal(t, []uint64{2000, 0}, monitor.appliedLag, "failed reads are skipped")
+}
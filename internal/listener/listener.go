@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -22,12 +23,20 @@ import (
 )
 
 // Logical decoding plugin.
-const pgOutputPlugin = "pgoutput"
+const (
+	pgOutputPlugin         = "pgoutput"
+	defaultShutdownTimeout = 10 * time.Second
+)
 
 type eventPublisher interface {
 	Publish(context.Context, string, *publisher.Event) error
 }
 
+// flusher is implemented by publishers buffering the events, the buffer is flushed before the events are acknowledged.
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
 type parser interface {
 	ParseWalMessage([]byte, *tx.WAL) error
 }
@@ -47,14 +56,36 @@ type repository interface {
 	GetSlotLSN(ctx context.Context, slotName string) (string, error)
 	NewStandbyStatus(walPositions ...uint64) (status *pgx.StandbyStatus, err error)
 	IsReplicationActive(ctx context.Context, slotName string) (bool, error)
+	LoadRelation(ctx context.Context, relationID int32) (tx.Relation, error)
+	RelationID(ctx context.Context, table string) (int32, error)
+	TableColumns(ctx context.Context, table string) ([]string, error)
+	ColumnTags(ctx context.Context, schema, table string, cfg config.ClassificationCfg) (map[string]string, error)
+	IsUniqueColumn(ctx context.Context, table, column string) (bool, error)
+	LookupValue(ctx context.Context, table, keyColumn, valueColumn string, key any) (any, bool, error)
+	ReadSnapshot(
+		ctx context.Context,
+		tables []string,
+		batchSize int,
+		fn func(rel tx.Relation, rows [][]tx.TupleData) error,
+	) (SnapshotPoint, error)
 	IsAlive() bool
 	Close() error
 }
 
 type monitor interface {
-	IncPublishedEvents(subject, table string)
+	IncPublishedEvents(subject, table, action string)
+	IncPublishErrors(table string)
+	ObservePublishLatency(table string, latency time.Duration)
 	IncFilterSkippedEvents(table string)
 	IncProblematicEvents(kind string)
+	SetRelationCacheSize(size int)
+	IncTransitionSkippedEvents(table string)
+	ObserveBatchFlush(reason string, size int, duration time.Duration)
+	IncLongTransactions()
+	IncEventPool(op string)
+	SetReplicationLag(lag uint64)
+	SetAppliedLag(lag uint64)
+	IncSlotLagAlerts()
 }
 
 // Listener main service struct.
@@ -67,8 +98,22 @@ type Listener struct {
 	replicator replication
 	repository repository
 	parser     parser
+	protector  *publisher.ColumnProtector
+	router     *TopicRouter
+	deadLetter deadLetterPublisher // the dead-letter cluster, the publisher itself when nil
+	enricher   *enricher
+	classifier *classifier
+	source     *publisher.EventSource
 	lsn        uint64
+	state      *StreamState
 	isAlive    atomic.Bool
+	// feedbackInterval is the minimum time between the standby statuses acknowledging messages.
+	feedbackInterval time.Duration
+	lastFeedback     time.Time
+	// destinations of the tables publishing to named destinations instead of their topic.
+	destinations map[string][]destination
+	// lag is the replication lag state, the fast-forward drops the backlog of the skippable tables while behind.
+	lag lagState
 }
 
 var (
@@ -86,8 +131,23 @@ func NewWalListener(
 	pub eventPublisher,
 	parser parser,
 	monitor monitor,
+	protector *publisher.ColumnProtector,
+	router *TopicRouter,
+	deadLetter deadLetterPublisher,
+	state *StreamState,
 ) *Listener {
+	if state == nil {
+		state = NewStreamState()
+	}
+
 	return &Listener{
+		state:      state,
+		protector:  protector,
+		router:     router,
+		deadLetter: deadLetter,
+		enricher:   newEnricher(cfg.Listener.Enrichment, cfg.Listener.EnrichmentCache, repo),
+		classifier: newClassifier(cfg.Listener.Protection.Classification, repo),
+		source:     publisher.NewEventSource(cfg.Listener.Source),
 		log:        log,
 		monitor:    monitor,
 		cfg:        cfg,
@@ -95,6 +155,9 @@ func NewWalListener(
 		repository: repo,
 		replicator: repl,
 		parser:     parser,
+
+		feedbackInterval: cfg.Listener.FeedbackInterval,
+		destinations:     newDestinations(cfg),
 	}
 }
 
@@ -128,6 +191,13 @@ func (l *Listener) InitHandlers(ctx context.Context) {
 	l.log.Debug("web handlers were initialised", slog.String("addr", addr))
 
 	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		l.log.Error("web server shutdown failed", "err", err)
+	}
 }
 
 const contentTypeTextPlain = "text/plain"
@@ -189,6 +259,14 @@ func (l *Listener) Process(ctx context.Context) error {
 		logger.Warn("publication creation was skipped", "err", err)
 	}
 
+	if err := l.checkBusinessKey(ctx); err != nil {
+		return fmt.Errorf("business key: %w", err)
+	}
+
+	if err := l.checkMessageID(ctx); err != nil {
+		return fmt.Errorf("message id: %w", err)
+	}
+
 	slotIsExists, err := l.slotIsExists(ctx)
 	if err != nil {
 		return fmt.Errorf("slot is exists: %w", err)
@@ -208,6 +286,17 @@ func (l *Listener) Process(ctx context.Context) error {
 		l.setLSN(lsn)
 
 		logger.Info("new slot was created", slog.String("slot", l.cfg.Listener.SlotName))
+
+		if len(l.cfg.Listener.Snapshot.Tables) > 0 {
+			if err := l.initialSnapshot(ctx); err != nil {
+				// the slot is dropped, so the snapshot is taken again with a new slot by the next attempt.
+				if dropErr := l.replicator.DropReplicationSlot(l.cfg.Listener.SlotName); dropErr != nil {
+					logger.Error("drop replication slot failed", "err", dropErr)
+				}
+
+				return fmt.Errorf("initial snapshot: %w", err)
+			}
+		}
 	} else {
 		logger.Info("slot already exists, LSN updated")
 	}
@@ -221,19 +310,29 @@ func (l *Listener) Process(ctx context.Context) error {
 		return errReplDidNotStart
 	}
 
-	group := new(errgroup.Group)
+	// a failure of either goroutine cancels the other one, so the service can be reconnected.
+	group, groupCtx := errgroup.WithContext(ctx)
 
 	group.Go(func() error {
-		return l.Stream(ctx)
+		return l.Stream(groupCtx)
 	})
 	group.Go(func() error {
-		return l.checkConnection(ctx)
+		return l.checkConnection(groupCtx)
 	})
 
 	if err = group.Wait(); err != nil {
 		return fmt.Errorf("group: %w", err)
 	}
 
+	// the stream has stopped, the last position is acknowledged before the connections are closed.
+	if err := l.SendStandbyStatus(); err != nil {
+		logger.Warn("final standby status was not sent", "err", err)
+	}
+
+	if err := l.Stop(); err != nil {
+		logger.Error("failed to stop service", "err", err)
+	}
+
 	return nil
 }
 
@@ -254,11 +353,6 @@ func (l *Listener) checkConnection(ctx context.Context) error {
 			}
 		case <-ctx.Done():
 			l.log.Debug("check connection: context was canceled")
-
-			if err := l.Stop(); err != nil {
-				l.log.Error("failed to stop service", "err", err)
-			}
-
 			return nil
 		}
 	}
@@ -287,39 +381,47 @@ func (l *Listener) slotIsExists(ctx context.Context) (bool, error) {
 }
 
 const (
-	protoVersion    = "proto_version '1'"
-	publicationName = "wal-listener"
+	protoVersion          = "proto_version '1'"
+	protoVersionStreaming = "proto_version '2'"
+	streamingOn           = "streaming 'on'"
+	messagesOn            = "messages 'true'"
+	publicationName       = "wal-listener"
 )
 
 const (
 	problemKindParse   = "parse"
+	problemKindProtect = "protect"
 	problemKindPublish = "publish"
 	problemKindAck     = "ack"
 )
 
+// poolOpNew counts the events allocated because the pool was empty.
+const poolOpNew = "new"
+
 // Stream receives event from PostgreSQL.
 // Accept message, apply filter and publish it in NATS server.
 func (l *Listener) Stream(ctx context.Context) error {
+	pool := l.newEventPool()
+	txWAL := tx.NewWAL(l.log, pool, l.monitor, l.cfg.Listener, l.repository)
+	txWAL.OnRelation(l.classifier.Invalidate)
+
+	if l.cfg.Listener.WarmUp.Enabled {
+		if err := l.warmUp(ctx, txWAL); err != nil {
+			return fmt.Errorf("warm up: %w", err)
+		}
+	}
+
 	if err := l.replicator.StartReplication(
 		l.cfg.Listener.SlotName,
 		l.readLSN(),
 		-1,
-		protoVersion,
-		publicationNames(publicationName),
+		l.pluginArguments()...,
 	); err != nil {
 		return fmt.Errorf("start replication: %w", err)
 	}
 
 	go l.SendPeriodicHeartbeats(ctx)
 
-	pool := &sync.Pool{
-		New: func() any {
-			return &publisher.Event{}
-		},
-	}
-
-	txWAL := tx.NewWAL(l.log, pool, l.monitor)
-
 	for {
 		if err := ctx.Err(); err != nil {
 			l.log.Warn("stream: context canceled", "err", err)
@@ -328,6 +430,11 @@ func (l *Listener) Stream(ctx context.Context) error {
 
 		msg, err := l.replicator.WaitForReplicationMessage(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				l.log.Warn("stream: context canceled", "err", err)
+				return nil
+			}
+
 			return fmt.Errorf("wait for replication message: %w", err)
 		}
 
@@ -340,7 +447,17 @@ func (l *Listener) Stream(ctx context.Context) error {
 			return fmt.Errorf("process message: %w", err)
 		}
 
-		l.processHeartBeat(msg)
+		l.processHeartBeat(msg, txWAL)
+	}
+}
+
+// newEventPool returns the pool of the published events, allocations are counted.
+func (l *Listener) newEventPool() *sync.Pool {
+	return &sync.Pool{
+		New: func() any {
+			l.monitor.IncEventPool(poolOpNew)
+			return &publisher.Event{}
+		},
 	}
 }
 
@@ -351,37 +468,43 @@ func (l *Listener) processMessage(ctx context.Context, msg *pgx.ReplicationMessa
 	}
 
 	l.log.Debug("WAL message has been received", slog.Uint64("wal", msg.WalMessage.WalStart))
+	l.checkLag(msg.WalMessage.WalStart, msg.WalMessage.ServerWalEnd)
 
 	if err := l.parser.ParseWalMessage(msg.WalMessage.WalData, txWAL); err != nil {
 		l.monitor.IncProblematicEvents(problemKindParse)
 		return fmt.Errorf("parse: %w", err)
 	}
 
-	if txWAL.CommitTime != nil {
-		for event := range txWAL.CreateEventsWithFilter(ctx, l.cfg.Listener.Filter) {
-			subjectName := event.SubjectName(l.cfg)
+	committed := txWAL.CommitTime != nil
 
-			if err := l.publisher.Publish(ctx, subjectName, event); err != nil {
-				l.monitor.IncProblematicEvents(problemKindPublish)
-				return fmt.Errorf("publish: %w", err)
-			}
+	if committed {
+		if err := l.checkCommitLSN(uint64(txWAL.LSN)); err != nil {
+			return err
+		}
 
-			l.monitor.IncPublishedEvents(subjectName, event.Table)
+		l.dropSnapshotted(txWAL)
+		l.fastForward(txWAL)
 
-			l.log.Info(
-				"event was sent",
-				slog.String("subject", subjectName),
-				slog.String("action", event.Action),
-				slog.String("table", event.Table),
-				slog.Uint64("lsn", l.readLSN()),
-			)
+		pubCtx, cancel := l.publishContext(ctx)
+		err := l.publishEvents(pubCtx, txWAL)
 
-			txWAL.RetrieveEvent(event)
+		cancel()
+
+		if err != nil {
+			return err
 		}
 
 		txWAL.Clear()
 	}
 
+	if err := l.checkTxBuffer(ctx, txWAL, time.Now()); err != nil {
+		return err
+	}
+
+	if l.cfg.Listener.AckMode == config.AckModeCommit && !committed {
+		return nil
+	}
+
 	if msg.WalMessage.WalStart > l.readLSN() {
 		if err := l.AckWalMessage(msg.WalMessage.WalStart); err != nil {
 			l.monitor.IncProblematicEvents(problemKindAck)
@@ -394,7 +517,223 @@ func (l *Listener) processMessage(ctx context.Context, msg *pgx.ReplicationMessa
 	return nil
 }
 
-func (l *Listener) processHeartBeat(msg *pgx.ReplicationMessage) {
+// publishContext returns the context publishing the committed transaction. It outlives the stop of the listener
+// by the shutdown timeout, so the transaction in progress is completed and acknowledged instead of cut short.
+func (l *Listener) publishContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := l.cfg.Listener.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	pubCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel(fmt.Errorf("shutdown timeout: %w", context.Cause(ctx)))
+		case <-pubCtx.Done():
+		}
+	})
+
+	return pubCtx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// publishEvents publishes the events of the committed transaction one by one or in batches.
+// The transaction is not acknowledged if its events were cut short by the context or weren't flushed.
+func (l *Listener) publishEvents(ctx context.Context, txWAL *tx.WAL) error {
+	routeCtx, cancel := context.WithCancel(ctx)
+	jobs, routed := l.routeEvents(routeCtx, txWAL, txWAL.CreateEventsWithFilter(ctx, l.cfg.Listener.Filter))
+
+	defer drainJobs(txWAL, jobs)
+	defer cancel()
+
+	var err error
+
+	switch {
+	case l.cfg.Publisher != nil && l.cfg.Publisher.Batch.Enabled():
+		err = l.publishBatched(ctx, txWAL, jobs)
+	case l.cfg.Publisher != nil && l.cfg.Publisher.Workers > 1:
+		err = l.publishParallel(ctx, txWAL, jobs, l.cfg.Publisher.Workers)
+	default:
+		err = l.publishEach(ctx, txWAL, jobs)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := routed(); err != nil {
+		return err
+	}
+
+	if f, ok := l.publisher.(flusher); ok {
+		if err := f.Flush(ctx); err != nil {
+			l.monitor.IncProblematicEvents(problemKindPublish)
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+
+	if err := context.Cause(ctx); err != nil {
+		return fmt.Errorf("create events: %w", err)
+	}
+
+	return nil
+}
+
+// drainEvents returns the events left unpublished after a failure to the pool, so their producer doesn't block.
+func drainEvents(txWAL *tx.WAL, events <-chan *publisher.Event) {
+	for event := range events {
+		txWAL.RetrieveEvent(event)
+	}
+}
+
+// drainJobs returns the events of the jobs left unpublished after a failure to the pool.
+func drainJobs(txWAL *tx.WAL, jobs <-chan publishJob) {
+	for job := range jobs {
+		txWAL.RetrieveEvent(job.event)
+	}
+}
+
+// publishEach publishes the events one by one.
+func (l *Listener) publishEach(ctx context.Context, txWAL *tx.WAL, jobs <-chan publishJob) error {
+	for job := range jobs {
+		for _, msg := range job.messages {
+			if err := l.publishMessage(ctx, msg); err != nil {
+				l.monitor.IncProblematicEvents(problemKindPublish)
+				return fmt.Errorf("publish: %w", err)
+			}
+		}
+
+		txWAL.RetrieveEvent(job.event)
+	}
+
+	return nil
+}
+
+func (l *Listener) prepareEvent(ctx context.Context, event *publisher.Event) (string, error) {
+	if event.Action == actionMessage {
+		return publisher.TopicName(l.cfg, l.cfg.Listener.LogicalMessages.Topic), nil
+	}
+
+	subjectName := event.Topic(l.cfg, l.topicsMap())
+	event.Key = event.MessageKey(l.cfg.Listener.EventKey)
+
+	if key := event.BusinessKey(l.cfg.Listener.BusinessKey); key != "" {
+		event.DedupKey = key
+
+		if l.cfg.Listener.BusinessKey.MessageKey {
+			event.Key = key
+		}
+	}
+
+	if column, ok := l.cfg.Listener.MessageID[event.Table]; ok && !event.ApplyMessageID(column) {
+		l.log.Warn(
+			"message id column is empty, event id is generated",
+			slog.String("table", event.Table),
+			slog.String("column", column),
+		)
+	}
+
+	event.Source = l.source
+	l.enricher.Enrich(ctx, l.log, l.monitor, event)
+
+	if err := l.protector.Apply(event); err != nil {
+		l.monitor.IncProblematicEvents(problemKindProtect)
+		return "", fmt.Errorf("protect: %w", err)
+	}
+
+	if err := l.classifier.Apply(ctx, l.log, l.protector, event); err != nil {
+		l.monitor.IncProblematicEvents(problemKindProtect)
+		return "", fmt.Errorf("classify: %w", err)
+	}
+
+	return subjectName, nil
+}
+
+// topicsMap returns the topic map of the router, or the static one if routes aren't loaded externally.
+func (l *Listener) topicsMap() map[string]string {
+	if l.router == nil {
+		return l.cfg.Listener.TopicsMap
+	}
+
+	return l.router.TopicsMap()
+}
+
+// checkBusinessKey makes sure the configured business key columns exist in their tables.
+func (l *Listener) checkBusinessKey(ctx context.Context) error {
+	for table, columns := range l.cfg.Listener.BusinessKey.Columns {
+		existing, err := l.repository.TableColumns(ctx, table)
+		if err != nil {
+			return fmt.Errorf("table columns %s: %w", table, err)
+		}
+
+		if len(existing) == 0 {
+			return fmt.Errorf("table not found: %s", table)
+		}
+
+		for _, col := range columns {
+			if !slices.Contains(existing, col) {
+				return fmt.Errorf("column not found: %s.%s", table, col)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkMessageID makes sure the message ID columns exist, and warns if they aren't backed by a unique index.
+func (l *Listener) checkMessageID(ctx context.Context) error {
+	for table, column := range l.cfg.Listener.MessageID {
+		existing, err := l.repository.TableColumns(ctx, table)
+		if err != nil {
+			return fmt.Errorf("table columns %s: %w", table, err)
+		}
+
+		if !slices.Contains(existing, column) {
+			return fmt.Errorf("column not found: %s.%s", table, column)
+		}
+
+		unique, err := l.repository.IsUniqueColumn(ctx, table, column)
+		if err != nil {
+			return fmt.Errorf("unique column %s.%s: %w", table, column, err)
+		}
+
+		if !unique {
+			l.log.Warn(
+				"message id column has no unique index, duplicate values produce duplicate event ids",
+				slog.String("table", table),
+				slog.String("column", column),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (l *Listener) eventSent(subjectName string, event *publisher.Event) {
+	l.monitor.IncPublishedEvents(subjectName, event.Table, event.Action)
+
+	// the events without a commit time are not observed.
+	if !event.EventTime.IsZero() {
+		l.monitor.ObservePublishLatency(event.Table, time.Since(event.EventTime))
+	}
+
+	l.log.Info(
+		"event was sent",
+		slog.String("subject", subjectName),
+		slog.String("action", event.Action),
+		slog.String("table", event.Table),
+		slog.Uint64("lsn", l.readLSN()),
+	)
+}
+
+func (l *Listener) processHeartBeat(msg *pgx.ReplicationMessage, txWAL *tx.WAL) {
 	if msg.ServerHeartbeat == nil {
 		l.log.Debug("empty server heartbeat message")
 		return
@@ -406,7 +745,10 @@ func (l *Listener) processHeartBeat(msg *pgx.ReplicationMessage) {
 		slog.Uint64("server_time", msg.ServerHeartbeat.ServerTime),
 	)
 
-	if msg.ServerHeartbeat.ServerWalEnd > l.readLSN() {
+	// in the commit mode the position doesn't pass the changes not yet committed and published.
+	pending := l.cfg.Listener.AckMode == config.AckModeCommit && txWAL.Pending()
+
+	if !pending && msg.ServerHeartbeat.ServerWalEnd > l.readLSN() {
 		l.setLSN(msg.ServerHeartbeat.ServerWalEnd)
 	}
 
@@ -419,6 +761,21 @@ func (l *Listener) processHeartBeat(msg *pgx.ReplicationMessage) {
 	}
 }
 
+// pluginArguments returns pgoutput options, streaming requires protocol version 2.
+func (l *Listener) pluginArguments() []string {
+	args := []string{protoVersion}
+
+	if l.cfg.Listener.Streaming {
+		args = []string{protoVersionStreaming, streamingOn}
+	}
+
+	if l.cfg.Listener.LogicalMessages.Enabled {
+		args = append(args, messagesOn)
+	}
+
+	return append(args, publicationNames(publicationName))
+}
+
 func publicationNames(publication string) string {
 	return fmt.Sprintf(`publication_names '%s'`, publication)
 }
@@ -477,13 +834,23 @@ func (l *Listener) SendStandbyStatus() error {
 		return fmt.Errorf("unable to send StandbyStatus object: %w", err)
 	}
 
+	l.mu.Lock()
+	l.lastFeedback = time.Now()
+	l.mu.Unlock()
+
 	return nil
 }
 
 // AckWalMessage acknowledge received wal message.
+// With the feedback interval the status is sent at most once per interval, the skipped acknowledgements
+// are coalesced into the next status: the next due ack, a periodic heartbeat or a reply requested by the server.
 func (l *Listener) AckWalMessage(lsn uint64) error {
 	l.setLSN(lsn)
 
+	if !l.feedbackDue(time.Now()) {
+		return nil
+	}
+
 	if err := l.SendStandbyStatus(); err != nil {
 		return fmt.Errorf("send status: %w", err)
 	}
@@ -491,6 +858,18 @@ func (l *Listener) AckWalMessage(lsn uint64) error {
 	return nil
 }
 
+// feedbackDue reports whether the feedback interval has passed since the last status.
+func (l *Listener) feedbackDue(now time.Time) bool {
+	if l.feedbackInterval <= 0 {
+		return true
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return now.Sub(l.lastFeedback) >= l.feedbackInterval
+}
+
 func (l *Listener) readLSN() uint64 {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
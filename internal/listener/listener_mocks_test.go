@@ -3,6 +3,7 @@ package listener
 import (
 	"context"
 	"github.com/jackc/pgx"
+	"sync"
 	"time"
 
 	"github.com/stretchr/testify/mock"
@@ -11,14 +12,90 @@ import (
 	"github.com/ihippik/wal-listener/v2/internal/publisher"
 )
 
-type monitorMock struct{}
+type monitorMock struct {
+	mu               sync.Mutex // the events are published and recycled by the publish workers
+	flushReasons     []string
+	flushSizes       []int
+	longTransactions int
+	eventPool        map[string]int
+	replicationLag   uint64
+	appliedLag       []uint64
+	slotLagAlerts    int
+	filterSkipped    map[string]int
+	publishErrors    map[string]int
+	publishLatency   map[string][]time.Duration
+}
+
+func (m *monitorMock) IncPublishedEvents(subject, table, action string) {}
+
+func (m *monitorMock) IncPublishErrors(table string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.publishErrors == nil {
+		m.publishErrors = make(map[string]int)
+	}
+
+	m.publishErrors[table]++
+}
+
+func (m *monitorMock) ObservePublishLatency(table string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (m *monitorMock) IncPublishedEvents(subject, table string) {}
+	if m.publishLatency == nil {
+		m.publishLatency = make(map[string][]time.Duration)
+	}
+
+	m.publishLatency[table] = append(m.publishLatency[table], latency)
+}
+
+func (m *monitorMock) IncFilterSkippedEvents(table string) {
+	if m.filterSkipped == nil {
+		m.filterSkipped = make(map[string]int)
+	}
 
-func (m *monitorMock) IncFilterSkippedEvents(table string) {}
+	m.filterSkipped[table]++
+}
 
 func (m *monitorMock) IncProblematicEvents(kind string) {}
 
+func (m *monitorMock) SetRelationCacheSize(size int) {}
+
+func (m *monitorMock) IncEventPool(op string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.eventPool == nil {
+		m.eventPool = make(map[string]int)
+	}
+
+	m.eventPool[op]++
+}
+
+func (m *monitorMock) IncLongTransactions() {
+	m.longTransactions++
+}
+
+func (m *monitorMock) IncTransitionSkippedEvents(table string) {}
+
+func (m *monitorMock) SetReplicationLag(lag uint64) {
+	m.replicationLag = lag
+}
+
+func (m *monitorMock) SetAppliedLag(lag uint64) {
+	m.appliedLag = append(m.appliedLag, lag)
+}
+
+func (m *monitorMock) IncSlotLagAlerts() {
+	m.slotLagAlerts++
+}
+
+func (m *monitorMock) ObserveBatchFlush(reason string, size int, _ time.Duration) {
+	m.flushReasons = append(m.flushReasons, reason)
+	m.flushSizes = append(m.flushSizes, size)
+}
+
 type parserMock struct {
 	mock.Mock
 }
@@ -67,7 +144,7 @@ func (r *replicatorMock) CreateReplicationSlotEx(slotName, outputPlugin string)
 
 func (r *replicatorMock) DropReplicationSlot(slotName string) (err error) {
 	args := r.Called(slotName)
-	return args.Error(1)
+	return args.Error(0)
 }
 
 func (r *replicatorMock) StartReplication(
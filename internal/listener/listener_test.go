@@ -7,6 +7,7 @@ import (
 	"io"
 	"log/slog"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/jackc/pgx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ihippik/wal-listener/v2/internal/config"
 	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
@@ -446,6 +448,96 @@ func TestListener_AckWalMessage(t *testing.T) {
 	}
 }
 
+func TestListener_AckWalMessage_FeedbackInterval(t *testing.T) {
+	repo := new(repositoryMock)
+	repo.On("NewStandbyStatus", mock.Anything).Return(&pgx.StandbyStatus{}, nil)
+
+	repl := new(replicatorMock)
+	repl.On("SendStandbyStatus", mock.Anything).Return(nil)
+
+	l := &Listener{
+		cfg:              &config.Config{Listener: &config.ListenerCfg{}},
+		log:              slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		replicator:       repl,
+		repository:       repo,
+		feedbackInterval: time.Hour,
+	}
+
+	for lsn := uint64(1); lsn <= 3; lsn++ {
+		require.NoError(t, l.AckWalMessage(lsn))
+	}
+
+	repl.AssertNumberOfCalls(t, "SendStandbyStatus", 1)
+	assert.Equal(t, uint64(3), l.readLSN())
+
+	l.processHeartBeat(&pgx.ReplicationMessage{ServerHeartbeat: &pgx.ServerHeartbeat{ReplyRequested: 1}}, &tx.WAL{})
+	repl.AssertNumberOfCalls(t, "SendStandbyStatus", 2)
+
+	require.NoError(t, l.AckWalMessage(4))
+	repl.AssertNumberOfCalls(t, "SendStandbyStatus", 2)
+	repo.AssertCalled(t, "NewStandbyStatus", []uint64{3})
+}
+
+type parserFunc func(data []byte, txWAL *tx.WAL) error
+
+func (f parserFunc) ParseWalMessage(data []byte, txWAL *tx.WAL) error {
+	return f(data, txWAL)
+}
+
+func TestListener_AckMode_Commit(t *testing.T) {
+	repo := new(repositoryMock)
+	repo.On("NewStandbyStatus", mock.Anything).Return(&pgx.StandbyStatus{}, nil)
+
+	repl := new(replicatorMock)
+	repl.On("SendStandbyStatus", mock.Anything).Return(nil)
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	monitor := new(monitorMock)
+
+	// begin and insert are received in separate messages, the commit completes the transaction.
+	var commit bool
+
+	l := &Listener{
+		cfg:        &config.Config{Listener: &config.ListenerCfg{AckMode: config.AckModeCommit}},
+		log:        logger,
+		monitor:    monitor,
+		replicator: repl,
+		repository: repo,
+		publisher:  new(publisherMock),
+		state:      NewStreamState(),
+		parser: parserFunc(func(_ []byte, txWAL *tx.WAL) error {
+			now := time.Now()
+
+			if commit {
+				txWAL.CommitTime = &now
+			} else {
+				txWAL.BeginTime = &now
+			}
+
+			return nil
+		}),
+	}
+
+	txWAL := tx.NewWAL(logger, nil, monitor, l.cfg.Listener, nil)
+	walMessage := func(lsn uint64) *pgx.ReplicationMessage {
+		return &pgx.ReplicationMessage{WalMessage: &pgx.WalMessage{WalStart: lsn}}
+	}
+
+	require.NoError(t, l.processMessage(context.Background(), walMessage(100), txWAL))
+	assert.Equal(t, uint64(0), l.readLSN(), "the open transaction is not acknowledged")
+
+	l.processHeartBeat(&pgx.ReplicationMessage{ServerHeartbeat: &pgx.ServerHeartbeat{ServerWalEnd: 500}}, txWAL)
+	assert.Equal(t, uint64(0), l.readLSN(), "heartbeats don't pass the pending changes")
+
+	commit = true
+
+	require.NoError(t, l.processMessage(context.Background(), walMessage(200), txWAL))
+	assert.Equal(t, uint64(200), l.readLSN())
+
+	l.processHeartBeat(&pgx.ReplicationMessage{ServerHeartbeat: &pgx.ServerHeartbeat{ServerWalEnd: 500}}, txWAL)
+	assert.Equal(t, uint64(500), l.readLSN())
+}
+
 func TestListener_Stream(t *testing.T) {
 	t.Skip() // FIXME
 
@@ -561,7 +653,7 @@ func TestListener_Stream(t *testing.T) {
 
 				setParseWalMessageOnce(
 					[]byte(`some bytes`),
-					tx.NewWAL(logger, nil, metrics),
+					tx.NewWAL(logger, nil, metrics, &config.ListenerCfg{}, nil),
 					nil,
 				)
 
@@ -983,6 +1075,10 @@ func TestListener_Process(t *testing.T) {
 				pub,
 				parser,
 				monitor,
+				nil,
+				nil,
+				nil,
+				nil,
 			)
 
 			err := l.Process(ctx)
@@ -994,3 +1090,345 @@ func TestListener_Process(t *testing.T) {
 		})
 	}
 }
+
+func TestListener_prepareEvent_BusinessKey(t *testing.T) {
+	newEvent := func() *publisher.Event {
+		return &publisher.Event{
+			Schema: "public",
+			Table:  "orders",
+			Action: "INSERT",
+			Data:   map[string]any{"id": 7, "order_number": "A-100", "region": "eu"},
+		}
+	}
+
+	newListener := func(businessKey config.BusinessKeyCfg) *Listener {
+		return &Listener{cfg: &config.Config{
+			Listener: &config.ListenerCfg{
+				EventKey:    config.EventKeyCfg{Columns: map[string][]string{"orders": {"id"}}},
+				BusinessKey: businessKey,
+			},
+			Publisher: &config.PublisherCfg{Topic: "wal"},
+		}}
+	}
+
+	t.Run("message key", func(t *testing.T) {
+		l := newListener(config.BusinessKeyCfg{
+			Columns:    map[string][]string{"orders": {"order_number", "region"}},
+			MessageKey: true,
+		})
+
+		event := newEvent()
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, "A-100|eu", event.Key)
+		assert.Equal(t, "A-100|eu", event.DedupKey)
+	})
+
+	t.Run("dedup field only", func(t *testing.T) {
+		l := newListener(config.BusinessKeyCfg{
+			Columns: map[string][]string{"orders": {"order_number"}},
+		})
+
+		event := newEvent()
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, "7", event.Key)
+		assert.Equal(t, "A-100", event.DedupKey)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		event := newEvent()
+		_, err := newListener(config.BusinessKeyCfg{}).prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, "7", event.Key)
+		assert.Empty(t, event.DedupKey)
+	})
+}
+
+func TestListener_checkBusinessKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		wantErr string
+	}{
+		{
+			name:    "columns exist",
+			columns: []string{"id", "order_number"},
+		},
+		{
+			name:    "unknown column",
+			columns: []string{"id"},
+			wantErr: "column not found: orders.order_number",
+		},
+		{
+			name:    "unknown table",
+			columns: []string{},
+			wantErr: "table not found: orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(repositoryMock)
+			repo.On("TableColumns", mock.Anything, "orders").Return(tt.columns, nil).Once()
+
+			l := &Listener{
+				cfg: &config.Config{Listener: &config.ListenerCfg{
+					BusinessKey: config.BusinessKeyCfg{Columns: map[string][]string{"orders": {"order_number"}}},
+				}},
+				repository: repo,
+			}
+
+			err := l.checkBusinessKey(context.Background())
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListener_prepareEvent_MessageID(t *testing.T) {
+	l := &Listener{
+		cfg: &config.Config{
+			Listener: &config.ListenerCfg{
+				MessageID: map[string]string{"outbox": "message_id"},
+			},
+			Publisher: &config.PublisherCfg{Topic: "wal"},
+		},
+		log: slog.New(slog.NewJSONHandler(io.Discard, nil)),
+	}
+
+	t.Run("uuid column", func(t *testing.T) {
+		event := &publisher.Event{
+			ID:     uuid.New(),
+			Table:  "outbox",
+			Action: "INSERT",
+			Data:   map[string]any{"message_id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "payload": "{}"},
+		}
+
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), event.ID)
+		assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", event.Key)
+	})
+
+	t.Run("non uuid column is stable", func(t *testing.T) {
+		first := &publisher.Event{ID: uuid.New(), Table: "outbox", Data: map[string]any{"message_id": 42}}
+		second := &publisher.Event{ID: uuid.New(), Table: "outbox", Data: map[string]any{"message_id": 42}}
+
+		_, err := l.prepareEvent(context.Background(), first)
+		require.NoError(t, err)
+		_, err = l.prepareEvent(context.Background(), second)
+		require.NoError(t, err)
+
+		assert.Equal(t, first.ID, second.ID)
+		assert.Equal(t, "42", first.Key)
+	})
+
+	t.Run("later changes of the row get their own id", func(t *testing.T) {
+		newEvent := func(action string, lsn uint64) *publisher.Event {
+			return &publisher.Event{
+				ID:     uuid.New(),
+				Table:  "outbox",
+				Action: action,
+				LSN:    lsn,
+				Data:   map[string]any{"message_id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+			}
+		}
+
+		insert, update, del, redelivered := newEvent("INSERT", 10), newEvent("UPDATE", 20), newEvent("DELETE", 30),
+			newEvent("DELETE", 30)
+
+		for _, event := range []*publisher.Event{insert, update, del, redelivered} {
+			_, err := l.prepareEvent(context.Background(), event)
+			require.NoError(t, err)
+			assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", event.Key)
+		}
+
+		assert.Equal(t, uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), insert.ID)
+		assert.NotEqual(t, insert.ID, update.ID)
+		assert.NotEqual(t, update.ID, del.ID)
+		assert.NotEqual(t, insert.ID, del.ID)
+		assert.Equal(t, del.ID, redelivered.ID, "the same change keeps its id")
+	})
+
+	t.Run("other table keeps the generated id", func(t *testing.T) {
+		id := uuid.New()
+		event := &publisher.Event{ID: id, Table: "users", Data: map[string]any{"message_id": 42}}
+
+		_, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+
+		assert.Equal(t, id, event.ID)
+		assert.Empty(t, event.Key)
+	})
+}
+
+func TestListener_checkMessageID(t *testing.T) {
+	newListener := func(repo *repositoryMock) *Listener {
+		return &Listener{
+			cfg: &config.Config{Listener: &config.ListenerCfg{
+				MessageID: map[string]string{"outbox": "message_id"},
+			}},
+			log:        slog.New(slog.NewJSONHandler(io.Discard, nil)),
+			repository: repo,
+		}
+	}
+
+	t.Run("unique column", func(t *testing.T) {
+		repo := new(repositoryMock)
+		repo.On("TableColumns", mock.Anything, "outbox").Return([]string{"id", "message_id"}, nil).Once()
+		repo.On("IsUniqueColumn", mock.Anything, "outbox", "message_id").Return(true, nil).Once()
+
+		assert.NoError(t, newListener(repo).checkMessageID(context.Background()))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		repo := new(repositoryMock)
+		repo.On("TableColumns", mock.Anything, "outbox").Return([]string{"id"}, nil).Once()
+
+		assert.EqualError(t, newListener(repo).checkMessageID(context.Background()), "column not found: outbox.message_id")
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestListener_publishEvents_EventPool(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	monitor := new(monitorMock)
+
+	pub := new(publisherMock)
+	pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Return(nil).Times(3)
+
+	l := &Listener{
+		cfg: &config.Config{
+			Listener: &config.ListenerCfg{
+				Filter: config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}},
+			},
+			Publisher: &config.PublisherCfg{Topic: "wal"},
+		},
+		log:       logger,
+		monitor:   monitor,
+		publisher: pub,
+	}
+
+	require.NoError(t, l.publishEvents(context.Background(), newBatchWAL(logger, monitor, 3)))
+	assert.Equal(t, map[string]int{"get": 3, "put": 3}, monitor.eventPool)
+	pub.AssertExpectations(t)
+}
+
+func TestListener_publishEvents_Shutdown(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	newListener := func(pub eventPublisher, monitor *monitorMock) *Listener {
+		return &Listener{
+			cfg: &config.Config{
+				Listener: &config.ListenerCfg{
+					Filter:          config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}},
+					ShutdownTimeout: 50 * time.Millisecond,
+				},
+				Publisher: &config.PublisherCfg{Topic: "wal"},
+			},
+			log:       logger,
+			monitor:   monitor,
+			publisher: pub,
+		}
+	}
+
+	t.Run("cut short", func(t *testing.T) {
+		monitor := new(monitorMock)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := newListener(new(publisherMock), monitor).publishEvents(ctx, newBatchWAL(logger, monitor, 3))
+		require.ErrorIs(t, err, context.Canceled, "the transaction is not acknowledged")
+	})
+
+	t.Run("failed publish drains the events", func(t *testing.T) {
+		monitor := new(monitorMock)
+
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Return(publisher.Permanent(errSimple)).Once()
+
+		err := newListener(pub, monitor).publishEvents(context.Background(), newBatchWAL(logger, monitor, 3))
+		require.ErrorIs(t, err, errSimple)
+		assert.Equal(t, map[string]int{"get": 3, "put": 2}, monitor.eventPool, "the failed event is not recycled")
+	})
+
+	t.Run("in-flight transaction outlives the stop", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		pubCtx, done := newListener(nil, nil).publishContext(ctx)
+		defer done()
+
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, pubCtx.Err(), "publishing goes on within the shutdown timeout")
+
+		<-pubCtx.Done()
+		assert.ErrorContains(t, context.Cause(pubCtx), "shutdown timeout")
+		assert.ErrorIs(t, context.Cause(pubCtx), context.Canceled)
+	})
+}
+
+type flushingPublisherMock struct {
+	publisherMock
+}
+
+func (p *flushingPublisherMock) Flush(ctx context.Context) error {
+	return p.Called(ctx).Error(0)
+}
+
+func TestListener_publishEvents_Flush(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			Filter: config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}},
+		},
+		Publisher: &config.PublisherCfg{Topic: "wal"},
+	}
+
+	newWAL := func() *tx.WAL {
+		txWAL := tx.NewWAL(logger, &sync.Pool{New: func() any { return &publisher.Event{} }}, new(monitorMock), cfg.Listener, nil)
+		now := time.Now()
+		txWAL.CommitTime = &now
+		txWAL.Actions = []tx.ActionData{{
+			Schema:     "public",
+			Table:      "users",
+			Kind:       tx.ActionKindInsert,
+			NewColumns: []tx.Column{tx.InitColumn(logger, "id", 1, 23, true)},
+		}}
+
+		return txWAL
+	}
+
+	t.Run("flushed before the acknowledgement", func(t *testing.T) {
+		pub := new(flushingPublisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Return(nil).Once()
+		pub.On("Flush", mock.Anything).Return(nil).Once()
+
+		l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub}
+
+		require.NoError(t, l.publishEvents(context.Background(), newWAL()))
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("failed flush", func(t *testing.T) {
+		pub := new(flushingPublisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Return(nil).Once()
+		pub.On("Flush", mock.Anything).Return(errors.New("disk full")).Once()
+
+		l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub}
+
+		assert.EqualError(t, l.publishEvents(context.Background(), newWAL()), "flush: disk full")
+		pub.AssertExpectations(t)
+	})
+}
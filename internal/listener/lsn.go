@@ -0,0 +1,73 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+const (
+	problemKindLSNRegression = "lsn_regression"
+	problemKindLSNJump       = "lsn_jump"
+)
+
+var errLSNAnomaly = errors.New("commit lsn anomaly")
+
+// checkCommitLSN compares the commit LSN with the previous one and applies the configured policy
+// when it goes backwards or jumps ahead. Commit LSNs are monotonic within one server timeline,
+// an anomaly usually means a failover to a server with a different WAL history.
+// The previous commit LSN is kept in the stream state, so the guard also covers the reconnects.
+func (l *Listener) checkCommitLSN(lsn uint64) error {
+	guard := l.cfg.Listener.LSNGuard
+	if guard.Policy == "" {
+		return nil
+	}
+
+	prev := l.state.commitLSN
+	l.state.commitLSN = lsn
+
+	if prev == 0 {
+		return nil
+	}
+
+	var kind string
+
+	switch {
+	case lsn < prev:
+		kind = problemKindLSNRegression
+	case guard.MaxJump > 0 && lsn-prev > guard.MaxJump:
+		kind = problemKindLSNJump
+	default:
+		return nil
+	}
+
+	l.monitor.IncProblematicEvents(kind)
+	l.log.Warn(
+		"commit lsn anomaly detected",
+		slog.String("kind", kind),
+		slog.String("policy", string(guard.Policy)),
+		slog.String("previous_lsn", pgx.FormatLSN(prev)),
+		slog.String("lsn", pgx.FormatLSN(lsn)),
+	)
+
+	switch guard.Policy {
+	case config.LSNPolicyError:
+		return fmt.Errorf("%w: %s after %s", errLSNAnomaly, pgx.FormatLSN(lsn), pgx.FormatLSN(prev))
+	case config.LSNPolicyResync:
+		// the stream is restarted from the position of the replication slot, the guard starts over with it.
+		l.state.commitLSN = 0
+
+		return fmt.Errorf("%w: %s after %s, resync from the slot", errLSNAnomaly, pgx.FormatLSN(lsn), pgx.FormatLSN(prev))
+	default:
+		// acknowledgements only move forward, let them follow the new LSN after a regression.
+		if kind == problemKindLSNRegression {
+			l.setLSN(lsn)
+		}
+	}
+
+	return nil
+}
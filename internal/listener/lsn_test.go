@@ -0,0 +1,90 @@
+package listener
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestListener_checkCommitLSN(t *testing.T) {
+	const (
+		first   = 0x1000
+		earlier = 0x0800
+	)
+
+	newListener := func(guard config.LSNGuardCfg, state *StreamState) *Listener {
+		return &Listener{
+			cfg: &config.Config{Listener: &config.ListenerCfg{
+				SlotName: "slot1",
+				LSNGuard: guard,
+			}},
+			log:     slog.New(slog.NewJSONHandler(io.Discard, nil)),
+			monitor: new(monitorMock),
+			state:   state,
+		}
+	}
+
+	t.Run("error policy stops on regression", func(t *testing.T) {
+		l := newListener(config.LSNGuardCfg{Policy: config.LSNPolicyError}, NewStreamState())
+
+		require.NoError(t, l.checkCommitLSN(first))
+
+		err := l.checkCommitLSN(earlier)
+		assert.True(t, errors.Is(err, errLSNAnomaly))
+		assert.EqualError(t, err, "commit lsn anomaly: 0/800 after 0/1000")
+	})
+
+	t.Run("resync policy restarts from the slot", func(t *testing.T) {
+		state := NewStreamState()
+		l := newListener(config.LSNGuardCfg{Policy: config.LSNPolicyResync}, state)
+		l.setLSN(first)
+
+		require.NoError(t, l.checkCommitLSN(first))
+
+		err := l.checkCommitLSN(earlier)
+		assert.ErrorIs(t, err, errLSNAnomaly)
+		assert.Equal(t, uint64(first), l.readLSN())
+
+		// the listener of the next connection accepts the position of the slot.
+		assert.NoError(t, newListener(config.LSNGuardCfg{Policy: config.LSNPolicyResync}, state).checkCommitLSN(earlier))
+	})
+
+	t.Run("regression across reconnects", func(t *testing.T) {
+		state := NewStreamState()
+
+		require.NoError(t, newListener(config.LSNGuardCfg{Policy: config.LSNPolicyError}, state).checkCommitLSN(first))
+		assert.ErrorIs(t, newListener(config.LSNGuardCfg{Policy: config.LSNPolicyError}, state).checkCommitLSN(earlier), errLSNAnomaly)
+	})
+
+	t.Run("continue policy follows the new lsn", func(t *testing.T) {
+		l := newListener(config.LSNGuardCfg{Policy: config.LSNPolicyContinue}, NewStreamState())
+		l.setLSN(first)
+
+		require.NoError(t, l.checkCommitLSN(first))
+		require.NoError(t, l.checkCommitLSN(earlier))
+
+		assert.Equal(t, uint64(earlier), l.readLSN())
+		assert.NoError(t, l.checkCommitLSN(earlier+1))
+	})
+
+	t.Run("jump", func(t *testing.T) {
+		l := newListener(config.LSNGuardCfg{Policy: config.LSNPolicyError, MaxJump: 0x100}, NewStreamState())
+
+		require.NoError(t, l.checkCommitLSN(first))
+		require.NoError(t, l.checkCommitLSN(first+0x100))
+		assert.ErrorIs(t, l.checkCommitLSN(first+0x1000), errLSNAnomaly)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		l := newListener(config.LSNGuardCfg{}, nil)
+
+		require.NoError(t, l.checkCommitLSN(first))
+		assert.NoError(t, l.checkCommitLSN(earlier))
+	})
+}
@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// Reconnector spaces reconnect attempts so a flapping listener doesn't overwhelm Postgres.
+// Attempts are delayed by an exponential backoff with jitter starting at the minimum interval,
+// and limited to MaxAttempts within the sliding Window.
+type Reconnector struct {
+	cfg      config.ReconnectCfg
+	failures int
+	last     time.Time
+	attempts []time.Time
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+	jitter   func(d time.Duration) time.Duration
+}
+
+// NewReconnector create new Reconnector instance.
+func NewReconnector(cfg config.ReconnectCfg) *Reconnector {
+	return &Reconnector{
+		cfg:   cfg,
+		now:   time.Now,
+		sleep: sleepContext,
+		jitter: func(d time.Duration) time.Duration {
+			if d <= 0 {
+				return 0
+			}
+
+			return rand.N(d)
+		},
+	}
+}
+
+// Wait blocks until the next reconnect attempt is allowed.
+func (r *Reconnector) Wait(ctx context.Context) error {
+	now := r.now()
+	next := now
+
+	if !r.last.IsZero() {
+		next = r.last.Add(r.backoff())
+	}
+
+	if limited := r.rateLimited(now); limited.After(next) {
+		next = limited
+	}
+
+	if d := next.Sub(now); d > 0 {
+		if err := r.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	r.failures++
+	r.last = r.now()
+	r.attempts = append(r.attempts, r.last)
+
+	return nil
+}
+
+// Done resets the backoff if the connection stayed healthy longer than the backoff could grow.
+func (r *Reconnector) Done(uptime time.Duration) {
+	if uptime > max(r.cfg.MaxInterval, r.cfg.MinInterval) {
+		r.failures = 0
+	}
+}
+
+// backoff returns the delay since the previous attempt, never shorter than the minimum interval.
+func (r *Reconnector) backoff() time.Duration {
+	delay := r.cfg.MinInterval
+
+	for i := 1; i < r.failures && (r.cfg.MaxInterval <= 0 || delay < r.cfg.MaxInterval); i++ {
+		delay *= 2
+	}
+
+	if r.cfg.MaxInterval > 0 && delay > r.cfg.MaxInterval {
+		delay = r.cfg.MaxInterval
+	}
+
+	return delay + r.jitter(time.Duration(float64(delay)*r.cfg.Jitter))
+}
+
+// rateLimited returns the time the next attempt fits the window limit.
+func (r *Reconnector) rateLimited(now time.Time) time.Time {
+	if r.cfg.MaxAttempts <= 0 || r.cfg.Window <= 0 {
+		return now
+	}
+
+	kept := r.attempts[:0]
+
+	for _, at := range r.attempts {
+		if now.Sub(at) < r.cfg.Window {
+			kept = append(kept, at)
+		}
+	}
+
+	r.attempts = kept
+
+	if len(r.attempts) < r.cfg.MaxAttempts {
+		return now
+	}
+
+	return r.attempts[len(r.attempts)-r.cfg.MaxAttempts].Add(r.cfg.Window)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// newTestReconnector returns the reconnector with a fake clock which advances on sleep.
+func newTestReconnector(cfg config.ReconnectCfg, jitter time.Duration) *Reconnector {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := NewReconnector(cfg)
+
+	r.now = func() time.Time { return now }
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		now = now.Add(d)
+		return nil
+	}
+	r.jitter = func(time.Duration) time.Duration { return jitter }
+
+	return r
+}
+
+func TestReconnector_Wait(t *testing.T) {
+	t.Run("spaced by min interval with backoff", func(t *testing.T) {
+		cfg := config.ReconnectCfg{MinInterval: time.Second, MaxInterval: 5 * time.Second, Jitter: 0.5}
+		r := newTestReconnector(cfg, 100*time.Millisecond)
+
+		var attempts []time.Time
+
+		for i := 0; i < 6; i++ {
+			require.NoError(t, r.Wait(context.Background()))
+			attempts = append(attempts, r.now())
+		}
+
+		gaps := make([]time.Duration, 0, len(attempts)-1)
+
+		for i := 1; i < len(attempts); i++ {
+			gap := attempts[i].Sub(attempts[i-1])
+			assert.GreaterOrEqual(t, gap, cfg.MinInterval)
+			gaps = append(gaps, gap)
+		}
+
+		ms := time.Millisecond
+		assert.Equal(t, []time.Duration{1100 * ms, 2100 * ms, 4100 * ms, 5100 * ms, 5100 * ms}, gaps)
+	})
+
+	t.Run("reset backoff", func(t *testing.T) {
+		r := newTestReconnector(config.ReconnectCfg{MinInterval: time.Second}, 0)
+
+		for i := 0; i < 4; i++ {
+			require.NoError(t, r.Wait(context.Background()))
+		}
+
+		r.Done(time.Millisecond)
+
+		before := r.now()
+		require.NoError(t, r.Wait(context.Background()))
+		assert.Equal(t, 8*time.Second, r.now().Sub(before))
+
+		r.Done(time.Minute)
+
+		before = r.now()
+		require.NoError(t, r.Wait(context.Background()))
+		assert.Equal(t, time.Second, r.now().Sub(before))
+	})
+
+	t.Run("rate limited within window", func(t *testing.T) {
+		cfg := config.ReconnectCfg{MinInterval: time.Second, MaxInterval: time.Second, MaxAttempts: 3, Window: time.Minute}
+		r := newTestReconnector(cfg, 0)
+		start := r.now()
+
+		for i := 0; i < 4; i++ {
+			require.NoError(t, r.Wait(context.Background()))
+		}
+
+		assert.Equal(t, time.Minute, r.now().Sub(start))
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		r := NewReconnector(config.ReconnectCfg{MinInterval: time.Hour})
+		require.NoError(t, r.Wait(context.Background()))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.ErrorIs(t, r.Wait(ctx), context.Canceled)
+	})
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/jackc/pgx"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
 )
 
 // RepositoryImpl service repository.
@@ -69,3 +73,423 @@ func (r RepositoryImpl) IsReplicationActive(ctx context.Context, slotName string
 
 	return true, err
 }
+
+// LoadRelation returns relation metadata from the catalog in the same shape as the WAL relation message.
+func (r RepositoryImpl) LoadRelation(ctx context.Context, relationID int32) (tx.Relation, error) {
+	rel := tx.Relation{ID: relationID}
+
+	var replica string
+
+	err := r.conn.QueryRowEx(
+		ctx,
+		`SELECT n.nspname, c.relname, c.relreplident::text
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = $1;`,
+		nil,
+		relationID,
+	).Scan(&rel.Namespace, &rel.Name, &replica)
+	if err != nil {
+		return rel, fmt.Errorf("query relation: %w", err)
+	}
+
+	if len(replica) > 0 {
+		rel.Replica = int8(replica[0])
+	}
+
+	rows, err := r.conn.QueryEx(
+		ctx,
+		`SELECT a.attname, a.atttypid::int4, a.atttypmod,
+			COALESCE(c.relreplident = 'f' OR a.attnum = ANY(i.indkey), false)
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		LEFT JOIN pg_index i ON i.indrelid = a.attrelid
+			AND ((c.relreplident = 'd' AND i.indisprimary) OR (c.relreplident = 'i' AND i.indisreplident))
+		WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''
+		ORDER BY a.attnum;`,
+		nil,
+		relationID,
+	)
+	if err != nil {
+		return rel, fmt.Errorf("query columns: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var col tx.RelationColumn
+
+		if err := rows.Scan(&col.Name, &col.TypeID, &col.ModifierType, &col.Key); err != nil {
+			return rel, fmt.Errorf("scan column: %w", err)
+		}
+
+		rel.Columns = append(rel.Columns, col)
+	}
+
+	if err := rows.Err(); err != nil {
+		return rel, fmt.Errorf("rows: %w", err)
+	}
+
+	return rel, nil
+}
+
+// CompositeFields returns the attributes of the composite type, none if the type is not composite.
+func (r RepositoryImpl) CompositeFields(ctx context.Context, typeID int32) ([]tx.CompositeField, error) {
+	rows, err := r.conn.QueryEx(
+		ctx,
+		`SELECT a.attname, a.atttypid::int4
+		FROM pg_type t
+		JOIN pg_attribute a ON a.attrelid = t.typrelid
+		WHERE t.oid = $1 AND t.typtype = 'c' AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum;`,
+		nil,
+		typeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query composite type: %w", err)
+	}
+
+	defer rows.Close()
+
+	var fields []tx.CompositeField
+
+	for rows.Next() {
+		var (
+			field  tx.CompositeField
+			typeID int32
+		)
+
+		if err := rows.Scan(&field.Name, &typeID); err != nil {
+			return nil, fmt.Errorf("scan attribute: %w", err)
+		}
+
+		field.TypeID = int(typeID)
+		fields = append(fields, field)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return fields, nil
+}
+
+// RelationID returns the OID of the optionally schema-qualified table.
+func (r RepositoryImpl) RelationID(ctx context.Context, table string) (int32, error) {
+	var relationID int32
+
+	if err := r.conn.QueryRowEx(ctx, "SELECT $1::regclass::oid::int4;", nil, table).Scan(&relationID); err != nil {
+		return 0, fmt.Errorf("query relation id: %w", err)
+	}
+
+	return relationID, nil
+}
+
+// TableColumns returns the column names of the tables with the given name in any schema.
+func (r RepositoryImpl) TableColumns(ctx context.Context, table string) ([]string, error) {
+	rows, err := r.conn.QueryEx(
+		ctx,
+		`SELECT DISTINCT a.attname
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		WHERE c.relname = $1 AND c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped;`,
+		nil,
+		table,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query columns: %w", err)
+	}
+
+	defer rows.Close()
+
+	var columns []string
+
+	for rows.Next() {
+		var name string
+
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan column: %w", err)
+		}
+
+		columns = append(columns, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return columns, nil
+}
+
+// ColumnTags returns the comments or security labels of the table columns, the columns without one are omitted.
+func (r RepositoryImpl) ColumnTags(ctx context.Context, schema, table string, cfg config.ClassificationCfg) (map[string]string, error) {
+	query := `SELECT a.attname, col_description(a.attrelid, a.attnum)
+		FROM pg_attribute a
+		WHERE a.attrelid = (quote_ident($1) || '.' || quote_ident($2))::regclass
+			AND a.attnum > 0 AND NOT a.attisdropped AND col_description(a.attrelid, a.attnum) IS NOT NULL;`
+	args := []any{schema, table}
+
+	if cfg.Source == config.ClassificationSecurityLabel {
+		query = `SELECT a.attname, string_agg(s.label, ',')
+		FROM pg_seclabel s
+		JOIN pg_attribute a ON a.attrelid = s.objoid AND a.attnum = s.objsubid
+		WHERE s.classoid = 'pg_class'::regclass AND s.objoid = (quote_ident($1) || '.' || quote_ident($2))::regclass
+			AND NOT a.attisdropped AND ($3 = '' OR s.provider = $3)
+		GROUP BY a.attname;`
+		args = append(args, cfg.Provider)
+	}
+
+	rows, err := r.conn.QueryEx(ctx, query, nil, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tags: %w", err)
+	}
+
+	defer rows.Close()
+
+	tags := make(map[string]string)
+
+	for rows.Next() {
+		var column, tag string
+
+		if err := rows.Scan(&column, &tag); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+
+		tags[column] = tag
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// TopicRoutes returns the topic map stored in the table with the table_name and topic columns.
+func (r RepositoryImpl) TopicRoutes(ctx context.Context, table string) (map[string]string, error) {
+	rows, err := r.conn.QueryEx(
+		ctx,
+		`SELECT table_name, topic FROM `+pgx.Identifier(strings.Split(table, ".")).Sanitize()+`;`,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query routes: %w", err)
+	}
+
+	defer rows.Close()
+
+	routes := make(map[string]string)
+
+	for rows.Next() {
+		var name, topic string
+
+		if err := rows.Scan(&name, &topic); err != nil {
+			return nil, fmt.Errorf("scan route: %w", err)
+		}
+
+		routes[name] = topic
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return routes, nil
+}
+
+// IsUniqueColumn reports whether the column is covered by a single-column unique index (or the primary key).
+func (r RepositoryImpl) IsUniqueColumn(ctx context.Context, table, column string) (bool, error) {
+	var unique bool
+
+	err := r.conn.QueryRowEx(
+		ctx,
+		`SELECT EXISTS (
+			SELECT 1
+			FROM pg_index i
+			JOIN pg_class c ON c.oid = i.indrelid
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+			WHERE c.relname = $1 AND a.attname = $2 AND i.indisunique AND i.indnatts = 1
+		);`,
+		nil,
+		table,
+		column,
+	).Scan(&unique)
+	if err != nil {
+		return false, fmt.Errorf("query index: %w", err)
+	}
+
+	return unique, nil
+}
+
+// LookupValue returns the value column of the reference table row with the given key.
+func (r RepositoryImpl) LookupValue(ctx context.Context, table, keyColumn, valueColumn string, key any) (any, bool, error) {
+	rows, err := r.conn.QueryEx(
+		ctx,
+		fmt.Sprintf(
+			`SELECT %s FROM %s WHERE %s = $1 LIMIT 1;`,
+			pgx.Identifier{valueColumn}.Sanitize(),
+			pgx.Identifier(strings.Split(table, ".")).Sanitize(),
+			pgx.Identifier{keyColumn}.Sanitize(),
+		),
+		nil,
+		key,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("query value: %w", err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, false, rows.Err()
+	}
+
+	values, err := rows.Values()
+	if err != nil {
+		return nil, false, fmt.Errorf("values: %w", err)
+	}
+
+	return values[0], true, nil
+}
+
+// ReadSnapshot reads the rows of the tables in one repeatable read transaction.
+// The rows are passed in the shape of the WAL: the relation and the values in the text format.
+// They are read by a cursor in batches of batchSize rows, fn is called with each batch once it is read,
+// so fn can query the connection, e.g. to enrich the events.
+func (r RepositoryImpl) ReadSnapshot(
+	ctx context.Context,
+	tables []string,
+	batchSize int,
+	fn func(rel tx.Relation, rows [][]tx.TupleData) error,
+) (SnapshotPoint, error) {
+	var point SnapshotPoint
+
+	trx, err := r.conn.BeginEx(ctx, &pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return point, fmt.Errorf("begin: %w", err)
+	}
+
+	defer func() {
+		_ = trx.RollbackEx(ctx)
+	}()
+
+	var txidSnapshot, lsn string
+
+	// the snapshot is taken by the first statement, the WAL position is read after it.
+	if err := trx.QueryRowEx(
+		ctx,
+		"SELECT txid_current_snapshot()::text, pg_current_wal_insert_lsn()::text;",
+		nil,
+	).Scan(&txidSnapshot, &lsn); err != nil {
+		return point, fmt.Errorf("query snapshot: %w", err)
+	}
+
+	if point, err = parseSnapshotPoint(txidSnapshot, lsn); err != nil {
+		return point, err
+	}
+
+	for _, table := range tables {
+		var relationID int32
+
+		if err := trx.QueryRowEx(ctx, "SELECT $1::regclass::oid::int4;", nil, table).Scan(&relationID); err != nil {
+			return point, fmt.Errorf("query table %s: %w", table, err)
+		}
+
+		rel, err := r.LoadRelation(ctx, relationID)
+		if err != nil {
+			return point, fmt.Errorf("table %s: %w", table, err)
+		}
+
+		if err := r.readTable(ctx, trx, rel, batchSize, fn); err != nil {
+			return point, fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+
+	if err := trx.CommitEx(ctx); err != nil {
+		return point, fmt.Errorf("commit: %w", err)
+	}
+
+	return point, nil
+}
+
+// snapshotCursor is the cursor reading the rows of the snapshot table.
+const snapshotCursor = "wal_listener_snapshot"
+
+// readTable reads the rows of the relation with the values cast to text, as the WAL sends them.
+func (r RepositoryImpl) readTable(
+	ctx context.Context,
+	trx *pgx.Tx,
+	rel tx.Relation,
+	batchSize int,
+	fn func(rel tx.Relation, rows [][]tx.TupleData) error,
+) error {
+	columns := make([]string, 0, len(rel.Columns))
+
+	for _, col := range rel.Columns {
+		columns = append(columns, pgx.Identifier{col.Name}.Sanitize()+"::text")
+	}
+
+	if _, err := trx.ExecEx(
+		ctx,
+		fmt.Sprintf(
+			"DECLARE %s NO SCROLL CURSOR FOR SELECT %s FROM %s;",
+			snapshotCursor,
+			strings.Join(columns, ", "),
+			pgx.Identifier{rel.Namespace, rel.Name}.Sanitize(),
+		),
+		nil,
+	); err != nil {
+		return fmt.Errorf("declare cursor: %w", err)
+	}
+
+	for {
+		batch, err := fetchRows(ctx, trx, batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		if err := fn(rel, batch); err != nil {
+			return err
+		}
+	}
+
+	if _, err := trx.ExecEx(ctx, "CLOSE "+snapshotCursor+";", nil); err != nil {
+		return fmt.Errorf("close cursor: %w", err)
+	}
+
+	return nil
+}
+
+// fetchRows reads the next rows of the snapshot cursor, the result is closed before they are returned.
+func fetchRows(ctx context.Context, trx *pgx.Tx, limit int) ([][]tx.TupleData, error) {
+	rows, err := trx.QueryEx(ctx, fmt.Sprintf("FETCH FORWARD %d FROM %s;", limit, snapshotCursor), nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch rows: %w", err)
+	}
+
+	defer rows.Close()
+
+	var batch [][]tx.TupleData
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		row := make([]tx.TupleData, len(values))
+
+		for i, v := range values {
+			if s, ok := v.(string); ok {
+				row[i] = tx.TupleData{Value: []byte(s)}
+			}
+		}
+
+		batch = append(batch, row)
+	}
+
+	return batch, rows.Err()
+}
@@ -5,6 +5,9 @@ import (
 
 	"github.com/jackc/pgx"
 	"github.com/stretchr/testify/mock"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
 )
 
 type repositoryMock struct {
@@ -38,3 +41,47 @@ func (r *repositoryMock) IsReplicationActive(ctx context.Context, slotName strin
 	args := r.Called(ctx, slotName)
 	return args.Bool(0), args.Error(1)
 }
+
+func (r *repositoryMock) LoadRelation(ctx context.Context, relationID int32) (tx.Relation, error) {
+	args := r.Called(ctx, relationID)
+	return args.Get(0).(tx.Relation), args.Error(1)
+}
+
+func (r *repositoryMock) RelationID(ctx context.Context, table string) (int32, error) {
+	args := r.Called(ctx, table)
+	return args.Get(0).(int32), args.Error(1)
+}
+
+func (r *repositoryMock) TableColumns(ctx context.Context, table string) ([]string, error) {
+	args := r.Called(ctx, table)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (r *repositoryMock) ColumnTags(
+	ctx context.Context,
+	schema, table string,
+	cfg config.ClassificationCfg,
+) (map[string]string, error) {
+	args := r.Called(ctx, schema, table, cfg)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (r *repositoryMock) IsUniqueColumn(ctx context.Context, table, column string) (bool, error) {
+	args := r.Called(ctx, table, column)
+	return args.Bool(0), args.Error(1)
+}
+
+func (r *repositoryMock) LookupValue(ctx context.Context, table, keyColumn, valueColumn string, key any) (any, bool, error) {
+	args := r.Called(ctx, table, keyColumn, valueColumn, key)
+	return args.Get(0), args.Bool(1), args.Error(2)
+}
+
+func (r *repositoryMock) ReadSnapshot(
+	ctx context.Context,
+	tables []string,
+	batchSize int,
+	fn func(rel tx.Relation, rows [][]tx.TupleData) error,
+) (SnapshotPoint, error) {
+	args := r.Called(ctx, tables, batchSize, fn)
+	return args.Get(0).(SnapshotPoint), args.Error(1)
+}
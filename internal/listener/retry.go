@@ -0,0 +1,199 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	problemKindDeadLetter = "dead_letter"
+)
+
+// retry calls publish until it succeeds, the attempts are exhausted, the error is permanent or the context is done.
+// The retries are delayed by an exponential backoff with jitter. Returns the number of attempts.
+func (l *Listener) retry(ctx context.Context, publish func() error) (int, error) {
+	cfg := l.cfg.Publisher.Retry
+
+	for attempt := 1; ; attempt++ {
+		err := publish()
+		if err == nil || attempt >= cfg.MaxAttempts || publisher.IsPermanent(err) {
+			return attempt, err
+		}
+
+		delay := retryDelay(cfg, attempt)
+
+		l.log.Warn(
+			"publish failed, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.String("err", err.Error()),
+		)
+
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return attempt, errors.Join(err, sleepErr)
+		}
+	}
+}
+
+// publishMessage publishes the message with retries, see deadLetterUndelivered for the undelivered one.
+func (l *Listener) publishMessage(ctx context.Context, msg publisher.Message) error {
+	attempts, err := l.retry(ctx, func() error {
+		err := l.publisher.Publish(ctx, msg.Topic, msg.Event)
+		l.publishFailed([]publisher.Message{msg}, err)
+
+		return err
+	})
+	if err != nil {
+		return l.deadLetterUndelivered(ctx, []publisher.Message{msg}, attempts, err)
+	}
+
+	l.eventSent(msg.Topic, msg.Event)
+
+	return nil
+}
+
+// publishFailed counts the messages of the failed publish attempt: the failed ones if the batch was partially delivered.
+func (l *Listener) publishFailed(messages []publisher.Message, err error) {
+	if err == nil {
+		return
+	}
+
+	for _, f := range undeliveredMessages(messages, err) {
+		l.monitor.IncPublishErrors(f.Event.Table)
+	}
+}
+
+// deadLetterUndelivered sends the messages that failed after the retries to the dead-letter topic, if configured,
+// so the listener goes on. Only the messages that fail again on retry are dead-lettered: if a message failed with
+// a transient error, e.g. the broker is down, or a dead letter can't be stored, the publish error is returned:
+// the listener stops and the messages are sent again after the replication restarts.
+func (l *Listener) deadLetterUndelivered(
+	ctx context.Context,
+	messages []publisher.Message,
+	attempts int,
+	err error,
+) error {
+	if !l.cfg.Publisher.Retry.DeadLetter || ctx.Err() != nil {
+		return err
+	}
+
+	undelivered := undeliveredMessages(messages, err)
+	if slices.ContainsFunc(undelivered, func(f publisher.FailedMessage) bool { return !publisher.IsPermanent(f.Err) }) {
+		return err
+	}
+
+	dlp, ok := l.deadLetterPublisher()
+	if !ok {
+		return err
+	}
+
+	for _, f := range undelivered {
+		if dlErr := dlp.PublishDeadLetter(ctx, l.cfg.Publisher.DeadLetterTopic, &publisher.DeadLetter{
+			Event:     f.Event,
+			Topic:     f.Topic,
+			Key:       f.Event.Key,
+			Error:     f.Err.Error(),
+			Attempts:  attempts,
+			Timestamp: time.Now(),
+		}); dlErr != nil {
+			l.log.Error(
+				"publish dead letter",
+				slog.String("topic", f.Topic),
+				slog.String("err", dlErr.Error()),
+			)
+
+			return err
+		}
+
+		l.monitor.IncProblematicEvents(problemKindDeadLetter)
+		l.log.Warn(
+			"undelivered event was dead-lettered",
+			slog.String("topic", f.Topic),
+			slog.Int("attempts", attempts),
+			slog.String("err", f.Err.Error()),
+		)
+	}
+
+	return nil
+}
+
+// undeliveredMessages returns the messages that were not delivered with their errors:
+// the failed ones if the batch was partially delivered.
+func undeliveredMessages(messages []publisher.Message, err error) []publisher.FailedMessage {
+	var batchErr *publisher.BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Failed
+	}
+
+	failed := make([]publisher.FailedMessage, 0, len(messages))
+
+	for _, msg := range messages {
+		failed = append(failed, publisher.FailedMessage{Message: msg, Err: err})
+	}
+
+	return failed
+}
+
+// retryDelay returns the backoff after the failed attempt.
+func retryDelay(cfg config.RetryCfg, attempt int) time.Duration {
+	delay := cfg.BaseDelay
+	if delay <= 0 {
+		delay = defaultRetryBaseDelay
+	}
+
+	for i := 1; i < attempt && (cfg.MaxDelay <= 0 || delay < cfg.MaxDelay); i++ {
+		delay *= 2
+	}
+
+	if cfg.MaxDelay > 0 && delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+
+	if jitter := time.Duration(float64(delay) * cfg.Jitter); jitter > 0 {
+		delay += rand.N(jitter)
+	}
+
+	return delay
+}
+
+// failedMessages returns the messages to send again. If the batch was partially delivered, these are the failed
+// messages and the messages after them with the same topic and key: the events of a key are delivered in order.
+func failedMessages(messages []publisher.Message, err error) []publisher.Message {
+	var batchErr *publisher.BatchError
+	if !errors.As(err, &batchErr) {
+		return messages
+	}
+
+	type messageKey struct{ topic, key string }
+
+	failed := make(map[publisher.Message]struct{}, len(batchErr.Failed))
+
+	for _, f := range batchErr.Failed {
+		failed[f.Message] = struct{}{}
+	}
+
+	var (
+		resend []publisher.Message
+		keys   = make(map[messageKey]struct{}, len(failed))
+	)
+
+	for _, msg := range messages {
+		key := messageKey{topic: msg.Topic, key: msg.Event.Key}
+
+		_, isFailed := failed[msg]
+		if _, blocked := keys[key]; isFailed || blocked {
+			keys[key] = struct{}{}
+			resend = append(resend, msg)
+		}
+	}
+
+	return resend
+}
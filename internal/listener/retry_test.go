@@ -0,0 +1,252 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+type batchPublisherMock struct {
+	publisherMock
+}
+
+func (p *batchPublisherMock) PublishBatch(ctx context.Context, messages []publisher.Message) error {
+	args := p.Called(ctx, messages)
+	return args.Error(0)
+}
+
+func TestListener_retry(t *testing.T) {
+	errBroker := errors.New("broker is down")
+
+	newListener := func(pub eventPublisher) *Listener {
+		return &Listener{
+			cfg: &config.Config{Publisher: &config.PublisherCfg{
+				Retry: config.RetryCfg{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			}},
+			log:       slog.New(slog.NewJSONHandler(io.Discard, nil)),
+			monitor:   new(monitorMock),
+			publisher: pub,
+		}
+	}
+
+	event := &publisher.Event{Table: "users"}
+	messages := []publisher.Message{{Topic: "wal.public_users", Event: event}}
+
+	t.Run("recovered", func(t *testing.T) {
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(errBroker).Twice()
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(nil).Once()
+
+		l := newListener(pub)
+
+		require.NoError(t, l.sendBatch(context.Background(), messages))
+		assert.Equal(t, map[string]int{"users": 2}, l.monitor.(*monitorMock).publishErrors)
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("publish latency", func(t *testing.T) {
+		committed := &publisher.Event{Table: "users", EventTime: time.Now().Add(-time.Minute)}
+
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", committed).Return(nil).Once()
+
+		l := newListener(pub)
+
+		require.NoError(t, l.publishMessage(context.Background(), publisher.Message{Topic: "wal.public_users", Event: committed}))
+
+		latency := l.monitor.(*monitorMock).publishLatency["users"]
+		require.Len(t, latency, 1)
+		assert.GreaterOrEqual(t, latency[0], time.Minute)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(errBroker).Times(3)
+
+		require.ErrorIs(t, newListener(pub).sendBatch(context.Background(), messages), errBroker)
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(publisher.Permanent(errBroker)).Once()
+
+		require.ErrorIs(t, newListener(pub).sendBatch(context.Background(), messages), errBroker)
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(errBroker).Once()
+
+		err := newListener(pub).sendBatch(ctx, messages)
+		require.ErrorIs(t, err, errBroker)
+		require.ErrorIs(t, err, context.Canceled)
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("failed messages of the batch", func(t *testing.T) {
+		other := publisher.Message{Topic: "wal.public_orders", Event: &publisher.Event{Table: "orders"}}
+		batch := append([]publisher.Message{other}, messages...)
+
+		pub := new(batchPublisherMock)
+		pub.On("PublishBatch", mock.Anything, batch).Return(&publisher.BatchError{
+			Failed: []publisher.FailedMessage{{Message: messages[0], Err: errBroker}},
+			Total:  2,
+		}).Once()
+		pub.On("PublishBatch", mock.Anything, messages).Return(nil).Once()
+
+		l := newListener(pub)
+
+		require.NoError(t, l.sendBatch(context.Background(), batch))
+		assert.Equal(t, map[string]int{"users": 1}, l.monitor.(*monitorMock).publishErrors, "the failed message only")
+		pub.AssertExpectations(t)
+	})
+
+	t.Run("messages after the failed key", func(t *testing.T) {
+		newMessage := func(key string) publisher.Message {
+			return publisher.Message{Topic: "wal.public_users", Event: &publisher.Event{Table: "users", Key: key}}
+		}
+
+		failed, other, later := newMessage("1"), newMessage("2"), newMessage("1")
+		batch := []publisher.Message{failed, other, later}
+
+		pub := new(batchPublisherMock)
+		pub.On("PublishBatch", mock.Anything, batch).Return(&publisher.BatchError{
+			Failed: []publisher.FailedMessage{{Message: failed, Err: errBroker}},
+			Total:  3,
+		}).Once()
+		pub.On("PublishBatch", mock.Anything, []publisher.Message{failed, later}).Return(nil).Once()
+
+		l := newListener(pub)
+
+		require.NoError(t, l.sendBatch(context.Background(), batch))
+		assert.Equal(t, map[string]int{"users": 1}, l.monitor.(*monitorMock).publishErrors)
+		pub.AssertExpectations(t)
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	cfg := config.RetryCfg{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, retryDelay(cfg, 1))
+	assert.Equal(t, 400*time.Millisecond, retryDelay(cfg, 3))
+	assert.Equal(t, time.Second, retryDelay(cfg, 10), "capped")
+	assert.Equal(t, defaultRetryBaseDelay, retryDelay(config.RetryCfg{}, 1))
+
+	cfg.Jitter = 0.5
+
+	for range 10 {
+		delay := retryDelay(cfg, 1)
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.Less(t, delay, 150*time.Millisecond)
+	}
+}
+
+func TestListener_deadLetterUndelivered(t *testing.T) {
+	errTooLarge := publisher.Permanent(errors.New("message too large"))
+	errBroker := errors.New("broker is down")
+
+	newListener := func(pub eventPublisher, dlp deadLetterPublisher) *Listener {
+		return &Listener{
+			cfg: &config.Config{Publisher: &config.PublisherCfg{
+				DeadLetterTopic: "wal.dlq",
+				Retry:           config.RetryCfg{MaxAttempts: 2, BaseDelay: time.Millisecond, DeadLetter: true},
+			}},
+			log:        slog.New(slog.NewJSONHandler(io.Discard, nil)),
+			monitor:    new(monitorMock),
+			publisher:  pub,
+			deadLetter: dlp,
+		}
+	}
+
+	event := &publisher.Event{Table: "users", Key: "1"}
+	msg := publisher.Message{Topic: "wal.public_users", Event: event}
+
+	t.Run("dead-lettered", func(t *testing.T) {
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(errTooLarge).Once()
+
+		dlp := new(deadLetterPublisherMock)
+		dlp.On("PublishDeadLetter", mock.Anything, "wal.dlq", mock.MatchedBy(func(dl *publisher.DeadLetter) bool {
+			return dl.Event == event && dl.Topic == "wal.public_users" && dl.Key == "1" &&
+				dl.Error == "message too large" && dl.Attempts == 1 && !dl.Timestamp.IsZero()
+		})).Return(nil).Once()
+
+		require.NoError(t, newListener(pub, dlp).publishMessage(context.Background(), msg))
+		pub.AssertExpectations(t)
+		dlp.AssertExpectations(t)
+	})
+
+	t.Run("transient error", func(t *testing.T) {
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(errBroker).Twice()
+
+		dlp := new(deadLetterPublisherMock)
+
+		err := newListener(pub, dlp).publishMessage(context.Background(), msg)
+		require.ErrorIs(t, err, errBroker, "the listener stops, the event is sent again after the restart")
+		pub.AssertExpectations(t)
+		dlp.AssertNotCalled(t, "PublishDeadLetter", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("dead letter failure", func(t *testing.T) {
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, "wal.public_users", event).Return(errTooLarge).Once()
+
+		dlp := new(deadLetterPublisherMock)
+		dlp.On("PublishDeadLetter", mock.Anything, "wal.dlq", mock.Anything).Return(errors.New("dlq is down")).Once()
+
+		err := newListener(pub, dlp).publishMessage(context.Background(), msg)
+		require.ErrorIs(t, err, errTooLarge, "the listener stops with the publish error")
+		dlp.AssertExpectations(t)
+	})
+
+	t.Run("failed messages of the batch", func(t *testing.T) {
+		other := publisher.Message{Topic: "wal.public_orders", Event: &publisher.Event{Table: "orders"}}
+		batchErr := &publisher.BatchError{Failed: []publisher.FailedMessage{{Message: msg, Err: errTooLarge}}, Total: 2}
+
+		pub := new(batchPublisherMock)
+		pub.On("PublishBatch", mock.Anything, []publisher.Message{other, msg}).Return(batchErr).Once()
+
+		dlp := new(deadLetterPublisherMock)
+		dlp.On("PublishDeadLetter", mock.Anything, "wal.dlq", mock.MatchedBy(func(dl *publisher.DeadLetter) bool {
+			return dl.Event == event && dl.Error == "message too large"
+		})).Return(nil).Once()
+
+		require.NoError(t, newListener(pub, dlp).sendBatch(context.Background(), []publisher.Message{other, msg}))
+		pub.AssertExpectations(t)
+		dlp.AssertExpectations(t)
+	})
+
+	t.Run("transient failure in the batch", func(t *testing.T) {
+		other := publisher.Message{Topic: "wal.public_orders", Event: &publisher.Event{Table: "orders"}}
+		batchErr := &publisher.BatchError{Failed: []publisher.FailedMessage{
+			{Message: other, Err: errBroker},
+			{Message: msg, Err: errTooLarge},
+		}, Total: 2}
+
+		pub := new(batchPublisherMock)
+		pub.On("PublishBatch", mock.Anything, []publisher.Message{other, msg}).Return(batchErr).Twice()
+
+		dlp := new(deadLetterPublisherMock)
+
+		err := newListener(pub, dlp).sendBatch(context.Background(), []publisher.Message{other, msg})
+		require.ErrorIs(t, err, errBroker, "retried, then the listener stops")
+		pub.AssertExpectations(t)
+		dlp.AssertNotCalled(t, "PublishDeadLetter", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,150 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+const defaultRoutesRefreshInterval = time.Minute
+
+// RouteLoader loads the topic map, see FileRoutes and TableRoutes.
+type RouteLoader interface {
+	LoadRoutes(ctx context.Context) (map[string]string, error)
+}
+
+type topicChecker interface {
+	CheckTopics(ctx context.Context, topics []string) error
+}
+
+// FileRoutes loads the topic map from a yaml (or json) file.
+type FileRoutes string
+
+// LoadRoutes reads the file, implements RouteLoader.
+func (f FileRoutes) LoadRoutes(_ context.Context) (map[string]string, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	var routes map[string]string
+
+	if err := yaml.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return routes, nil
+}
+
+// TableRoutes loads the topic map from a database table.
+// A connection is opened per load, so a refresh doesn't depend on a long-lived connection.
+type TableRoutes struct {
+	Conn  pgx.ConnConfig
+	Table string
+}
+
+// LoadRoutes queries the table, implements RouteLoader.
+func (t TableRoutes) LoadRoutes(ctx context.Context) (map[string]string, error) {
+	conn, err := pgx.Connect(t.Conn)
+	if err != nil {
+		return nil, fmt.Errorf("db connection: %w", err)
+	}
+
+	defer conn.Close()
+
+	return NewRepository(conn).TopicRoutes(ctx, t.Table)
+}
+
+// TopicRouter keeps the topic map loaded from an external source.
+// The loaded routes take precedence over the static topic map of the config.
+type TopicRouter struct {
+	cfg     *config.Config
+	log     *slog.Logger
+	loader  RouteLoader
+	checker topicChecker
+	routes  atomic.Pointer[map[string]string]
+}
+
+// NewTopicRouter returns a router serving the static topic map until the first refresh.
+// The checker is optional: routed topics are only validated when it is set.
+func NewTopicRouter(cfg *config.Config, log *slog.Logger, loader RouteLoader, checker topicChecker) *TopicRouter {
+	r := &TopicRouter{cfg: cfg, log: log, loader: loader, checker: checker}
+	static := maps.Clone(cfg.Listener.TopicsMap)
+	r.routes.Store(&static)
+
+	return r
+}
+
+// TopicsMap returns the current topic map.
+func (r *TopicRouter) TopicsMap() map[string]string {
+	return *r.routes.Load()
+}
+
+// Refresh loads the routes and replaces the topic map.
+// The current topic map is kept if the routes can't be loaded or point to unknown topics.
+func (r *TopicRouter) Refresh(ctx context.Context) error {
+	loaded, err := r.loader.LoadRoutes(ctx)
+	if err != nil {
+		return fmt.Errorf("load routes: %w", err)
+	}
+
+	if r.checker != nil {
+		topics := make([]string, 0, len(loaded))
+
+		for _, topic := range loaded {
+			// the topics of the templates depend on the events.
+			if !publisher.IsTopicTemplate(topic) {
+				topics = append(topics, publisher.TopicName(r.cfg, topic))
+			}
+		}
+
+		slices.Sort(topics)
+
+		if err := r.checker.CheckTopics(ctx, slices.Compact(topics)); err != nil {
+			return fmt.Errorf("check topics: %w", err)
+		}
+	}
+
+	routes := maps.Clone(r.cfg.Listener.TopicsMap)
+	if routes == nil {
+		routes = make(map[string]string, len(loaded))
+	}
+
+	maps.Copy(routes, loaded)
+	r.routes.Store(&routes)
+
+	return nil
+}
+
+// Run refreshes the routes periodically until the context is done.
+func (r *TopicRouter) Run(ctx context.Context) {
+	interval := r.cfg.Listener.TopicsMapSource.RefreshInterval
+	if interval <= 0 {
+		interval = defaultRoutesRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil {
+				r.log.Error("refresh topic routes failed, keeping the current ones", "err", err)
+			}
+		}
+	}
+}
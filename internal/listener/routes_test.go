@@ -0,0 +1,101 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+type topicCheckerFunc func(ctx context.Context, topics []string) error
+
+func (f topicCheckerFunc) CheckTopics(ctx context.Context, topics []string) error {
+	return f(ctx, topics)
+}
+
+func TestTopicRouter_Refresh(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "routes.yml")
+
+	writeRoutes := func(t *testing.T, data string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	}
+
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			TopicsMap: map[string]string{"public_users": "users", "public_orders": "orders"},
+		},
+		Publisher: &config.PublisherCfg{Topic: "wal"},
+	}
+
+	t.Run("routing change takes effect after refresh", func(t *testing.T) {
+		writeRoutes(t, "public_orders: billing\n")
+
+		router := NewTopicRouter(cfg, logger, FileRoutes(path), nil)
+		l := &Listener{cfg: cfg, log: logger, router: router}
+		event := &publisher.Event{Schema: "public", Table: "orders"}
+
+		subject, err := l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+		assert.Equal(t, "wal.orders", subject)
+
+		require.NoError(t, router.Refresh(context.Background()))
+
+		subject, err = l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+		assert.Equal(t, "wal.billing", subject)
+
+		writeRoutes(t, "public_orders: invoices\n")
+		require.NoError(t, router.Refresh(context.Background()))
+
+		subject, err = l.prepareEvent(context.Background(), event)
+		require.NoError(t, err)
+		assert.Equal(t, "wal.invoices", subject)
+		assert.Equal(t, "users", router.TopicsMap()["public_users"])
+	})
+
+	t.Run("unknown topic keeps the current routes", func(t *testing.T) {
+		writeRoutes(t, "public_orders: billing\n")
+
+		var checked []string
+
+		checker := topicCheckerFunc(func(_ context.Context, topics []string) error {
+			checked = topics
+
+			if topics[0] == "wal.missing" {
+				return errors.New("unknown topics: wal.missing")
+			}
+
+			return nil
+		})
+
+		router := NewTopicRouter(cfg, logger, FileRoutes(path), checker)
+		require.NoError(t, router.Refresh(context.Background()))
+		assert.Equal(t, []string{"wal.billing"}, checked)
+
+		writeRoutes(t, "public_orders: missing\n")
+		assert.EqualError(t, router.Refresh(context.Background()), "check topics: unknown topics: wal.missing")
+		assert.Equal(t, "billing", router.TopicsMap()["public_orders"])
+	})
+
+	t.Run("broken file keeps the current routes", func(t *testing.T) {
+		writeRoutes(t, "public_orders: billing\n")
+
+		router := NewTopicRouter(cfg, logger, FileRoutes(path), nil)
+		require.NoError(t, router.Refresh(context.Background()))
+
+		writeRoutes(t, "public_orders: [")
+		assert.Error(t, router.Refresh(context.Background()))
+		assert.Equal(t, "billing", router.TopicsMap()["public_orders"])
+	})
+}
@@ -0,0 +1,157 @@
+package listener
+
+import (
+	"context"
+
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// publishJob is the prepared event and its messages.
+type publishJob struct {
+	event    *publisher.Event
+	messages []publisher.Message
+	worker   int // publish worker of the row, taken before the key columns can be protected
+}
+
+// routeEvents prepares the events in order and returns them with their messages. The returned function reports
+// the routing failure once the jobs are consumed. With the sequence enabled the jobs are held until the last event
+// is routed, so the messages are numbered as published.
+func (l *Listener) routeEvents(
+	ctx context.Context,
+	txWAL *tx.WAL,
+	events <-chan *publisher.Event,
+) (<-chan publishJob, func() error) {
+	jobs := make(chan publishJob)
+	errCh := make(chan error, 1)
+
+	send := func(job publishJob) bool {
+		select {
+		case jobs <- job:
+			return true
+		case <-ctx.Done():
+			txWAL.RetrieveEvent(job.event)
+			return false
+		}
+	}
+
+	go func() {
+		defer close(jobs)
+		defer drainEvents(txWAL, events)
+
+		var (
+			held   []publishJob
+			shards *rowShards
+		)
+
+		if l.cfg.Publisher != nil && l.cfg.Publisher.Workers > 1 {
+			shards = newRowShards(l.cfg.Publisher.Workers)
+		}
+
+		for event := range events {
+			job, ok, err := l.routeEvent(ctx, txWAL, shards, event)
+			if err != nil {
+				errCh <- err
+
+				for _, job := range held {
+					txWAL.RetrieveEvent(job.event)
+				}
+
+				return
+			}
+
+			switch {
+			case !ok:
+			case l.cfg.Listener.Sequence:
+				held = append(held, job)
+			case !send(job):
+				return
+			}
+		}
+
+		numberMessages(held)
+
+		for i, job := range held {
+			if !send(job) {
+				for _, job := range held[i+1:] {
+					txWAL.RetrieveEvent(job.event)
+				}
+
+				return
+			}
+		}
+	}()
+
+	return jobs, func() error {
+		select {
+		case err := <-errCh:
+			return err
+		default:
+			return nil
+		}
+	}
+}
+
+// routeEvent prepares the event and returns its messages, false if the event is not published.
+// The worker of the row is taken from the shards of the transaction, nil without the publish workers.
+func (l *Listener) routeEvent(
+	ctx context.Context,
+	txWAL *tx.WAL,
+	shards *rowShards,
+	event *publisher.Event,
+) (publishJob, bool, error) {
+	job := publishJob{event: event}
+
+	if shards != nil {
+		job.worker = shards.worker(event)
+	}
+
+	subjectName, err := l.prepareEvent(ctx, event)
+	if err != nil {
+		return job, false, err
+	}
+
+	ok, err := l.checkContract(ctx, subjectName, event)
+	if err != nil {
+		return job, false, err
+	}
+
+	if !ok {
+		txWAL.RetrieveEvent(event)
+		return job, false, nil
+	}
+
+	job.messages = l.messages(subjectName, event)
+
+	return job, true, nil
+}
+
+// numberMessages sets the position of each message among the messages of the transaction published to its topic,
+// and their count, so the consumers of a topic can detect missing events. An event published to several topics
+// is copied for each of them.
+func numberMessages(jobs []publishJob) {
+	totals := make(map[string]int)
+
+	for _, job := range jobs {
+		for _, msg := range job.messages {
+			totals[msg.Topic]++
+		}
+	}
+
+	next := make(map[string]int, len(totals))
+
+	for _, job := range jobs {
+		for i, msg := range job.messages {
+			if len(job.messages) > 1 {
+				msg.Event = ownCopy(msg.Event, job.event)
+			}
+
+			seq, total := next[msg.Topic], totals[msg.Topic]
+			next[msg.Topic]++
+
+			msg.Event.Seq = &seq
+			msg.Event.SeqTotal = &total
+			job.messages[i] = msg
+		}
+	}
+}
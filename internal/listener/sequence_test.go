@@ -0,0 +1,84 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+func TestListener_publishEvents_Sequence(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	newWAL := func() *tx.WAL {
+		pool := &sync.Pool{New: func() any { return &publisher.Event{} }}
+		txWAL := tx.NewWAL(logger, pool, new(monitorMock), &config.ListenerCfg{}, nil)
+		now := time.Now()
+		txWAL.CommitTime = &now
+
+		row := func(kind tx.ActionKind, table string, id int) tx.ActionData {
+			columns := []tx.Column{tx.InitColumn(logger, "id", id, 23, true)}
+			if kind == tx.ActionKindDelete {
+				return tx.ActionData{Schema: "public", Table: table, Kind: kind, OldColumns: columns}
+			}
+
+			return tx.ActionData{Schema: "public", Table: table, Kind: kind, NewColumns: columns}
+		}
+
+		txWAL.Actions = []tx.ActionData{
+			row(tx.ActionKindInsert, "users", 1),
+			row(tx.ActionKindInsert, "audit_log", 1), // filtered out, not counted
+			row(tx.ActionKindUpdate, "users", 1),
+			row(tx.ActionKindDelete, "users", 1),
+		}
+
+		return txWAL
+	}
+
+	type seq struct {
+		action     string
+		seq, total int
+	}
+
+	for _, size := range []int{0, 10} {
+		cfg := &config.Config{
+			Listener: &config.ListenerCfg{
+				Sequence: true,
+				Filter: config.FilterStruct{
+					Tables: map[string][]string{"users": {"insert", "update", "delete"}},
+				},
+				Fanout: map[string][]string{"public_users": {"search"}},
+				Topics: map[string]config.TopicCfg{"search": {Actions: []string{"insert", "delete"}}},
+			},
+			Publisher: &config.PublisherCfg{Topic: "wal", Batch: config.BatchCfg{Size: size}},
+		}
+
+		got := make(map[string][]seq)
+		pub := new(publisherMock)
+		pub.On("Publish", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			event := args.Get(2).(*publisher.Event)
+			require.NotNil(t, event.Seq)
+			require.NotNil(t, event.SeqTotal)
+
+			got[args.String(1)] = append(got[args.String(1)], seq{event.Action, *event.Seq, *event.SeqTotal})
+		}).Return(nil)
+
+		l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub}
+
+		require.NoError(t, l.publishEvents(context.Background(), newWAL()))
+		assert.Equal(t, map[string][]seq{
+			"wal.public_users": {{"INSERT", 0, 3}, {"UPDATE", 1, 3}, {"DELETE", 2, 3}},
+			"wal.search":       {{"INSERT", 0, 2}, {"DELETE", 1, 2}}, // the update isn't published to the topic
+		}, got, "batch size %d", size)
+	}
+}
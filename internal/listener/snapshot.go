@@ -0,0 +1,195 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+)
+
+const defaultSnapshotBatchSize = 1000
+
+// SnapshotPoint is the position of the initial snapshot in the WAL.
+type SnapshotPoint struct {
+	LSN        uint64 // WAL insert position read after the snapshot was taken
+	Xmin, Xmax uint64
+	Xip        []uint64 // transactions in progress when the snapshot was taken
+}
+
+// parseSnapshotPoint parses the txid_current_snapshot text form xmin:xmax:xip,... and the WAL position.
+func parseSnapshotPoint(txidSnapshot, lsn string) (SnapshotPoint, error) {
+	var point SnapshotPoint
+
+	parts := strings.Split(txidSnapshot, ":")
+	if len(parts) != 3 {
+		return point, fmt.Errorf("invalid txid snapshot: %s", txidSnapshot)
+	}
+
+	var err error
+
+	if point.Xmin, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return point, fmt.Errorf("parse xmin: %w", err)
+	}
+
+	if point.Xmax, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return point, fmt.Errorf("parse xmax: %w", err)
+	}
+
+	if parts[2] != "" {
+		for _, s := range strings.Split(parts[2], ",") {
+			xid, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return point, fmt.Errorf("parse xip: %w", err)
+			}
+
+			point.Xip = append(point.Xip, xid)
+		}
+	}
+
+	if point.LSN, err = pgx.ParseLSN(lsn); err != nil {
+		return point, fmt.Errorf("parse lsn: %w", err)
+	}
+
+	return point, nil
+}
+
+// visible reports whether the committed transaction was visible to the snapshot, so its changes are in the snapshot.
+// The 32-bit xid of the WAL is extended with the epoch of the snapshot.
+func (p SnapshotPoint) visible(xid int32) bool {
+	const epochShift = 32
+
+	full := p.Xmax>>epochShift<<epochShift | uint64(uint32(xid))
+	if full > p.Xmax && full >= 1<<epochShift {
+		full -= 1 << epochShift
+	}
+
+	if full < p.Xmin {
+		return true
+	}
+
+	return full < p.Xmax && !slices.Contains(p.Xip, full)
+}
+
+// snapshotHandover suppresses the streamed changes already contained in the initial snapshot.
+type snapshotHandover struct {
+	point  SnapshotPoint
+	tables map[string]struct{} // schema.table
+}
+
+// snapshotTable returns the schema-qualified name of the configured snapshot table.
+func snapshotTable(table string) string {
+	if strings.Contains(table, ".") {
+		return table
+	}
+
+	return "public." + table
+}
+
+// initialSnapshot publishes the current rows of the snapshot tables as inserts.
+// Each batch is published once it is read, so the enrichment and the classification can query the connection.
+// The streamed transactions visible to the snapshot are suppressed for these tables until the handover.
+func (l *Listener) initialSnapshot(ctx context.Context) error {
+	cfg := l.cfg.Listener.Snapshot
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSnapshotBatchSize
+	}
+
+	snapWAL := tx.NewWAL(l.log, l.newEventPool(), l.monitor, l.cfg.Listener, nil)
+
+	var rows int
+
+	point, err := l.repository.ReadSnapshot(ctx, cfg.Tables, batchSize, func(rel tx.Relation, batch [][]tx.TupleData) error {
+		if _, ok := snapWAL.RelationStore[rel.ID]; !ok {
+			snapWAL.SetRelation(rel)
+		}
+
+		for _, row := range batch {
+			action, err := snapWAL.CreateActionData(rel.ID, nil, row, tx.ActionKindInsert)
+			if err != nil {
+				return fmt.Errorf("create action data: %w", err)
+			}
+
+			snapWAL.Actions = append(snapWAL.Actions, action)
+		}
+
+		now := time.Now()
+		snapWAL.CommitTime = &now
+
+		if err := l.publishEvents(ctx, snapWAL); err != nil {
+			return err
+		}
+
+		rows += len(snapWAL.Actions)
+		snapWAL.Actions = snapWAL.Actions[:0]
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	handover := &snapshotHandover{point: point, tables: make(map[string]struct{}, len(cfg.Tables))}
+
+	for _, table := range cfg.Tables {
+		handover.tables[snapshotTable(table)] = struct{}{}
+	}
+
+	l.state.snapshot = handover
+
+	l.log.Info(
+		"initial snapshot was published",
+		slog.Int("rows", rows),
+		slog.String("lsn", pgx.FormatLSN(point.LSN)),
+	)
+
+	return nil
+}
+
+// dropSnapshotted removes the changes of the snapshot tables from the committed transaction
+// if the snapshot already contains them. The handover is completed by the first commit after the snapshot.
+func (l *Listener) dropSnapshotted(txWAL *tx.WAL) {
+	if l.state.snapshot == nil {
+		return
+	}
+
+	if uint64(txWAL.LSN) > l.state.snapshot.point.LSN {
+		l.state.snapshot = nil
+		l.log.Info("snapshot handover completed", slog.String("lsn", pgx.FormatLSN(uint64(txWAL.LSN))))
+
+		return
+	}
+
+	if !l.state.snapshot.point.visible(txWAL.XID) {
+		return
+	}
+
+	kept := txWAL.Actions[:0]
+
+	for _, action := range txWAL.Actions {
+		if _, ok := l.state.snapshot.tables[action.Schema+"."+action.Table]; ok {
+			l.monitor.IncFilterSkippedEvents(action.Table)
+			continue
+		}
+
+		kept = append(kept, action)
+	}
+
+	if dropped := len(txWAL.Actions) - len(kept); dropped > 0 {
+		l.log.Debug(
+			"changes already contained in the snapshot were skipped",
+			slog.Any("xid", txWAL.XID),
+			slog.Int("actions", dropped),
+		)
+	}
+
+	txWAL.Actions = kept
+}
@@ -0,0 +1,246 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+func TestParseSnapshotPoint(t *testing.T) {
+	point, err := parseSnapshotPoint("100:105:102,104", "0/64")
+	require.NoError(t, err)
+	assert.Equal(t, SnapshotPoint{LSN: 100, Xmin: 100, Xmax: 105, Xip: []uint64{102, 104}}, point)
+
+	for xid, want := range map[int32]bool{99: true, 100: true, 102: false, 103: true, 105: false, 110: false} {
+		assert.Equal(t, want, point.visible(xid), "xid %d", xid)
+	}
+
+	point, err = parseSnapshotPoint("4294967300:4294967310:", "0/64")
+	require.NoError(t, err)
+	assert.True(t, point.visible(5), "xid of the snapshot epoch")
+	assert.True(t, point.visible(-10), "xid of the previous epoch")
+	assert.False(t, point.visible(14), "xid after the snapshot")
+
+	_, err = parseSnapshotPoint("100:105", "0/64")
+	assert.EqualError(t, err, "invalid txid snapshot: 100:105")
+}
+
+func TestListener_initialSnapshot_Handover(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			Filter:   config.FilterStruct{Tables: map[string][]string{"users": {"insert", "update"}}},
+			Snapshot: config.SnapshotCfg{Tables: []string{"users"}},
+		},
+		Publisher: &config.PublisherCfg{Topic: "wal"},
+	}
+
+	users := tx.Relation{
+		ID:        16384,
+		Namespace: "public",
+		Name:      "users",
+		Columns: []tx.RelationColumn{
+			{Key: true, Name: "id", TypeID: pgtype.Int4OID},
+			{Name: "email", TypeID: pgtype.TextOID},
+		},
+	}
+
+	// the row was updated by the transaction 52 while the snapshot was taken:
+	// the snapshot sees the update, the stream delivers it after the snapshot.
+	repo := new(repositoryMock)
+	repo.On("ReadSnapshot", mock.Anything, []string{"users"}, defaultSnapshotBatchSize, mock.Anything).Run(func(args mock.Arguments) {
+		fn := args.Get(3).(func(rel tx.Relation, rows [][]tx.TupleData) error)
+		require.NoError(t, fn(users, [][]tx.TupleData{{{Value: []byte("1")}, {Value: []byte("new@doe.com")}}}))
+	}).Return(SnapshotPoint{LSN: 100, Xmin: 50, Xmax: 60, Xip: []uint64{55}}, nil).Once()
+
+	var published []publisher.Event
+
+	pub := new(publisherMock)
+	pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Run(func(args mock.Arguments) {
+		published = append(published, *args.Get(2).(*publisher.Event))
+	}).Return(nil)
+
+	l := &Listener{cfg: cfg, log: logger, monitor: new(monitorMock), publisher: pub, repository: repo, state: NewStreamState()}
+
+	require.NoError(t, l.initialSnapshot(context.Background()))
+	require.Len(t, published, 1)
+	assert.Equal(t, "INSERT", published[0].Action)
+	assert.Equal(t, map[string]any{"id": 1, "email": "new@doe.com"}, published[0].Data)
+
+	txWAL := tx.NewWAL(logger, &sync.Pool{New: func() any { return &publisher.Event{} }}, new(monitorMock), cfg.Listener, nil)
+
+	commit := func(xid int32, lsn int64, email string) {
+		now := time.Now()
+
+		txWAL.XID = xid
+		txWAL.LSN = lsn
+		txWAL.CommitTime = &now
+		txWAL.Actions = []tx.ActionData{{
+			Schema: "public",
+			Table:  "users",
+			Kind:   tx.ActionKindUpdate,
+			NewColumns: []tx.Column{
+				tx.InitColumn(logger, "id", 1, pgtype.Int4OID, true),
+				tx.InitColumn(logger, "email", email, pgtype.TextOID, false),
+			},
+		}}
+
+		l.dropSnapshotted(txWAL)
+		require.NoError(t, l.publishEvents(context.Background(), txWAL))
+		txWAL.Clear()
+	}
+
+	commit(52, 90, "new@doe.com")
+	assert.Len(t, published, 1, "the update contained in the snapshot is suppressed")
+
+	commit(55, 95, "later@doe.com")
+	require.Len(t, published, 2, "the transaction in progress at the snapshot is published")
+	assert.Equal(t, "later@doe.com", published[1].Data["email"])
+
+	commit(58, 120, "last@doe.com")
+	require.Len(t, published, 3)
+	assert.Nil(t, l.state.snapshot, "the handover is completed")
+
+	repo.AssertExpectations(t)
+}
+
+func TestListener_initialSnapshot_Lookups(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	protection := config.ProtectionCfg{
+		Classification: config.ClassificationCfg{Source: config.ClassificationComment, Mask: []string{"pii"}},
+	}
+	lookups := map[string][]config.EnrichmentCfg{
+		"users": {{Column: "org_id", Table: "public.orgs", KeyColumn: "id", ValueColumn: "name", Field: "org_name"}},
+	}
+	cfg := &config.Config{
+		Listener: &config.ListenerCfg{
+			Filter:     config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}},
+			Snapshot:   config.SnapshotCfg{Tables: []string{"users"}, BatchSize: 2},
+			Enrichment: lookups,
+			Protection: protection,
+		},
+		Publisher: &config.PublisherCfg{Topic: "wal"},
+	}
+
+	users := tx.Relation{
+		ID:        16384,
+		Namespace: "public",
+		Name:      "users",
+		Columns: []tx.RelationColumn{
+			{Key: true, Name: "id", TypeID: pgtype.Int4OID},
+			{Name: "email", TypeID: pgtype.TextOID},
+			{Name: "org_id", TypeID: pgtype.Int4OID},
+		},
+	}
+
+	// the connection can't be queried while the rows of a batch are read.
+	var reading bool
+
+	repo := new(repositoryMock)
+	repo.On("ReadSnapshot", mock.Anything, []string{"users"}, 2, mock.Anything).Run(func(args mock.Arguments) {
+		fn := args.Get(3).(func(rel tx.Relation, rows [][]tx.TupleData) error)
+
+		for _, ids := range [][]string{{"1", "2"}, {"3"}} {
+			reading = true
+
+			batch := make([][]tx.TupleData, 0, len(ids))
+			for _, id := range ids {
+				batch = append(batch, []tx.TupleData{{Value: []byte(id)}, {Value: []byte(id + "@doe.com")}, {Value: []byte("7")}})
+			}
+
+			reading = false
+
+			require.NoError(t, fn(users, batch))
+		}
+	}).Return(SnapshotPoint{LSN: 100}, nil).Once()
+	repo.On("ColumnTags", mock.Anything, "public", "users", protection.Classification).Run(func(mock.Arguments) {
+		assert.False(t, reading, "conn busy")
+	}).Return(map[string]string{"email": "pii"}, nil).Once()
+	repo.On("LookupValue", mock.Anything, "public.orgs", "id", "name", 7).Run(func(mock.Arguments) {
+		assert.False(t, reading, "conn busy")
+	}).Return("Acme", true, nil)
+
+	protector, err := publisher.NewColumnProtector(protection)
+	require.NoError(t, err)
+
+	var published []publisher.Event
+
+	pub := new(publisherMock)
+	pub.On("Publish", mock.Anything, "wal.public_users", mock.Anything).Run(func(args mock.Arguments) {
+		published = append(published, *args.Get(2).(*publisher.Event))
+	}).Return(nil)
+
+	l := NewWalListener(cfg, logger, repo, nil, pub, nil, new(monitorMock), protector, nil, nil, nil)
+
+	require.NoError(t, l.initialSnapshot(context.Background()))
+	require.Len(t, published, 3)
+
+	for _, event := range published {
+		assert.Equal(t, "***", event.Data["email"])
+		assert.Equal(t, map[string]any{"org_name": "Acme"}, event.Enrichment)
+	}
+
+	repo.AssertExpectations(t)
+}
+
+func TestListener_Process_SnapshotFailure(t *testing.T) {
+	cfg := &config.Config{Listener: &config.ListenerCfg{
+		SlotName: "slot1",
+		Snapshot: config.SnapshotCfg{Tables: []string{"users"}},
+	}}
+
+	repo := new(repositoryMock)
+	repo.On("CreatePublication", mock.Anything, publicationName).Return(nil).Once()
+	repo.On("GetSlotLSN", mock.Anything, "slot1").Return("", nil).Once()
+	repo.On("ReadSnapshot", mock.Anything, []string{"users"}, defaultSnapshotBatchSize, mock.Anything).
+		Return(SnapshotPoint{}, errors.New("canceling statement")).Once()
+
+	repl := new(replicatorMock)
+	repl.On("CreateReplicationSlotEx", "slot1", pgOutputPlugin).Return("0/64", "", nil).Once()
+	repl.On("DropReplicationSlot", "slot1").Return(nil).Once()
+
+	l := NewWalListener(cfg, slog.New(slog.NewJSONHandler(io.Discard, nil)), repo, repl, nil, nil, new(monitorMock),
+		nil, nil, nil, nil)
+
+	err := l.Process(context.Background())
+	require.ErrorContains(t, err, "initial snapshot")
+
+	// the slot is dropped, the next attempt creates it again and repeats the snapshot.
+	repl.AssertExpectations(t)
+	repo.AssertExpectations(t)
+}
+
+func TestListener_snapshotHandover_Reconnect(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := &config.Config{Listener: &config.ListenerCfg{}}
+	state := NewStreamState()
+	state.snapshot = &snapshotHandover{
+		point:  SnapshotPoint{LSN: 100, Xmin: 50, Xmax: 60},
+		tables: map[string]struct{}{"public.users": {}},
+	}
+
+	// the listener of the next connection still suppresses the changes contained in the snapshot.
+	l := NewWalListener(cfg, logger, nil, nil, nil, nil, new(monitorMock), nil, nil, nil, state)
+
+	txWAL := tx.NewWAL(logger, nil, new(monitorMock), cfg.Listener, nil)
+	txWAL.XID = 52
+	txWAL.LSN = 90
+	txWAL.Actions = []tx.ActionData{{Schema: "public", Table: "users", Kind: tx.ActionKindUpdate}}
+
+	l.dropSnapshotted(txWAL)
+	assert.Empty(t, txWAL.Actions)
+	assert.NotNil(t, state.snapshot)
+}
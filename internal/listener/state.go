@@ -0,0 +1,14 @@
+package listener
+
+// StreamState is the state of the replication stream kept across the reconnects of the listener.
+// A listener is created for every connection attempt, the state is created once and passed to each of them.
+type StreamState struct {
+	commitLSN uint64 // LSN of the last committed transaction, checked by the LSN guard
+	// snapshot suppresses the changes contained in the initial snapshot until the stream passes it.
+	snapshot *snapshotHandover
+}
+
+// NewStreamState create new StreamState instance.
+func NewStreamState() *StreamState {
+	return &StreamState{}
+}
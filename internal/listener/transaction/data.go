@@ -14,29 +14,53 @@ type ActionKind string
 
 // kind of WAL message.
 const (
-	ActionKindInsert ActionKind = "INSERT"
-	ActionKindUpdate ActionKind = "UPDATE"
-	ActionKindDelete ActionKind = "DELETE"
+	ActionKindInsert   ActionKind = "INSERT"
+	ActionKindUpdate   ActionKind = "UPDATE"
+	ActionKindDelete   ActionKind = "DELETE"
+	ActionKindTruncate ActionKind = "TRUNCATE"
+	ActionKindMessage  ActionKind = "MESSAGE" // logical message, not a change of a table
 )
 
 func (k ActionKind) string() string {
 	return string(k)
 }
 
+// Op returns the normalized op code of the action, a stable vocabulary independent of the action names:
+// c (insert), u (update), d (delete), t (truncate) and m (logical message).
+func (k ActionKind) Op() string {
+	switch k {
+	case ActionKindInsert:
+		return "c"
+	case ActionKindUpdate:
+		return "u"
+	case ActionKindDelete:
+		return "d"
+	case ActionKindTruncate:
+		return "t"
+	case ActionKindMessage:
+		return "m"
+	default:
+		return ""
+	}
+}
+
 // RelationData kind of WAL message data.
 type RelationData struct {
-	Schema  string
-	Table   string
-	Columns []Column
+	Schema      string
+	Table       string
+	Columns     []Column
+	Fingerprint string // hash of the column names and types
 }
 
 // ActionData kind of WAL message data.
 type ActionData struct {
-	Schema     string
-	Table      string
-	Kind       ActionKind
-	OldColumns []Column
-	NewColumns []Column
+	Schema      string
+	Table       string
+	Kind        ActionKind
+	OldColumns  []Column
+	NewColumns  []Column
+	Fingerprint string   // of the relation the action was decoded with
+	Message     *Message // of the logical message action
 }
 
 // Column of the table with which changes occur.
@@ -46,6 +70,10 @@ type Column struct {
 	value     any
 	valueType int
 	isKey     bool
+	raw       []byte // value not decoded yet, see WAL.decodeActions
+	toast     bool   // unchanged TOASTed value, the WAL doesn't send it
+
+	composites map[int][]CompositeField // attributes of the composite types, by the type OID
 }
 
 // InitColumn create new Column instance with data.s
@@ -55,17 +83,28 @@ func InitColumn(log *slog.Logger, name string, value any, valueType int, isKey b
 
 // AssertValue converts bytes to a specific type depending
 // on the type of this data in the database table.
+// The arrays of the built-in types are decoded into slices, the composite types into maps of their attributes.
 func (c *Column) AssertValue(src []byte) {
-	var (
-		val any
-		err error
-	)
-
 	if src == nil {
 		c.value = nil
 		return
 	}
 
+	val, err := c.decode(c.valueType, src)
+	if err != nil {
+		c.log.Error(
+			"column data parse error",
+			slog.String("err", err.Error()),
+			slog.Int("pg_type", c.valueType),
+			slog.String("column_name", c.name),
+		)
+	}
+
+	c.value = val
+}
+
+// decode converts the text representation of the value of the type.
+func (c *Column) decode(valueType int, src []byte) (any, error) {
 	strSrc := string(src)
 
 	const (
@@ -73,52 +112,53 @@ func (c *Column) AssertValue(src []byte) {
 		timestampWithTZLayout = "2006-01-02 15:04:05.999999999-07"
 	)
 
-	switch c.valueType {
+	switch valueType {
 	case BoolOID:
-		val, err = strconv.ParseBool(strSrc)
+		return strconv.ParseBool(strSrc)
 	case Int2OID, Int4OID:
-		val, err = strconv.Atoi(strSrc)
+		return strconv.Atoi(strSrc)
 	case Int8OID:
-		val, err = strconv.ParseInt(strSrc, 10, 64)
+		return strconv.ParseInt(strSrc, 10, 64)
 	case TextOID, VarcharOID:
-		val = strSrc
+		return strSrc, nil
 	case TimestampOID:
-		val, err = time.Parse(timestampLayout, strSrc)
+		return time.Parse(timestampLayout, strSrc)
 	case TimestamptzOID:
-		val, err = time.ParseInLocation(timestampWithTZLayout, strSrc, time.UTC)
+		return time.ParseInLocation(timestampWithTZLayout, strSrc, time.UTC)
 	case DateOID, TimeOID:
-		val = strSrc
+		return strSrc, nil
+	case NumericOID:
+		// kept as the exact decimal text, a float64 would round e.g. numeric(20,4) values.
+		return strSrc, nil
 	case UUIDOID:
-		val, err = uuid.Parse(strSrc)
+		return uuid.Parse(strSrc)
 	case JSONBOID:
 		var m any
 
-		if src[0] == '[' {
+		if len(src) > 0 && src[0] == '[' {
 			m = make([]any, 0)
 		} else {
 			m = make(map[string]any)
 		}
 
-		err = json.Unmarshal(src, &m)
-		val = m
-	default:
-		c.log.Debug(
-			"unknown oid type",
-			slog.Int("pg_type", c.valueType),
-			slog.String("column_name", c.name),
-		)
+		err := json.Unmarshal(src, &m)
 
-		val = strSrc
+		return m, err
 	}
 
-	if err != nil {
-		c.log.Error(
-			"column data parse error",
-			slog.String("err", err.Error()),
-			slog.Int("pg_type", c.valueType),
-			slog.String("column_name", c.name),
-		)
+	if elemType, ok := arrayElemTypes[valueType]; ok {
+		return c.decodeArray(elemType, strSrc)
 	}
 
-	c.value = val
+	if fields, ok := c.composites[valueType]; ok {
+		return c.decodeComposite(fields, strSrc)
+	}
+
+	c.log.Debug(
+		"unknown oid type",
+		slog.Int("pg_type", valueType),
+		slog.String("column_name", c.name),
+	)
+
+	return strSrc, nil
 }
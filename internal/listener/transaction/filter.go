@@ -0,0 +1,346 @@
+package transaction
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// defaultTableActions pass the tables not excluded when only the exclude filter is configured.
+var defaultTableActions = []string{"insert", "update", "delete"}
+
+// matchTable returns the filtered actions of the table. The precedence is:
+//  1. an excluded table never passes, even if it's listed in the tables;
+//  2. without tables every other table passes with the row actions if tables or schemas are excluded
+//     or schemas are listed, truncates stay opt-in;
+//  3. an exact table name takes precedence over the patterns, which are tried in the order of their keys.
+func (w *WAL) matchTable(filter config.FilterStruct, table string) ([]string, bool) {
+	if w.excluded.match(table) {
+		return nil, false
+	}
+
+	hasSchemas := len(filter.Schemas) > 0 || len(filter.ExcludeSchemas) > 0
+
+	if len(filter.Tables) == 0 && (len(filter.ExcludeTables) > 0 || hasSchemas) {
+		return defaultTableActions, true
+	}
+
+	if actions, ok := filter.Tables[table]; ok {
+		return actions, true
+	}
+
+	for _, p := range w.tablePatterns {
+		if p.re.MatchString(table) {
+			return p.actions, true
+		}
+	}
+
+	return nil, false
+}
+
+// matchSchema checks the schema against the allowed and excluded schemas, the table filters apply after it.
+func matchSchema(filter config.FilterStruct, schema string) bool {
+	if slices.Contains(filter.ExcludeSchemas, schema) {
+		return false
+	}
+
+	return len(filter.Schemas) == 0 || slices.Contains(filter.Schemas, schema)
+}
+
+// match reports whether the table is excluded by name or pattern.
+func (e excludedTables) match(table string) bool {
+	if _, ok := e.names[table]; ok {
+		return true
+	}
+
+	return slices.ContainsFunc(e.patterns, func(re *regexp.Regexp) bool { return re.MatchString(table) })
+}
+
+// matchColumnFilters checks the column values if column filters or patterns are configured for the table.
+// A column passes if its value is one of the allowed values or matches the pattern; all columns must pass.
+func (w *WAL) matchColumnFilters(filter config.FilterStruct, table string, data map[string]any) bool {
+	if !w.matchExcludedValues(filter, table, data) || !w.matchColumnConditions(filter, table, data) {
+		return false
+	}
+
+	columnFilters := filter.ColumnFilter[table]
+	patterns := w.patterns[table]
+
+	if len(columnFilters) == 0 && len(patterns) == 0 {
+		return true
+	}
+
+	columns := make([]string, 0, len(columnFilters)+len(patterns))
+
+	for columnName := range columnFilters {
+		columns = append(columns, columnName)
+	}
+
+	for columnName := range patterns {
+		if _, ok := columnFilters[columnName]; !ok {
+			columns = append(columns, columnName)
+		}
+	}
+
+	for _, columnName := range columns {
+		actualValue, exists := data[columnName]
+		if !exists {
+			w.log.Debug(
+				"column filter skipped: column not found in event",
+				slog.String("table", table),
+				slog.String("column", columnName),
+			)
+			continue
+		}
+
+		actualStr := fmt.Sprintf("%v", actualValue)
+
+		allowedValues, hasValues := columnFilters[columnName]
+		pattern, hasPattern := patterns[columnName]
+
+		if (hasValues && inArray(allowedValues, actualStr)) || (hasPattern && pattern.MatchString(actualStr)) {
+			continue
+		}
+
+		w.monitor.IncFilterSkippedEvents(table)
+		w.log.Debug(
+			"wal-message was skipped by column filter",
+			slog.String("table", table),
+			slog.String("column", columnName),
+			slog.String("value", actualStr),
+		)
+
+		return false
+	}
+
+	return true
+}
+
+// matchOldColumnFilters checks the old column values of the update against the old column filters.
+// A column missing from the old row (no REPLICA IDENTITY FULL) can't be ruled out, so it passes.
+func (w *WAL) matchOldColumnFilters(filter config.FilterStruct, table string, dataOld map[string]any) bool {
+	for columnName, allowedValues := range filter.OldColumnFilter[table] {
+		oldValue, exists := dataOld[columnName]
+		if !exists {
+			w.log.Debug(
+				"old column filter skipped: column not found in old row",
+				slog.String("table", table),
+				slog.String("column", columnName),
+			)
+
+			continue
+		}
+
+		oldStr := fmt.Sprintf("%v", oldValue)
+
+		if inArray(allowedValues, oldStr) {
+			continue
+		}
+
+		w.monitor.IncFilterSkippedEvents(table)
+		w.log.Debug(
+			"wal-message was skipped by old column filter",
+			slog.String("table", table),
+			slog.String("column", columnName),
+			slog.String("value", oldStr),
+		)
+
+		return false
+	}
+
+	return true
+}
+
+// matchColumnConditions checks the column values against the conditions of the table.
+// The comparison is skipped for null and missing columns.
+func (w *WAL) matchColumnConditions(filter config.FilterStruct, table string, data map[string]any) bool {
+	for columnName, conditions := range filter.ColumnConditions[table] {
+		actualValue := data[columnName]
+		if actualValue == nil {
+			continue
+		}
+
+		for _, cond := range conditions {
+			if cond.Match(actualValue) {
+				continue
+			}
+
+			w.monitor.IncFilterSkippedEvents(table)
+			w.log.Debug(
+				"wal-message was skipped by column condition",
+				slog.String("table", table),
+				slog.String("column", columnName),
+				slog.String("op", string(cond.Op)),
+				slog.String("value", fmt.Sprintf("%v", actualValue)),
+			)
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchExcludedValues checks that none of the columns has one of its excluded values.
+// Like the allowed values, the values are compared case-insensitively and missing columns pass.
+func (w *WAL) matchExcludedValues(filter config.FilterStruct, table string, data map[string]any) bool {
+	for columnName, excludedValues := range filter.ExcludeColumnFilter[table] {
+		actualValue, exists := data[columnName]
+		if !exists {
+			continue
+		}
+
+		actualStr := fmt.Sprintf("%v", actualValue)
+
+		if !inArray(excludedValues, actualStr) {
+			continue
+		}
+
+		w.monitor.IncFilterSkippedEvents(table)
+		w.log.Debug(
+			"wal-message was skipped by column exclusion filter",
+			slog.String("table", table),
+			slog.String("column", columnName),
+			slog.String("value", actualStr),
+		)
+
+		return false
+	}
+
+	return true
+}
+
+// matchSignificantColumns checks that one of the actions of the transaction changed a significant column,
+// all transactions pass if none are configured. Inserts, deletes and truncates of the table change its columns.
+// An update changes the column if the new value differs from the old one; without the old value
+// (no REPLICA IDENTITY FULL) the change can't be ruled out, so the update counts.
+func (w *WAL) matchSignificantColumns(filter config.FilterStruct) bool {
+	if len(filter.SignificantColumns) == 0 {
+		return true
+	}
+
+	for _, item := range w.Actions {
+		columns, ok := filter.SignificantColumns[item.Table]
+		if !ok {
+			continue
+		}
+
+		if item.Kind != ActionKindUpdate || slices.ContainsFunc(columns, item.changed) {
+			return true
+		}
+	}
+
+	for _, item := range w.Actions {
+		w.monitor.IncFilterSkippedEvents(item.Table)
+	}
+
+	w.log.Debug(
+		"transaction was skipped by significant columns filter",
+		slog.Int64("lsn", w.LSN),
+		slog.Int("actions", len(w.Actions)),
+	)
+
+	return false
+}
+
+// changed reports whether the update may have changed the column.
+func (a ActionData) changed(column string) bool {
+	i := slices.IndexFunc(a.NewColumns, func(c Column) bool { return c.name == column })
+	if i < 0 {
+		return false
+	}
+
+	j := slices.IndexFunc(a.OldColumns, func(c Column) bool { return c.name == column })
+	if j < 0 {
+		return true
+	}
+
+	return !reflect.DeepEqual(a.OldColumns[j].value, a.NewColumns[i].value)
+}
+
+// matchNullTransitions checks that an update moved one of the configured columns between NULL and a value.
+// Other actions pass. The old value is known only with REPLICA IDENTITY FULL,
+// a column missing from the old data never matches.
+func (w *WAL) matchNullTransitions(filter config.FilterStruct, item ActionData, data, dataOld map[string]any) bool {
+	rule, ok := filter.NullTransitions[item.Table]
+	if !ok || item.Kind != ActionKindUpdate {
+		return true
+	}
+
+	for _, column := range rule.Columns {
+		oldVal, oldExists := dataOld[column]
+		newVal, newExists := data[column]
+
+		if !oldExists || !newExists {
+			continue
+		}
+
+		if rule.Direction.Match(oldVal == nil, newVal == nil) {
+			return true
+		}
+	}
+
+	w.monitor.IncTransitionSkippedEvents(item.Table)
+	w.log.Debug(
+		"wal-message was skipped by null transition filter",
+		slog.String("table", item.Table),
+		slog.String("direction", string(rule.Direction)),
+	)
+
+	return false
+}
+
+// stripInternalColumns removes the internal columns from the published event, unless the table keeps them.
+// Filters are applied before, so they still see the complete row.
+func stripInternalColumns(filter config.FilterStruct, event *publisher.Event) {
+	if len(filter.InternalColumns) == 0 {
+		return
+	}
+
+	keep := filter.KeepColumns[event.Table]
+
+	internal := func(name string) bool {
+		if slices.Contains(keep, name) {
+			return false
+		}
+
+		for _, pattern := range filter.InternalColumns {
+			// patterns are validated with the config.
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, columns := range []map[string]any{event.Data, event.DataOld, event.PrimaryKey} {
+		for name := range columns {
+			if internal(name) {
+				delete(columns, name)
+			}
+		}
+	}
+
+	for name := range event.Types {
+		if internal(name) {
+			delete(event.Types, name)
+		}
+	}
+
+	for name := range event.Changes {
+		if internal(name) {
+			delete(event.Changes, name)
+		}
+	}
+
+	event.KeyColumns = slices.DeleteFunc(event.KeyColumns, internal)
+	event.ColumnOrder = slices.DeleteFunc(event.ColumnOrder, internal)
+	event.UnchangedToast = slices.DeleteFunc(event.UnchangedToast, internal)
+}
@@ -0,0 +1,583 @@
+package transaction
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestWAL_CreateEventsWithFilter_NullTransitions(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	update := func(oldVal, newVal any) ActionData {
+		return ActionData{
+			Schema:     "public",
+			Table:      "users",
+			Kind:       ActionKindUpdate,
+			OldColumns: []Column{{name: "id", value: 1}, {name: "confirmed_at", value: oldVal}},
+			NewColumns: []Column{{name: "id", value: 1}, {name: "confirmed_at", value: newVal}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		direction config.NullTransitionDirection
+		action    ActionData
+		want      int
+	}{
+		{
+			name:      "null to value matched",
+			direction: config.NullToValue,
+			action:    update(nil, "2024-05-01"),
+			want:      1,
+		},
+		{
+			name:      "null to value skips value to null",
+			direction: config.NullToValue,
+			action:    update("2024-05-01", nil),
+			want:      0,
+		},
+		{
+			name:      "value to null matched",
+			direction: config.ValueToNull,
+			action:    update("2024-05-01", nil),
+			want:      1,
+		},
+		{
+			name:      "value to null skips null to value",
+			direction: config.ValueToNull,
+			action:    update(nil, "2024-05-01"),
+			want:      0,
+		},
+		{
+			name:      "both matched null to value",
+			direction: config.NullBoth,
+			action:    update(nil, "2024-05-01"),
+			want:      1,
+		},
+		{
+			name:      "both matched value to null",
+			direction: config.NullBoth,
+			action:    update("2024-05-01", nil),
+			want:      1,
+		},
+		{
+			name:      "value changed without null",
+			direction: config.NullBoth,
+			action:    update("2024-05-01", "2024-05-02"),
+			want:      0,
+		},
+		{
+			name:      "old value unknown",
+			direction: config.NullBoth,
+			action: ActionData{
+				Schema:     "public",
+				Table:      "users",
+				Kind:       ActionKindUpdate,
+				NewColumns: []Column{{name: "confirmed_at", value: "2024-05-01"}},
+			},
+			want: 0,
+		},
+		{
+			name:      "insert is not filtered",
+			direction: config.NullToValue,
+			action: ActionData{
+				Schema:     "public",
+				Table:      "users",
+				Kind:       ActionKindInsert,
+				NewColumns: []Column{{name: "confirmed_at", value: nil}},
+			},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := new(monitorMock)
+			w := &WAL{
+				log:        logger,
+				monitor:    monitor,
+				pool:       newEventPool(),
+				CommitTime: &now,
+				Actions:    []ActionData{tt.action},
+			}
+
+			filter := config.FilterStruct{
+				Tables: map[string][]string{"users": {"insert", "update"}},
+				NullTransitions: map[string]config.NullTransitionRule{
+					"users": {Columns: []string{"confirmed_at"}, Direction: tt.direction},
+				},
+			}
+
+			events := collectEvents(w.CreateEventsWithFilter(context.Background(), filter))
+
+			assert.Len(t, events, tt.want)
+			assert.Equal(t, 1-tt.want, monitor.transitionSkipped)
+		})
+	}
+}
+
+func TestWAL_CreateEventsWithFilter_InternalColumns(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	update := func(table string) ActionData {
+		columns := []Column{
+			{name: "id", value: 1, isKey: true},
+			{name: "xmin", value: 100, isKey: true},
+			{name: "_audit_user", value: "admin"},
+		}
+
+		return ActionData{
+			Schema:     "public",
+			Table:      table,
+			Kind:       ActionKindUpdate,
+			OldColumns: columns,
+			NewColumns: append(slices.Clone(columns), Column{name: "_audit_note", toast: true}),
+		}
+	}
+
+	w := &WAL{
+		log:         logger,
+		monitor:     new(monitorMock),
+		pool:        newEventPool(),
+		columnOrder: true,
+		CommitTime:  &now,
+		Actions:     []ActionData{update("users"), update("orders"), update("audit_log")},
+	}
+
+	filter := config.FilterStruct{
+		Tables: map[string][]string{
+			"users":     {"update"},
+			"orders":    {"update"},
+			"audit_log": {"update"},
+		},
+		InternalColumns: []string{"xmin", "_audit_*"},
+		KeepColumns:     map[string][]string{"audit_log": {"_audit_user"}},
+	}
+
+	events := collectEvents(w.CreateEventsWithFilter(context.Background(), filter))
+	assert.Len(t, events, 3)
+
+	for _, event := range events[:2] {
+		assert.Equal(t, map[string]any{"id": 1}, event.Data, event.Table)
+		assert.Equal(t, map[string]any{"id": 1}, event.DataOld, event.Table)
+		assert.Equal(t, map[string]any{"id": 1}, event.PrimaryKey, event.Table)
+		assert.Equal(t, []string{"id"}, event.KeyColumns, event.Table)
+		assert.Equal(t, []string{"id"}, event.ColumnOrder, event.Table)
+		assert.Empty(t, event.UnchangedToast, event.Table)
+	}
+
+	assert.Equal(t, map[string]any{"id": 1, "_audit_user": "admin"}, events[2].Data)
+	assert.Equal(t, map[string]any{"id": 1, "_audit_user": "admin"}, events[2].DataOld)
+	assert.Equal(t, []string{"id", "_audit_user"}, events[2].ColumnOrder)
+}
+
+func TestWAL_CreateEventsWithFilter_ColumnPatterns(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	insert := func(email, role string) ActionData {
+		return ActionData{
+			Schema: "public",
+			Table:  "users",
+			Kind:   ActionKindInsert,
+			NewColumns: []Column{
+				{name: "email", value: email},
+				{name: "role", value: role},
+			},
+		}
+	}
+
+	filter := config.FilterStruct{
+		Tables:         map[string][]string{"users": {"insert"}},
+		ColumnFilter:   map[string]map[string][]string{"users": {"role": {"admin"}}},
+		ColumnPatterns: map[string]map[string]string{"users": {"email": `@corp\.example$`, "role": "^ops-"}},
+	}
+
+	monitor := new(monitorMock)
+	w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: filter}, nil)
+	w.CommitTime = &now
+	w.Actions = []ActionData{
+		insert("ann@corp.example", "admin"),  // pattern and allowed value
+		insert("bob@corp.example", "ops-db"), // pattern and role pattern
+		insert("eve@mail.example", "admin"),  // email rejected
+		insert("kim@corp.example", "guest"),  // role is neither allowed nor matched
+	}
+
+	var got []any
+
+	for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+		got = append(got, event.Data["email"])
+	}
+
+	assert.Equal(t, []any{"ann@corp.example", "bob@corp.example"}, got)
+	assert.Equal(t, 2, monitor.eventPool["get"], "filtered rows take no pooled events")
+}
+
+func TestWAL_CreateEventsWithFilter_ExcludeColumnFilter(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	insert := func(id int, columns ...Column) ActionData {
+		return ActionData{
+			Schema:     "public",
+			Table:      "orders",
+			Kind:       ActionKindInsert,
+			NewColumns: append([]Column{{name: "id", value: id}}, columns...),
+		}
+	}
+
+	filter := config.FilterStruct{
+		Tables:              map[string][]string{"orders": {"insert"}},
+		ColumnFilter:        map[string]map[string][]string{"orders": {"region": {"eu", "us"}}},
+		ExcludeColumnFilter: map[string]map[string][]string{"orders": {"status": {"internal", "test"}}},
+	}
+
+	monitor := new(monitorMock)
+	w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: filter}, nil)
+	w.CommitTime = &now
+	w.Actions = []ActionData{
+		insert(1, Column{name: "status", value: "paid"}, Column{name: "region", value: "eu"}),
+		insert(2, Column{name: "status", value: "INTERNAL"}, Column{name: "region", value: "eu"}), // case-insensitive
+		insert(3, Column{name: "status", value: "paid"}, Column{name: "region", value: "apac"}),   // not allowed
+		insert(4, Column{name: "region", value: "us"}),                                            // no status column
+	}
+
+	var got []any
+
+	for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+		got = append(got, event.Data["id"])
+	}
+
+	assert.Equal(t, []any{1, 4}, got)
+	assert.Equal(t, 2, monitor.filterSkipped["orders"], "both modes count the skipped events")
+}
+
+func TestWAL_CreateEventsWithFilter_OldColumnFilter(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	update := func(id int, oldStatus, status string) ActionData {
+		action := ActionData{
+			Schema: "public",
+			Table:  "orders",
+			Kind:   ActionKindUpdate,
+			NewColumns: []Column{
+				{name: "id", value: id, isKey: true},
+				{name: "status", value: status},
+			},
+			OldColumns: []Column{{name: "id", value: id, isKey: true}},
+		}
+
+		if oldStatus != "" {
+			action.OldColumns = append(action.OldColumns, Column{name: "status", value: oldStatus})
+		}
+
+		return action
+	}
+
+	filter := config.FilterStruct{
+		Tables:          map[string][]string{"orders": {"insert", "update"}},
+		ColumnFilter:    map[string]map[string][]string{"orders": {"status": {"paid", "canceled"}}},
+		OldColumnFilter: map[string]map[string][]string{"orders": {"status": {"pending"}}},
+	}
+
+	monitor := new(monitorMock)
+	w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: filter}, nil)
+	w.CommitTime = &now
+	w.Actions = []ActionData{
+		update(1, "pending", "paid"),
+		update(2, "paid", "canceled"),   // was not pending
+		update(3, "pending", "shipped"), // the new value is not allowed
+		update(4, "", "paid"),           // no old value without REPLICA IDENTITY FULL
+		{
+			Schema:     "public",
+			Table:      "orders",
+			Kind:       ActionKindInsert,
+			NewColumns: []Column{{name: "id", value: 5}, {name: "status", value: "paid"}},
+		},
+	}
+
+	var got []any
+
+	for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+		got = append(got, event.Data["id"])
+	}
+
+	assert.Equal(t, []any{1, 4, 5}, got)
+	assert.Equal(t, 2, monitor.filterSkipped["orders"])
+}
+
+func TestWAL_CreateEventsWithFilter_ColumnConditions(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	insert := func(id int, amount any, currency string) ActionData {
+		return ActionData{
+			Schema: "public",
+			Table:  "payments",
+			Kind:   ActionKindInsert,
+			NewColumns: []Column{
+				{name: "id", value: id},
+				{name: "amount", value: amount},
+				{name: "currency", value: currency},
+			},
+		}
+	}
+
+	filter := config.FilterStruct{
+		Tables: map[string][]string{"payments": {"insert"}},
+		ColumnConditions: map[string]map[string][]config.ColumnCondition{
+			"payments": {
+				"amount":   {{Op: config.CompareGt, Value: "1000"}, {Op: config.CompareLte, Value: "1e6"}},
+				"currency": {{Op: config.CompareNe, Value: "xxx"}, {Op: config.CompareLt, Value: "USD"}},
+			},
+		},
+	}
+
+	monitor := new(monitorMock)
+	w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: filter}, nil)
+	w.CommitTime = &now
+	w.Actions = []ActionData{
+		insert(1, 1500, "EUR"),
+		insert(2, 999, "EUR"),         // not greater
+		insert(3, "2000000.5", "EUR"), // numeric text above the upper bound
+		insert(4, nil, "EUR"),         // null amount is not compared
+		insert(5, 1500, "XXX"),        // case-insensitive equality
+		insert(6, 1500, "USD"),        // strings compared as strings
+	}
+
+	var got []any
+
+	for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+		got = append(got, event.Data["id"])
+	}
+
+	assert.Equal(t, []any{1, 4}, got)
+	assert.Equal(t, 4, monitor.filterSkipped["payments"])
+}
+
+func TestWAL_CreateEventsWithFilter_TablePatterns(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	insert := func(table string) ActionData {
+		return ActionData{Schema: "public", Table: table, Kind: ActionKindInsert}
+	}
+
+	filter := config.FilterStruct{
+		Tables: map[string][]string{
+			"~events_.*":     {"insert"},
+			"events_2024_01": {"update"}, // exact name takes precedence
+		},
+	}
+
+	monitor := new(monitorMock)
+	w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: filter}, nil)
+	w.CommitTime = &now
+	w.Actions = []ActionData{
+		insert("events_2024_01"),
+		insert("events_2024_02"),
+		insert("events_2024_03"),
+		insert("old_events_2024_03"), // the pattern matches the whole name
+		insert("users"),
+	}
+
+	var got []string
+
+	for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+		got = append(got, event.Table)
+	}
+
+	assert.Equal(t, []string{"events_2024_02", "events_2024_03"}, got)
+	assert.Equal(t, map[string]int{"events_2024_01": 1, "old_events_2024_03": 1, "users": 1}, monitor.filterSkipped)
+}
+
+func TestWAL_CreateEventsWithFilter_ExcludeTables(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	action := func(table string, kind ActionKind) ActionData {
+		return ActionData{Schema: "public", Table: table, Kind: kind}
+	}
+
+	actions := []ActionData{
+		action("users", ActionKindInsert),
+		action("audit_log", ActionKindInsert),
+		action("audit_login", ActionKindUpdate),
+		action("orders", ActionKindDelete),
+		action("orders", ActionKindTruncate),
+	}
+
+	tests := []struct {
+		name    string
+		filter  config.FilterStruct
+		want    []string
+		skipped map[string]int
+	}{
+		{
+			name:    "all tables except excluded",
+			filter:  config.FilterStruct{ExcludeTables: []string{"audit_log", "~audit_.*"}},
+			want:    []string{"users INSERT", "orders DELETE"},
+			skipped: map[string]int{"audit_log": 1, "audit_login": 1, "orders": 1},
+		},
+		{
+			name: "exclusion wins over tables",
+			filter: config.FilterStruct{
+				Tables:        map[string][]string{"users": {"insert"}, "audit_log": {"insert"}},
+				ExcludeTables: []string{"audit_log"},
+			},
+			want:    []string{"users INSERT"},
+			skipped: map[string]int{"audit_log": 1, "audit_login": 1, "orders": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := new(monitorMock)
+			w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: tt.filter}, nil)
+			w.CommitTime = &now
+			w.Actions = actions
+
+			var got []string
+
+			for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), tt.filter)) {
+				got = append(got, event.Table+" "+event.Action)
+			}
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.skipped, monitor.filterSkipped)
+		})
+	}
+}
+
+func TestWAL_CreateEventsWithFilter_Schemas(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	action := func(schema, table string, kind ActionKind) ActionData {
+		return ActionData{Schema: schema, Table: table, Kind: kind}
+	}
+
+	actions := []ActionData{
+		action("public", "users", ActionKindInsert),
+		action("billing", "invoices", ActionKindUpdate),
+		action("billing", "invoices", ActionKindTruncate),
+		action("staging", "users", ActionKindInsert),
+	}
+
+	tests := []struct {
+		name    string
+		filter  config.FilterStruct
+		want    []string
+		skipped map[string]int
+	}{
+		{
+			name:    "allowed schemas",
+			filter:  config.FilterStruct{Schemas: []string{"public", "billing"}},
+			want:    []string{"public.users INSERT", "billing.invoices UPDATE"},
+			skipped: map[string]int{"invoices": 1, "users": 1},
+		},
+		{
+			name:    "excluded schema",
+			filter:  config.FilterStruct{ExcludeSchemas: []string{"staging"}},
+			want:    []string{"public.users INSERT", "billing.invoices UPDATE"},
+			skipped: map[string]int{"invoices": 1, "users": 1},
+		},
+		{
+			name: "composed with tables",
+			filter: config.FilterStruct{
+				Schemas: []string{"public", "staging"},
+				Tables:  map[string][]string{"users": {"insert"}, "invoices": {"update"}},
+			},
+			want:    []string{"public.users INSERT", "staging.users INSERT"},
+			skipped: map[string]int{"invoices": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := new(monitorMock)
+			w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: tt.filter}, nil)
+			w.CommitTime = &now
+			w.Actions = actions
+
+			var got []string
+
+			for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), tt.filter)) {
+				got = append(got, event.Schema+"."+event.Table+" "+event.Action)
+			}
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.skipped, monitor.filterSkipped)
+		})
+	}
+}
+
+func TestWAL_CreateEventsWithFilter_SignificantColumns(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	update := func(table string, oldBalance, newBalance any) ActionData {
+		return ActionData{
+			Schema:     "public",
+			Table:      table,
+			Kind:       ActionKindUpdate,
+			OldColumns: []Column{{name: "id", value: 1}, {name: "balance", value: oldBalance}},
+			NewColumns: []Column{{name: "id", value: 1}, {name: "balance", value: newBalance}},
+		}
+	}
+
+	filter := config.FilterStruct{
+		Tables:             map[string][]string{"accounts": {"update"}, "audit_log": {"insert"}},
+		SignificantColumns: map[string][]string{"accounts": {"balance"}},
+	}
+	audit := ActionData{Schema: "public", Table: "audit_log", Kind: ActionKindInsert}
+
+	tests := []struct {
+		name    string
+		actions []ActionData
+		want    int
+	}{
+		{
+			name:    "changed in one of several actions",
+			actions: []ActionData{update("accounts", 10, 10), audit, update("accounts", 10, 15), update("accounts", 5, 5)},
+			want:    4, // the transaction qualifies as a whole, unchanged updates included
+		},
+		{
+			name:    "not changed",
+			actions: []ActionData{update("accounts", 10, 10), audit},
+			want:    0,
+		},
+		{
+			name:    "changed in another table",
+			actions: []ActionData{update("ledger", 10, 15), audit},
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := new(monitorMock)
+			w := NewWAL(logger, newEventPool(), monitor, &config.ListenerCfg{Filter: filter}, nil)
+			w.CommitTime = &now
+			w.Actions = tt.actions
+
+			events := collectEvents(w.CreateEventsWithFilter(context.Background(), filter))
+			assert.Len(t, events, tt.want)
+
+			if tt.want == 0 {
+				assert.Equal(t, map[string]int{tt.actions[0].Table: 1, "audit_log": 1}, monitor.filterSkipped)
+			}
+		})
+	}
+}
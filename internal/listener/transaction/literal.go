@@ -0,0 +1,284 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// arrayElemTypes maps the built-in array types to the types of their elements.
+var arrayElemTypes = map[int]int{
+	1000: BoolOID,
+	1005: Int2OID,
+	1007: Int4OID,
+	1016: Int8OID,
+	1009: TextOID,
+	1015: VarcharOID,
+	1231: NumericOID,
+	1115: TimestampOID,
+	1185: TimestamptzOID,
+	1182: DateOID,
+	1183: TimeOID,
+	2951: UUIDOID,
+	3807: JSONBOID,
+}
+
+// CompositeField is an attribute of a composite type.
+type CompositeField struct {
+	Name   string
+	TypeID int
+}
+
+// compositeLoader fetches the attributes of the composite types from the database catalog.
+type compositeLoader interface {
+	CompositeFields(ctx context.Context, typeID int32) ([]CompositeField, error)
+}
+
+var errUnterminatedLiteral = errors.New("unterminated literal")
+
+// loadComposite loads the attributes of the announced type if it's a composite type, the attributes of the nested
+// composite types are loaded too: the WAL only announces the types of the table columns.
+func (w *WAL) loadComposite(typeID int32) {
+	loader, ok := w.relations.loader.(compositeLoader)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), relationLoadTimeout)
+	defer cancel()
+
+	pending := []int32{typeID}
+
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+
+		fields, err := loader.CompositeFields(ctx, id)
+		if err != nil {
+			w.log.Error("load composite type", slog.Any("type_id", id), slog.String("err", err.Error()))
+			return
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if w.composites == nil {
+			w.composites = make(map[int][]CompositeField)
+		}
+
+		w.composites[int(id)] = fields
+
+		for _, field := range fields {
+			if !isBuiltinType(field.TypeID) && w.composites[field.TypeID] == nil {
+				pending = append(pending, int32(field.TypeID))
+			}
+		}
+	}
+}
+
+func isBuiltinType(typeID int) bool {
+	_, scalar := builtinTypeNames[typeID]
+	_, array := arrayElemTypes[typeID]
+
+	return scalar || array
+}
+
+// decodeArray decodes the array literal, e.g. {1,2,NULL} or {"a,b","c\"d"}, the elements are decoded
+// by the element type. The elements of a multidimensional array are nested slices.
+func (c *Column) decodeArray(elemType int, src string) (any, error) {
+	sc := literalScanner{s: src}
+
+	// the literal of an array with non-default bounds starts with the dimensions, e.g. [0:1]={1,2}.
+	if strings.HasPrefix(src, "[") {
+		if i := strings.Index(src, "={"); i > 0 {
+			sc.pos = i + 1
+		}
+	}
+
+	values, err := c.scanArray(&sc, elemType)
+	if err != nil {
+		return src, fmt.Errorf("array: %w", err)
+	}
+
+	if sc.pos != len(sc.s) {
+		return src, errors.New("array: unexpected data after the literal")
+	}
+
+	return values, nil
+}
+
+func (c *Column) scanArray(sc *literalScanner, elemType int) ([]any, error) {
+	if !sc.consume('{') {
+		return nil, errors.New("literal must start with {")
+	}
+
+	values := make([]any, 0)
+
+	if sc.consume('}') {
+		return values, nil
+	}
+
+	for {
+		var val any
+
+		if sc.peek() == '{' {
+			nested, err := c.scanArray(sc, elemType)
+			if err != nil {
+				return nil, err
+			}
+
+			val = nested
+		} else {
+			elem, quoted, err := sc.element('}', true)
+			if err != nil {
+				return nil, err
+			}
+
+			if quoted || !strings.EqualFold(elem, "NULL") {
+				if val, err = c.decode(elemType, []byte(elem)); err != nil {
+					return nil, fmt.Errorf("element %d: %w", len(values)+1, err)
+				}
+			}
+		}
+
+		values = append(values, val)
+
+		switch sc.next() {
+		case ',':
+		case '}':
+			return values, nil
+		default:
+			return nil, errUnterminatedLiteral
+		}
+	}
+}
+
+// decodeComposite decodes the row literal of the composite type, e.g. (1,"a b",), into the map of the attributes.
+// An empty unquoted attribute is NULL.
+func (c *Column) decodeComposite(fields []CompositeField, src string) (any, error) {
+	sc := literalScanner{s: src}
+
+	if !sc.consume('(') {
+		return src, errors.New("composite: literal must start with (")
+	}
+
+	row := make(map[string]any, len(fields))
+
+	for i := 0; ; i++ {
+		elem, quoted, err := sc.element(')', false)
+		if err != nil {
+			return src, fmt.Errorf("composite: %w", err)
+		}
+
+		if i >= len(fields) {
+			return src, fmt.Errorf("composite: more than %d attributes", len(fields))
+		}
+
+		var val any
+
+		if quoted || elem != "" {
+			if val, err = c.decode(fields[i].TypeID, []byte(elem)); err != nil {
+				return src, fmt.Errorf("composite attribute %s: %w", fields[i].Name, err)
+			}
+		}
+
+		row[fields[i].Name] = val
+
+		switch sc.next() {
+		case ',':
+		case ')':
+			if i+1 != len(fields) || sc.pos != len(sc.s) {
+				return src, fmt.Errorf("composite: %d attributes expected", len(fields))
+			}
+
+			return row, nil
+		default:
+			return src, fmt.Errorf("composite: %w", errUnterminatedLiteral)
+		}
+	}
+}
+
+// literalScanner reads the elements of the array and row literals.
+type literalScanner struct {
+	s   string
+	pos int
+}
+
+func (sc *literalScanner) peek() byte {
+	if sc.pos >= len(sc.s) {
+		return 0
+	}
+
+	return sc.s[sc.pos]
+}
+
+func (sc *literalScanner) next() byte {
+	ch := sc.peek()
+	if ch != 0 {
+		sc.pos++
+	}
+
+	return ch
+}
+
+func (sc *literalScanner) consume(ch byte) bool {
+	if sc.peek() != ch {
+		return false
+	}
+
+	sc.pos++
+
+	return true
+}
+
+// element reads the element up to the comma or the end of the literal, it removes the quotes and the escapes:
+// backslashes and doubled quotes inside the quotes. The whitespace around the unquoted array elements is trimmed.
+func (sc *literalScanner) element(end byte, trim bool) (string, bool, error) {
+	var (
+		b        strings.Builder
+		quoted   bool
+		inQuotes bool
+	)
+
+	for sc.pos < len(sc.s) {
+		ch := sc.s[sc.pos]
+
+		switch {
+		case ch == '\\':
+			if sc.pos+1 >= len(sc.s) {
+				return "", false, errUnterminatedLiteral
+			}
+
+			b.WriteByte(sc.s[sc.pos+1])
+			sc.pos += 2
+
+			continue
+		case ch == '"':
+			if inQuotes && sc.pos+1 < len(sc.s) && sc.s[sc.pos+1] == '"' {
+				b.WriteByte('"')
+				sc.pos += 2
+
+				continue
+			}
+
+			inQuotes = !inQuotes
+			quoted = true
+		case !inQuotes && (ch == ',' || ch == end):
+			elem := b.String()
+			if trim && !quoted {
+				elem = strings.TrimSpace(elem)
+			}
+
+			return elem, quoted, nil
+		default:
+			b.WriteByte(ch)
+		}
+
+		sc.pos++
+	}
+
+	return "", false, errUnterminatedLiteral
+}
@@ -0,0 +1,64 @@
+package transaction
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// messageTransactional is the flag of a logical message emitted as part of its transaction.
+const messageTransactional = 1
+
+// Transactional reports whether the message belongs to a transaction, otherwise it was emitted right away.
+func (m Message) Transactional() bool {
+	return m.Flags&messageTransactional != 0
+}
+
+// AddMessage adds the logical message. A transactional message is published with its transaction,
+// a non-transactional one right away: it's decoded outside of any transaction, as the only action
+// with the message LSN and the receive time.
+func (w *WAL) AddMessage(xid int32, msg Message, now time.Time) {
+	action := ActionData{Kind: ActionKindMessage, Message: &msg}
+
+	if msg.Transactional() {
+		w.addAction(xid, action)
+		return
+	}
+
+	w.XID = 0
+	w.LSN = msg.LSN
+	w.Actions = []ActionData{action}
+	w.CommitTime = &now
+}
+
+// messageEvent returns the event of the logical message, nil if its prefix isn't published.
+func (w *WAL) messageEvent(msg *Message) *publisher.Event {
+	if len(w.msgPrefixes) > 0 && !slices.Contains(w.msgPrefixes, msg.Prefix) {
+		w.log.Debug("logical message was skipped by prefix", slog.String("prefix", msg.Prefix))
+		return nil
+	}
+
+	event := w.getPoolEvent()
+
+	event.ID = uuid.New()
+	event.Action = ActionKindMessage.string()
+	event.Data = map[string]any{
+		"prefix":        msg.Prefix,
+		"content":       string(msg.Content),
+		"transactional": msg.Transactional(),
+	}
+	event.DataOld = make(map[string]any)
+	event.EventTime = *w.CommitTime
+	event.TransactionID = uint32(w.XID)
+	event.LSN = uint64(w.LSN)
+
+	if w.opField {
+		event.Op = ActionKindMessage.Op()
+	}
+
+	return event
+}
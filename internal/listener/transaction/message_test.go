@@ -0,0 +1,90 @@
+package transaction
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// logicalMsg builds the logical message emitted by pg_logical_emit_message.
+func logicalMsg(flags int8, lsn int64, prefix, content string) []byte {
+	return streamMsg(
+		MessageMsgType,
+		flags,
+		lsn,
+		append([]byte(prefix), 0),
+		int32(len(content)),
+		[]byte(content),
+	)
+}
+
+func TestBinaryParser_ParseWalMessage_LogicalMessage(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}}
+
+	tests := []struct {
+		name     string
+		prefixes []string
+		messages [][]byte
+		want     []map[string]any
+		wantXID  uint32
+		wantLSN  uint64
+	}{
+		{
+			name: "transactional",
+			messages: [][]byte{
+				streamMsg(BeginMsgType, int64(7), int64(0), int32(5)),
+				logicalMsg(1, 6, "audit", `{"user":"bob"}`),
+				streamMsg(CommitMsgType, int8(0), int64(7), int64(8), int64(0)),
+			},
+			want: []map[string]any{
+				{"prefix": "audit", "content": `{"user":"bob"}`, "transactional": true},
+			},
+			wantXID: 5,
+			wantLSN: 7,
+		},
+		{
+			name:     "non-transactional",
+			messages: [][]byte{logicalMsg(0, 9, "heartbeat", "")},
+			want: []map[string]any{
+				{"prefix": "heartbeat", "content": "", "transactional": false},
+			},
+			wantLSN: 9,
+		},
+		{
+			name:     "skipped by prefix",
+			prefixes: []string{"audit"},
+			messages: [][]byte{logicalMsg(0, 9, "heartbeat", "ping")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.ListenerCfg{LogicalMessages: config.LogicalMessagesCfg{Prefixes: tt.prefixes}}
+			w := NewWAL(logger, newEventPool(), new(monitorMock), cfg, nil)
+			p := NewBinaryParser(logger, binary.BigEndian)
+
+			for _, msg := range tt.messages {
+				require.NoError(t, p.ParseWalMessage(msg, w))
+			}
+
+			var got []map[string]any
+
+			for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+				assert.Equal(t, "MESSAGE", event.Action)
+				assert.Equal(t, tt.wantXID, event.TransactionID)
+				assert.Equal(t, tt.wantLSN, event.LSN)
+				got = append(got, event.Data)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -1,9 +1,33 @@
 package transaction
 
-type monitorMock struct{}
+type monitorMock struct {
+	filterSkipped     map[string]int
+	transitionSkipped int
+	eventPool         map[string]int
+}
 
-func (m *monitorMock) IncPublishedEvents(subject, table string) {}
+func (m *monitorMock) IncEventPool(op string) {
+	if m.eventPool == nil {
+		m.eventPool = make(map[string]int)
+	}
 
-func (m *monitorMock) IncFilterSkippedEvents(table string) {}
+	m.eventPool[op]++
+}
+
+func (m *monitorMock) IncPublishedEvents(subject, table, action string) {}
+
+func (m *monitorMock) IncFilterSkippedEvents(table string) {
+	if m.filterSkipped == nil {
+		m.filterSkipped = make(map[string]int)
+	}
+
+	m.filterSkipped[table]++
+}
 
 func (m *monitorMock) IncProblematicEvents(kind string) {}
+
+func (m *monitorMock) SetRelationCacheSize(size int) {}
+
+func (m *monitorMock) IncTransitionSkippedEvents(table string) {
+	m.transitionSkipped++
+}
@@ -51,6 +51,7 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *WAL) error {
 		)
 
 		tx.LSN = begin.LSN
+		tx.XID = begin.XID
 		tx.BeginTime = &begin.Timestamp
 	case CommitMsgType:
 		commit := p.getCommitMsg()
@@ -68,7 +69,42 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *WAL) error {
 		tx.CommitTime = &commit.Timestamp
 	case OriginMsgType:
 		p.log.Debug("origin type message was received")
+	case StreamStartMsgType:
+		start := p.getStreamStartMsg()
+
+		p.log.Debug(
+			"stream start message was received",
+			slog.Any("xid", start.XID),
+			slog.Any("first_segment", start.FirstSegment),
+		)
+
+		tx.StartStream(start.XID)
+	case StreamStopMsgType:
+		p.log.Debug("stream stop message was received")
+
+		tx.StopStream()
+	case StreamCommitMsgType:
+		commit := p.getStreamCommitMsg()
+
+		p.log.Debug(
+			"stream commit message was received",
+			slog.Any("xid", commit.XID),
+			slog.Int64("lsn", commit.LSN),
+		)
+
+		tx.CommitStream(commit.XID, commit.LSN, commit.Timestamp)
+	case StreamAbortMsgType:
+		abort := p.getStreamAbortMsg()
+
+		p.log.Debug(
+			"stream abort message was received",
+			slog.Any("xid", abort.XID),
+			slog.Any("sub_xid", abort.SubXID),
+		)
+
+		tx.AbortStream(abort.XID, abort.SubXID)
 	case RelationMsgType:
+		p.readStreamXID(tx)
 		relation := p.getRelationMsg()
 
 		p.log.Debug(
@@ -77,24 +113,24 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *WAL) error {
 			slog.String("schema", relation.Namespace),
 		)
 
-		if tx.LSN == 0 {
+		if tx.LSN == 0 && !tx.InStream() {
 			return fmt.Errorf("commit: %w", ErrMessageLost)
 		}
 
-		rd := RelationData{
-			Schema: relation.Namespace,
-			Table:  relation.Name,
-		}
+		tx.SetRelation(relation)
+	case TypeMsgType:
+		p.readStreamXID(tx)
+		dataType := p.getTypeMsg()
 
-		for _, rf := range relation.Columns {
-			c := InitColumn(p.log, rf.Name, nil, int(rf.TypeID), rf.Key)
-			rd.Columns = append(rd.Columns, c)
-		}
+		p.log.Debug(
+			"type message was received",
+			slog.Any("type_id", dataType.ID),
+			slog.String("name", dataType.Name),
+		)
 
-		tx.RelationStore[relation.ID] = rd
-	case TypeMsgType:
-		p.log.Debug("type message was received")
+		tx.SetType(dataType)
 	case InsertMsgType:
+		xid := p.readStreamXID(tx)
 		insert := p.getInsertMsg()
 
 		p.log.Debug(
@@ -112,8 +148,9 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *WAL) error {
 			return fmt.Errorf("create action data: %w", err)
 		}
 
-		tx.Actions = append(tx.Actions, action)
+		tx.addAction(xid, action)
 	case UpdateMsgType:
+		xid := p.readStreamXID(tx)
 		upd := p.getUpdateMsg()
 
 		p.log.Debug("update type message was received", slog.Any("relation_id", upd.RelationID))
@@ -128,8 +165,13 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *WAL) error {
 			return fmt.Errorf("create action data: %w", err)
 		}
 
-		tx.Actions = append(tx.Actions, action)
+		if upd.KeyTuple {
+			action.OldColumns = identityColumns(action.OldColumns)
+		}
+
+		tx.addAction(xid, action)
 	case DeleteMsgType:
+		xid := p.readStreamXID(tx)
 		del := p.getDeleteMsg()
 
 		p.log.Debug(
@@ -147,7 +189,37 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *WAL) error {
 			return fmt.Errorf("create action data: %w", err)
 		}
 
-		tx.Actions = append(tx.Actions, action)
+		if del.KeyTuple {
+			action.OldColumns = identityColumns(action.OldColumns)
+		}
+
+		tx.addAction(xid, action)
+	case TruncateMsgType:
+		xid := p.readStreamXID(tx)
+		truncate := p.getTruncateMsg()
+
+		p.log.Debug(
+			"truncate type message was received",
+			slog.Any("relation_ids", truncate.RelationIDs),
+		)
+
+		actions, err := tx.CreateTruncateActionData(truncate.RelationIDs)
+		if err != nil {
+			return fmt.Errorf("create truncate action data: %w", err)
+		}
+
+		tx.addAction(xid, actions...)
+	case MessageMsgType:
+		xid := p.readStreamXID(tx)
+		message := p.getMessageMsg()
+
+		p.log.Debug(
+			"logical message was received",
+			slog.String("prefix", message.Prefix),
+			slog.Bool("transactional", message.Transactional()),
+		)
+
+		tx.AddMessage(xid, message, time.Now())
 	default:
 		return fmt.Errorf("%w : %s", ErrUnknownMessageType, []byte{p.msgType})
 	}
@@ -172,6 +244,39 @@ func (p *BinaryParser) getCommitMsg() Commit {
 	}
 }
 
+func (p *BinaryParser) getStreamStartMsg() StreamStart {
+	return StreamStart{
+		XID:          p.readInt32(),
+		FirstSegment: p.readInt8(),
+	}
+}
+
+func (p *BinaryParser) getStreamCommitMsg() StreamCommit {
+	return StreamCommit{
+		XID:            p.readInt32(),
+		Flags:          p.readInt8(),
+		LSN:            p.readInt64(),
+		TransactionLSN: p.readInt64(),
+		Timestamp:      p.readTimestamp(),
+	}
+}
+
+func (p *BinaryParser) getStreamAbortMsg() StreamAbort {
+	return StreamAbort{
+		XID:    p.readInt32(),
+		SubXID: p.readInt32(),
+	}
+}
+
+// readStreamXID reads the (sub)transaction xid which precedes changes inside a stream block.
+func (p *BinaryParser) readStreamXID(tx *WAL) int32 {
+	if !tx.InStream() {
+		return 0
+	}
+
+	return p.readInt32()
+}
+
 func (p *BinaryParser) getInsertMsg() Insert {
 	return Insert{
 		RelationID: p.readInt32(),
@@ -205,6 +310,34 @@ func (p *BinaryParser) getUpdateMsg() Update {
 	return u
 }
 
+func (p *BinaryParser) getTruncateMsg() Truncate {
+	size := int(p.readInt32())
+
+	t := Truncate{
+		Options:     p.readInt8(),
+		RelationIDs: make([]int32, size),
+	}
+
+	for i := 0; i < size; i++ {
+		t.RelationIDs[i] = p.readInt32()
+	}
+
+	return t
+}
+
+func (p *BinaryParser) getMessageMsg() Message {
+	m := Message{
+		Flags:  p.readInt8(),
+		LSN:    p.readInt64(),
+		Prefix: p.readString(),
+	}
+
+	size := int(p.readInt32())
+	m.Content = bytes.Clone(p.buffer.Next(size))
+
+	return m
+}
+
 func (p *BinaryParser) getRelationMsg() Relation {
 	return Relation{
 		ID:        p.readInt32(),
@@ -215,6 +348,14 @@ func (p *BinaryParser) getRelationMsg() Relation {
 	}
 }
 
+func (p *BinaryParser) getTypeMsg() DataType {
+	return DataType{
+		ID:        p.readInt32(),
+		Namespace: p.readString(),
+		Name:      p.readString(),
+	}
+}
+
 func (p *BinaryParser) readInt32() (val int32) {
 	r := bytes.NewReader(p.buffer.Next(4))
 	_ = binary.Read(r, p.byteOrder, &val)
@@ -298,6 +439,7 @@ func (p *BinaryParser) readTupleData() []TupleData {
 			p.log.Debug("tupleData: null data type")
 		case ToastDataType:
 			p.log.Debug("tupleData: toast data type")
+			data[i] = TupleData{Toast: true}
 		case TextDataType:
 			vSize := int(p.readInt32())
 			data[i] = TupleData{Value: p.buffer.Next(vSize)}
@@ -2,14 +2,18 @@ package transaction
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"io"
 	"log/slog"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/pgtype"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
 )
 
 func TestBinaryParser_readTupleData(t *testing.T) {
@@ -57,7 +61,7 @@ func TestBinaryParser_readTupleData(t *testing.T) {
 				buffer: bytes.NewBuffer([]byte{0, 1, 117, 0, 0, 0, 1, 116}),
 			},
 			want: []TupleData{
-				{},
+				{Toast: true},
 			},
 		},
 	}
@@ -487,12 +491,13 @@ func TestBinaryParser_ParseWalMessage(t *testing.T) {
 					0, 0, 0, 0, 0, 0, 0, 0,
 					0, 0, 0, 5,
 				},
-				tx: NewWAL(logger, nil, metrics),
+				tx: NewWAL(logger, nil, metrics, &config.ListenerCfg{}, nil),
 			},
 			want: &WAL{
 				pool:          nil,
 				log:           logger,
 				LSN:           7,
+				XID:           5,
 				monitor:       metrics,
 				BeginTime:     &postgresEpoch,
 				RelationStore: make(map[int32]RelationData),
@@ -856,6 +861,73 @@ func TestBinaryParser_ParseWalMessage(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "parse truncate message",
+			args: args{
+				// 84 - T
+				// 0,0,0,1 = 1 int32, number of relations
+				// 1 = int8 options, cascade
+				// 0,0,0,5 = 5 int32, relation id
+				msg: []byte{
+					84,
+					0, 0, 0, 1,
+					1,
+					0, 0, 0, 5,
+				},
+				tx: &WAL{
+					monitor:    metrics,
+					log:        logger,
+					LSN:        4,
+					BeginTime:  &postgresEpoch,
+					CommitTime: &postgresEpoch,
+					RelationStore: map[int32]RelationData{
+						5: {
+							Schema: "public",
+							Table:  "users",
+							Columns: []Column{
+								{
+									log:       logger,
+									name:      "id",
+									value:     nil,
+									valueType: pgtype.Int4OID,
+									isKey:     true,
+								},
+							},
+						},
+					},
+				},
+			},
+			want: &WAL{
+				monitor:    metrics,
+				log:        logger,
+				LSN:        4,
+				BeginTime:  &postgresEpoch,
+				CommitTime: &postgresEpoch,
+				RelationStore: map[int32]RelationData{
+					5: {
+						Schema: "public",
+						Table:  "users",
+						Columns: []Column{
+							{
+								log:       logger,
+								name:      "id",
+								value:     nil,
+								valueType: pgtype.Int4OID,
+								isKey:     true,
+							},
+						},
+					},
+				},
+				Actions: []ActionData{
+					{
+						Schema: "public",
+						Table:  "users",
+						Kind:   ActionKindTruncate,
+					},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "unknown message type",
 			args: args{
@@ -932,3 +1004,64 @@ func TestBinaryParser_ParseWalMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestBinaryParser_ParseWalMessage_ReplicaIdentity(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	// 68 = D, 0,0,0,1 = relation id, the flag, 0,2 = count of columns, 116 = t, 0,0,0,1 = size, 49 = "1"
+	header := func(flag byte) []byte {
+		return []byte{68, 0, 0, 0, 1, flag, 0, 2, 116, 0, 0, 0, 1, 49}
+	}
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		wantOld map[string]any
+	}{
+		{
+			// 75 = K, the non-key column is sent as null (110 = n).
+			name:    "default replica identity",
+			msg:     append(header(75), 110),
+			wantOld: map[string]any{"id": 1},
+		},
+		{
+			// 79 = O, every column of the old row.
+			name:    "replica identity full",
+			msg:     append(header(79), 116, 0, 0, 0, 3, 98, 111, 98),
+			wantOld: map[string]any{"id": 1, "email": "bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			tx := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{}, nil)
+			tx.CommitTime = &now
+			tx.RelationStore[1] = RelationData{
+				Schema: "public",
+				Table:  "users",
+				Columns: []Column{
+					InitColumn(logger, "id", nil, pgtype.Int4OID, true),
+					InitColumn(logger, "email", nil, pgtype.TextOID, false),
+				},
+			}
+
+			p := NewBinaryParser(logger, binary.BigEndian)
+			if err := p.ParseWalMessage(tt.msg, tx); err != nil {
+				t.Fatalf("ParseWalMessage() error = %v", err)
+			}
+
+			events := collectEvents(tx.CreateEventsWithFilter(
+				context.Background(),
+				config.FilterStruct{Tables: map[string][]string{"users": {"delete"}}},
+			))
+
+			if len(events) != 1 {
+				t.Fatalf("CreateEventsWithFilter() got %d events, want 1", len(events))
+			}
+
+			assert.Equal(t, tt.wantOld, events[0].DataOld)
+			assert.Equal(t, []string{"id"}, events[0].KeyColumns)
+		})
+	}
+}
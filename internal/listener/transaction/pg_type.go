@@ -9,6 +9,7 @@ const (
 
 	TextOID    = 25
 	VarcharOID = 1043
+	NumericOID = 1700
 
 	TimestampOID   = 1114
 	TimestamptzOID = 1184
@@ -19,3 +20,69 @@ const (
 	UUIDOID  = 2950
 	BoolOID  = 16
 )
+
+// builtinTypeNames names of the built-in types, other types are announced by the type messages.
+var builtinTypeNames = map[int]string{
+	BoolOID:        "bool",
+	17:             "bytea",
+	18:             "char",
+	19:             "name",
+	Int8OID:        "int8",
+	Int2OID:        "int2",
+	Int4OID:        "int4",
+	TextOID:        "text",
+	26:             "oid",
+	114:            "json",
+	142:            "xml",
+	650:            "cidr",
+	700:            "float4",
+	701:            "float8",
+	790:            "money",
+	829:            "macaddr",
+	869:            "inet",
+	1042:           "bpchar",
+	VarcharOID:     "varchar",
+	DateOID:        "date",
+	TimeOID:        "time",
+	TimestampOID:   "timestamp",
+	TimestamptzOID: "timestamptz",
+	1186:           "interval",
+	1266:           "timetz",
+	1560:           "bit",
+	1562:           "varbit",
+	NumericOID:     "numeric",
+	UUIDOID:        "uuid",
+	JSONBOID:       "jsonb",
+
+	// arrays
+	143:  "_xml",
+	199:  "_json",
+	651:  "_cidr",
+	791:  "_money",
+	1000: "_bool",
+	1001: "_bytea",
+	1002: "_char",
+	1003: "_name",
+	1005: "_int2",
+	1007: "_int4",
+	1009: "_text",
+	1014: "_bpchar",
+	1015: "_varchar",
+	1016: "_int8",
+	1021: "_float4",
+	1022: "_float8",
+	1028: "_oid",
+	1040: "_macaddr",
+	1041: "_inet",
+	1115: "_timestamp",
+	1182: "_date",
+	1183: "_time",
+	1185: "_timestamptz",
+	1187: "_interval",
+	1231: "_numeric",
+	1270: "_timetz",
+	1561: "_bit",
+	1563: "_varbit",
+	2951: "_uuid",
+	3807: "_jsonb",
+}
@@ -29,6 +29,24 @@ const (
 	// DeleteMsgType protocol delete message type.
 	DeleteMsgType byte = 'D'
 
+	// TruncateMsgType protocol truncate message type.
+	TruncateMsgType byte = 'T'
+
+	// MessageMsgType protocol logical message type (pg_logical_emit_message).
+	MessageMsgType byte = 'M'
+
+	// StreamStartMsgType protocol stream start message type (protocol version 2).
+	StreamStartMsgType byte = 'S'
+
+	// StreamStopMsgType protocol stream stop message type (protocol version 2).
+	StreamStopMsgType byte = 'E'
+
+	// StreamCommitMsgType protocol stream commit message type (protocol version 2).
+	StreamCommitMsgType byte = 'c'
+
+	// StreamAbortMsgType protocol stream abort message type (protocol version 2).
+	StreamAbortMsgType byte = 'A'
+
 	// NewTupleDataType protocol new tuple data type.
 	NewTupleDataType byte = 'N'
 
@@ -128,6 +146,56 @@ type (
 		// TupleData message part representing the contents of new tuple.
 		OldRow []TupleData
 	}
+
+	// StreamStart message format.
+	StreamStart struct {
+		// Xid of the transaction.
+		XID int32
+		// 1 if the first stream segment for the transaction.
+		FirstSegment int8
+	}
+
+	// StreamCommit message format.
+	StreamCommit struct {
+		// Xid of the transaction.
+		XID int32
+		// Flags; currently unused (must be 0).
+		Flags int8
+		// The LSN of the commit.
+		LSN int64
+		// The end LSN of the transaction.
+		TransactionLSN int64
+		// Commit timestamp of the transaction.
+		Timestamp time.Time
+	}
+
+	// StreamAbort message format.
+	StreamAbort struct {
+		// Xid of the transaction.
+		XID int32
+		// Xid of the subtransaction (will be same as xid of the transaction for top-level transactions).
+		SubXID int32
+	}
+
+	// Message logical message format.
+	Message struct {
+		// Flags; either 0 for no flags or 1 if the logical decoding message is transactional.
+		Flags int8
+		// The LSN of the logical decoding message.
+		LSN int64
+		// The prefix of the logical decoding message.
+		Prefix string
+		// The content of the logical decoding message.
+		Content []byte
+	}
+
+	// Truncate message format.
+	Truncate struct {
+		// Option bits for TRUNCATE: 1 for CASCADE, 2 for RESTART IDENTITY.
+		Options int8
+		// IDs of the relations corresponding to the ID in the relation message.
+		RelationIDs []int32
+	}
 )
 
 // DataType path of WAL message data.
@@ -155,4 +223,6 @@ type RelationColumn struct {
 // TupleData path of WAL message data.
 type TupleData struct {
 	Value []byte
+	// Toast marks the unchanged TOASTed value, which is not sent.
+	Toast bool
 }
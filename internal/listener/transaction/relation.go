@@ -0,0 +1,181 @@
+package transaction
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// relationLoader fetches relation metadata from the database catalog.
+type relationLoader interface {
+	LoadRelation(ctx context.Context, relationID int32) (Relation, error)
+}
+
+const relationLoadTimeout = 5 * time.Second
+
+// relationCache keeps track of the last time a relation was used.
+type relationCache struct {
+	cfg    config.RelationCacheCfg
+	loader relationLoader
+	seen   map[int32]time.Time
+}
+
+func newRelationCache(cfg config.RelationCacheCfg, loader relationLoader) relationCache {
+	return relationCache{
+		cfg:    cfg,
+		loader: loader,
+	}
+}
+
+// evictionEnabled returns true if relations should be evicted.
+func (c *relationCache) evictionEnabled() bool {
+	return c.cfg.TTL > 0 || c.cfg.Size > 0
+}
+
+// SetRelation store relation metadata received from the WAL.
+func (w *WAL) SetRelation(relation Relation) {
+	rd := RelationData{
+		Schema: relation.Namespace,
+		Table:  relation.Name,
+	}
+
+	for _, rf := range relation.Columns {
+		c := InitColumn(w.log, rf.Name, nil, int(rf.TypeID), rf.Key)
+		rd.Columns = append(rd.Columns, c)
+	}
+
+	if w.fingerprint {
+		rd.Fingerprint = fingerprint(relation.Columns)
+	}
+
+	prev, known := w.RelationStore[relation.ID]
+
+	w.RelationStore[relation.ID] = rd
+	w.touchRelation(relation.ID)
+	w.monitor.SetRelationCacheSize(len(w.RelationStore))
+
+	if w.onRelation != nil && (!known || !sameRelation(prev, rd)) {
+		w.onRelation(relation.Namespace, relation.Name)
+	}
+}
+
+// sameRelation reports whether the relation is unchanged: the same table with the same columns.
+func sameRelation(a, b RelationData) bool {
+	return a.Schema == b.Schema && a.Table == b.Table &&
+		slices.EqualFunc(a.Columns, b.Columns, func(x, y Column) bool {
+			return x.name == y.name && x.valueType == y.valueType && x.isKey == y.isKey
+		})
+}
+
+// fingerprintLength is the number of hex characters of the schema fingerprint.
+const fingerprintLength = 16
+
+// fingerprint hashes the column names, type OIDs and type modifiers (e.g. the varchar length) in the column order.
+// It changes when a column is added, dropped, renamed or its type is changed.
+func fingerprint(columns []RelationColumn) string {
+	h := sha256.New()
+
+	for _, col := range columns {
+		fmt.Fprintf(h, "%s:%d:%d\n", col.Name, col.TypeID, col.ModifierType)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:fingerprintLength]
+}
+
+// relation returns relation metadata, re-requesting it from the catalog if it was evicted.
+func (w *WAL) relation(relationID int32) (RelationData, error) {
+	if rel, ok := w.RelationStore[relationID]; ok {
+		w.touchRelation(relationID)
+		return rel, nil
+	}
+
+	return w.refreshRelation(relationID)
+}
+
+// refreshRelation re-requests relation metadata from the catalog.
+func (w *WAL) refreshRelation(relationID int32) (RelationData, error) {
+	if w.relations.loader == nil {
+		return RelationData{}, errRelationNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), relationLoadTimeout)
+	defer cancel()
+
+	relation, err := w.relations.loader.LoadRelation(ctx, relationID)
+	if err != nil {
+		return RelationData{}, fmt.Errorf("load relation: %w", err)
+	}
+
+	w.log.Info("relation metadata was loaded from catalog", slog.Any("relation_id", relationID))
+
+	w.SetRelation(relation)
+
+	return w.RelationStore[relationID], nil
+}
+
+func (w *WAL) touchRelation(relationID int32) {
+	if !w.relations.evictionEnabled() {
+		return
+	}
+
+	if w.relations.seen == nil {
+		w.relations.seen = make(map[int32]time.Time)
+	}
+
+	w.relations.seen[relationID] = time.Now()
+}
+
+// evictRelations removes relations not seen within the TTL and
+// the least recently seen ones when the cache size is exceeded.
+func (w *WAL) evictRelations(now time.Time) {
+	if !w.relations.evictionEnabled() {
+		return
+	}
+
+	cfg := w.relations.cfg
+
+	var evicted int
+
+	if cfg.TTL > 0 {
+		for id := range w.RelationStore {
+			if now.Sub(w.relations.seen[id]) > cfg.TTL {
+				w.evictRelation(id)
+				evicted++
+			}
+		}
+	}
+
+	if cfg.Size > 0 && len(w.RelationStore) > cfg.Size {
+		ids := make([]int32, 0, len(w.RelationStore))
+
+		for id := range w.RelationStore {
+			ids = append(ids, id)
+		}
+
+		sort.Slice(ids, func(i, j int) bool {
+			return w.relations.seen[ids[i]].Before(w.relations.seen[ids[j]])
+		})
+
+		for _, id := range ids[:len(ids)-cfg.Size] {
+			w.evictRelation(id)
+			evicted++
+		}
+	}
+
+	if evicted > 0 {
+		w.log.Debug("relations were evicted", slog.Int("count", evicted))
+		w.monitor.SetRelationCacheSize(len(w.RelationStore))
+	}
+}
+
+func (w *WAL) evictRelation(relationID int32) {
+	delete(w.RelationStore, relationID)
+	delete(w.relations.seen, relationID)
+}
@@ -0,0 +1,168 @@
+package transaction
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+type relationLoaderMock struct {
+	relations map[int32]Relation
+	calls     int
+}
+
+func (r *relationLoaderMock) LoadRelation(_ context.Context, relationID int32) (Relation, error) {
+	r.calls++
+
+	rel, ok := r.relations[relationID]
+	if !ok {
+		return Relation{}, errRelationNotFound
+	}
+
+	return rel, nil
+}
+
+func TestWAL_evictRelations(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	users := Relation{
+		ID:        1,
+		Namespace: "public",
+		Name:      "users",
+		Columns:   []RelationColumn{{Key: true, Name: "id", TypeID: pgtype.Int4OID}},
+	}
+	orders := Relation{
+		ID:        2,
+		Namespace: "public",
+		Name:      "orders",
+		Columns:   []RelationColumn{{Key: true, Name: "id", TypeID: pgtype.Int4OID}},
+	}
+
+	t.Run("ttl", func(t *testing.T) {
+		loader := &relationLoaderMock{relations: map[int32]Relation{1: users}}
+		w := NewWAL(logger, nil, new(monitorMock), &config.ListenerCfg{
+			RelationCache: config.RelationCacheCfg{TTL: time.Minute},
+		}, loader)
+
+		w.SetRelation(users)
+		w.evictRelations(time.Now())
+		assert.Contains(t, w.RelationStore, int32(1))
+
+		w.evictRelations(time.Now().Add(2 * time.Minute))
+		assert.NotContains(t, w.RelationStore, int32(1))
+
+		action, err := w.CreateActionData(1, nil, []TupleData{{Value: []byte("7")}}, ActionKindInsert)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, loader.calls)
+		assert.Equal(t, "users", action.Table)
+		assert.Equal(t, 7, action.NewColumns[0].value)
+		assert.Contains(t, w.RelationStore, int32(1))
+	})
+
+	t.Run("size", func(t *testing.T) {
+		w := NewWAL(logger, nil, new(monitorMock), &config.ListenerCfg{
+			RelationCache: config.RelationCacheCfg{Size: 1},
+		}, nil)
+
+		w.SetRelation(users)
+		w.relations.seen[1] = time.Now().Add(-time.Second)
+		w.SetRelation(orders)
+		w.evictRelations(time.Now())
+
+		assert.Len(t, w.RelationStore, 1)
+		assert.Contains(t, w.RelationStore, int32(2))
+	})
+
+	t.Run("evicted without loader", func(t *testing.T) {
+		w := NewWAL(logger, nil, new(monitorMock), &config.ListenerCfg{
+			RelationCache: config.RelationCacheCfg{TTL: time.Minute},
+		}, nil)
+
+		w.SetRelation(users)
+		w.evictRelations(time.Now().Add(2 * time.Minute))
+
+		_, err := w.CreateActionData(1, nil, nil, ActionKindInsert)
+		assert.ErrorIs(t, err, errRelationNotFound)
+	})
+}
+
+func TestWAL_SetRelation_Fingerprint(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{SchemaFingerprint: true}, nil)
+	w.CommitTime = &now
+
+	users := Relation{
+		ID:        1,
+		Namespace: "public",
+		Name:      "users",
+		Columns: []RelationColumn{
+			{Key: true, Name: "id", TypeID: pgtype.Int4OID},
+			{Name: "email", TypeID: pgtype.VarcharOID, ModifierType: 104},
+		},
+	}
+
+	w.SetRelation(users)
+	before := w.RelationStore[1].Fingerprint
+
+	w.SetRelation(users)
+	assert.Equal(t, before, w.RelationStore[1].Fingerprint, "stable for the same columns")
+	assert.Len(t, before, fingerprintLength)
+
+	users.Columns = append(users.Columns, RelationColumn{Name: "deleted_at", TypeID: pgtype.TimestamptzOID})
+	w.SetRelation(users)
+	added := w.RelationStore[1].Fingerprint
+	assert.NotEqual(t, before, added, "changed by the added column")
+
+	users.Columns[1].ModifierType = 260
+	w.SetRelation(users)
+	assert.NotEqual(t, added, w.RelationStore[1].Fingerprint, "changed by the varchar length")
+
+	action, err := w.CreateActionData(1, nil, []TupleData{{Value: []byte("1")}, {}, {}}, ActionKindInsert)
+	require.NoError(t, err)
+
+	w.Actions = []ActionData{action}
+
+	events := collectEvents(w.CreateEventsWithFilter(context.Background(), config.FilterStruct{
+		Tables: map[string][]string{"users": {"insert"}},
+	}))
+	require.Len(t, events, 1)
+	assert.Equal(t, w.RelationStore[1].Fingerprint, events[0].SchemaFingerprint)
+}
+
+func TestWAL_SetRelation_OnRelation(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{}, nil)
+
+	var notified []string
+
+	w.OnRelation(func(schema, table string) {
+		notified = append(notified, schema+"."+table)
+	})
+
+	users := Relation{
+		ID:        1,
+		Namespace: "public",
+		Name:      "users",
+		Columns:   []RelationColumn{{Key: true, Name: "id", TypeID: pgtype.Int4OID}},
+	}
+
+	w.SetRelation(users)
+	w.SetRelation(users)
+	assert.Equal(t, []string{"public.users"}, notified, "an unchanged relation isn't reported again")
+
+	users.Columns = append(users.Columns, RelationColumn{Name: "email", TypeID: pgtype.VarcharOID})
+	w.SetRelation(users)
+	assert.Equal(t, []string{"public.users", "public.users"}, notified)
+}
@@ -0,0 +1,186 @@
+package transaction
+
+import (
+	"log/slog"
+	"time"
+)
+
+// streamedAction is a change of the in-progress transaction streamed before its commit.
+type streamedAction struct {
+	xid    int32 // (sub)transaction the change belongs to
+	action ActionData
+}
+
+// streamState tracks the buffering of the streamed transaction.
+type streamState struct {
+	since    time.Time // the first block was received
+	reported bool
+	emitted  bool // some changes were published before the commit
+}
+
+// LongStream is a streamed transaction buffered longer than the limit without commit.
+type LongStream struct {
+	XID     int32
+	Age     time.Duration
+	Actions int // buffered changes
+}
+
+// InStream reports whether the parser is inside a stream start/stop block.
+func (w *WAL) InStream() bool {
+	return w.streamXID != 0
+}
+
+// Pending reports whether changes were received but not committed yet: the open transaction or streamed ones.
+func (w *WAL) Pending() bool {
+	return w.BeginTime != nil || len(w.streamStates) > 0
+}
+
+// StartStream opens a block of changes of the streamed transaction.
+func (w *WAL) StartStream(xid int32) {
+	w.streamXID = xid
+
+	if w.streamStates == nil {
+		w.streamStates = make(map[int32]*streamState)
+	}
+
+	if _, ok := w.streamStates[xid]; !ok {
+		w.streamStates[xid] = &streamState{since: time.Now()}
+	}
+}
+
+// StopStream closes the current block of the streamed transaction, changes stay buffered until commit or abort.
+func (w *WAL) StopStream() {
+	w.streamXID = 0
+}
+
+// addAction appends the action to the transaction, or buffers it if the transaction is streamed.
+func (w *WAL) addAction(xid int32, actions ...ActionData) {
+	if !w.InStream() {
+		w.Actions = append(w.Actions, actions...)
+		return
+	}
+
+	if w.streams == nil {
+		w.streams = make(map[int32][]streamedAction)
+	}
+
+	for _, action := range actions {
+		w.streams[w.streamXID] = append(w.streams[w.streamXID], streamedAction{xid: xid, action: action})
+	}
+}
+
+// CommitStream moves the buffered changes of the streamed transaction to the actions for publishing.
+func (w *WAL) CommitStream(xid int32, lsn int64, commitTime time.Time) {
+	streamed := w.streams[xid]
+	delete(w.streams, xid)
+	delete(w.streamStates, xid)
+
+	actions := make([]ActionData, 0, len(streamed))
+
+	for _, s := range streamed {
+		actions = append(actions, s.action)
+	}
+
+	w.LSN = lsn
+	w.XID = xid
+	w.Actions = actions
+	w.CommitTime = &commitTime
+}
+
+// AbortStream discards the buffered changes of the aborted streamed transaction.
+// If only a subtransaction was aborted, its changes are discarded and the rest stay buffered.
+func (w *WAL) AbortStream(xid, subXID int32) {
+	if xid == subXID {
+		if state := w.streamStates[xid]; state != nil && state.emitted {
+			w.log.Warn("streamed transaction was aborted after early emission", slog.Any("xid", xid))
+		}
+
+		delete(w.streamStates, xid)
+	}
+
+	streamed, ok := w.streams[xid]
+	if !ok {
+		return
+	}
+
+	if xid == subXID {
+		delete(w.streams, xid)
+
+		w.log.Debug(
+			"streamed transaction was aborted, changes discarded",
+			slog.Any("xid", xid),
+			slog.Int("actions", len(streamed)),
+		)
+
+		return
+	}
+
+	kept := streamed[:0]
+
+	for _, s := range streamed {
+		if s.xid != subXID {
+			kept = append(kept, s)
+		}
+	}
+
+	w.streams[xid] = kept
+}
+
+// LongStreams returns the streamed transactions buffered longer than maxTime, each one is returned once.
+func (w *WAL) LongStreams(now time.Time, maxTime time.Duration) []LongStream {
+	var long []LongStream
+
+	for xid, state := range w.streamStates {
+		if state.reported || now.Sub(state.since) < maxTime {
+			continue
+		}
+
+		state.reported = true
+		long = append(long, LongStream{XID: xid, Age: now.Sub(state.since), Actions: len(w.streams[xid])})
+	}
+
+	return long
+}
+
+// EmitStream moves the changes buffered so far of the streamed transaction to the actions for publishing,
+// the rest is published on commit. The event time of the changes is the emission time,
+// they have no LSN as the commit LSN is not known yet.
+// Returns false if there is nothing to emit, or a transaction is open as the actions are its changes.
+func (w *WAL) EmitStream(xid int32, now time.Time) bool {
+	streamed := w.streams[xid]
+	if len(streamed) == 0 || w.BeginTime != nil {
+		return false
+	}
+
+	delete(w.streams, xid)
+
+	if state := w.streamStates[xid]; state != nil {
+		state.emitted = true
+	}
+
+	actions := make([]ActionData, 0, len(streamed))
+
+	for _, s := range streamed {
+		actions = append(actions, s.action)
+	}
+
+	w.XID = xid
+	w.LSN = 0
+	w.Actions = actions
+	w.CommitTime = &now
+
+	return true
+}
+
+// ReportedStreams returns the streamed transactions already returned by LongStreams.
+func (w *WAL) ReportedStreams() []int32 {
+	var xids []int32
+
+	for xid, state := range w.streamStates {
+		if state.reported {
+			xids = append(xids, xid)
+		}
+	}
+
+	return xids
+}
@@ -0,0 +1,210 @@
+package transaction
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// streamMsg builds the protocol message of the type from int32, int8, int64 and raw byte parts.
+func streamMsg(msgType byte, parts ...any) []byte {
+	msg := []byte{msgType}
+
+	for _, part := range parts {
+		switch v := part.(type) {
+		case int32:
+			msg = binary.BigEndian.AppendUint32(msg, uint32(v))
+		case int16:
+			msg = binary.BigEndian.AppendUint16(msg, uint16(v))
+		case int8:
+			msg = append(msg, byte(v))
+		case int64:
+			msg = binary.BigEndian.AppendUint64(msg, uint64(v))
+		case []byte:
+			msg = append(msg, v...)
+		}
+	}
+
+	return msg
+}
+
+// streamedInsert builds an insert of the single int4 column value inside a stream block.
+func streamedInsert(xid int32, value string) []byte {
+	return streamMsg(
+		InsertMsgType,
+		xid,
+		int32(5),
+		[]byte{NewTupleDataType},
+		int16(1),
+		[]byte{TextDataType},
+		int32(len(value)),
+		[]byte(value),
+	)
+}
+
+func TestBinaryParser_ParseWalMessage_Stream(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}}
+
+	tests := []struct {
+		name     string
+		messages [][]byte
+		want     []any
+	}{
+		{
+			name: "aborted transaction",
+			messages: [][]byte{
+				streamMsg(StreamStartMsgType, int32(100), int8(1)),
+				streamedInsert(100, "1"),
+				streamMsg(StreamStopMsgType),
+				streamMsg(StreamStartMsgType, int32(100), int8(0)),
+				streamedInsert(100, "2"),
+				streamMsg(StreamStopMsgType),
+				streamMsg(StreamAbortMsgType, int32(100), int32(100)),
+			},
+		},
+		{
+			name: "committed transaction",
+			messages: [][]byte{
+				streamMsg(StreamStartMsgType, int32(100), int8(1)),
+				streamedInsert(100, "1"),
+				streamMsg(StreamStopMsgType),
+				streamMsg(StreamStartMsgType, int32(100), int8(0)),
+				streamedInsert(100, "2"),
+				streamMsg(StreamStopMsgType),
+				streamMsg(StreamCommitMsgType, int32(100), int8(0), int64(10), int64(20), int64(0)),
+			},
+			want: []any{1, 2},
+		},
+		{
+			name: "aborted subtransaction",
+			messages: [][]byte{
+				streamMsg(StreamStartMsgType, int32(100), int8(1)),
+				streamedInsert(100, "1"),
+				streamedInsert(101, "2"),
+				streamMsg(StreamStopMsgType),
+				streamMsg(StreamAbortMsgType, int32(100), int32(101)),
+				streamMsg(StreamCommitMsgType, int32(100), int8(0), int64(10), int64(20), int64(0)),
+			},
+			want: []any{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &WAL{
+				log:     logger,
+				monitor: new(monitorMock),
+				pool:    newEventPool(),
+				RelationStore: map[int32]RelationData{
+					5: {
+						Schema:  "public",
+						Table:   "users",
+						Columns: []Column{InitColumn(logger, "id", nil, Int4OID, true)},
+					},
+				},
+			}
+
+			p := NewBinaryParser(logger, binary.BigEndian)
+
+			for _, msg := range tt.messages {
+				require.NoError(t, p.ParseWalMessage(msg, w))
+			}
+
+			var got []any
+
+			if w.CommitTime != nil {
+				for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+					got = append(got, event.Data["id"])
+				}
+			}
+
+			assert.Equal(t, tt.want, got)
+			assert.False(t, w.InStream())
+			assert.Empty(t, w.streams)
+		})
+	}
+}
+
+func TestWAL_EmitStream(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}}
+
+	w := &WAL{
+		log:     logger,
+		monitor: new(monitorMock),
+		pool:    newEventPool(),
+		RelationStore: map[int32]RelationData{
+			5: {
+				Schema:  "public",
+				Table:   "users",
+				Columns: []Column{InitColumn(logger, "id", nil, Int4OID, true)},
+			},
+		},
+	}
+
+	p := NewBinaryParser(logger, binary.BigEndian)
+	parse := func(messages ...[]byte) {
+		for _, msg := range messages {
+			require.NoError(t, p.ParseWalMessage(msg, w))
+		}
+	}
+	ids := func() []any {
+		var got []any
+
+		for _, event := range collectEvents(w.CreateEventsWithFilter(context.Background(), filter)) {
+			got = append(got, event.Data["id"])
+		}
+
+		w.Clear()
+
+		return got
+	}
+
+	parse(
+		streamMsg(StreamStartMsgType, int32(100), int8(1)),
+		streamedInsert(100, "1"),
+		streamMsg(StreamStopMsgType),
+	)
+
+	now := time.Now()
+	assert.Empty(t, w.LongStreams(now, time.Minute))
+
+	long := w.LongStreams(now.Add(time.Hour), time.Minute)
+	require.Len(t, long, 1)
+	assert.Equal(t, int32(100), long[0].XID)
+	assert.Equal(t, 1, long[0].Actions)
+	assert.Empty(t, w.LongStreams(now.Add(time.Hour), time.Minute), "reported once")
+
+	begin := now
+	w.BeginTime = &begin
+
+	assert.False(t, w.EmitStream(100, now), "a transaction is open")
+
+	w.Clear()
+	w.LSN = 5 // of the previous transaction
+
+	require.True(t, w.EmitStream(100, now))
+	assert.Zero(t, w.LSN, "commit LSN is not known yet")
+	assert.Equal(t, []any{1}, ids())
+	assert.False(t, w.EmitStream(100, now), "nothing buffered")
+
+	parse(
+		streamMsg(StreamStartMsgType, int32(100), int8(0)),
+		streamedInsert(100, "2"),
+		streamMsg(StreamStopMsgType),
+		streamMsg(StreamCommitMsgType, int32(100), int8(0), int64(10), int64(20), int64(0)),
+	)
+
+	assert.Equal(t, int64(10), w.LSN)
+	assert.Equal(t, []any{2}, ids(), "the rest is published on commit")
+	assert.Empty(t, w.streamStates)
+}
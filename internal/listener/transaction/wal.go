@@ -1,14 +1,20 @@
 package transaction
 
 import (
+	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"log/slog"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/goccy/go-json"
 	"github.com/google/uuid"
 
 	"github.com/ihippik/wal-listener/v2/internal/config"
@@ -17,24 +23,67 @@ import (
 
 type monitor interface {
 	IncFilterSkippedEvents(table string)
+	IncProblematicEvents(kind string)
+	SetRelationCacheSize(size int)
+	IncTransitionSkippedEvents(table string)
+	IncEventPool(op string)
 }
 
+const problemKindRelationMismatch = "relation_mismatch"
+
+// event pool operations.
+const (
+	poolOpGet = "get"
+	poolOpPut = "put"
+)
+
 // WAL transaction specified WAL message.
 type WAL struct {
 	log           *slog.Logger
 	monitor       monitor
 	LSN           int64
+	XID           int32 // of the transaction, set on begin
 	BeginTime     *time.Time
 	CommitTime    *time.Time
 	RelationStore map[int32]RelationData
 	Actions       []ActionData
 	pool          *sync.Pool
+	relations     relationCache
+	streamXID     int32                      // top-level xid of the open stream block
+	streams       map[int32][]streamedAction // buffered changes of in-progress streamed transactions
+	streamStates  map[int32]*streamState
+	annotateTypes bool
+	fingerprint   bool
+	changes       bool
+	onlyChanged   bool
+	columnOrder   bool
+	omitNulls     bool
+	byteDelta     bool
+	opField       bool
+	oldColumns    map[string]config.OldColumnsMode
+	types         map[int32]string                     // names of the non built-in types announced by the type messages
+	composites    map[int][]CompositeField             // attributes of the composite types loaded from the catalog
+	projection    map[string]map[string]struct{}       // table -> decoded columns
+	patterns      map[string]map[string]*regexp.Regexp // table -> column -> compiled column pattern
+	tablePatterns []tablePattern                       // compiled table filter patterns, in the key order
+	excluded      excludedTables
+	mapCapacity   int
+	decodeWorkers int
+	softDelete    map[string]config.SoftDeleteCfg // table -> soft delete marker
+	msgPrefixes   []string                        // published logical message prefixes, all when empty
+	onRelation    func(schema, table string)      // called when the relation metadata is new or changed
 }
 
 var errRelationNotFound = errors.New("relation not found")
 
 // NewWAL create and initialize new WAL transaction.
-func NewWAL(log *slog.Logger, pool *sync.Pool, monitor monitor) *WAL {
+func NewWAL(
+	log *slog.Logger,
+	pool *sync.Pool,
+	monitor monitor,
+	cfg *config.ListenerCfg,
+	loader relationLoader,
+) *WAL {
 	const aproxData = 300
 
 	return &WAL{
@@ -43,21 +92,136 @@ func NewWAL(log *slog.Logger, pool *sync.Pool, monitor monitor) *WAL {
 		monitor:       monitor,
 		RelationStore: make(map[int32]RelationData),
 		Actions:       make([]ActionData, 0, aproxData),
+		relations:     newRelationCache(cfg.RelationCache, loader),
+		annotateTypes: cfg.AnnotateTypes,
+		byteDelta:     cfg.ByteDelta,
+		opField:       cfg.OpField != "",
+		fingerprint:   cfg.SchemaFingerprint,
+		changes:       cfg.Changes,
+		onlyChanged:   cfg.OnlyChangedColumns,
+		columnOrder:   cfg.OrderedColumns,
+		omitNulls:     cfg.Nulls == config.NullsOmit,
+		oldColumns:    cfg.OldColumns,
+		projection:    newProjection(cfg.Projection.Columns),
+		patterns:      compilePatterns(cfg.Filter.ColumnPatterns),
+		tablePatterns: compileTablePatterns(cfg.Filter.Tables),
+		excluded:      newExcludedTables(cfg.Filter.ExcludeTables),
+		mapCapacity:   cfg.Projection.MapCapacity,
+		decodeWorkers: cfg.DecodeWorkers,
+		softDelete:    cfg.SoftDelete,
+		msgPrefixes:   cfg.LogicalMessages.Prefixes,
+	}
+}
+
+// OnRelation registers the function called with a new relation received from the WAL or loaded from the catalog,
+// or one whose columns changed, e.g. after a schema change.
+func (w *WAL) OnRelation(fn func(schema, table string)) {
+	w.onRelation = fn
+}
+
+// newProjection indexes the projected columns by table, returns nil if nothing is projected.
+func newProjection(columns map[string][]string) map[string]map[string]struct{} {
+	if len(columns) == 0 {
+		return nil
+	}
+
+	projection := make(map[string]map[string]struct{}, len(columns))
+
+	for table, names := range columns {
+		set := make(map[string]struct{}, len(names))
+
+		for _, name := range names {
+			set[name] = struct{}{}
+		}
+
+		projection[table] = set
+	}
+
+	return projection
+}
+
+// compilePatterns compiles the column patterns, they are validated with the config.
+func compilePatterns(patterns map[string]map[string]string) map[string]map[string]*regexp.Regexp {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	compiled := make(map[string]map[string]*regexp.Regexp, len(patterns))
+
+	for table, columns := range patterns {
+		compiled[table] = make(map[string]*regexp.Regexp, len(columns))
+
+		for column, pattern := range columns {
+			compiled[table][column] = regexp.MustCompile(pattern)
+		}
+	}
+
+	return compiled
+}
+
+// tablePattern is a table filter matching the table names by regular expression.
+type tablePattern struct {
+	re      *regexp.Regexp
+	actions []string
+}
+
+// compileTablePatterns compiles the table filter keys with the pattern marker, they are validated with the config.
+func compileTablePatterns(tables map[string][]string) []tablePattern {
+	var patterns []tablePattern
+
+	for _, key := range slices.Sorted(maps.Keys(tables)) {
+		if pattern, ok := config.TablePattern(key); ok {
+			patterns = append(patterns, tablePattern{re: regexp.MustCompile(pattern), actions: tables[key]})
+		}
 	}
+
+	return patterns
 }
 
-// Clear transaction data.
+// excludedTables are the table names and compiled patterns of the exclude filter.
+type excludedTables struct {
+	names    map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// newExcludedTables compiles the exclude filter, the patterns are validated with the config.
+func newExcludedTables(tables []string) excludedTables {
+	var excluded excludedTables
+
+	for _, table := range tables {
+		if pattern, ok := config.TablePattern(table); ok {
+			excluded.patterns = append(excluded.patterns, regexp.MustCompile(pattern))
+			continue
+		}
+
+		if excluded.names == nil {
+			excluded.names = make(map[string]struct{})
+		}
+
+		excluded.names[table] = struct{}{}
+	}
+
+	return excluded
+}
+
+// Clear transaction data and evict stale relations.
 func (w *WAL) Clear() {
 	w.CommitTime = nil
 	w.BeginTime = nil
 	w.Actions = nil
+
+	w.evictRelations(time.Now())
 }
 
+// RetrieveEvent resets the published event and returns it to the pool.
 func (w *WAL) RetrieveEvent(event *publisher.Event) {
+	event.Reset()
 	w.pool.Put(event)
+	w.monitor.IncEventPool(poolOpPut)
 }
 
 func (w *WAL) getPoolEvent() *publisher.Event {
+	w.monitor.IncEventPool(poolOpGet)
 	return w.pool.Get().(*publisher.Event)
 }
 
@@ -68,37 +232,76 @@ func (w *WAL) CreateActionData(
 	newRows []TupleData,
 	kind ActionKind,
 ) (a ActionData, err error) {
-	rel, ok := w.RelationStore[relationID]
-	if !ok {
-		return a, errRelationNotFound
+	rel, err := w.relation(relationID)
+	if err != nil {
+		return a, err
+	}
+
+	if columnsMismatch(rel, oldRows) || columnsMismatch(rel, newRows) {
+		w.monitor.IncProblematicEvents(problemKindRelationMismatch)
+		w.log.Warn(
+			"tuple columns do not match cached relation, refreshing",
+			slog.String("schema", rel.Schema),
+			slog.String("table", rel.Table),
+			slog.Int("relation_columns", len(rel.Columns)),
+			slog.Int("old_columns", len(oldRows)),
+			slog.Int("new_columns", len(newRows)),
+		)
+
+		if refreshed, err := w.refreshRelation(relationID); err != nil {
+			w.log.Warn("relation refresh failed", "err", err)
+		} else {
+			rel = refreshed
+		}
 	}
 
 	a = ActionData{
-		Schema: rel.Schema,
-		Table:  rel.Table,
-		Kind:   kind,
+		Schema:      rel.Schema,
+		Table:       rel.Table,
+		Kind:        kind,
+		OldColumns:  w.buildColumns(rel, oldRows),
+		NewColumns:  w.buildColumns(rel, newRows),
+		Fingerprint: rel.Fingerprint,
 	}
 
-	oldColumns := make([]Column, 0, len(oldRows))
+	return a, nil
+}
 
-	for num, row := range oldRows {
-		column := InitColumn(
-			w.log,
-			rel.Columns[num].name,
-			nil,
-			rel.Columns[num].valueType,
-			rel.Columns[num].isKey,
-		)
+// columnsMismatch checks whether the tuple has a different number of columns than the cached relation.
+func columnsMismatch(rel RelationData, rows []TupleData) bool {
+	return len(rows) > 0 && len(rows) != len(rel.Columns)
+}
+
+// buildColumns maps tuple values to relation columns by position.
+// Values without a corresponding relation column are dropped,
+// as well as the columns outside the table projection, before their values are decoded.
+func (w *WAL) buildColumns(rel RelationData, rows []TupleData) []Column {
+	projected, hasProjection := w.projection[rel.Table]
 
-		column.AssertValue(row.Value)
-		oldColumns = append(oldColumns, column)
+	size := len(rows)
+	if hasProjection {
+		size = min(size, len(projected))
 	}
 
-	a.OldColumns = oldColumns
+	columns := make([]Column, 0, size)
+
+	for num, row := range rows {
+		if num >= len(rel.Columns) {
+			w.log.Warn(
+				"tuple value without relation column was dropped",
+				slog.String("table", rel.Table),
+				slog.Int("position", num),
+			)
+
+			continue
+		}
 
-	newColumns := make([]Column, 0, len(newRows))
+		if hasProjection {
+			if _, ok := projected[rel.Columns[num].name]; !ok {
+				continue
+			}
+		}
 
-	for num, row := range newRows {
 		column := InitColumn(
 			w.log,
 			rel.Columns[num].name,
@@ -106,13 +309,84 @@ func (w *WAL) CreateActionData(
 			rel.Columns[num].valueType,
 			rel.Columns[num].isKey,
 		)
-		column.AssertValue(row.Value)
-		newColumns = append(newColumns, column)
+
+		column.composites = w.composites
+
+		if row.Toast {
+			column.toast = true
+		} else if w.decodeWorkers > 1 {
+			// the tuple data refers to the message buffer, which is not kept until the commit.
+			column.raw = bytes.Clone(row.Value)
+		} else {
+			column.AssertValue(row.Value)
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns
+}
+
+// decodeActions decodes the deferred column values of the actions with the decode workers.
+// Every action is decoded by one worker in place, so the order of the actions is kept.
+func (w *WAL) decodeActions() {
+	if w.decodeWorkers <= 1 || len(w.Actions) == 0 {
+		return
 	}
 
-	a.NewColumns = newColumns
+	jobs := make(chan int)
 
-	return a, nil
+	var wg sync.WaitGroup
+
+	for range min(w.decodeWorkers, len(w.Actions)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				decodeColumns(w.Actions[i].OldColumns)
+				decodeColumns(w.Actions[i].NewColumns)
+			}
+		}()
+	}
+
+	for i := range w.Actions {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+func decodeColumns(columns []Column) {
+	for i := range columns {
+		if columns[i].raw != nil {
+			columns[i].AssertValue(columns[i].raw)
+			columns[i].raw = nil
+		}
+	}
+}
+
+// CreateTruncateActionData create an action without row data for each truncated relation.
+func (w *WAL) CreateTruncateActionData(relationIDs []int32) ([]ActionData, error) {
+	actions := make([]ActionData, 0, len(relationIDs))
+
+	for _, id := range relationIDs {
+		rel, err := w.relation(id)
+		if err != nil {
+			return nil, err
+		}
+
+		actions = append(actions, ActionData{
+			Schema:      rel.Schema,
+			Table:       rel.Table,
+			Kind:        ActionKindTruncate,
+			Fingerprint: rel.Fingerprint,
+		})
+	}
+
+	return actions, nil
 }
 
 // CreateEventsWithFilter filter WAL message by table,
@@ -121,36 +395,69 @@ func (w *WAL) CreateEventsWithFilter(ctx context.Context, filter config.FilterSt
 	output := make(chan *publisher.Event)
 
 	go func(ctx context.Context) {
+		w.decodeActions()
+
+		if !w.matchSignificantColumns(filter) {
+			close(output)
+			return
+		}
+
 		for _, item := range w.Actions {
 			if err := ctx.Err(); err != nil {
 				w.log.Debug("create events with filter: context canceled")
 				break
 			}
 
-			dataOld := make(map[string]any, len(item.OldColumns))
+			if item.Kind == ActionKindMessage {
+				event := w.messageEvent(item.Message)
 
-			for _, val := range item.OldColumns {
-				dataOld[val.name] = val.value
+				if event != nil {
+					output <- event
+				}
+
+				continue
 			}
 
-			data := make(map[string]any, len(item.NewColumns))
+			if !matchSchema(filter, item.Schema) {
+				w.monitor.IncFilterSkippedEvents(item.Table)
+				w.log.Debug(
+					"wal-message was skipped by schema filter",
+					slog.String("schema", item.Schema),
+					slog.String("table", item.Table),
+				)
 
-			for _, val := range item.NewColumns {
-				data[val.name] = val.value
+				continue
 			}
 
-			event := w.getPoolEvent()
+			dataOld := make(map[string]any, w.mapSize(len(item.OldColumns)))
 
-			event.ID = uuid.New()
-			event.Schema = item.Schema
-			event.Table = item.Table
-			event.Action = item.Kind.string()
-			event.Data = data
-			event.DataOld = dataOld
-			event.EventTime = *w.CommitTime
+			for _, val := range item.OldColumns {
+				if !val.toast {
+					dataOld[val.name] = val.value
+				}
+			}
+
+			data := make(map[string]any, w.mapSize(len(item.NewColumns)))
+
+			var unchangedToast []string
+
+			for _, val := range item.NewColumns {
+				if !val.toast {
+					data[val.name] = val.value
+					continue
+				}
+
+				// the unchanged TOASTed value is carried over from the old row (REPLICA IDENTITY FULL),
+				// otherwise it's omitted rather than published as null.
+				if oldVal, ok := dataOld[val.name]; ok {
+					data[val.name] = oldVal
+				} else {
+					unchangedToast = append(unchangedToast, val.name)
+				}
+			}
 
 			// Check table and action filters
-			actions, validTable := filter.Tables[item.Table]
+			actions, validTable := w.matchTable(filter, item.Table)
 			validAction := inArray(actions, item.Kind.string())
 			if !validTable || !validAction {
 				w.monitor.IncFilterSkippedEvents(item.Table)
@@ -163,46 +470,65 @@ func (w *WAL) CreateEventsWithFilter(ctx context.Context, filter config.FilterSt
 				continue
 			}
 
-			// Check column filters if configured for this table
-			if columnFilters, hasColumnFilters := filter.ColumnFilter[item.Table]; hasColumnFilters {
-				// Assume event passes filter until we find a mismatch
-				passesColumnFilters := true
-
-				// For each column that has filters
-				for columnName, allowedValues := range columnFilters {
-					// Get the actual value for this column from the event data
-					actualValue, exists := data[columnName]
-					if !exists {
-						w.log.Debug(
-							"column filter skipped: column not found in event",
-							slog.String("table", item.Table),
-							slog.String("column", columnName),
-						)
-						continue
-					}
-
-					// Convert actual value to string for comparison
-					actualStr := fmt.Sprintf("%v", actualValue)
-
-					// Check if the value is in the allowed list
-					if !inArray(allowedValues, actualStr) {
-						passesColumnFilters = false
-						w.monitor.IncFilterSkippedEvents(item.Table)
-						w.log.Debug(
-							"wal-message was skipped by column filter",
-							slog.String("table", item.Table),
-							slog.String("column", columnName),
-							slog.String("value", actualStr),
-						)
-						break
-					}
-				}
+			if !w.matchColumnFilters(filter, item.Table, data) {
+				continue
+			}
 
-				if !passesColumnFilters {
-					continue
-				}
+			if item.Kind == ActionKindUpdate && !w.matchOldColumnFilters(filter, item.Table, dataOld) {
+				continue
+			}
+
+			if !w.matchNullTransitions(filter, item, data, dataOld) {
+				continue
+			}
+
+			event := w.getPoolEvent()
+
+			event.ID = uuid.New()
+			event.Schema = item.Schema
+			event.Table = item.Table
+			event.Action = item.Kind.string()
+			event.Data = data
+			event.DataOld = w.oldData(item, dataOld)
+			event.EventTime = *w.CommitTime
+			event.TransactionID = uint32(w.XID)
+			event.LSN = uint64(w.LSN)
+			event.Types = w.columnTypes(item)
+			event.ByteDelta = w.rowByteDelta(item.Kind, data, dataOld) // after the filters, the rows are marshalled
+			event.Changes = w.columnChanges(item.Kind, data, dataOld)
+			event.UnchangedToast = unchangedToast
+
+			if w.opField {
+				event.Op = item.Kind.Op()
+			}
+
+			event.Deleted = w.softDeleted(item, data, dataOld)
+
+			event.SchemaFingerprint = item.Fingerprint
+
+			if w.onlyChanged && item.Kind == ActionKindUpdate {
+				event.Data = changedData(item, data, dataOld)
 			}
 
+			if item.Kind == ActionKindDelete {
+				event.KeyColumns = keyColumns(item.OldColumns)
+				event.PrimaryKey = primaryKey(event.KeyColumns, dataOld)
+			} else {
+				event.KeyColumns = keyColumns(item.NewColumns)
+				event.PrimaryKey = primaryKey(event.KeyColumns, data)
+			}
+
+			if w.columnOrder {
+				event.ColumnOrder = columnNames(item)
+			}
+
+			if w.omitNulls {
+				omitNulls(event.Data)
+				omitNulls(event.DataOld)
+			}
+
+			stripInternalColumns(filter, event)
+
 			output <- event
 		}
 
@@ -212,6 +538,234 @@ func (w *WAL) CreateEventsWithFilter(ctx context.Context, filter config.FilterSt
 	return output
 }
 
+// mapSize returns the initial capacity of an event data map for the number of columns.
+func (w *WAL) mapSize(columns int) int {
+	if w.mapCapacity > 0 {
+		return min(columns, w.mapCapacity)
+	}
+
+	return columns
+}
+
+// columnNames returns the columns of the action in the table order.
+func columnNames(item ActionData) []string {
+	columns := item.NewColumns
+	if len(columns) == 0 {
+		columns = item.OldColumns
+	}
+
+	names := make([]string, 0, len(columns))
+
+	for _, col := range columns {
+		names = append(names, col.name)
+	}
+
+	return names
+}
+
+// primaryKey returns the values of the key columns, nil if the row has none.
+func primaryKey(keys []string, data map[string]any) map[string]any {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pk := make(map[string]any, len(keys))
+
+	for _, name := range keys {
+		pk[name] = data[name]
+	}
+
+	return pk
+}
+
+// keyColumns returns the names of the key columns.
+func keyColumns(columns []Column) []string {
+	var keys []string
+
+	for _, col := range columns {
+		if col.isKey {
+			keys = append(keys, col.name)
+		}
+	}
+
+	return keys
+}
+
+// identityColumns returns the replica identity columns of the key tuple.
+// Without REPLICA IDENTITY FULL the old tuple has every column, but only the key columns carry values,
+// the others are sent as nulls and must not be mistaken for the old values.
+func identityColumns(columns []Column) []Column {
+	keys := columns[:0]
+
+	for _, col := range columns {
+		if col.isKey {
+			keys = append(keys, col)
+		}
+	}
+
+	return keys
+}
+
+// oldData returns the old row columns selected for the action.
+// Filters and the byte delta still see the complete old row.
+func (w *WAL) oldData(item ActionData, dataOld map[string]any) map[string]any {
+	switch w.oldColumns[strings.ToLower(item.Kind.string())] {
+	case config.OldColumnsNone:
+		return make(map[string]any)
+	case config.OldColumnsKeys:
+		keys := make(map[string]any)
+
+		for _, val := range item.OldColumns {
+			if val.isKey {
+				keys[val.name] = val.value
+			}
+		}
+
+		return keys
+	default:
+		return dataOld
+	}
+}
+
+// softDeleted returns the soft delete flag of the update, nil if the table has no soft delete marker.
+// In the transition mode an old row without the column (no REPLICA IDENTITY FULL) counts as not deleted before.
+func (w *WAL) softDeleted(item ActionData, data, dataOld map[string]any) *bool {
+	sd, ok := w.softDelete[item.Table]
+	if !ok || item.Kind != ActionKindUpdate {
+		return nil
+	}
+
+	deleted := data[sd.Column] != nil
+
+	if sd.Mode == config.SoftDeleteTransition {
+		deleted = deleted && dataOld[sd.Column] == nil
+	}
+
+	return &deleted
+}
+
+// rowByteDelta returns the size difference between the new and old serialized row of the update.
+// Returns nil if disabled or the old row is not present.
+func (w *WAL) rowByteDelta(kind ActionKind, data, dataOld map[string]any) *int {
+	if !w.byteDelta || kind != ActionKindUpdate || len(dataOld) == 0 {
+		return nil
+	}
+
+	newRow, err := json.Marshal(data)
+	if err != nil {
+		w.log.Warn("byte delta: marshal new row", "err", err)
+		return nil
+	}
+
+	oldRow, err := json.Marshal(dataOld)
+	if err != nil {
+		w.log.Warn("byte delta: marshal old row", "err", err)
+		return nil
+	}
+
+	delta := len(newRow) - len(oldRow)
+
+	return &delta
+}
+
+// columnChanges returns the columns of the update whose value differs from the old row.
+// Returns nil if disabled or the old row is not present; columns missing from the old row are omitted.
+func (w *WAL) columnChanges(kind ActionKind, data, dataOld map[string]any) map[string]publisher.ColumnChange {
+	if !w.changes || kind != ActionKindUpdate || len(dataOld) == 0 {
+		return nil
+	}
+
+	changes := make(map[string]publisher.ColumnChange)
+
+	for column, val := range data {
+		oldVal, ok := dataOld[column]
+		if !ok || reflect.DeepEqual(oldVal, val) {
+			continue
+		}
+
+		changes[column] = publisher.ColumnChange{Old: oldVal, New: val}
+	}
+
+	return changes
+}
+
+// changedData returns the columns of the update that differ from the old row and the key columns.
+// The columns missing from the old row can't be compared, so they are kept.
+func changedData(item ActionData, data, dataOld map[string]any) map[string]any {
+	changed := make(map[string]any, len(data))
+
+	for _, col := range item.NewColumns {
+		val, ok := data[col.name]
+		if !ok {
+			continue
+		}
+
+		if oldVal, inOld := dataOld[col.name]; !col.isKey && inOld && reflect.DeepEqual(oldVal, val) {
+			continue
+		}
+
+		changed[col.name] = val
+	}
+
+	return changed
+}
+
+// omitNulls removes the NULL columns from the row data.
+func omitNulls(data map[string]any) {
+	for name, val := range data {
+		if val == nil {
+			delete(data, name)
+		}
+	}
+}
+
+// SetType stores the name of the data type announced by the type message,
+// the attributes of a composite type are loaded from the catalog.
+func (w *WAL) SetType(dataType DataType) {
+	if w.types == nil {
+		w.types = make(map[int32]string)
+	}
+
+	name := dataType.Name
+	if dataType.Namespace != "" {
+		name = dataType.Namespace + "." + name
+	}
+
+	w.types[dataType.ID] = name
+
+	w.loadComposite(dataType.ID)
+}
+
+// columnTypes returns the type names of the action columns if type annotations are enabled.
+func (w *WAL) columnTypes(item ActionData) map[string]string {
+	if !w.annotateTypes {
+		return nil
+	}
+
+	types := make(map[string]string, len(item.NewColumns))
+
+	for _, columns := range [][]Column{item.OldColumns, item.NewColumns} {
+		for _, col := range columns {
+			types[col.name] = w.typeName(col.valueType)
+		}
+	}
+
+	return types
+}
+
+// typeName resolves the type name by OID, unknown types are named by their OID.
+func (w *WAL) typeName(oid int) string {
+	if name, ok := builtinTypeNames[oid]; ok {
+		return name
+	}
+
+	if name, ok := w.types[int32(oid)]; ok {
+		return name
+	}
+
+	return strconv.Itoa(oid)
+}
+
 // inArray checks whether the value is in an array.
 func inArray(arr []string, value string) bool {
 	for _, v := range arr {
@@ -1,15 +1,22 @@
 package transaction
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
-
 	"github.com/magiconair/properties/assert"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
 )
 
 func TestWalTransaction_CreateActionData(t *testing.T) {
@@ -391,6 +398,24 @@ func TestColumn_AssertValue(t *testing.T) {
 				isKey:     false,
 			},
 		},
+		{
+			name: "numeric",
+			fields: fields{
+				name:      "amount",
+				valueType: NumericOID,
+				isKey:     false,
+			},
+			args: args{
+				src: []byte("12345678901234567.8901"),
+			},
+			want: &Column{
+				log:       logger,
+				name:      "amount",
+				value:     "12345678901234567.8901",
+				valueType: 1700,
+				isKey:     false,
+			},
+		},
 		{
 			name: "unknown",
 			fields: fields{
@@ -426,3 +451,1059 @@ func TestColumn_AssertValue(t *testing.T) {
 		})
 	}
 }
+
+func TestColumn_AssertValue_ArrayComposite(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	const (
+		addressOID = 16390
+		personOID  = 16391
+	)
+
+	composites := map[int][]CompositeField{
+		addressOID: {{Name: "city", TypeID: TextOID}, {Name: "zip", TypeID: Int4OID}},
+		personOID: {
+			{Name: "name", TypeID: TextOID},
+			{Name: "tags", TypeID: 1009},
+			{Name: "address", TypeID: addressOID},
+			{Name: "note", TypeID: TextOID},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		valueType int
+		src       string
+		want      any
+	}{
+		{
+			name:      "int array",
+			valueType: 1007,
+			src:       "{1,-2,NULL,3}",
+			want:      []any{1, -2, nil, 3},
+		},
+		{
+			name:      "empty array",
+			valueType: 1007,
+			src:       "{}",
+			want:      []any{},
+		},
+		{
+			name:      "array with bounds",
+			valueType: 1016,
+			src:       "[0:1]={7,8}",
+			want:      []any{int64(7), int64(8)},
+		},
+		{
+			name:      "text array with commas and quotes",
+			valueType: 1009,
+			src:       `{plain,"a,b","say \"hi\"","back\\slash","NULL",NULL,""," x "}`,
+			want:      []any{"plain", "a,b", `say "hi"`, `back\slash`, "NULL", nil, "", " x "},
+		},
+		{
+			name:      "two-dimensional array",
+			valueType: 1007,
+			src:       "{{1,2},{3,4}}",
+			want:      []any{[]any{1, 2}, []any{3, 4}},
+		},
+		{
+			name:      "nested composite",
+			valueType: personOID,
+			src:       `("John ""JD"" Doe","{admin,""a b""}","(""New York"",10001)",)`,
+			want: map[string]any{
+				"name":    `John "JD" Doe`,
+				"tags":    []any{"admin", "a b"},
+				"address": map[string]any{"city": "New York", "zip": 10001},
+				"note":    nil,
+			},
+		},
+		{
+			name:      "composite with empty string",
+			valueType: addressOID,
+			src:       `("",)`,
+			want:      map[string]any{"city": "", "zip": nil},
+		},
+		{
+			name:      "malformed array",
+			valueType: 1007,
+			src:       "{1,2",
+			want:      "{1,2",
+		},
+		{
+			name:      "composite with extra attributes",
+			valueType: addressOID,
+			src:       "(Paris,75001,FR)",
+			want:      "(Paris,75001,FR)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Column{log: logger, name: "value", valueType: tt.valueType, composites: composites}
+
+			c.AssertValue([]byte(tt.src))
+
+			assert.Equal(t, c.value, tt.want)
+		})
+	}
+}
+
+type compositeLoaderMock struct {
+	relationLoaderMock
+	types map[int32][]CompositeField
+}
+
+func (l *compositeLoaderMock) CompositeFields(_ context.Context, typeID int32) ([]CompositeField, error) {
+	return l.types[typeID], nil
+}
+
+func TestWAL_SetType_Composite(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	loader := &compositeLoaderMock{types: map[int32][]CompositeField{
+		16390: {{Name: "city", TypeID: TextOID}, {Name: "zip", TypeID: Int4OID}},
+		16391: {{Name: "name", TypeID: TextOID}, {Name: "address", TypeID: 16390}},
+	}}
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{}, loader)
+
+	w.SetType(DataType{ID: 16385, Namespace: "public", Name: "mood"})
+	w.SetType(DataType{ID: 16391, Namespace: "public", Name: "person"})
+	w.SetRelation(Relation{
+		ID:        1,
+		Namespace: "public",
+		Name:      "users",
+		Columns: []RelationColumn{
+			{Key: true, Name: "id", TypeID: Int4OID},
+			{Name: "person", TypeID: 16391},
+		},
+	})
+
+	assert.Equal(t, len(w.composites), 2, "the nested composite type is loaded too")
+
+	action, err := w.CreateActionData(
+		1,
+		nil,
+		[]TupleData{{Value: []byte("1")}, {Value: []byte(`(John,"(Paris,75001)")`)}},
+		ActionKindInsert,
+	)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	assert.Equal(t, action.NewColumns[1].value, map[string]any{
+		"name":    "John",
+		"address": map[string]any{"city": "Paris", "zip": 75001},
+	})
+}
+
+func newEventPool() *sync.Pool {
+	return &sync.Pool{
+		New: func() any {
+			return &publisher.Event{}
+		},
+	}
+}
+
+func collectEvents(ch <-chan *publisher.Event) []*publisher.Event {
+	var events []*publisher.Event
+
+	for e := range ch {
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func TestWAL_CreateEventsWithFilter_Truncate(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := &WAL{
+		log:        logger,
+		monitor:    new(monitorMock),
+		pool:       newEventPool(),
+		CommitTime: &now,
+		RelationStore: map[int32]RelationData{
+			1: {Schema: "public", Table: "users"},
+			2: {Schema: "public", Table: "orders"},
+		},
+	}
+
+	actions, err := w.CreateTruncateActionData([]int32{1, 2})
+	if err != nil {
+		t.Fatalf("CreateTruncateActionData() error = %v", err)
+	}
+
+	w.Actions = actions
+
+	filter := config.FilterStruct{
+		Tables: map[string][]string{
+			"users":  {"insert", "truncate"},
+			"orders": {"insert"},
+		},
+	}
+
+	events := collectEvents(w.CreateEventsWithFilter(context.Background(), filter))
+
+	if len(events) != 1 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 1", len(events))
+	}
+
+	assert.Equal(t, "public", events[0].Schema)
+	assert.Equal(t, "users", events[0].Table)
+	assert.Equal(t, "TRUNCATE", events[0].Action)
+	assert.Equal(t, map[string]any{}, events[0].Data)
+	assert.Equal(t, map[string]any{}, events[0].DataOld)
+}
+
+func TestWAL_CreateActionData_ColumnsMismatch(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	cached := map[int32]RelationData{
+		1: {
+			Schema:  "public",
+			Table:   "users",
+			Columns: []Column{InitColumn(logger, "id", nil, Int4OID, true)},
+		},
+	}
+
+	newRows := []TupleData{{Value: []byte("1")}, {Value: []byte("john")}}
+
+	t.Run("refreshed relation", func(t *testing.T) {
+		loader := &relationLoaderMock{relations: map[int32]Relation{
+			1: {
+				ID:        1,
+				Namespace: "public",
+				Name:      "users",
+				Columns: []RelationColumn{
+					{Key: true, Name: "id", TypeID: Int4OID},
+					{Name: "name", TypeID: TextOID},
+				},
+			},
+		}}
+
+		w := &WAL{
+			log:           logger,
+			monitor:       new(monitorMock),
+			RelationStore: map[int32]RelationData{1: cached[1]},
+			relations:     relationCache{loader: loader},
+		}
+
+		got, err := w.CreateActionData(1, nil, newRows, ActionKindInsert)
+		if err != nil {
+			t.Fatalf("CreateActionData() error = %v", err)
+		}
+
+		assert.Equal(t, loader.calls, 1)
+		assert.Equal(t, len(got.NewColumns), 2)
+		assert.Equal(t, got.NewColumns[1].name, "name")
+		assert.Equal(t, got.NewColumns[1].value, "john")
+		assert.Equal(t, len(w.RelationStore[1].Columns), 2)
+	})
+
+	t.Run("extra value dropped", func(t *testing.T) {
+		w := &WAL{
+			log:           logger,
+			monitor:       new(monitorMock),
+			RelationStore: map[int32]RelationData{1: cached[1]},
+		}
+
+		got, err := w.CreateActionData(1, nil, newRows, ActionKindInsert)
+		if err != nil {
+			t.Fatalf("CreateActionData() error = %v", err)
+		}
+
+		assert.Equal(t, len(got.NewColumns), 1)
+		assert.Equal(t, got.NewColumns[0].name, "id")
+		assert.Equal(t, got.NewColumns[0].value, 1)
+	})
+}
+
+func TestWAL_CreateEventsWithFilter_TypeAnnotations(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{AnnotateTypes: true}, nil)
+	w.CommitTime = &now
+
+	w.SetType(DataType{ID: 16385, Namespace: "public", Name: "mood"})
+	w.SetRelation(Relation{
+		ID:        1,
+		Namespace: "public",
+		Name:      "users",
+		Columns: []RelationColumn{
+			{Key: true, Name: "id", TypeID: Int4OID},
+			{Name: "email", TypeID: VarcharOID},
+			{Name: "mood", TypeID: 16385},
+			{Name: "tags", TypeID: 1009},
+		},
+	})
+
+	action, err := w.CreateActionData(
+		1,
+		nil,
+		[]TupleData{{Value: []byte("1")}, {Value: []byte("john@doe.com")}, {Value: []byte("happy")}, {}},
+		ActionKindInsert,
+	)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	w.Actions = []ActionData{action}
+
+	events := collectEvents(w.CreateEventsWithFilter(
+		context.Background(),
+		config.FilterStruct{Tables: map[string][]string{"users": {"insert"}}},
+	))
+
+	if len(events) != 1 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 1", len(events))
+	}
+
+	assert.Equal(t, map[string]string{
+		"id":    "int4",
+		"email": "varchar",
+		"mood":  "public.mood",
+		"tags":  "_text",
+	}, events[0].Types)
+}
+
+func TestWAL_CreateEventsWithFilter_ByteDelta(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert", "update"}}}
+
+	newWAL := func(enabled bool, actions ...ActionData) *WAL {
+		w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{ByteDelta: enabled}, nil)
+		w.CommitTime = &now
+		w.Actions = actions
+
+		return w
+	}
+
+	update := ActionData{
+		Schema:     "public",
+		Table:      "users",
+		Kind:       ActionKindUpdate,
+		OldColumns: []Column{{name: "id", value: 1}, {name: "bio", value: "short"}},
+		NewColumns: []Column{{name: "id", value: 1}, {name: "bio", value: "much longer biography"}},
+	}
+	insert := ActionData{
+		Schema:     "public",
+		Table:      "users",
+		Kind:       ActionKindInsert,
+		NewColumns: []Column{{name: "id", value: 2}},
+	}
+
+	events := collectEvents(newWAL(true, update, insert).CreateEventsWithFilter(context.Background(), filter))
+	if len(events) != 2 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 2", len(events))
+	}
+
+	if events[0].ByteDelta == nil {
+		t.Fatal("byte delta of the update is missing")
+	}
+
+	assert.Equal(t, *events[0].ByteDelta, len("much longer biography")-len("short"))
+	assert.Equal(t, events[1].ByteDelta == nil, true)
+
+	events = collectEvents(newWAL(false, update).CreateEventsWithFilter(context.Background(), filter))
+	assert.Equal(t, events[0].ByteDelta == nil, true)
+
+	// the rows are only marshalled for the events passing the filters: the filtered out update would fail.
+	var logs strings.Builder
+
+	logger = slog.New(slog.NewTextHandler(&logs, nil))
+	skipped := ActionData{
+		Schema:     "public",
+		Table:      "audit",
+		Kind:       ActionKindUpdate,
+		OldColumns: []Column{{name: "id", value: 1}},
+		NewColumns: []Column{{name: "id", value: 1}, {name: "payload", value: make(chan int)}},
+	}
+
+	events = collectEvents(newWAL(true, skipped, update).CreateEventsWithFilter(context.Background(), filter))
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, strings.Contains(logs.String(), "byte delta"), false)
+}
+
+func TestWAL_CreateEventsWithFilter_SoftDelete(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert", "update"}}}
+
+	newWAL := func(mode config.SoftDeleteMode, actions ...ActionData) *WAL {
+		cfg := &config.ListenerCfg{SoftDelete: map[string]config.SoftDeleteCfg{
+			"users": {Column: "deleted_at", Mode: mode},
+		}}
+
+		w := NewWAL(logger, newEventPool(), new(monitorMock), cfg, nil)
+		w.CommitTime = &now
+		w.Actions = actions
+
+		return w
+	}
+
+	update := func(oldDeletedAt, deletedAt any) ActionData {
+		return ActionData{
+			Schema:     "public",
+			Table:      "users",
+			Kind:       ActionKindUpdate,
+			OldColumns: []Column{{name: "id", value: 1}, {name: "deleted_at", value: oldDeletedAt}},
+			NewColumns: []Column{{name: "id", value: 1}, {name: "deleted_at", value: deletedAt}},
+		}
+	}
+	insert := ActionData{
+		Schema:     "public",
+		Table:      "users",
+		Kind:       ActionKindInsert,
+		NewColumns: []Column{{name: "id", value: 2}, {name: "deleted_at", value: now}},
+	}
+
+	events := collectEvents(newWAL("", update(nil, now), update(now, now), update(nil, nil), insert).
+		CreateEventsWithFilter(context.Background(), filter))
+	if len(events) != 4 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 4", len(events))
+	}
+
+	for i, want := range []bool{true, true, false} {
+		if events[i].Deleted == nil {
+			t.Fatalf("soft delete flag of update %d is missing", i)
+		}
+
+		assert.Equal(t, *events[i].Deleted, want)
+		assert.Equal(t, events[i].Action, "UPDATE")
+	}
+
+	assert.Equal(t, events[3].Deleted == nil, true)
+
+	events = collectEvents(newWAL(config.SoftDeleteTransition, update(nil, now), update(now, now)).
+		CreateEventsWithFilter(context.Background(), filter))
+	assert.Equal(t, *events[0].Deleted, true)
+	assert.Equal(t, *events[1].Deleted, false)
+}
+
+func TestWAL_CreateEventsWithFilter_OldColumns(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	oldRow := []Column{
+		{name: "id", value: 1, isKey: true},
+		{name: "email", value: "john@doe.com"},
+	}
+	cfg := &config.ListenerCfg{
+		OldColumns: map[string]config.OldColumnsMode{
+			"update": config.OldColumnsKeys,
+			"delete": config.OldColumnsFull,
+		},
+	}
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), cfg, nil)
+	w.CommitTime = &now
+	w.Actions = []ActionData{
+		{
+			Schema:     "public",
+			Table:      "users",
+			Kind:       ActionKindUpdate,
+			OldColumns: oldRow,
+			NewColumns: []Column{{name: "id", value: 1, isKey: true}, {name: "email", value: "bob@doe.com"}},
+		},
+		{
+			Schema:     "public",
+			Table:      "users",
+			Kind:       ActionKindDelete,
+			OldColumns: oldRow,
+		},
+	}
+
+	events := collectEvents(w.CreateEventsWithFilter(
+		context.Background(),
+		config.FilterStruct{Tables: map[string][]string{"users": {"update", "delete"}}},
+	))
+
+	if len(events) != 2 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 2", len(events))
+	}
+
+	assert.Equal(t, events[0].DataOld, map[string]any{"id": 1})
+	assert.Equal(t, events[1].DataOld, map[string]any{"id": 1, "email": "john@doe.com"})
+}
+
+// newWideWAL returns a WAL with a cached relation of the given number of text columns and a matching tuple.
+func newWideWAL(columns int, projection config.ProjectionCfg) (*WAL, []TupleData) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{Projection: projection}, nil)
+
+	rel := RelationData{Schema: "public", Table: "wide"}
+	rows := make([]TupleData, 0, columns)
+
+	for i := 0; i < columns; i++ {
+		rel.Columns = append(rel.Columns, InitColumn(logger, fmt.Sprintf("col_%d", i), nil, TextOID, i == 0))
+		rows = append(rows, TupleData{Value: []byte("value")})
+	}
+
+	now := time.Now()
+	w.CommitTime = &now
+	w.RelationStore[1] = rel
+
+	return w, rows
+}
+
+func TestWAL_CreateActionData_Projection(t *testing.T) {
+	projection := config.ProjectionCfg{Columns: map[string][]string{"wide": {"col_0", "col_7"}}}
+
+	w, rows := newWideWAL(300, projection)
+
+	action, err := w.CreateActionData(1, nil, rows, ActionKindInsert)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	assert.Equal(t, len(action.NewColumns), 2)
+	assert.Equal(t, action.NewColumns[0].name, "col_0")
+	assert.Equal(t, action.NewColumns[1].name, "col_7")
+
+	allocs := func(projection config.ProjectionCfg) float64 {
+		w, rows := newWideWAL(300, projection)
+
+		return testing.AllocsPerRun(100, func() {
+			w.Actions = w.Actions[:0]
+			action, _ := w.CreateActionData(1, nil, rows, ActionKindInsert)
+			w.Actions = append(w.Actions, action)
+
+			for event := range w.CreateEventsWithFilter(context.Background(), config.FilterStruct{
+				Tables: map[string][]string{"wide": {"insert"}},
+			}) {
+				w.RetrieveEvent(event)
+			}
+		})
+	}
+
+	full, projected := allocs(config.ProjectionCfg{}), allocs(projection)
+	if projected*10 > full {
+		t.Errorf("projection allocations = %v, want less than a tenth of %v", projected, full)
+	}
+}
+
+func BenchmarkWAL_CreateActionData(b *testing.B) {
+	benchmarks := []struct {
+		name       string
+		projection config.ProjectionCfg
+	}{
+		{name: "full row"},
+		{name: "projection", projection: config.ProjectionCfg{Columns: map[string][]string{"wide": {"col_0", "col_7"}}}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			w, rows := newWideWAL(300, bm.projection)
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := w.CreateActionData(1, nil, rows, ActionKindInsert); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newDecodeWAL creates the WAL decoding on commit with the given workers and the rows of the wide inserts.
+func newDecodeWAL(workers, actions int) (*WAL, [][]TupleData) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{DecodeWorkers: workers}, nil)
+
+	rel := RelationData{Schema: "public", Table: "orders"}
+	rel.Columns = append(rel.Columns, InitColumn(logger, "id", nil, Int4OID, true))
+
+	for i := 0; i < 20; i++ {
+		rel.Columns = append(rel.Columns, InitColumn(logger, fmt.Sprintf("doc_%d", i), nil, JSONBOID, false))
+	}
+
+	now := time.Now()
+	w.CommitTime = &now
+	w.RelationStore[1] = rel
+
+	txRows := make([][]TupleData, 0, actions)
+
+	for i := 0; i < actions; i++ {
+		rows := []TupleData{{Value: []byte(strconv.Itoa(i))}}
+
+		for j := 1; j < len(rel.Columns); j++ {
+			rows = append(rows, TupleData{Value: []byte(fmt.Sprintf(`{"order":%d,"items":[1,2,3],"note":"n"}`, i))})
+		}
+
+		txRows = append(txRows, rows)
+	}
+
+	return w, txRows
+}
+
+// decodeTx parses the inserts of the transaction and returns its events.
+func decodeTx(tb testing.TB, w *WAL, txRows [][]TupleData) <-chan *publisher.Event {
+	w.Actions = w.Actions[:0]
+
+	for _, rows := range txRows {
+		action, err := w.CreateActionData(1, nil, rows, ActionKindInsert)
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		w.Actions = append(w.Actions, action)
+	}
+
+	return w.CreateEventsWithFilter(context.Background(), config.FilterStruct{
+		Tables: map[string][]string{"orders": {"insert"}},
+	})
+}
+
+func TestWAL_CreateEventsWithFilter_DecodeWorkers(t *testing.T) {
+	w, txRows := newDecodeWAL(0, 100)
+	sequential := collectEvents(decodeTx(t, w, txRows))
+
+	w, txRows = newDecodeWAL(4, 100)
+	parallel := collectEvents(decodeTx(t, w, txRows))
+
+	assert.Equal(t, len(parallel), 100)
+
+	for i, event := range parallel {
+		assert.Equal(t, event.Data["id"], i)
+		assert.Equal(t, event.Data, sequential[i].Data)
+	}
+}
+
+func BenchmarkWAL_DecodeWorkers(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers %d", workers), func(b *testing.B) {
+			w, txRows := newDecodeWAL(workers, 200)
+
+			for i := 0; i < b.N; i++ {
+				for event := range decodeTx(b, w, txRows) {
+					w.RetrieveEvent(event)
+				}
+			}
+		})
+	}
+}
+
+func TestWAL_RetrieveEvent(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+	delta := 10
+
+	w := &WAL{log: logger, monitor: new(monitorMock), pool: newEventPool(), CommitTime: &now}
+
+	event := w.getPoolEvent()
+	event.ID = uuid.New()
+	event.Schema = "public"
+	event.Table = "users"
+	event.Action = "UPDATE"
+	event.Data = map[string]any{"id": 1, "email": "john@doe.com"}
+	event.DataOld = map[string]any{"id": 1, "email": "old@doe.com"}
+	event.EventTime = now
+	event.Types = map[string]string{"id": "int4"}
+	event.ByteDelta = &delta
+	event.Source = &publisher.EventSource{Version: "v1"}
+	event.DedupKey = "1"
+	event.Enrichment = map[string]any{"name": "John"}
+	event.Key = "1"
+
+	data := event.Data
+
+	w.RetrieveEvent(event)
+
+	assert.Equal(t, *event, publisher.Event{})
+	// the previous user may still hold the map, so it's dropped and not cleared.
+	assert.Equal(t, len(data), 2)
+
+	// the next transaction gets a clean event, whether reused or new.
+	w.Actions = []ActionData{{
+		Schema:     "public",
+		Table:      "orders",
+		Kind:       ActionKindInsert,
+		NewColumns: []Column{{name: "id", value: 2}},
+	}}
+
+	events := collectEvents(w.CreateEventsWithFilter(context.Background(), config.FilterStruct{
+		Tables: map[string][]string{"orders": {"insert"}},
+	}))
+
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Data, map[string]any{"id": 2})
+	assert.Equal(t, events[0].DedupKey, "")
+	assert.Equal(t, events[0].Enrichment == nil, true)
+	assert.Equal(t, events[0].Source == nil, true)
+	assert.Equal(t, events[0].Key, "")
+}
+
+func TestActionKind_Op(t *testing.T) {
+	tests := map[ActionKind]string{
+		ActionKindInsert:    "c",
+		ActionKindUpdate:    "u",
+		ActionKindDelete:    "d",
+		ActionKindTruncate:  "t",
+		ActionKind("MERGE"): "",
+	}
+
+	for kind, want := range tests {
+		assert.Equal(t, kind.Op(), want, string(kind))
+	}
+}
+
+func TestWAL_CreateEventsWithFilter_OpField(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{OpField: config.OpFieldAlongside}, nil)
+	w.CommitTime = &now
+	w.Actions = []ActionData{
+		{Schema: "public", Table: "users", Kind: ActionKindInsert},
+		{Schema: "public", Table: "users", Kind: ActionKindDelete},
+	}
+
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert", "delete"}}}
+	events := collectEvents(w.CreateEventsWithFilter(context.Background(), filter))
+
+	if len(events) != 2 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 2", len(events))
+	}
+
+	assert.Equal(t, events[0].Op, "c")
+	assert.Equal(t, events[0].Action, "INSERT")
+	assert.Equal(t, events[1].Op, "d")
+}
+
+func TestWAL_CreateEventsWithFilter_Changes(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert", "update"}}}
+
+	newWAL := func(enabled bool, actions ...ActionData) *WAL {
+		w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{Changes: enabled}, nil)
+		w.CommitTime = &now
+		w.Actions = actions
+
+		return w
+	}
+
+	update := ActionData{
+		Schema: "public",
+		Table:  "users",
+		Kind:   ActionKindUpdate,
+		OldColumns: []Column{
+			{name: "id", value: 1},
+			{name: "email", value: "old@example.com"},
+			{name: "bio", value: nil},
+			{name: "tags", value: []any{"a"}},
+		},
+		NewColumns: []Column{
+			{name: "id", value: 1},
+			{name: "email", value: "new@example.com"},
+			{name: "bio", value: "hello"},
+			{name: "tags", value: []any{"a"}},
+		},
+	}
+	insert := ActionData{
+		Schema:     "public",
+		Table:      "users",
+		Kind:       ActionKindInsert,
+		NewColumns: []Column{{name: "id", value: 2}},
+	}
+
+	events := collectEvents(newWAL(true, update, insert).CreateEventsWithFilter(context.Background(), filter))
+	if len(events) != 2 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 2", len(events))
+	}
+
+	assert.Equal(t, events[0].Changes, map[string]publisher.ColumnChange{
+		"email": {Old: "old@example.com", New: "new@example.com"},
+		"bio":   {Old: nil, New: "hello"},
+	})
+	assert.Equal(t, events[1].Changes == nil, true)
+
+	events = collectEvents(newWAL(false, update).CreateEventsWithFilter(context.Background(), filter))
+	assert.Equal(t, events[0].Changes == nil, true)
+}
+
+func TestWAL_CreateEventsWithFilter_UnchangedToast(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{}, nil)
+	w.CommitTime = &now
+	w.RelationStore[1] = RelationData{
+		Schema: "public",
+		Table:  "docs",
+		Columns: []Column{
+			InitColumn(logger, "id", nil, TextOID, true),
+			InitColumn(logger, "title", nil, TextOID, false),
+			InitColumn(logger, "body", nil, TextOID, false),
+		},
+	}
+
+	newRow := []TupleData{{Value: []byte("1")}, {Value: []byte("new")}, {Toast: true}}
+
+	// without REPLICA IDENTITY FULL there is no old row to take the value from.
+	keyOnly, err := w.CreateActionData(1, nil, newRow, ActionKindUpdate)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	full, err := w.CreateActionData(
+		1,
+		[]TupleData{{Value: []byte("1")}, {Value: []byte("old")}, {Value: []byte("large body")}},
+		newRow,
+		ActionKindUpdate,
+	)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	assert.Equal(t, keyOnly.NewColumns[2].toast, true, "the column is flagged as the TOAST placeholder")
+
+	w.Actions = []ActionData{keyOnly, full}
+
+	events := collectEvents(w.CreateEventsWithFilter(
+		context.Background(),
+		config.FilterStruct{Tables: map[string][]string{"docs": {"update"}}},
+	))
+	if len(events) != 2 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 2", len(events))
+	}
+
+	assert.Equal(t, events[0].Data, map[string]any{"id": "1", "title": "new"}, "not published as null")
+	assert.Equal(t, events[0].UnchangedToast, []string{"body"})
+
+	assert.Equal(t, events[1].Data, map[string]any{"id": "1", "title": "new", "body": "large body"})
+	assert.Equal(t, len(events[1].UnchangedToast), 0, "carried over from the old row")
+}
+
+func TestWAL_CreateEventsWithFilter_PrimaryKey(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{}, nil)
+	w.CommitTime = &now
+	w.RelationStore[1] = RelationData{
+		Schema: "public",
+		Table:  "members",
+		Columns: []Column{
+			InitColumn(logger, "tenant", nil, TextOID, true),
+			InitColumn(logger, "id", nil, TextOID, true),
+			InitColumn(logger, "name", nil, TextOID, false),
+		},
+	}
+
+	insert, err := w.CreateActionData(
+		1, nil, []TupleData{{Value: []byte("acme")}, {Value: []byte("7")}, {Value: []byte("john")}}, ActionKindInsert,
+	)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	// the old tuple of a delete only has the key columns.
+	del, err := w.CreateActionData(1, []TupleData{{Value: []byte("acme")}, {Value: []byte("7")}}, nil, ActionKindDelete)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	w.Actions = []ActionData{insert, del}
+
+	events := collectEvents(w.CreateEventsWithFilter(
+		context.Background(),
+		config.FilterStruct{Tables: map[string][]string{"members": {"insert", "delete"}}},
+	))
+	if len(events) != 2 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 2", len(events))
+	}
+
+	assert.Equal(t, events[0].PrimaryKey, map[string]any{"tenant": "acme", "id": "7"})
+	assert.Equal(t, events[1].PrimaryKey, map[string]any{"tenant": "acme", "id": "7"}, "taken from the old row")
+}
+
+func TestWAL_CreateEventsWithFilter_Nulls(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	newWAL := func(nulls config.NullsMode) *WAL {
+		w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{Nulls: nulls}, nil)
+		w.CommitTime = &now
+		w.RelationStore[1] = RelationData{
+			Schema: "public",
+			Table:  "users",
+			Columns: []Column{
+				InitColumn(logger, "id", nil, Int4OID, true),
+				InitColumn(logger, "email", nil, TextOID, false),
+				InitColumn(logger, "phone", nil, TextOID, false),
+			},
+		}
+
+		row := []TupleData{{Value: []byte("1")}, {Value: []byte("john@doe.com")}, {}}
+
+		for _, kind := range []ActionKind{ActionKindInsert, ActionKindUpdate, ActionKindDelete} {
+			var oldRow, newRow []TupleData
+
+			switch kind {
+			case ActionKindInsert:
+				newRow = row
+			case ActionKindUpdate:
+				oldRow, newRow = row, row
+			case ActionKindDelete:
+				oldRow = row
+			}
+
+			action, err := w.CreateActionData(1, oldRow, newRow, kind)
+			if err != nil {
+				t.Fatalf("CreateActionData() error = %v", err)
+			}
+
+			w.Actions = append(w.Actions, action)
+		}
+
+		return w
+	}
+
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert", "update", "delete"}}}
+
+	t.Run("keep", func(t *testing.T) {
+		events := collectEvents(newWAL("").CreateEventsWithFilter(context.Background(), filter))
+		if len(events) != 3 {
+			t.Fatalf("CreateEventsWithFilter() got %d events, want 3", len(events))
+		}
+
+		row := map[string]any{"id": 1, "email": "john@doe.com", "phone": nil}
+
+		assert.Equal(t, events[0].Data, row)
+		assert.Equal(t, events[1].Data, row)
+		assert.Equal(t, events[1].DataOld, row)
+		assert.Equal(t, events[2].DataOld, row)
+	})
+
+	t.Run("omit", func(t *testing.T) {
+		events := collectEvents(newWAL(config.NullsOmit).CreateEventsWithFilter(context.Background(), filter))
+		if len(events) != 3 {
+			t.Fatalf("CreateEventsWithFilter() got %d events, want 3", len(events))
+		}
+
+		row := map[string]any{"id": 1, "email": "john@doe.com"}
+
+		assert.Equal(t, events[0].Data, row)
+		assert.Equal(t, events[1].Data, row)
+		assert.Equal(t, events[1].DataOld, row)
+		assert.Equal(t, events[2].DataOld, row)
+	})
+}
+
+func TestWAL_CreateEventsWithFilter_OrderedColumns(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{OrderedColumns: true}, nil)
+	w.CommitTime = &now
+	w.RelationStore[1] = RelationData{
+		Schema: "public",
+		Table:  "members",
+		Columns: []Column{
+			InitColumn(logger, "name", nil, TextOID, false),
+			InitColumn(logger, "id", nil, TextOID, true),
+		},
+	}
+
+	insert, err := w.CreateActionData(1, nil, []TupleData{{Value: []byte("john")}, {Value: []byte("7")}}, ActionKindInsert)
+	if err != nil {
+		t.Fatalf("CreateActionData() error = %v", err)
+	}
+
+	w.Actions = []ActionData{insert}
+
+	events := collectEvents(w.CreateEventsWithFilter(
+		context.Background(),
+		config.FilterStruct{Tables: map[string][]string{"members": {"insert"}}},
+	))
+	if len(events) != 1 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 1", len(events))
+	}
+
+	assert.Equal(t, events[0].ColumnOrder, []string{"name", "id"})
+}
+
+func TestWAL_CreateEventsWithFilter_TransactionID(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{}, nil)
+	w.CommitTime = &now
+	w.XID = 3_000_000_000 - 1<<32 // read as int32 from the protocol
+	w.LSN = 0x16B374D848
+	w.Actions = []ActionData{
+		{Schema: "public", Table: "users", Kind: ActionKindInsert},
+		{Schema: "public", Table: "orders", Kind: ActionKindInsert},
+	}
+
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert"}, "orders": {"insert"}}}
+	events := collectEvents(w.CreateEventsWithFilter(context.Background(), filter))
+
+	if len(events) != 2 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 2", len(events))
+	}
+
+	for _, event := range events {
+		assert.Equal(t, event.TransactionID, uint32(3_000_000_000))
+		assert.Equal(t, event.LSN, uint64(0x16B374D848))
+	}
+}
+
+func TestWAL_CreateEventsWithFilter_OnlyChangedColumns(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Now()
+	filter := config.FilterStruct{Tables: map[string][]string{"users": {"insert", "update"}}}
+
+	newRow := []Column{
+		{name: "id", value: 1, isKey: true},
+		{name: "email", value: "new@example.com"},
+		{name: "name", value: "John"},
+	}
+	actions := []ActionData{
+		{
+			Schema: "public",
+			Table:  "users",
+			Kind:   ActionKindUpdate,
+			OldColumns: []Column{
+				{name: "id", value: 1, isKey: true},
+				{name: "email", value: "old@example.com"},
+				{name: "name", value: "John"},
+			},
+			NewColumns: newRow,
+		},
+		{
+			// without REPLICA IDENTITY FULL the old row has the key columns only.
+			Schema:     "public",
+			Table:      "users",
+			Kind:       ActionKindUpdate,
+			OldColumns: []Column{{name: "id", value: 1, isKey: true}},
+			NewColumns: newRow,
+		},
+		{
+			Schema:     "public",
+			Table:      "users",
+			Kind:       ActionKindInsert,
+			NewColumns: newRow,
+		},
+	}
+
+	w := NewWAL(logger, newEventPool(), new(monitorMock), &config.ListenerCfg{OnlyChangedColumns: true}, nil)
+	w.CommitTime = &now
+	w.Actions = actions
+
+	events := collectEvents(w.CreateEventsWithFilter(context.Background(), filter))
+	if len(events) != 3 {
+		t.Fatalf("CreateEventsWithFilter() got %d events, want 3", len(events))
+	}
+
+	full := map[string]any{"id": 1, "email": "new@example.com", "name": "John"}
+
+	assert.Equal(t, events[0].Data, map[string]any{"id": 1, "email": "new@example.com"})
+	assert.Equal(t, events[1].Data, full, "the columns missing from the old row are kept")
+	assert.Equal(t, events[2].Data, full, "inserts are complete")
+}
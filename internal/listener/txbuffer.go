@@ -0,0 +1,46 @@
+package listener
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+)
+
+// checkTxBuffer reports the streamed transactions buffered longer than the limit without commit,
+// and publishes their buffered changes early if configured.
+func (l *Listener) checkTxBuffer(ctx context.Context, txWAL *tx.WAL, now time.Time) error {
+	cfg := l.cfg.Listener.TxBuffer
+	if cfg.MaxTime <= 0 {
+		return nil
+	}
+
+	for _, s := range txWAL.LongStreams(now, cfg.MaxTime) {
+		l.monitor.IncLongTransactions()
+		l.log.Warn(
+			"transaction is buffered longer than the limit without commit",
+			slog.Any("xid", s.XID),
+			slog.Duration("age", s.Age),
+			slog.Int("actions", s.Actions),
+		)
+	}
+
+	if !cfg.EarlyEmit {
+		return nil
+	}
+
+	for _, xid := range txWAL.ReportedStreams() {
+		if !txWAL.EmitStream(xid, now) {
+			continue
+		}
+
+		if err := l.publishEvents(ctx, txWAL); err != nil {
+			return err
+		}
+
+		txWAL.Clear()
+	}
+
+	return nil
+}
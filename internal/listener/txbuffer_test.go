@@ -0,0 +1,46 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+func TestListener_checkTxBuffer(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	monitor := new(monitorMock)
+
+	l := &Listener{
+		cfg: &config.Config{Listener: &config.ListenerCfg{
+			TxBuffer: config.TxBufferCfg{MaxTime: time.Minute},
+		}},
+		log:     logger,
+		monitor: monitor,
+	}
+
+	pool := &sync.Pool{New: func() any { return &publisher.Event{} }}
+	txWAL := tx.NewWAL(logger, pool, monitor, l.cfg.Listener, nil)
+	txWAL.StartStream(100)
+	txWAL.StopStream()
+
+	now := time.Now()
+
+	require.NoError(t, l.checkTxBuffer(context.Background(), txWAL, now.Add(30*time.Second)))
+	assert.Equal(t, 0, monitor.longTransactions, "within the limit")
+
+	require.NoError(t, l.checkTxBuffer(context.Background(), txWAL, now.Add(2*time.Minute)))
+	assert.Equal(t, 1, monitor.longTransactions, "past the limit")
+
+	require.NoError(t, l.checkTxBuffer(context.Background(), txWAL, now.Add(3*time.Minute)))
+	assert.Equal(t, 1, monitor.longTransactions, "reported once")
+}
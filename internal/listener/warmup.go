@@ -0,0 +1,83 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+)
+
+const warmUpProbeTimeout = 10 * time.Second
+
+// prober is implemented by publishers that can check the broker without publishing.
+type prober interface {
+	Probe(ctx context.Context) error
+}
+
+// warmUp probes the publisher and preloads the relations (and the column classification) of the tables,
+// so the first events don't wait for them. The event pool is not primed: a sync.Pool is emptied by the GC.
+func (l *Listener) warmUp(ctx context.Context, txWAL *tx.WAL) error {
+	started := time.Now()
+
+	if p, ok := l.publisher.(prober); ok {
+		probeCtx, cancel := context.WithTimeout(ctx, warmUpProbeTimeout)
+		err := p.Probe(probeCtx)
+
+		cancel()
+
+		if err != nil {
+			return fmt.Errorf("probe publisher: %w", err)
+		}
+	}
+
+	tables := l.warmUpTables()
+
+	for _, table := range tables {
+		relationID, err := l.repository.RelationID(ctx, table)
+		if err != nil {
+			return fmt.Errorf("relation id %s: %w", table, err)
+		}
+
+		rel, err := l.repository.LoadRelation(ctx, relationID)
+		if err != nil {
+			return fmt.Errorf("load relation %s: %w", table, err)
+		}
+
+		txWAL.SetRelation(rel)
+
+		if err := l.classifier.load(ctx, rel.Namespace, rel.Name); err != nil {
+			return fmt.Errorf("classify %s: %w", table, err)
+		}
+	}
+
+	l.log.Info(
+		"pipeline was warmed up",
+		slog.Int("relations", len(tables)),
+		slog.Duration("duration", time.Since(started)),
+	)
+
+	return nil
+}
+
+// warmUpTables returns the configured tables, or the tables of the filter except the patterns.
+func (l *Listener) warmUpTables() []string {
+	if tables := l.cfg.Listener.WarmUp.Tables; len(tables) > 0 {
+		return tables
+	}
+
+	var tables []string
+
+	for table := range l.cfg.Listener.Filter.Tables {
+		if _, ok := config.TablePattern(table); !ok {
+			tables = append(tables, table)
+		}
+	}
+
+	sort.Strings(tables)
+
+	return tables
+}
@@ -0,0 +1,77 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+)
+
+type probingPublisherMock struct {
+	publisherMock
+}
+
+func (p *probingPublisherMock) Probe(ctx context.Context) error {
+	return p.Called(ctx).Error(0)
+}
+
+func TestListener_warmUp(t *testing.T) {
+	users := tx.Relation{
+		ID:        16384,
+		Namespace: "public",
+		Name:      "users",
+		Columns:   []tx.RelationColumn{{Key: true, Name: "id", TypeID: 23}},
+	}
+
+	newListener := func(pub eventPublisher, repo *repositoryMock, monitor *monitorMock) *Listener {
+		cfg := &config.Config{
+			Listener: &config.ListenerCfg{
+				Filter: config.FilterStruct{Tables: map[string][]string{"users": {"insert"}, "~events_.*": {"insert"}}},
+				WarmUp: config.WarmUpCfg{Enabled: true},
+			},
+		}
+
+		return NewWalListener(cfg, slog.New(slog.NewJSONHandler(io.Discard, nil)), repo, nil, pub, nil, monitor, nil, nil, nil, nil)
+	}
+
+	t.Run("ready before the first event", func(t *testing.T) {
+		pub := new(probingPublisherMock)
+		pub.On("Probe", mock.Anything).Return(nil).Once()
+
+		repo := new(repositoryMock)
+		repo.On("RelationID", mock.Anything, "users").Return(users.ID, nil).Once()
+		repo.On("LoadRelation", mock.Anything, users.ID).Return(users, nil).Once()
+
+		monitor := new(monitorMock)
+		l := newListener(pub, repo, monitor)
+		txWAL := tx.NewWAL(l.log, l.newEventPool(), monitor, l.cfg.Listener, repo)
+
+		require.NoError(t, l.warmUp(context.Background(), txWAL))
+
+		pub.AssertExpectations(t)
+		repo.AssertExpectations(t)
+		assert.Equal(t, "users", txWAL.RelationStore[users.ID].Table)
+
+		// the relation message of the first event doesn't reload anything.
+		txWAL.SetRelation(users)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("publisher not ready", func(t *testing.T) {
+		pub := new(probingPublisherMock)
+		pub.On("Probe", mock.Anything).Return(errors.New("no brokers")).Once()
+
+		monitor := new(monitorMock)
+		l := newListener(pub, new(repositoryMock), monitor)
+		err := l.warmUp(context.Background(), tx.NewWAL(l.log, l.newEventPool(), monitor, l.cfg.Listener, nil))
+		require.ErrorContains(t, err, "no brokers")
+	})
+}
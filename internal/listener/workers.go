@@ -0,0 +1,132 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"golang.org/x/sync/errgroup"
+
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// workerQueueSize is the number of events prepared ahead for each publish worker.
+const workerQueueSize = 64
+
+// publishParallel publishes the events by the workers. The events are prepared in order and sharded by the row key,
+// so the events of a row (or of a table without key) are published by the same worker in order.
+// The first failure stops the workers, the queued events are returned to the pool and the transaction
+// is not acknowledged.
+func (l *Listener) publishParallel(
+	ctx context.Context,
+	txWAL *tx.WAL,
+	jobs <-chan publishJob,
+	workers int,
+) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+	queues := make([]chan publishJob, workers)
+
+	for i := range queues {
+		queue := make(chan publishJob, workerQueueSize)
+		queues[i] = queue
+
+		group.Go(func() error {
+			return l.publishWorker(groupCtx, txWAL, queue)
+		})
+	}
+
+	err := dispatchJobs(groupCtx, txWAL, jobs, queues)
+
+	for _, queue := range queues {
+		close(queue)
+	}
+
+	groupErr := group.Wait()
+
+	for _, queue := range queues {
+		drainJobs(txWAL, queue)
+	}
+
+	if groupErr != nil {
+		return groupErr
+	}
+
+	return err
+}
+
+// dispatchJobs queues the prepared events to the worker of their row.
+func dispatchJobs(ctx context.Context, txWAL *tx.WAL, jobs <-chan publishJob, queues []chan publishJob) error {
+	for job := range jobs {
+		select {
+		case queues[job.worker] <- job:
+		case <-ctx.Done():
+			txWAL.RetrieveEvent(job.event)
+			return context.Cause(ctx)
+		}
+	}
+
+	return nil
+}
+
+// publishWorker publishes the queued events until the queue is closed, a publish fails or another worker failed.
+// The events left in the queue are drained by publishParallel.
+func (l *Listener) publishWorker(ctx context.Context, txWAL *tx.WAL, queue <-chan publishJob) error {
+	for job := range queue {
+		if ctx.Err() != nil {
+			txWAL.RetrieveEvent(job.event)
+			return context.Cause(ctx)
+		}
+
+		for _, msg := range job.messages {
+			if err := l.publishMessage(ctx, msg); err != nil {
+				txWAL.RetrieveEvent(job.event)
+				l.monitor.IncProblematicEvents(problemKindPublish)
+
+				return fmt.Errorf("publish: %w", err)
+			}
+		}
+
+		txWAL.RetrieveEvent(job.event)
+	}
+
+	return nil
+}
+
+// rowShards returns the publish worker of the rows of a transaction.
+type rowShards struct {
+	workers int
+	moved   map[string]int // row of the new key -> worker of the old key, after an update of the key
+}
+
+func newRowShards(workers int) *rowShards {
+	return &rowShards{workers: workers, moved: make(map[string]int)}
+}
+
+// worker returns the worker of the event: by the table and the row key, by the table if it has no key.
+// An update of the key is published by the worker of the old key, after the earlier events of the row,
+// and so are the later events of the new key in the transaction.
+func (s *rowShards) worker(event *publisher.Event) int {
+	table := event.Schema + "." + event.Table + "\x00"
+	key := event.RowKey()
+
+	if old := event.OldRowKey(); old != "" && old != key {
+		worker := s.rowWorker(table + old)
+		s.moved[table+key] = worker
+
+		return worker
+	}
+
+	return s.rowWorker(table + key)
+}
+
+func (s *rowShards) rowWorker(row string) int {
+	if worker, ok := s.moved[row]; ok {
+		return worker
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(row))
+
+	return int(h.Sum32() % uint32(s.workers))
+}
@@ -0,0 +1,141 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+	tx "github.com/ihippik/wal-listener/v2/internal/listener/transaction"
+	"github.com/ihippik/wal-listener/v2/internal/publisher"
+)
+
+// recordingPublisher records the published sequence numbers per row, it fails the configured one.
+type recordingPublisher struct {
+	mu     sync.Mutex
+	rows   map[any][]any // id -> n
+	failOn any
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, _ string, event *publisher.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if event.Data["n"] == p.failOn {
+		return publisher.Permanent(errors.New("broker is down"))
+	}
+
+	if p.rows == nil {
+		p.rows = make(map[any][]any)
+	}
+
+	p.rows[event.Data["id"]] = append(p.rows[event.Data["id"]], event.Data["n"])
+
+	return nil
+}
+
+func TestListener_publishParallel(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	newWAL := func(monitor *monitorMock, events int) *tx.WAL {
+		pool := &sync.Pool{New: func() any { return &publisher.Event{} }}
+		txWAL := tx.NewWAL(logger, pool, monitor, &config.ListenerCfg{}, nil)
+		now := time.Now()
+		txWAL.CommitTime = &now
+
+		for i := range events {
+			txWAL.Actions = append(txWAL.Actions, tx.ActionData{
+				Schema: "public",
+				Table:  "users",
+				Kind:   tx.ActionKindUpdate,
+				NewColumns: []tx.Column{
+					tx.InitColumn(logger, "id", i%5, 23, true),
+					tx.InitColumn(logger, "n", i, 23, false),
+				},
+			})
+		}
+
+		return txWAL
+	}
+
+	newListener := func(pub eventPublisher, monitor *monitorMock) *Listener {
+		return &Listener{
+			cfg: &config.Config{
+				Listener: &config.ListenerCfg{
+					Filter: config.FilterStruct{Tables: map[string][]string{"users": {"update"}}},
+				},
+				Publisher: &config.PublisherCfg{Topic: "wal", Workers: 4},
+			},
+			log:       logger,
+			monitor:   monitor,
+			publisher: pub,
+		}
+	}
+
+	t.Run("rows keep their order", func(t *testing.T) {
+		monitor := new(monitorMock)
+		pub := new(recordingPublisher)
+
+		require.NoError(t, newListener(pub, monitor).publishEvents(context.Background(), newWAL(monitor, 200)))
+		require.Len(t, pub.rows, 5)
+
+		for id, seq := range pub.rows {
+			require.Len(t, seq, 40)
+
+			for i, n := range seq {
+				assert.Equal(t, i*5+id.(int), n, "row %v", id)
+			}
+		}
+
+		assert.Equal(t, map[string]int{"get": 200, "put": 200}, monitor.eventPool)
+	})
+
+	t.Run("failure stops the workers", func(t *testing.T) {
+		monitor := new(monitorMock)
+		pub := &recordingPublisher{failOn: 42}
+
+		err := newListener(pub, monitor).publishEvents(context.Background(), newWAL(monitor, 200))
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "broker is down")
+		assert.NotContains(t, pub.rows[42%5], 47, "the row stops at the failed event")
+		assert.Equal(t, monitor.eventPool["get"], monitor.eventPool["put"], "the queued events are returned to the pool")
+	})
+}
+
+func TestRowShards(t *testing.T) {
+	newEvent := func(data, dataOld map[string]any) *publisher.Event {
+		return &publisher.Event{
+			Schema:     "public",
+			Table:      "users",
+			KeyColumns: []string{"id"},
+			Data:       data,
+			DataOld:    dataOld,
+		}
+	}
+
+	// the new key of the row is sharded to another worker than the old one.
+	newKey := 2
+	for newRowShards(4).worker(newEvent(map[string]any{"id": newKey}, nil)) ==
+		newRowShards(4).worker(newEvent(map[string]any{"id": 1}, nil)) {
+		newKey++
+	}
+
+	shards := newRowShards(4)
+
+	insert := shards.worker(newEvent(map[string]any{"id": 1}, nil))
+	assert.Equal(t, insert, shards.worker(newEvent(map[string]any{"id": newKey}, map[string]any{"id": 1})),
+		"the key update is published by the worker of the old key")
+	assert.Equal(t, insert, shards.worker(newEvent(map[string]any{"id": newKey}, nil)),
+		"the later update of the new key follows the key update")
+	assert.Equal(t, insert, shards.worker(newEvent(nil, map[string]any{"id": newKey})), "delete")
+
+	assert.NotEqual(t, insert, newRowShards(4).worker(newEvent(map[string]any{"id": newKey}, nil)),
+		"the moves are kept for the transaction")
+}
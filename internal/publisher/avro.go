@@ -0,0 +1,363 @@
+package publisher
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+)
+
+// Confluent wire format: the magic byte and the big-endian schema ID precede the Avro payload.
+const (
+	avroMagicByte       = 0
+	avroContentType     = "application/vnd.confluent.avro"
+	avroValueSubjectSfx = "-value"
+)
+
+// avro types of the columns, derived from the Postgres type names.
+const (
+	avroBoolean   = "boolean"
+	avroInt       = "int"
+	avroLong      = "long"
+	avroString    = "string"
+	avroTimestamp = "timestamp-micros"
+	avroUUID      = "uuid"
+)
+
+// avroTypes maps the Postgres types decoded to non-string values, other columns are strings.
+var avroTypes = map[string]string{
+	"bool":        avroBoolean,
+	"int2":        avroInt,
+	"int4":        avroInt,
+	"int8":        avroLong,
+	"timestamp":   avroTimestamp,
+	"timestamptz": avroTimestamp,
+	"uuid":        avroUUID,
+}
+
+// errSchemaRegistry marks the failed schema lookups; unlike the other marshal errors they are temporary.
+var errSchemaRegistry = errors.New("schema registry")
+
+// TopicMarshaler is implemented by the marshalers whose payload depends on the topic, e.g. the schema subject.
+type TopicMarshaler interface {
+	MarshalTopic(topic string, event *Event) ([]byte, error)
+}
+
+// marshalEvent serializes the event published to the topic.
+func marshalEvent(m Marshaler, topic string, event *Event) ([]byte, error) {
+	if tm, ok := m.(TopicMarshaler); ok {
+		return tm.MarshalTopic(topic, event)
+	}
+
+	return m.Marshal(event)
+}
+
+// schemaIDs resolves the schema ID of the subject.
+type schemaIDs interface {
+	SchemaID(ctx context.Context, subject, schema string) (int, error)
+}
+
+// AvroMarshaler serializes events as Avro in the Confluent wire format. The record schema is derived from
+// the column types of the event (type annotations) and registered under the subject of the topic (<topic>-value).
+// The schema IDs are cached, so the registry is only asked when the columns of a table change.
+type AvroMarshaler struct {
+	registry schemaIDs
+}
+
+// NewAvroMarshaler return new AvroMarshaler instance.
+func NewAvroMarshaler(registry schemaIDs) AvroMarshaler {
+	return AvroMarshaler{registry: registry}
+}
+
+// MarshalTopic serializes the event with the schema registered under the subject of the topic.
+func (m AvroMarshaler) MarshalTopic(topic string, event *Event) ([]byte, error) {
+	return m.marshal(topic+avroValueSubjectSfx, event)
+}
+
+// Marshal serializes the event with the schema registered under the full name of the record,
+// for the publishers without topics.
+func (m AvroMarshaler) Marshal(event *Event) ([]byte, error) {
+	return m.marshal("", event)
+}
+
+func (m AvroMarshaler) marshal(subject string, event *Event) ([]byte, error) {
+	columns := avroColumns(event)
+	ns := avroNamespace(event)
+
+	schema, err := json.Marshal(avroEventSchema(ns, columns))
+	if err != nil {
+		return nil, fmt.Errorf("avro schema: %w", err)
+	}
+
+	if subject == "" {
+		subject = strings.TrimPrefix(ns+".Event", ".")
+	}
+
+	id, err := m.registry.SchemaID(context.Background(), subject, string(schema))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSchemaRegistry, err)
+	}
+
+	buf := make([]byte, 5, 256)
+	buf[0] = avroMagicByte
+	binary.BigEndian.PutUint32(buf[1:], uint32(id))
+
+	buf = appendAvroString(buf, event.ID.String())
+	buf = appendAvroString(buf, event.Schema)
+	buf = appendAvroString(buf, event.Table)
+	buf = appendAvroString(buf, event.Action)
+	buf = binary.AppendVarint(buf, event.EventTime.UnixMicro())
+	buf = binary.AppendVarint(buf, int64(event.TransactionID))
+	buf = binary.AppendVarint(buf, int64(event.LSN))
+
+	for _, row := range []map[string]any{event.Data, event.DataOld} {
+		if buf, err = appendAvroRow(buf, columns, row); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
+
+// ContentType returns the Confluent Avro MIME type.
+func (AvroMarshaler) ContentType() string {
+	return avroContentType
+}
+
+// ContentEncoding returns empty encoding, Avro is not compressed.
+func (AvroMarshaler) ContentEncoding() string {
+	return ""
+}
+
+// avroColumn is a field of the row record.
+type avroColumn struct {
+	name     string // column name
+	field    string // avro field name
+	typeName string
+}
+
+// avroColumns returns the columns of the event sorted by name, typed by the type annotations.
+func avroColumns(event *Event) []avroColumn {
+	names := make(map[string]struct{}, len(event.Types))
+
+	for _, values := range []map[string]any{event.Data, event.DataOld} {
+		for name := range values {
+			names[name] = struct{}{}
+		}
+	}
+
+	for name := range event.Types {
+		names[name] = struct{}{}
+	}
+
+	columns := make([]avroColumn, 0, len(names))
+
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		typeName, ok := avroTypes[event.Types[name]]
+		if !ok {
+			typeName = avroString
+		}
+
+		columns = append(columns, avroColumn{name: name, field: avroName(name), typeName: typeName})
+	}
+
+	return columns
+}
+
+type avroRecord struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace,omitempty"`
+	Fields    []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name    string          `json:"name"`
+	Type    any             `json:"type"`
+	Default json.RawMessage `json:"default,omitempty"`
+}
+
+type avroLogicalType struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logicalType"`
+}
+
+// avroEventSchema returns the record of the event, the new and old rows share the row record.
+func avroEventSchema(namespace string, columns []avroColumn) avroRecord {
+	row := avroRecord{Type: "record", Name: "Row", Fields: make([]avroField, 0, len(columns))}
+
+	for _, col := range columns {
+		row.Fields = append(row.Fields, avroField{
+			Name:    col.field,
+			Type:    []any{"null", avroFieldType(col.typeName)},
+			Default: json.RawMessage("null"),
+		})
+	}
+
+	return avroRecord{
+		Type:      "record",
+		Name:      "Event",
+		Namespace: namespace,
+		Fields: []avroField{
+			{Name: "id", Type: avroFieldType(avroUUID)},
+			{Name: "schema", Type: avroString},
+			{Name: "table", Type: avroString},
+			{Name: "action", Type: avroString},
+			{Name: "commitTime", Type: avroFieldType(avroTimestamp)},
+			{Name: "xid", Type: avroLong},
+			{Name: "lsn", Type: avroLong},
+			{Name: "data", Type: []any{"null", row}, Default: json.RawMessage("null")},
+			{Name: "dataOld", Type: []any{"null", "Row"}, Default: json.RawMessage("null")},
+		},
+	}
+}
+
+func avroFieldType(typeName string) any {
+	switch typeName {
+	case avroTimestamp:
+		return avroLogicalType{Type: avroLong, LogicalType: avroTimestamp}
+	case avroUUID:
+		return avroLogicalType{Type: avroString, LogicalType: avroUUID}
+	default:
+		return typeName
+	}
+}
+
+// avroNamespace returns the namespace of the table records.
+func avroNamespace(event *Event) string {
+	var parts []string
+
+	for _, part := range []string{event.Schema, event.Table} {
+		if part != "" {
+			parts = append(parts, avroName(part))
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// avroName replaces the characters not allowed in Avro names with underscores.
+func avroName(name string) string {
+	var b strings.Builder
+
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', i > 0 && r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return b.String()
+}
+
+// appendAvroRow appends the row as the nullable row record, an empty row is null (e.g. the new row of a delete).
+func appendAvroRow(buf []byte, columns []avroColumn, row map[string]any) ([]byte, error) {
+	if len(row) == 0 {
+		return binary.AppendVarint(buf, 0), nil
+	}
+
+	buf = binary.AppendVarint(buf, 1)
+
+	for _, col := range columns {
+		val := row[col.name]
+		if val == nil {
+			buf = binary.AppendVarint(buf, 0)
+			continue
+		}
+
+		buf = binary.AppendVarint(buf, 1)
+
+		var err error
+		if buf, err = appendAvroValue(buf, col.typeName, val); err != nil {
+			return nil, fmt.Errorf("column %s: %w", col.name, err)
+		}
+	}
+
+	return buf, nil
+}
+
+func appendAvroValue(buf []byte, typeName string, val any) ([]byte, error) {
+	switch typeName {
+	case avroBoolean:
+		b, ok := val.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%T is not boolean", val)
+		}
+
+		if b {
+			return append(buf, 1), nil
+		}
+
+		return append(buf, 0), nil
+	case avroInt, avroLong:
+		n, ok := avroInteger(val)
+		if !ok || (typeName == avroInt && (n < math.MinInt32 || n > math.MaxInt32)) {
+			return nil, fmt.Errorf("%v is not %s", val, typeName)
+		}
+
+		return binary.AppendVarint(buf, n), nil
+	case avroTimestamp:
+		t, ok := val.(time.Time)
+		if !ok {
+			s, isStr := val.(string)
+			if !isStr {
+				return nil, fmt.Errorf("%T is not timestamp", val)
+			}
+
+			var err error
+			if t, err = time.Parse(time.RFC3339Nano, s); err != nil {
+				return nil, fmt.Errorf("parse timestamp: %w", err)
+			}
+		}
+
+		return binary.AppendVarint(buf, t.UnixMicro()), nil
+	}
+
+	switch v := val.(type) {
+	case string:
+		return appendAvroString(buf, v), nil
+	case uuid.UUID:
+		return appendAvroString(buf, v.String()), nil
+	default:
+		// e.g. jsonb values are written as JSON text.
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("marshal: %w", err)
+		}
+
+		return appendAvroString(buf, string(data)), nil
+	}
+}
+
+// avroInteger returns the integer value, the events decoded from JSON (e.g. replayed) carry float numbers.
+func avroInteger(val any) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint32:
+		return int64(v), true
+	case float64:
+		return int64(v), v == math.Trunc(v) && math.Abs(v) < 1<<63
+	default:
+		return 0, false
+	}
+}
+
+func appendAvroString(buf []byte, s string) []byte {
+	buf = binary.AppendVarint(buf, int64(len(s)))
+	return append(buf, s...)
+}
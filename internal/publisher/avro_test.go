@@ -0,0 +1,141 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestAvroMarshaler_MarshalTopic(t *testing.T) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		assert.Equal(t, "/subjects/wal.public_users-value/versions", r.URL.Path)
+		assert.Equal(t, "application/vnd.schemaregistry.v1+json", r.Header.Get("Content-Type"))
+
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "key", user)
+		assert.Equal(t, "secret", pass)
+
+		var body struct {
+			Schema string `json:"schema"`
+		}
+
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		var schema map[string]any
+		require.NoError(t, json.Unmarshal([]byte(body.Schema), &schema), "the schema is JSON")
+		assert.Equal(t, "public.users", schema["namespace"])
+
+		_, _ = io.WriteString(w, `{"id":42}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	m, err := NewPublisherMarshaler(&config.PublisherCfg{
+		Format:         config.FormatAvro,
+		SchemaRegistry: config.SchemaRegistryCfg{URL: srv.URL, Username: "key", Password: "secret"},
+	})
+	require.NoError(t, err)
+
+	commit := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	event := &Event{
+		ID:            uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Schema:        "public",
+		Table:         "users",
+		Action:        "UPDATE",
+		Data:          map[string]any{"active": true, "id": 7, "name": "new", "tags": []any{"a"}},
+		DataOld:       map[string]any{"active": true, "id": 7, "name": nil, "tags": []any{"a"}},
+		EventTime:     commit,
+		TransactionID: 5,
+		LSN:           100,
+		Types:         map[string]string{"active": "bool", "id": "int4", "name": "text", "tags": "jsonb"},
+	}
+
+	for range 2 {
+		got, err := marshalEvent(m, "wal.public_users", event)
+		require.NoError(t, err)
+
+		r := avroReader{t: t, buf: bytes.NewBuffer(got)}
+
+		assert.Equal(t, []byte{0, 0, 0, 0, 42}, r.buf.Next(5), "magic byte and schema id")
+		assert.Equal(t, "00000000-0000-0000-0000-000000000001", r.string())
+		assert.Equal(t, "public", r.string())
+		assert.Equal(t, "users", r.string())
+		assert.Equal(t, "UPDATE", r.string())
+		assert.Equal(t, commit.UnixMicro(), r.long())
+		assert.Equal(t, int64(5), r.long())
+		assert.Equal(t, int64(100), r.long())
+
+		// the rows: active, id, name, tags; the union index precedes every value.
+		assert.Equal(t, int64(1), r.long(), "data is not null")
+		assert.Equal(t, []byte{2, 1}, r.buf.Next(2), "active")
+		assert.Equal(t, []int64{1, 7}, []int64{r.long(), r.long()}, "id")
+		assert.Equal(t, int64(1), r.long())
+		assert.Equal(t, "new", r.string())
+		assert.Equal(t, int64(1), r.long())
+		assert.Equal(t, `["a"]`, r.string(), "jsonb as JSON text")
+
+		assert.Equal(t, int64(1), r.long(), "dataOld is not null")
+		assert.Equal(t, []byte{2, 1}, r.buf.Next(2))
+		assert.Equal(t, []int64{1, 7}, []int64{r.long(), r.long()})
+		assert.Equal(t, int64(0), r.long(), "null name")
+		assert.Equal(t, int64(1), r.long())
+		assert.Equal(t, `["a"]`, r.string())
+		assert.Zero(t, r.buf.Len())
+	}
+
+	assert.Equal(t, int32(1), requests.Load(), "the schema id is cached")
+}
+
+func TestAvroMarshaler_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"error_code":50001}`, http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	event := &Event{Schema: "public", Table: "users", Data: map[string]any{"id": "x"}, Types: map[string]string{"id": "int4"}}
+
+	_, err := NewAvroMarshaler(NewSchemaRegistry(config.SchemaRegistryCfg{URL: srv.URL})).Marshal(event)
+	require.ErrorIs(t, err, errSchemaRegistry, "temporary")
+
+	_, err = NewAvroMarshaler(staticSchemaIDs(1)).Marshal(event)
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, errSchemaRegistry), "the value doesn't fit the schema")
+}
+
+type staticSchemaIDs int
+
+func (s staticSchemaIDs) SchemaID(_ context.Context, _, _ string) (int, error) { return int(s), nil }
+
+// avroReader decodes the primitive values of the Avro binary encoding.
+type avroReader struct {
+	t   *testing.T
+	buf *bytes.Buffer
+}
+
+func (r avroReader) long() int64 {
+	n, err := binary.ReadVarint(r.buf)
+	require.NoError(r.t, err)
+
+	return n
+}
+
+func (r avroReader) string() string {
+	return string(r.buf.Next(int(r.long())))
+}
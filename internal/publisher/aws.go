@@ -0,0 +1,314 @@
+package publisher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+const (
+	awsFIFOSuffix      = ".fifo"
+	awsGroupIDMaxLen   = 128
+	awsStringAttribute = "String"
+)
+
+// sqsAPI is the part of the SQS client used by the publisher.
+type sqsAPI interface {
+	GetQueueUrl(
+		ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options),
+	) (*sqs.GetQueueUrlOutput, error)
+	SendMessage(
+		ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options),
+	) (*sqs.SendMessageOutput, error)
+}
+
+// snsAPI is the part of the SNS client used by the publisher.
+type snsAPI interface {
+	ListTopics(
+		ctx context.Context, params *sns.ListTopicsInput, optFns ...func(*sns.Options),
+	) (*sns.ListTopicsOutput, error)
+	Publish(
+		ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options),
+	) (*sns.PublishOutput, error)
+}
+
+// NewSQSClient returns the SQS client of the configured region and endpoint.
+func NewSQSClient(ctx context.Context, cfg config.AWSCfg) (*sqs.Client, error) {
+	awsCfg, err := loadAWSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	}), nil
+}
+
+// NewSNSClient returns the SNS client of the configured region and endpoint.
+func NewSNSClient(ctx context.Context, cfg config.AWSCfg) (*sns.Client, error) {
+	awsCfg, err := loadAWSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return sns.NewFromConfig(awsCfg, func(o *sns.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	}), nil
+}
+
+func loadAWSConfig(ctx context.Context, cfg config.AWSCfg) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("load aws config: %w", err)
+	}
+
+	return awsCfg, nil
+}
+
+// SQSPublisher sends the events to the SQS queues named by the topics, see awsName.
+// The queue URLs are looked up once.
+type SQSPublisher struct {
+	client    sqsAPI
+	marshaler Marshaler
+
+	mu   sync.Mutex
+	urls map[string]string // queue name -> URL
+}
+
+// NewSQSPublisher return new SQSPublisher instance.
+func NewSQSPublisher(client sqsAPI, marshaler Marshaler) *SQSPublisher {
+	return &SQSPublisher{client: client, marshaler: marshaler, urls: make(map[string]string)}
+}
+
+// Publish sends the serialized event as the message body, the schema, table and action are its attributes.
+// The messages of a FIFO queue are grouped by the row key and deduplicated by the event ID.
+func (p *SQSPublisher) Publish(ctx context.Context, topic string, event *Event) error {
+	body, err := eventMarshaler(event, p.marshaler).Marshal(event)
+	if err != nil {
+		return Permanent(fmt.Errorf("marshal: %w", err))
+	}
+
+	queueURL, err := p.queueURL(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       aws.String(string(body)),
+		MessageAttributes: make(map[string]sqstypes.MessageAttributeValue),
+	}
+
+	for name, value := range awsAttributes(event) {
+		input.MessageAttributes[name] = sqstypes.MessageAttributeValue{
+			DataType:    aws.String(awsStringAttribute),
+			StringValue: aws.String(value),
+		}
+	}
+
+	if strings.HasSuffix(queueURL, awsFIFOSuffix) {
+		input.MessageGroupId = aws.String(awsGroupID(event))
+		input.MessageDeduplicationId = aws.String(event.ID.String())
+	}
+
+	if _, err := p.client.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	return nil
+}
+
+func (p *SQSPublisher) queueURL(ctx context.Context, topic string) (string, error) {
+	name := awsName(topic)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if queueURL, ok := p.urls[name]; ok {
+		return queueURL, nil
+	}
+
+	out, err := p.client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return "", fmt.Errorf("get queue url of %s: %w", name, err)
+	}
+
+	queueURL := aws.ToString(out.QueueUrl)
+	p.urls[name] = queueURL
+
+	return queueURL, nil
+}
+
+// Close does nothing, the client has no connections to close.
+func (p *SQSPublisher) Close() error {
+	return nil
+}
+
+// SNSPublisher publishes the events to the SNS topics named by the topics, see awsName.
+// The topic ARNs are looked up in the topic list.
+type SNSPublisher struct {
+	client    snsAPI
+	marshaler Marshaler
+
+	mu   sync.Mutex
+	arns map[string]string // topic name -> ARN
+}
+
+// NewSNSPublisher return new SNSPublisher instance.
+func NewSNSPublisher(client snsAPI, marshaler Marshaler) *SNSPublisher {
+	return &SNSPublisher{client: client, marshaler: marshaler, arns: make(map[string]string)}
+}
+
+// Publish publishes the serialized event as the message, the schema, table and action are its attributes.
+// The messages of a FIFO topic are grouped by the row key and deduplicated by the event ID.
+func (p *SNSPublisher) Publish(ctx context.Context, topic string, event *Event) error {
+	body, err := eventMarshaler(event, p.marshaler).Marshal(event)
+	if err != nil {
+		return Permanent(fmt.Errorf("marshal: %w", err))
+	}
+
+	arn, err := p.topicARN(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	input := &sns.PublishInput{
+		TopicArn:          aws.String(arn),
+		Message:           aws.String(string(body)),
+		MessageAttributes: make(map[string]snstypes.MessageAttributeValue),
+	}
+
+	for name, value := range awsAttributes(event) {
+		input.MessageAttributes[name] = snstypes.MessageAttributeValue{
+			DataType:    aws.String(awsStringAttribute),
+			StringValue: aws.String(value),
+		}
+	}
+
+	if strings.HasSuffix(arn, awsFIFOSuffix) {
+		input.MessageGroupId = aws.String(awsGroupID(event))
+		input.MessageDeduplicationId = aws.String(event.ID.String())
+	}
+
+	if _, err := p.client.Publish(ctx, input); err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+
+	return nil
+}
+
+// topicARN returns the ARN of the topic, the topic list is reloaded when the name is unknown, e.g. a new topic.
+func (p *SNSPublisher) topicARN(ctx context.Context, topic string) (string, error) {
+	name := awsName(topic)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if arn, ok := p.arns[name]; ok {
+		return arn, nil
+	}
+
+	paginator := sns.NewListTopicsPaginator(p.client, &sns.ListTopicsInput{})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("list topics: %w", err)
+		}
+
+		for _, t := range page.Topics {
+			arn := aws.ToString(t.TopicArn)
+			p.arns[arn[strings.LastIndexByte(arn, ':')+1:]] = arn
+		}
+	}
+
+	arn, ok := p.arns[name]
+	if !ok {
+		return "", fmt.Errorf("sns topic %s not found", name)
+	}
+
+	return arn, nil
+}
+
+// Close does nothing, the client has no connections to close.
+func (p *SNSPublisher) Close() error {
+	return nil
+}
+
+// awsName returns the queue or topic name of the topic: the characters other than letters, digits, - and _
+// are replaced with _, e.g. wal.public_users is wal_public_users. The .fifo suffix is kept.
+func awsName(topic string) string {
+	name, fifo := strings.CutSuffix(topic, awsFIFOSuffix)
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '-', r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+
+	if fifo {
+		name += awsFIFOSuffix
+	}
+
+	return name
+}
+
+// awsAttributes returns the message attributes of the event, the empty values are left out.
+func awsAttributes(event *Event) map[string]string {
+	attributes := make(map[string]string, 4)
+
+	for name, value := range map[string]string{
+		attrSchema:              event.Schema,
+		attrTable:               event.Table,
+		attrAction:              event.Action,
+		headerSchemaFingerprint: event.SchemaFingerprint,
+	} {
+		if value != "" {
+			attributes[name] = value
+		}
+	}
+
+	return attributes
+}
+
+// awsGroupID returns the message group of the FIFO queues and topics: the row key, or the table if it has no key.
+// Keys too long or with characters not allowed in a group ID are hashed.
+func awsGroupID(event *Event) string {
+	key := event.RowKey()
+	if key == "" {
+		key = event.Schema + "." + event.Table
+	}
+
+	if len(key) <= awsGroupIDMaxLen && !strings.ContainsFunc(key, func(r rune) bool { return r <= ' ' || r > '~' }) {
+		return key
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sqsClientMock struct {
+	lookups int
+	sent    []*sqs.SendMessageInput
+}
+
+func (m *sqsClientMock) GetQueueUrl(
+	_ context.Context,
+	params *sqs.GetQueueUrlInput,
+	_ ...func(*sqs.Options),
+) (*sqs.GetQueueUrlOutput, error) {
+	m.lookups++
+
+	if aws.ToString(params.QueueName) == "missing" {
+		return nil, errors.New("queue does not exist")
+	}
+
+	return &sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/" + aws.ToString(params.QueueName)),
+	}, nil
+}
+
+func (m *sqsClientMock) SendMessage(
+	_ context.Context,
+	params *sqs.SendMessageInput,
+	_ ...func(*sqs.Options),
+) (*sqs.SendMessageOutput, error) {
+	m.sent = append(m.sent, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type snsClientMock struct {
+	lists     int
+	published []*sns.PublishInput
+}
+
+func (m *snsClientMock) ListTopics(
+	_ context.Context,
+	params *sns.ListTopicsInput,
+	_ ...func(*sns.Options),
+) (*sns.ListTopicsOutput, error) {
+	m.lists++
+
+	// two pages of topics.
+	if params.NextToken == nil {
+		return &sns.ListTopicsOutput{
+			Topics:    []snstypes.Topic{{TopicArn: aws.String("arn:aws:sns:eu-west-1:123456789012:audit")}},
+			NextToken: aws.String("next"),
+		}, nil
+	}
+
+	return &sns.ListTopicsOutput{
+		Topics: []snstypes.Topic{{TopicArn: aws.String("arn:aws:sns:eu-west-1:123456789012:wal_users.fifo")}},
+	}, nil
+}
+
+func (m *snsClientMock) Publish(
+	_ context.Context,
+	params *sns.PublishInput,
+	_ ...func(*sns.Options),
+) (*sns.PublishOutput, error) {
+	m.published = append(m.published, params)
+	return &sns.PublishOutput{}, nil
+}
+
+func newAWSTestEvent() *Event {
+	return &Event{
+		ID:         uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Schema:     "public",
+		Table:      "users",
+		Action:     "INSERT",
+		Data:       map[string]any{"id": 7, "name": "john"},
+		KeyColumns: []string{"id"},
+	}
+}
+
+func TestSQSPublisher_Publish(t *testing.T) {
+	t.Run("standard queue", func(t *testing.T) {
+		client := new(sqsClientMock)
+		p := NewSQSPublisher(client, JSONMarshaler{})
+
+		require.NoError(t, p.Publish(context.Background(), "wal.public_users", newAWSTestEvent()))
+		require.NoError(t, p.Publish(context.Background(), "wal.public_users", newAWSTestEvent()))
+		require.Len(t, client.sent, 2)
+
+		msg := client.sent[0]
+		assert.Equal(t, 1, client.lookups, "the queue URL is cached")
+		assert.Equal(t, "https://sqs.eu-west-1.amazonaws.com/123456789012/wal_public_users", aws.ToString(msg.QueueUrl))
+		assert.Contains(t, aws.ToString(msg.MessageBody), `"table":"users"`)
+		assert.Equal(t, "public", aws.ToString(msg.MessageAttributes["schema"].StringValue))
+		assert.Equal(t, "users", aws.ToString(msg.MessageAttributes["table"].StringValue))
+		assert.Equal(t, "INSERT", aws.ToString(msg.MessageAttributes["action"].StringValue))
+		assert.Nil(t, msg.MessageGroupId)
+		assert.Nil(t, msg.MessageDeduplicationId)
+	})
+
+	t.Run("fifo queue", func(t *testing.T) {
+		client := new(sqsClientMock)
+		p := NewSQSPublisher(client, JSONMarshaler{})
+
+		require.NoError(t, p.Publish(context.Background(), "wal.users.fifo", newAWSTestEvent()))
+		require.Len(t, client.sent, 1)
+
+		assert.Equal(t, "https://sqs.eu-west-1.amazonaws.com/123456789012/wal_users.fifo",
+			aws.ToString(client.sent[0].QueueUrl))
+		assert.Equal(t, "7", aws.ToString(client.sent[0].MessageGroupId))
+		assert.Equal(t, "00000000-0000-0000-0000-000000000001", aws.ToString(client.sent[0].MessageDeduplicationId))
+	})
+
+	t.Run("unknown queue", func(t *testing.T) {
+		p := NewSQSPublisher(new(sqsClientMock), JSONMarshaler{})
+
+		assert.ErrorContains(t, p.Publish(context.Background(), "missing", newAWSTestEvent()), "queue does not exist")
+	})
+}
+
+func TestSNSPublisher_Publish(t *testing.T) {
+	client := new(snsClientMock)
+	p := NewSNSPublisher(client, JSONMarshaler{})
+
+	require.NoError(t, p.Publish(context.Background(), "wal.users.fifo", newAWSTestEvent()))
+	require.NoError(t, p.Publish(context.Background(), "audit", newAWSTestEvent()))
+	require.Len(t, client.published, 2)
+
+	assert.Equal(t, 2, client.lists, "both pages are listed once")
+	assert.Equal(t, "arn:aws:sns:eu-west-1:123456789012:wal_users.fifo", aws.ToString(client.published[0].TopicArn))
+	assert.Equal(t, "7", aws.ToString(client.published[0].MessageGroupId))
+	assert.Equal(t, "users", aws.ToString(client.published[0].MessageAttributes["table"].StringValue))
+	assert.Nil(t, client.published[1].MessageGroupId, "standard topic")
+
+	err := p.Publish(context.Background(), "wal.orders", newAWSTestEvent())
+	assert.ErrorContains(t, err, "sns topic wal_orders not found")
+}
+
+func TestAWSName(t *testing.T) {
+	assert.Equal(t, "wal_public_users", awsName("wal.public_users"))
+	assert.Equal(t, "prod_wal_users-v2.fifo", awsName("prod.wal.users-v2.fifo"))
+	assert.Equal(t, "wal_sch_ma_t_ble", awsName("wal.schéma.t@ble"))
+}
+
+func TestAWSGroupID(t *testing.T) {
+	event := newAWSTestEvent()
+	assert.Equal(t, "7", awsGroupID(event))
+
+	event.KeyColumns = nil
+	assert.Equal(t, "public.users", awsGroupID(event), "the table without key")
+
+	event.KeyColumns = []string{"name"}
+	event.Data["name"] = "john doe"
+	assert.Len(t, awsGroupID(event), 64, "hashed, spaces are not allowed")
+
+	event.Data["name"] = strings.Repeat("x", 200)
+	assert.Len(t, awsGroupID(event), 64, "hashed, too long")
+}
@@ -0,0 +1,167 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+var (
+	errChannelClosed = errors.New("channel publisher is closed")
+	errNoSubscribers = errors.New("no subscribers")
+)
+
+// ChannelPublisher delivers the events to in-process subscribers, e.g. when the listener is embedded.
+//
+// In the broadcast mode every subscriber receives a copy of every event. Publish blocks until
+// each subscriber has taken the event or has room in its buffer, so the slowest subscriber sets the pace,
+// and fails without subscribers. In the work queue mode the subscribers share one buffered channel and
+// every event is received by one of them; Publish blocks while the buffer is full.
+// A blocked Publish returns when the context is done. The WAL position is not acknowledged until
+// Publish returns, so the backpressure never loses events.
+//
+// The subscribers receive copies of the event structure, the data maps are shared and must not be modified.
+type ChannelPublisher struct {
+	mode   config.ChannelMode
+	buffer int
+
+	mu          sync.RWMutex
+	queue       chan *Event // work queue mode
+	subscribers []*Subscription
+	closed      bool
+}
+
+// Subscription receives the events of the channel publisher.
+type Subscription struct {
+	C <-chan *Event // closed on unsubscribe or when the publisher is closed
+
+	pub  *ChannelPublisher
+	ch   chan *Event
+	done chan struct{} // unblocks the publish to the subscription
+	once sync.Once
+}
+
+// NewChannelPublisher return new ChannelPublisher instance.
+func NewChannelPublisher(cfg config.ChannelCfg) *ChannelPublisher {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = config.ChannelBroadcast
+	}
+
+	p := &ChannelPublisher{mode: mode, buffer: cfg.Buffer}
+
+	if mode == config.ChannelWorkQueue {
+		p.queue = make(chan *Event, cfg.Buffer)
+	}
+
+	return p
+}
+
+// Subscribe adds a subscriber. In the broadcast mode it receives the events published after the subscription.
+func (p *ChannelPublisher) Subscribe() *Subscription {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.mode == config.ChannelWorkQueue {
+		return &Subscription{C: p.queue}
+	}
+
+	ch := make(chan *Event, p.buffer)
+	s := &Subscription{C: ch, pub: p, ch: ch, done: make(chan struct{})}
+
+	if p.closed {
+		close(ch)
+		return s
+	}
+
+	p.subscribers = append(p.subscribers, s)
+
+	return s
+}
+
+// Unsubscribe stops the delivery to the subscriber, a publish blocked by it continues with the other subscribers.
+// The work queue is shared, it's closed only with the publisher.
+func (s *Subscription) Unsubscribe() {
+	if s.pub == nil {
+		return
+	}
+
+	s.once.Do(func() {
+		close(s.done)
+
+		s.pub.mu.Lock()
+		defer s.pub.mu.Unlock()
+
+		if i := slices.Index(s.pub.subscribers, s); i >= 0 {
+			s.pub.subscribers = slices.Delete(s.pub.subscribers, i, i+1)
+			close(s.ch)
+		}
+	})
+}
+
+// Publish delivers the event to the subscribers, the topic is ignored. Implements eventPublisher.
+func (p *ChannelPublisher) Publish(ctx context.Context, _ string, event *Event) error {
+	// the read lock is held while sending, so the channels aren't closed under a blocked publish.
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errChannelClosed
+	}
+
+	if p.mode == config.ChannelWorkQueue {
+		ev := *event
+
+		select {
+		case p.queue <- &ev:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("work queue: %w", ctx.Err())
+		}
+	}
+
+	if len(p.subscribers) == 0 {
+		return errNoSubscribers
+	}
+
+	for _, s := range p.subscribers {
+		ev := *event
+
+		select {
+		case s.ch <- &ev:
+		case <-s.done:
+		case <-ctx.Done():
+			return fmt.Errorf("broadcast: %w", ctx.Err())
+		}
+	}
+
+	return nil
+}
+
+// Close closes the channels of the subscribers, the buffered events can still be received.
+func (p *ChannelPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+
+	if p.queue != nil {
+		close(p.queue)
+	}
+
+	for _, s := range p.subscribers {
+		close(s.ch)
+	}
+
+	p.subscribers = nil
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestChannelPublisher_Broadcast(t *testing.T) {
+	ctx := context.Background()
+	pub := NewChannelPublisher(config.ChannelCfg{Buffer: 1})
+
+	assert.ErrorIs(t, pub.Publish(ctx, "wal", &Event{Table: "users"}), errNoSubscribers)
+
+	first, second := pub.Subscribe(), pub.Subscribe()
+
+	event := &Event{Table: "users"}
+	require.NoError(t, pub.Publish(ctx, "wal", event))
+
+	// the listener returns the event to the pool after the publish.
+	event.Reset()
+
+	for _, s := range []*Subscription{first, second} {
+		assert.Equal(t, "users", (<-s.C).Table)
+	}
+
+	t.Run("slowest subscriber blocks", func(t *testing.T) {
+		require.NoError(t, pub.Publish(ctx, "wal", &Event{Table: "orders"}))
+		<-first.C
+
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		// the buffer of the second subscriber is full, the first one has received the event.
+		assert.ErrorIs(t, pub.Publish(timeout, "wal", &Event{Table: "orders"}), context.DeadlineExceeded)
+		assert.Equal(t, "orders", (<-first.C).Table)
+		assert.Equal(t, "orders", (<-second.C).Table)
+	})
+
+	t.Run("unsubscribe unblocks", func(t *testing.T) {
+		require.NoError(t, pub.Publish(ctx, "wal", &Event{Table: "orders"}))
+		<-first.C
+
+		published := make(chan error)
+
+		go func() {
+			published <- pub.Publish(ctx, "wal", &Event{Table: "products"})
+		}()
+
+		assert.Equal(t, "products", (<-first.C).Table)
+
+		second.Unsubscribe()
+		require.NoError(t, <-published)
+
+		// the buffered event is still received.
+		assert.Equal(t, "orders", (<-second.C).Table)
+		_, ok := <-second.C
+		assert.False(t, ok)
+	})
+
+	require.NoError(t, pub.Close())
+
+	_, ok := <-first.C
+	assert.False(t, ok)
+	assert.ErrorIs(t, pub.Publish(ctx, "wal", &Event{}), errChannelClosed)
+}
+
+func TestChannelPublisher_WorkQueue(t *testing.T) {
+	const (
+		events  = 100
+		workers = 4
+	)
+
+	ctx := context.Background()
+	pub := NewChannelPublisher(config.ChannelCfg{Mode: config.ChannelWorkQueue, Buffer: 10})
+
+	var (
+		mu       sync.Mutex
+		received = make(map[string]int)
+		wg       sync.WaitGroup
+	)
+
+	for range workers {
+		s := pub.Subscribe()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for event := range s.C {
+				mu.Lock()
+				received[event.Table]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for range events {
+		require.NoError(t, pub.Publish(ctx, "wal", &Event{Table: "users"}))
+	}
+
+	require.NoError(t, pub.Close())
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"users": events}, received, "every event is received once")
+
+	t.Run("full queue blocks", func(t *testing.T) {
+		pub := NewChannelPublisher(config.ChannelCfg{Mode: config.ChannelWorkQueue, Buffer: 1})
+		s := pub.Subscribe()
+
+		require.NoError(t, pub.Publish(ctx, "wal", &Event{Table: "users"}))
+
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, pub.Publish(timeout, "wal", &Event{Table: "orders"}), context.DeadlineExceeded)
+		assert.Equal(t, "users", (<-s.C).Table)
+	})
+}
@@ -0,0 +1,81 @@
+package publisher
+
+import (
+	"cmp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	defaultCloudEventsName = "wal-listener"
+	// cloudEventsTypeChange is the type suffix of the events without an action.
+	cloudEventsTypeChange = "change"
+)
+
+// CloudEventsMarshaler serializes events as CloudEvents 1.0 in the structured JSON mode:
+// the event, as serialized by the JSON format, is the data of the envelope.
+type CloudEventsMarshaler struct {
+	Source            string // prefix of the source attribute, wal-listener by default
+	TypePrefix        string // prefix of the type attribute, wal-listener by default
+	DisableHTMLEscape bool   // string values are written verbatim
+	EpochMillis       bool   // time values of the data are written as milliseconds since the Unix epoch
+}
+
+// cloudEvent is the envelope, the required attributes are always set.
+type cloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time,omitempty"`
+	DataContentType string `json:"datacontenttype"`
+	Data            any    `json:"data"`
+}
+
+// Marshal event to the CloudEvents envelope.
+func (m CloudEventsMarshaler) Marshal(event *Event) ([]byte, error) {
+	id := event.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+
+	ce := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              id.String(),
+		Source:          cmp.Or(m.Source, defaultCloudEventsName) + "/" + event.Schema + "/" + event.Table,
+		Type:            cmp.Or(m.TypePrefix, defaultCloudEventsName) + "." + m.eventType(event),
+		Subject:         event.Key,
+		DataContentType: "application/json",
+		Data:            event,
+	}
+
+	if !event.EventTime.IsZero() {
+		ce.Time = event.EventTime.UTC().Format(time.RFC3339Nano)
+	}
+
+	if m.EpochMillis {
+		ce.Data = newMillisEvent(event)
+	}
+
+	return marshalJSON(ce, m.DisableHTMLEscape)
+}
+
+// eventType returns the lowercase action, the op code if the action is replaced by it.
+func (CloudEventsMarshaler) eventType(event *Event) string {
+	return strings.ToLower(cmp.Or(event.Action, event.Op, cloudEventsTypeChange))
+}
+
+// ContentType returns the CloudEvents structured mode MIME type.
+func (CloudEventsMarshaler) ContentType() string {
+	return cloudEventsContentType
+}
+
+// ContentEncoding returns empty encoding, the envelope is not compressed.
+func (CloudEventsMarshaler) ContentEncoding() string {
+	return ""
+}
@@ -0,0 +1,66 @@
+package publisher
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestCloudEventsMarshaler_Marshal(t *testing.T) {
+	event := &Event{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Schema:    "public",
+		Table:     "users",
+		Action:    "INSERT",
+		Data:      map[string]any{"id": 1},
+		EventTime: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Key:       "1",
+	}
+
+	t.Run("envelope", func(t *testing.T) {
+		m, err := NewPublisherMarshaler(&config.PublisherCfg{
+			Format:      config.FormatCloudEvents,
+			CloudEvents: config.CloudEventsCfg{Source: "/db/main", TypePrefix: "com.example.wal"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "application/cloudevents+json", m.ContentType())
+
+		got, err := m.Marshal(event)
+		require.NoError(t, err)
+
+		data, err := JSONMarshaler{}.Marshal(event)
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `{
+			"specversion": "1.0",
+			"id": "00000000-0000-0000-0000-000000000001",
+			"source": "/db/main/public/users",
+			"type": "com.example.wal.insert",
+			"subject": "1",
+			"time": "2024-05-01T00:00:00Z",
+			"datacontenttype": "application/json",
+			"data": `+string(data)+`
+		}`, string(got))
+	})
+
+	t.Run("required attributes", func(t *testing.T) {
+		got, err := CloudEventsMarshaler{}.Marshal(&Event{Schema: "public", Table: "users", Op: "d"})
+		require.NoError(t, err)
+
+		var ce map[string]any
+		require.NoError(t, json.Unmarshal(got, &ce))
+
+		assert.Equal(t, "1.0", ce["specversion"])
+		assert.NotEqual(t, uuid.Nil.String(), ce["id"], "the missing id is generated")
+		assert.Equal(t, "wal-listener/public/users", ce["source"])
+		assert.Equal(t, "wal-listener.d", ce["type"], "the op replacing the action")
+		assert.NotContains(t, ce, "time")
+		assert.NotContains(t, ce, "subject")
+	})
+}
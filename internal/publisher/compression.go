@@ -0,0 +1,74 @@
+package publisher
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// compressedMarshaler compresses the payload of the wrapped marshaler.
+type compressedMarshaler struct {
+	Marshaler
+	compression config.CompressionType
+	zstd        *zstd.Encoder
+}
+
+func newCompressedMarshaler(m Marshaler, compression config.CompressionType) (Marshaler, error) {
+	c := compressedMarshaler{Marshaler: m, compression: compression}
+
+	switch compression {
+	case config.CompressionNone:
+		return m, nil
+	case config.CompressionGzip, config.CompressionSnappy:
+	case config.CompressionZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd writer: %w", err)
+		}
+
+		c.zstd = enc
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+
+	return c, nil
+}
+
+// Marshal event and compress the payload.
+func (c compressedMarshaler) Marshal(event *Event) ([]byte, error) {
+	data, err := c.Marshaler.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.compression {
+	case config.CompressionGzip:
+		var buf bytes.Buffer
+
+		w := gzip.NewWriter(&buf)
+
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip write: %w", err)
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("gzip close: %w", err)
+		}
+
+		return buf.Bytes(), nil
+	case config.CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return c.zstd.EncodeAll(data, nil), nil
+	}
+}
+
+// ContentEncoding returns the compression name.
+func (c compressedMarshaler) ContentEncoding() string {
+	return string(c.compression)
+}
@@ -0,0 +1,59 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Publisher publishes events to the broker.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, event *Event) error
+}
+
+// permanentError is a publish error that fails again on retry, e.g. the event can't be serialized.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the publish error as not retryable.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether the publish error is not retryable.
+// A partially delivered batch is not retryable if all its failed messages are not.
+func IsPermanent(err error) bool {
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		for _, f := range batchErr.Failed {
+			if !IsPermanent(f.Err) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var perr permanentError
+
+	return errors.As(err, &perr)
+}
+
+// DeadLetter represents an event that could not be delivered to its topic.
+type DeadLetter struct {
+	Event     *Event    `json:"event"`
+	Topic     string    `json:"topic"`
+	Key       string    `json:"key,omitempty"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	Timestamp time.Time `json:"timestamp"`
+}
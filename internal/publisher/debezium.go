@@ -0,0 +1,112 @@
+package publisher
+
+import (
+	"cmp"
+	"strconv"
+	"time"
+)
+
+const (
+	debeziumConnector   = "postgresql"
+	defaultDebeziumName = "wal-listener"
+	debeziumOpSnapshot  = "r"
+)
+
+// debeziumOps maps the actions to the op codes of Debezium.
+var debeziumOps = map[string]string{
+	"INSERT":   "c",
+	"UPDATE":   "u",
+	"DELETE":   "d",
+	"TRUNCATE": "t",
+	"MESSAGE":  "m",
+}
+
+// DebeziumMarshaler serializes events as the value envelope of Debezium (JSON converter without schemas),
+// so Debezium consumers can read them: the old and new rows in before and after, the op code and the source block.
+type DebeziumMarshaler struct {
+	Name              string // logical name of the source, wal-listener by default
+	Database          string // database of the source, omitted when empty
+	DisableHTMLEscape bool   // string values are written verbatim
+	EpochMillis       bool   // time values are written as milliseconds since the Unix epoch
+}
+
+type debeziumEnvelope struct {
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+	Source debeziumSource `json:"source"`
+	Op     string         `json:"op"`
+	TsMs   int64          `json:"ts_ms"`
+}
+
+type debeziumSource struct {
+	Connector string  `json:"connector"`
+	Name      string  `json:"name"`
+	TsMs      int64   `json:"ts_ms"`
+	Snapshot  string  `json:"snapshot"`
+	DB        string  `json:"db,omitempty"`
+	Schema    string  `json:"schema"`
+	Table     string  `json:"table"`
+	TxID      *uint32 `json:"txId"`
+	LSN       *uint64 `json:"lsn"`
+}
+
+// Marshal event to the Debezium envelope. The rows of the initial snapshot have neither xid nor LSN,
+// they are published as reads.
+func (m DebeziumMarshaler) Marshal(event *Event) ([]byte, error) {
+	snapshot := event.TransactionID == 0 && event.LSN == 0
+
+	env := debeziumEnvelope{
+		Op:   cmp.Or(event.Op, debeziumOps[event.Action]),
+		TsMs: time.Now().UnixMilli(),
+		Source: debeziumSource{
+			Connector: debeziumConnector,
+			Name:      cmp.Or(m.Name, defaultDebeziumName),
+			TsMs:      event.EventTime.UnixMilli(),
+			Snapshot:  strconv.FormatBool(snapshot),
+			DB:        m.Database,
+			Schema:    event.Schema,
+			Table:     event.Table,
+		},
+	}
+
+	if snapshot && env.Op == debeziumOps["INSERT"] {
+		env.Op = debeziumOpSnapshot
+	}
+
+	if event.TransactionID != 0 {
+		env.Source.TxID = &event.TransactionID
+	}
+
+	if event.LSN != 0 {
+		env.Source.LSN = &event.LSN
+	}
+
+	// without REPLICA IDENTITY FULL Debezium has no before of the updates either.
+	if len(event.DataOld) > 0 {
+		env.Before = m.values(event.DataOld)
+	}
+
+	if env.Op != debeziumOps["DELETE"] && len(event.Data) > 0 {
+		env.After = m.values(event.Data)
+	}
+
+	return marshalJSON(env, m.DisableHTMLEscape)
+}
+
+func (m DebeziumMarshaler) values(values map[string]any) map[string]any {
+	if m.EpochMillis {
+		return millisValues(values)
+	}
+
+	return values
+}
+
+// ContentType returns JSON MIME type.
+func (DebeziumMarshaler) ContentType() string {
+	return "application/json"
+}
+
+// ContentEncoding returns empty encoding, the envelope is not compressed.
+func (DebeziumMarshaler) ContentEncoding() string {
+	return ""
+}
@@ -0,0 +1,87 @@
+package publisher
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestDebeziumMarshaler_Marshal(t *testing.T) {
+	commit := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		event *Event
+		want  string
+	}{
+		{
+			name: "update",
+			event: &Event{
+				Schema: "public", Table: "users", Action: "UPDATE", TransactionID: 7, LSN: 42, EventTime: commit,
+				Data: map[string]any{"id": 1, "name": "new"}, DataOld: map[string]any{"id": 1, "name": "old"},
+			},
+			want: `{
+				"before": {"id": 1, "name": "old"},
+				"after": {"id": 1, "name": "new"},
+				"op": "u",
+				"source": {"connector": "postgresql", "name": "main", "ts_ms": 1714521600000, "snapshot": "false",
+					"db": "shop", "schema": "public", "table": "users", "txId": 7, "lsn": 42}
+			}`,
+		},
+		{
+			name: "delete",
+			event: &Event{
+				Schema: "public", Table: "users", Action: "DELETE", TransactionID: 7, LSN: 42, EventTime: commit,
+				Data: map[string]any{}, DataOld: map[string]any{"id": 1},
+			},
+			want: `{
+				"before": {"id": 1},
+				"after": null,
+				"op": "d",
+				"source": {"connector": "postgresql", "name": "main", "ts_ms": 1714521600000, "snapshot": "false",
+					"db": "shop", "schema": "public", "table": "users", "txId": 7, "lsn": 42}
+			}`,
+		},
+		{
+			name: "snapshot row",
+			event: &Event{
+				Schema: "public", Table: "users", Action: "INSERT", EventTime: commit,
+				Data: map[string]any{"id": 1},
+			},
+			want: `{
+				"before": null,
+				"after": {"id": 1},
+				"op": "r",
+				"source": {"connector": "postgresql", "name": "main", "ts_ms": 1714521600000, "snapshot": "true",
+					"db": "shop", "schema": "public", "table": "users", "txId": null, "lsn": null}
+			}`,
+		},
+	}
+
+	m, err := NewPublisherMarshaler(&config.PublisherCfg{
+		Format:   config.FormatDebezium,
+		Debezium: config.DebeziumCfg{Name: "main", Database: "shop"},
+	})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.Marshal(tt.event)
+			require.NoError(t, err)
+
+			var env map[string]any
+			require.NoError(t, json.Unmarshal(got, &env))
+			assert.Positive(t, env["ts_ms"], "the processing time")
+			delete(env, "ts_ms")
+
+			stripped, err := json.Marshal(env)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(stripped))
+		})
+	}
+}
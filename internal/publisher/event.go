@@ -1,7 +1,14 @@
 package publisher
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,26 +18,302 @@ import (
 
 // Event structure for publishing to the NATS server.
 type Event struct {
-	ID        uuid.UUID      `json:"id"`
-	Schema    string         `json:"schema"`
-	Table     string         `json:"table"`
-	Action    string         `json:"action"`
-	Data      map[string]any `json:"data"`
-	DataOld   map[string]any `json:"dataOld"`
-	EventTime time.Time      `json:"commitTime"`
+	ID         uuid.UUID         `json:"id"`
+	Schema     string            `json:"schema"`
+	Table      string            `json:"table"`
+	Action     string            `json:"action"`
+	Op         string            `json:"op,omitempty"` // normalized action: c, u, d or t, opt-in
+	Data       map[string]any    `json:"data"`
+	DataOld    map[string]any    `json:"dataOld"`
+	EventTime  time.Time         `json:"commitTime"`
+	Types      map[string]string `json:"types,omitempty"`      // column -> Postgres type name, opt-in
+	ByteDelta  *int              `json:"byteDelta,omitempty"`  // serialized row size change on update, opt-in
+	Seq        *int              `json:"seq,omitempty"`        // position among the events of the transaction, opt-in
+	SeqTotal   *int              `json:"seqTotal,omitempty"`   // number of events of the transaction, opt-in
+	Deleted    *bool             `json:"_deleted,omitempty"`   // update soft-deleting the row, opt-in per table
+	Source     *EventSource      `json:"source,omitempty"`     // listener instance metadata, opt-in
+	DedupKey   string            `json:"dedupKey,omitempty"`   // business key values, opt-in
+	Enrichment map[string]any    `json:"enrichment,omitempty"` // values looked up in reference tables, opt-in
+	Key        string            `json:"-"`
+	KeyColumns []string          `json:"-"` // replica identity key columns of the row
+	Tombstone  bool              `json:"-"` // published without a value, e.g. a delete on a compacted topic
+	Marshaler  Marshaler         `json:"-"` // format of the destination, the publisher format when nil
+	// ColumnOrder are the columns of the table in order, the JSON data is written in this order when set.
+	ColumnOrder []string `json:"-"`
+
+	// TransactionID is the XID of the transaction, shared by its events; zero for the snapshot rows.
+	TransactionID uint32 `json:"xid,omitempty"`
+	// LSN is the commit LSN of the transaction, orders the events across transactions; zero for the snapshot rows.
+	LSN uint64 `json:"lsn,omitempty"`
+	// SchemaFingerprint identifies the columns of the table the event was decoded with, opt-in.
+	SchemaFingerprint string `json:"schemaFingerprint,omitempty"`
+	// Changes are the columns changed by the update with their old and new values, opt-in.
+	Changes map[string]ColumnChange `json:"changes,omitempty"`
+	// UnchangedToast are the columns of the update omitted from the data: their TOASTed values weren't changed,
+	// so the WAL doesn't send them.
+	UnchangedToast []string `json:"unchangedToast,omitempty"`
+	// PrimaryKey are the replica identity key columns of the row with their values, the old ones for deletes.
+	PrimaryKey map[string]any `json:"primaryKey,omitempty"`
+	// Headers are the message headers set besides the publisher ones, e.g. the original headers of a replayed
+	// dead letter.
+	Headers map[string]string `json:"-"`
+}
+
+// ColumnChange is the old and new value of a column changed by the update.
+type ColumnChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// Reset zeroes all fields, so a pooled event keeps no data (or references to it) from its previous use.
+// The maps are dropped rather than cleared, as they may still be referenced by the previous user.
+func (e *Event) Reset() {
+	*e = Event{}
+}
+
+// message headers of the publishers with header support.
+const (
+	headerContentEncoding   = "Content-Encoding"   // payload compression
+	headerSchemaFingerprint = "Schema-Fingerprint" // see Event.SchemaFingerprint
+)
+
+// Message is an event addressed to the topic.
+type Message struct {
+	Topic string
+	Event *Event
+}
+
+// FailedMessage the message of the batch that was not delivered.
+type FailedMessage struct {
+	Message
+	Err error
+}
+
+// BatchError reports the messages of the batch that were not delivered, the other messages were delivered.
+type BatchError struct {
+	Failed []FailedMessage
+	Total  int // messages in the batch
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d messages failed: %v", len(e.Failed), e.Total, e.Failed[0].Err)
+}
+
+// Unwrap returns the errors of the failed messages.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+
+	for _, f := range e.Failed {
+		errs = append(errs, f.Err)
+	}
+
+	return errs
+}
+
+// opInstead reports whether the event is published with the op instead of the action.
+func (e *Event) opInstead() bool {
+	return e.Action == "" && e.Op != ""
+}
+
+// action returns the action of the JSON formats, nil if it's left out.
+func (e *Event) action() *string {
+	if e.opInstead() {
+		return nil
+	}
+
+	return &e.Action
 }
 
 // SubjectName creates subject name from the prefix, schema and table name. Also using topic map from cfg.
+// The environment prefix is applied last, so it is present on every resolved topic.
 func (e *Event) SubjectName(cfg *config.Config) string {
-	topic := fmt.Sprintf("%s_%s", e.Schema, e.Table)
+	return e.Topic(cfg, cfg.Listener.TopicsMap)
+}
+
+// Topic creates subject name like SubjectName, but with the given topic map.
+func (e *Event) Topic(cfg *config.Config, topicsMap map[string]string) string {
+	return TopicName(cfg, e.Route(topicsMap, cfg.Listener.TopicTemplate))
+}
 
-	if cfg.Listener.TopicsMap != nil {
-		if t, ok := cfg.Listener.TopicsMap[topic]; ok {
-			topic = t
+// Route returns the topic of the event before the prefixes are applied: the topic map value of the table,
+// otherwise the topic template or schema_table. The placeholders of the topic are replaced with the event values.
+func (e *Event) Route(topicsMap map[string]string, template string) string {
+	topic, ok := topicsMap[e.Schema+"_"+e.Table]
+	if !ok {
+		if template == "" {
+			return e.Schema + "_" + e.Table
 		}
+
+		topic = template
+	}
+
+	if !IsTopicTemplate(topic) {
+		return topic
+	}
+
+	return strings.NewReplacer(
+		"{schema}", e.Schema,
+		"{table}", e.Table,
+		"{action}", strings.ToLower(e.Action),
+	).Replace(topic)
+}
+
+// IsTopicTemplate reports whether the topic has placeholders, so it's only known per event.
+func IsTopicTemplate(topic string) bool {
+	return strings.Contains(topic, "{")
+}
+
+// TopicName returns the full name of the topic with the publisher topic and the prefixes.
+func TopicName(cfg *config.Config, topic string) string {
+	return cfg.Publisher.EnvPrefix + cfg.Publisher.Topic + "." + cfg.Publisher.TopicPrefix + topic
+}
+
+// keySeparator separates column values in the message key.
+const keySeparator = "|"
+
+// MessageKey creates the message key from the configured table columns, or the row key columns with the row key option.
+// The row key is also used if a configured column is absent from the event.
+// Returns an empty string if no key columns are configured for the table.
+func (e *Event) MessageKey(cfg config.EventKeyCfg) string {
+	columns := cfg.Columns[e.Table]
+
+	key := e.columnsKey(columns)
+	if key == "" && (len(columns) > 0 || cfg.RowKey) {
+		key = e.RowKey()
+	}
+
+	if key == "" {
+		return ""
+	}
+
+	h := newKeyHash(cfg.Hash)
+	if h == nil {
+		return key
 	}
 
-	topic = cfg.Publisher.Topic + "." + cfg.Publisher.TopicPrefix + topic
+	h.Write([]byte(key))
+	key = hex.EncodeToString(h.Sum(nil))
 
-	return topic
+	if cfg.HashLength > 0 && cfg.HashLength < len(key) {
+		key = key[:cfg.HashLength]
+	}
+
+	return key
+}
+
+// BusinessKey creates the deduplication key from the configured business key columns.
+// Returns an empty string if no business key is configured for the table.
+func (e *Event) BusinessKey(cfg config.BusinessKeyCfg) string {
+	return e.columnsKey(cfg.Columns[e.Table])
+}
+
+// RowKey joins the values of the replica identity key columns of the row.
+// Returns an empty string if the table has no key columns.
+func (e *Event) RowKey() string {
+	return e.columnsKey(e.KeyColumns)
+}
+
+// OldRowKey joins the values of the key columns of the row before the change.
+// Returns an empty string if the event has no old key values, e.g. an update that didn't change the key.
+func (e *Event) OldRowKey() string {
+	if len(e.KeyColumns) == 0 {
+		return ""
+	}
+
+	values := make([]string, 0, len(e.KeyColumns))
+
+	for _, col := range e.KeyColumns {
+		value, ok := e.DataOld[col]
+		if !ok {
+			return ""
+		}
+
+		values = append(values, fmt.Sprintf("%v", value))
+	}
+
+	return strings.Join(values, keySeparator)
+}
+
+// messageIDNamespace is the namespace of the event IDs derived from non-UUID message IDs.
+var messageIDNamespace = uuid.MustParse("6f1f5a2e-3c4b-4e8a-9d8e-7b1c2a3d4e5f")
+
+// ApplyMessageID takes the event ID and message key from the column value.
+// A value that isn't a UUID is mapped to a stable name-based UUID, so the same value always produces the same ID.
+// Only the insert takes the ID as is: the ID of a later change of the row is derived from the value,
+// the action and the LSN, so the broker doesn't drop it as a duplicate of the insert.
+// Returns false if the column is absent or null.
+func (e *Event) ApplyMessageID(column string) bool {
+	value := e.columnValue(column)
+	if value == nil {
+		return false
+	}
+
+	key := fmt.Sprintf("%v", value)
+
+	id, err := uuid.Parse(key)
+	if err != nil {
+		id = uuid.NewSHA1(messageIDNamespace, []byte(key))
+	}
+
+	if e.Action != "INSERT" {
+		id = uuid.NewSHA1(id, []byte(fmt.Sprintf("%s/%d", e.Action, e.LSN)))
+	}
+
+	e.ID = id
+	e.Key = key
+
+	return true
+}
+
+// columnsKey joins the column values with the key separator.
+// Returns an empty string if a column is absent from the event, so unrelated rows don't share the key.
+func (e *Event) columnsKey(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+
+	values := make([]string, 0, len(columns))
+
+	for _, col := range columns {
+		value, ok := e.lookupColumn(col)
+		if !ok {
+			return ""
+		}
+
+		values = append(values, fmt.Sprintf("%v", value))
+	}
+
+	return strings.Join(values, keySeparator)
+}
+
+// columnValue returns the column value, falling back to the old data (e.g. for delete events).
+func (e *Event) columnValue(name string) any {
+	value, _ := e.lookupColumn(name)
+	return value
+}
+
+// lookupColumn returns the column value like columnValue, reports whether the event has the column.
+func (e *Event) lookupColumn(name string) (any, bool) {
+	if v, ok := e.Data[name]; ok {
+		return v, true
+	}
+
+	v, ok := e.DataOld[name]
+
+	return v, ok
+}
+
+func newKeyHash(kind config.KeyHashType) hash.Hash {
+	switch kind {
+	case config.KeyHashSHA256:
+		return sha256.New()
+	case config.KeyHashSHA1:
+		return sha1.New()
+	case config.KeyHashMD5:
+		return md5.New()
+	case config.KeyHashFNV:
+		return fnv.New64a()
+	default:
+		return nil
+	}
 }
@@ -0,0 +1,114 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestEvent_MessageKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.EventKeyCfg
+		event *Event
+		want  string
+	}{
+		{
+			name:  "no key columns",
+			cfg:   config.EventKeyCfg{},
+			event: &Event{Table: "users", Data: map[string]any{"id": 1}},
+			want:  "",
+		},
+		{
+			name: "raw values",
+			cfg: config.EventKeyCfg{
+				Columns: map[string][]string{"users": {"id", "email"}},
+			},
+			event: &Event{Table: "users", Data: map[string]any{"id": 1, "email": "john@doe.com"}},
+			want:  "1|john@doe.com",
+		},
+		{
+			name: "sha256",
+			cfg: config.EventKeyCfg{
+				Columns: map[string][]string{"users": {"id"}},
+				Hash:    config.KeyHashSHA256,
+			},
+			event: &Event{Table: "users", Data: map[string]any{"id": 1}},
+			want:  "6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b",
+		},
+		{
+			name: "sha256 truncated",
+			cfg: config.EventKeyCfg{
+				Columns:    map[string][]string{"users": {"id"}},
+				Hash:       config.KeyHashSHA256,
+				HashLength: 16,
+			},
+			event: &Event{Table: "users", Data: map[string]any{"id": 1}},
+			want:  "6b86b273ff34fce1",
+		},
+		{
+			name: "old data for delete",
+			cfg: config.EventKeyCfg{
+				Columns: map[string][]string{"users": {"id"}},
+				Hash:    config.KeyHashMD5,
+			},
+			event: &Event{Table: "users", DataOld: map[string]any{"id": 1}},
+			want:  "c4ca4238a0b923820dcc509a6f75849b",
+		},
+		{
+			name:  "row key",
+			cfg:   config.EventKeyCfg{RowKey: true},
+			event: &Event{Table: "users", KeyColumns: []string{"id"}, Data: map[string]any{"id": 1, "email": "a@b.c"}},
+			want:  "1",
+		},
+		{
+			name: "key columns over row key",
+			cfg: config.EventKeyCfg{
+				Columns: map[string][]string{"users": {"email"}},
+				RowKey:  true,
+			},
+			event: &Event{Table: "users", KeyColumns: []string{"id"}, Data: map[string]any{"id": 1, "email": "a@b.c"}},
+			want:  "a@b.c",
+		},
+		{
+			name: "absent key column falls back to row key",
+			cfg: config.EventKeyCfg{
+				Columns: map[string][]string{"users": {"id", "tenant"}},
+			},
+			event: &Event{Table: "users", KeyColumns: []string{"id"}, Data: map[string]any{"id": 1}},
+			want:  "1",
+		},
+		{
+			name: "absent key column without row key",
+			cfg: config.EventKeyCfg{
+				Columns: map[string][]string{"users": {"tenant"}},
+			},
+			event: &Event{Table: "users", Data: map[string]any{"id": 1}},
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.event.MessageKey(tt.cfg))
+		})
+	}
+}
+
+func TestEvent_MessageKey_Stable(t *testing.T) {
+	cfg := config.EventKeyCfg{
+		Columns:    map[string][]string{"orders": {"customer_id", "region"}},
+		Hash:       config.KeyHashSHA256,
+		HashLength: 32,
+	}
+
+	first := &Event{Table: "orders", Data: map[string]any{"customer_id": 42, "region": "eu", "amount": 10}}
+	second := &Event{Table: "orders", Data: map[string]any{"customer_id": 42, "region": "eu", "amount": 99}}
+	other := &Event{Table: "orders", Data: map[string]any{"customer_id": 43, "region": "eu", "amount": 10}}
+
+	assert.Equal(t, first.MessageKey(cfg), second.MessageKey(cfg))
+	assert.NotEqual(t, first.MessageKey(cfg), other.MessageKey(cfg))
+	assert.Len(t, first.MessageKey(cfg), 32)
+}
@@ -0,0 +1,165 @@
+package publisher
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// flat format column groups.
+const (
+	flatGroupNew = "new"
+	flatGroupOld = "old"
+)
+
+// flatField is a top-level field of the flat format.
+type flatField struct {
+	name  string
+	value any
+}
+
+// FlatJSONMarshaler serializes events as a single-level JSON object for consumers with a fixed schema:
+// the event fields followed by the new and old columns named by their group, each group sorted by column name.
+type FlatJSONMarshaler struct {
+	Order             config.FlattenOrder
+	Collision         config.FlattenCollision
+	DisableHTMLEscape bool // string values are written verbatim
+	EpochMillis       bool // time values are written as milliseconds since the Unix epoch
+}
+
+// Marshal event to flat JSON.
+func (m FlatJSONMarshaler) Marshal(event *Event) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	fields := []flatField{
+		{"id", event.ID},
+		{"schema", event.Schema},
+		{"table", event.Table},
+	}
+
+	if !event.opInstead() {
+		fields = append(fields, flatField{"action", event.Action})
+	}
+
+	if event.Op != "" {
+		fields = append(fields, flatField{"op", event.Op})
+	}
+
+	if event.SchemaFingerprint != "" {
+		fields = append(fields, flatField{"schemaFingerprint", event.SchemaFingerprint})
+	}
+
+	if event.TransactionID != 0 {
+		fields = append(fields, flatField{"xid", event.TransactionID})
+	}
+
+	if event.LSN != 0 {
+		fields = append(fields, flatField{"lsn", event.LSN})
+	}
+
+	if event.Seq != nil && event.SeqTotal != nil {
+		fields = append(fields, flatField{"seq", *event.Seq}, flatField{"seqTotal", *event.SeqTotal})
+	}
+
+	if event.Deleted != nil {
+		fields = append(fields, flatField{"_deleted", *event.Deleted})
+	}
+
+	fields = append(fields, flatField{"commitTime", event.EventTime})
+
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		if err := m.writeField(&buf, f.name, f.value); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := []struct {
+		name string
+		data map[string]any
+	}{
+		{flatGroupNew, event.Data},
+		{flatGroupOld, event.DataOld},
+	}
+
+	if m.Order == config.FlattenOldFirst {
+		slices.Reverse(groups)
+	}
+
+	for _, g := range groups {
+		columns := make([]string, 0, len(g.data))
+
+		for col := range g.data {
+			if g.name == flatGroupOld && m.Collision == config.FlattenCollisionDrop {
+				if _, ok := event.Data[col]; ok {
+					continue
+				}
+			}
+
+			columns = append(columns, col)
+		}
+
+		slices.Sort(columns)
+
+		for _, col := range columns {
+			buf.WriteByte(',')
+
+			if err := m.writeField(&buf, m.columnName(g.name, col), g.data[col]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// columnName returns the name of the column of the group; the group keeps the same-named new and old columns apart.
+func (m FlatJSONMarshaler) columnName(group, column string) string {
+	if m.Collision == config.FlattenCollisionSuffix {
+		return column + "_" + group
+	}
+
+	return group + "_" + column
+}
+
+func (m FlatJSONMarshaler) writeField(buf *bytes.Buffer, name string, value any) error {
+	if t, ok := value.(time.Time); ok && m.EpochMillis {
+		value = t.UnixMilli()
+	}
+
+	key, err := marshalJSON(name, m.DisableHTMLEscape)
+	if err != nil {
+		return fmt.Errorf("marshal field name: %w", err)
+	}
+
+	val, err := marshalJSON(value, m.DisableHTMLEscape)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", name, err)
+	}
+
+	buf.Write(key)
+	buf.WriteByte(':')
+	buf.Write(val)
+
+	return nil
+}
+
+// ContentType returns JSON MIME type.
+func (FlatJSONMarshaler) ContentType() string {
+	return "application/json"
+}
+
+// ContentEncoding returns empty encoding, flat JSON is not compressed.
+func (FlatJSONMarshaler) ContentEncoding() string {
+	return ""
+}
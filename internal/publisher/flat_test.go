@@ -0,0 +1,105 @@
+package publisher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestFlatJSONMarshaler_Marshal(t *testing.T) {
+	event := &Event{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Schema:    "public",
+		Table:     "users",
+		Action:    "UPDATE",
+		Data:      map[string]any{"name": "new", "id": 1},
+		DataOld:   map[string]any{"name": "old", "id": 1},
+		EventTime: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	const head = `{"id":"00000000-0000-0000-0000-000000000001","schema":"public","table":"users",` +
+		`"action":"UPDATE","commitTime":"2024-05-01T00:00:00Z",`
+
+	tests := []struct {
+		name  string
+		order config.FlattenOrder
+		want  string
+	}{
+		{
+			name: "default",
+			want: head + `"new_id":1,"new_name":"new","old_id":1,"old_name":"old"}`,
+		},
+		{
+			name:  "new then old",
+			order: config.FlattenNewFirst,
+			want:  head + `"new_id":1,"new_name":"new","old_id":1,"old_name":"old"}`,
+		},
+		{
+			name:  "old then new",
+			order: config.FlattenOldFirst,
+			want:  head + `"old_id":1,"old_name":"old","new_id":1,"new_name":"new"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FlatJSONMarshaler{Order: tt.order}.Marshal(event)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestFlatJSONMarshaler_Marshal_Collision(t *testing.T) {
+	event := &Event{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Schema:    "public",
+		Table:     "orders",
+		Action:    "UPDATE",
+		Data:      map[string]any{"status": "paid"},
+		DataOld:   map[string]any{"status": "new", "note": "x"},
+		EventTime: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	const head = `{"id":"00000000-0000-0000-0000-000000000001","schema":"public","table":"orders",` +
+		`"action":"UPDATE","commitTime":"2024-05-01T00:00:00Z",`
+
+	tests := []struct {
+		name      string
+		collision config.FlattenCollision
+		want      string
+	}{
+		{
+			name: "default",
+			want: head + `"new_status":"paid","old_note":"x","old_status":"new"}`,
+		},
+		{
+			name:      "prefix",
+			collision: config.FlattenCollisionPrefix,
+			want:      head + `"new_status":"paid","old_note":"x","old_status":"new"}`,
+		},
+		{
+			name:      "suffix",
+			collision: config.FlattenCollisionSuffix,
+			want:      head + `"status_new":"paid","note_old":"x","status_old":"new"}`,
+		},
+		{
+			name:      "drop",
+			collision: config.FlattenCollisionDrop,
+			want:      head + `"new_status":"paid","old_note":"x"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FlatJSONMarshaler{Collision: tt.collision}.Marshal(event)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -4,32 +4,185 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/IBM/sarama"
 	"github.com/goccy/go-json"
+	"github.com/xdg-go/scram"
 
 	"github.com/ihippik/wal-listener/v2/internal/config"
 )
 
 // KafkaPublisher represent event publisher with Kafka broker.
 type KafkaPublisher struct {
-	producer sarama.SyncProducer
+	producer  sarama.SyncProducer
+	marshaler Marshaler
 }
 
 // NewKafkaPublisher return new KafkaPublisher instance.
-func NewKafkaPublisher(producer sarama.SyncProducer) *KafkaPublisher {
-	return &KafkaPublisher{producer: producer}
+func NewKafkaPublisher(producer sarama.SyncProducer, marshaler Marshaler) *KafkaPublisher {
+	return &KafkaPublisher{producer: producer, marshaler: marshaler}
 }
 
 func (p *KafkaPublisher) Publish(_ context.Context, topic string, event *Event) error {
-	data, err := json.Marshal(event)
+	if event.Tombstone {
+		return p.publishTombstone(topic, event)
+	}
+
+	msg, err := p.producerMessage(topic, event)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err = p.producer.SendMessage(msg); err != nil {
+		return sendError(fmt.Errorf("send message: %w", err))
+	}
+
+	return nil
+}
+
+// PublishBatch sends the messages in one round trip. If some of them are not delivered,
+// the error is a *BatchError with the failed messages, the others are delivered.
+func (p *KafkaPublisher) PublishBatch(_ context.Context, messages []Message) error {
+	msgs := make([]*sarama.ProducerMessage, 0, len(messages))
+
+	for _, m := range messages {
+		msg, err := p.producerMessage(m.Topic, m.Event)
+		if err != nil {
+			return fmt.Errorf("topic %s: %w", m.Topic, err)
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	err := p.producer.SendMessages(msgs)
+
+	var producerErrs sarama.ProducerErrors
+	if errors.As(err, &producerErrs) {
+		failed := make([]FailedMessage, 0, len(producerErrs))
+
+		for _, perr := range producerErrs {
+			event, _ := perr.Msg.Metadata.(*Event)
+			failed = append(failed, FailedMessage{Message: Message{Topic: perr.Msg.Topic, Event: event}, Err: sendError(perr.Err)})
+		}
+
+		return &BatchError{Failed: failed, Total: len(msgs)}
+	}
+
+	if err != nil {
+		return fmt.Errorf("send messages: %w", err)
+	}
+
+	return nil
+}
+
+// producerMessage serializes the event into the Kafka message with the encoding headers.
+func (p *KafkaPublisher) producerMessage(topic string, event *Event) (*sarama.ProducerMessage, error) {
+	if event.Tombstone {
+		return tombstoneMessage(topic, event), nil
+	}
+
+	marshaler := eventMarshaler(event, p.marshaler)
+
+	data, err := marshalEvent(marshaler, topic, event)
+	if errors.Is(err, errSchemaRegistry) {
+		return nil, fmt.Errorf("marshal: %w", err)
+	} else if err != nil {
+		return nil, Permanent(fmt.Errorf("marshal: %w", err))
+	}
+
+	msg := prepareMessage(topic, event.Key, data)
+	msg.Metadata = event
+	msg.Headers = recordHeaders(marshaler.ContentEncoding(), event)
+
+	return msg, nil
+}
+
+// recordHeaders returns the headers of the event message: the encoding, the schema fingerprint
+// and the event headers not set by the publisher.
+func recordHeaders(encoding string, event *Event) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+
+	set := func(key, value string) {
+		if value == "" || slices.ContainsFunc(headers, func(h sarama.RecordHeader) bool { return string(h.Key) == key }) {
+			return
+		}
+
+		headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+
+	set(headerContentEncoding, encoding)
+	set(headerSchemaFingerprint, event.SchemaFingerprint)
+
+	for _, key := range slices.Sorted(maps.Keys(event.Headers)) {
+		set(key, event.Headers[key])
+	}
+
+	return headers
+}
+
+// publishTombstone sends the message without a value, compaction removes the earlier messages of the key.
+func (p *KafkaPublisher) publishTombstone(topic string, event *Event) error {
+	if _, _, err := p.producer.SendMessage(tombstoneMessage(topic, event)); err != nil {
+		return sendError(fmt.Errorf("send tombstone: %w", err))
+	}
+
+	return nil
+}
+
+// rejectedErrors are the errors of the messages the broker rejects on every attempt.
+var rejectedErrors = []error{
+	sarama.ErrMessageSizeTooLarge,
+	sarama.ErrMessageSetSizeTooLarge,
+	sarama.ErrInvalidMessage,
+	sarama.ErrInvalidRecord,
+	sarama.ErrInvalidTopic,
+}
+
+// sendError marks the error of the rejected message as permanent, like the message larger than
+// the producer MaxMessageBytes, that the producer rejects with a configuration error.
+func sendError(err error) error {
+	var cfgErr sarama.ConfigurationError
+	if errors.As(err, &cfgErr) || slices.ContainsFunc(rejectedErrors, func(target error) bool {
+		return errors.Is(err, target)
+	}) {
+		return Permanent(err)
+	}
+
+	return err
+}
+
+// tombstoneMessage returns the message of the event key without a value.
+func tombstoneMessage(topic string, event *Event) *sarama.ProducerMessage {
+	msg := prepareMessage(topic, event.Key, nil)
+	msg.Value = nil
+	msg.Metadata = event
+
+	return msg
+}
+
+// PublishDeadLetter sends the dead-letter record to the topic as JSON, the format read by the replay.
+func (p *KafkaPublisher) PublishDeadLetter(_ context.Context, topic string, dl *DeadLetter) error {
+	data, err := json.Marshal(dl)
 	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
+		return Permanent(fmt.Errorf("marshal: %w", err))
+	}
+
+	msg := prepareMessage(topic, dl.Key, data)
+
+	// the record is partitioned like the original message, its headers are kept for the replay.
+	if dl.Event != nil {
+		msg.Metadata = dl.Event
+		msg.Headers = recordHeaders("", dl.Event)
 	}
 
-	if _, _, err = p.producer.SendMessage(prepareMessage(topic, data)); err != nil {
+	if _, _, err = p.producer.SendMessage(msg); err != nil {
 		return fmt.Errorf("send message: %w", err)
 	}
 
@@ -43,11 +196,119 @@ func (p *KafkaPublisher) Close() error {
 
 // NewProducer return new Kafka producer instance.
 func NewProducer(pCfg *config.PublisherCfg) (sarama.SyncProducer, error) {
-	cfg := sarama.NewConfig()
-	cfg.Producer.Partitioner = sarama.NewRandomPartitioner
+	cfg, err := newProducerConfig(pCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducer([]string{pCfg.Address}, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new sync producer: %w", err)
+	}
+
+	return producer, nil
+}
+
+// saramaCodecs maps the producer compression codecs, none when empty.
+var saramaCodecs = map[config.KafkaCodec]sarama.CompressionCodec{
+	"":                      sarama.CompressionNone,
+	config.KafkaCodecNone:   sarama.CompressionNone,
+	config.KafkaCodecGzip:   sarama.CompressionGZIP,
+	config.KafkaCodecSnappy: sarama.CompressionSnappy,
+	config.KafkaCodecLZ4:    sarama.CompressionLZ4,
+	config.KafkaCodecZstd:   sarama.CompressionZSTD,
+}
+
+// newProducerConfig returns the Kafka client config with the producer settings.
+func newProducerConfig(pCfg *config.PublisherCfg) (*sarama.Config, error) {
+	cfg, err := newSaramaConfig(pCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// messages with the same key land in the same partition, messages without a key are distributed randomly.
+	cfg.Producer.Partitioner = sarama.NewHashPartitioner
+
+	if pCfg.Partitioner != "" {
+		if cfg.Producer.Partitioner, err = newSaramaPartitioner(pCfg.Partitioner); err != nil {
+			return nil, err
+		}
+	}
+
+	codec, ok := saramaCodecs[pCfg.ProducerCompression.Codec]
+	if !ok {
+		return nil, fmt.Errorf("unknown producer compression codec: %s", pCfg.ProducerCompression.Codec)
+	}
+
+	cfg.Producer.Compression = codec
+
+	if pCfg.ProducerCompression.Level != 0 {
+		cfg.Producer.CompressionLevel = pCfg.ProducerCompression.Level
+	}
+
 	cfg.Producer.RequiredAcks = sarama.WaitForAll
 	cfg.Producer.Return.Successes = true
 
+	return cfg, nil
+}
+
+// KafkaTopicChecker checks that topics exist in the Kafka cluster.
+type KafkaTopicChecker struct {
+	client sarama.Client
+}
+
+// NewKafkaTopicChecker return new KafkaTopicChecker instance.
+func NewKafkaTopicChecker(pCfg *config.PublisherCfg) (*KafkaTopicChecker, error) {
+	cfg, err := newSaramaConfig(pCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient([]string{pCfg.Address}, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new client: %w", err)
+	}
+
+	return &KafkaTopicChecker{client: client}, nil
+}
+
+// CheckTopics returns an error listing the topics missing in the cluster metadata.
+func (c *KafkaTopicChecker) CheckTopics(_ context.Context, topics []string) error {
+	if err := c.client.RefreshMetadata(); err != nil {
+		return fmt.Errorf("refresh metadata: %w", err)
+	}
+
+	existing, err := c.client.Topics()
+	if err != nil {
+		return fmt.Errorf("topics: %w", err)
+	}
+
+	var missing []string
+
+	for _, topic := range topics {
+		if !slices.Contains(existing, topic) {
+			missing = append(missing, topic)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("unknown topics: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Close closes the client.
+func (c *KafkaTopicChecker) Close() error {
+	return c.client.Close()
+}
+
+// newSaramaConfig returns Kafka client config shared by producers and consumers.
+func newSaramaConfig(pCfg *config.PublisherCfg) (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	cfg.ClientID = kafkaClientID(pCfg.ClientID, os.Getenv, os.Hostname)
+	cfg.RackID = pCfg.RackID
+
 	if pCfg.EnableTLS {
 		tlsCfg, err := newTLSCfg(pCfg.ClientCert, pCfg.ClientKey, pCfg.CACert)
 		if err != nil {
@@ -58,21 +319,88 @@ func NewProducer(pCfg *config.PublisherCfg) (sarama.SyncProducer, error) {
 		cfg.Net.TLS.Config = tlsCfg
 	}
 
-	producer, err := sarama.NewSyncProducer([]string{pCfg.Address}, cfg)
+	if pCfg.SASL.Mechanism != "" {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.Mechanism = sarama.SASLMechanism(pCfg.SASL.Mechanism)
+		cfg.Net.SASL.User = pCfg.SASL.Username
+		cfg.Net.SASL.Password = pCfg.SASL.Password
+
+		switch pCfg.SASL.Mechanism {
+		case config.SASLScramSHA256:
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.SHA256} }
+		case config.SASLScramSHA512:
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.SHA512} }
+		}
+	}
+
+	return cfg, nil
+}
+
+// scramClient the SCRAM conversation of the SASL authentication, implements sarama.SCRAMClient.
+type scramClient struct {
+	hash scram.HashGeneratorFcn
+	conv *scram.ClientConversation
+}
+
+// Begin starts the conversation.
+func (c *scramClient) Begin(username, password, authzID string) error {
+	client, err := c.hash.NewClient(username, password, authzID)
 	if err != nil {
-		return nil, fmt.Errorf("new sync producer: %w", err)
+		return err
 	}
 
-	return producer, nil
+	c.conv = client.NewConversation()
+
+	return nil
+}
+
+// Step returns the response to the server challenge.
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conv.Step(challenge)
+}
+
+// Done reports whether the conversation is completed.
+func (c *scramClient) Done() bool {
+	return c.conv.Done()
+}
+
+// defaultClientIDPrefix is prepended to the host name in the default Kafka client ID.
+const defaultClientIDPrefix = "wal-listener-"
+
+// invalidClientIDChars are the characters rejected by the brokers before Kafka 1.0.
+var invalidClientIDChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// kafkaClientID returns the configured client ID or the one derived from the pod or host name.
+func kafkaClientID(clientID string, getenv func(string) string, hostname func() (string, error)) string {
+	if clientID != "" {
+		return clientID
+	}
+
+	host := getenv(envPodName)
+	if host == "" {
+		host, _ = hostname()
+	}
+
+	if host == "" {
+		return strings.TrimSuffix(defaultClientIDPrefix, "-")
+	}
+
+	return defaultClientIDPrefix + invalidClientIDChars.ReplaceAllString(host, "-")
 }
 
 // prepareMessage prepare message for Kafka producer.
-func prepareMessage(topic string, data []byte) *sarama.ProducerMessage {
-	return &sarama.ProducerMessage{
+func prepareMessage(topic, key string, data []byte) *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
 		Topic:     topic,
 		Partition: -1,
 		Value:     sarama.ByteEncoder(data),
 	}
+
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+
+	return msg
 }
 
 func newTLSCfg(certFile, keyFile, caCert string) (*tls.Config, error) {
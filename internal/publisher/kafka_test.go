@@ -0,0 +1,438 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xdg-go/scram"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestKafkaPublisher_Publish_Encoding(t *testing.T) {
+	event := &Event{Schema: "public", Table: "users", Action: "INSERT", Data: map[string]any{"id": int64(1)}, Key: "1"}
+
+	m, err := NewMarshaler(config.FormatMsgPack, config.CompressionGzip)
+	require.NoError(t, err)
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if len(msg.Headers) != 1 || string(msg.Headers[0].Key) != "Content-Encoding" ||
+			string(msg.Headers[0].Value) != "gzip" {
+			return errors.New("content encoding header is missing")
+		}
+
+		value, err := msg.Value.Encode()
+		if err != nil {
+			return err
+		}
+
+		data, err := gunzip(value)
+		if err != nil {
+			return err
+		}
+
+		var got Event
+
+		if err := (MsgPackMarshaler{}).Unmarshal(data, &got); err != nil {
+			return err
+		}
+
+		if got.Table != "users" || got.Data["id"] != int64(1) {
+			return errors.New("unexpected event")
+		}
+
+		return nil
+	})
+
+	p := NewKafkaPublisher(producer, m)
+
+	assert.NoError(t, p.Publish(context.Background(), "wal.public_users", event))
+	assert.NoError(t, p.Close())
+}
+
+func TestKafkaPublisher_Publish_EventMarshaler(t *testing.T) {
+	event := &Event{Schema: "public", Table: "users", Action: "INSERT", Marshaler: MsgPackMarshaler{}}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		value, err := msg.Value.Encode()
+		if err != nil {
+			return err
+		}
+
+		var got Event
+
+		if err := (MsgPackMarshaler{}).Unmarshal(value, &got); err != nil {
+			return fmt.Errorf("destination format is not used: %w", err)
+		}
+
+		return nil
+	})
+
+	p := NewKafkaPublisher(producer, JSONMarshaler{})
+
+	assert.NoError(t, p.Publish(context.Background(), "wal.public_users", event))
+	assert.NoError(t, p.Close())
+}
+
+func TestKafkaPublisher_Publish_Numeric(t *testing.T) {
+	const amount = "12345678901234567.8901"
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		value, err := msg.Value.Encode()
+		if err != nil {
+			return err
+		}
+
+		if !strings.Contains(string(value), `"amount":"`+amount+`"`) {
+			return fmt.Errorf("numeric value was reformatted: %s", value)
+		}
+
+		return nil
+	})
+
+	p := NewKafkaPublisher(producer, JSONMarshaler{})
+	event := &Event{Table: "payments", Action: "INSERT", Data: map[string]any{"amount": amount}}
+
+	assert.NoError(t, p.Publish(context.Background(), "wal.public_payments", event))
+	assert.NoError(t, p.Close())
+}
+
+func TestKafkaPublisher_Publish_Tombstone(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Value != nil {
+			return errors.New("tombstone has a value")
+		}
+
+		if key, _ := msg.Key.Encode(); string(key) != "7" {
+			return errors.New("unexpected key")
+		}
+
+		return nil
+	})
+
+	p := NewKafkaPublisher(producer, JSONMarshaler{})
+	event := &Event{Table: "orders", Action: "DELETE", Key: "7", Tombstone: true}
+
+	assert.NoError(t, p.Publish(context.Background(), "wal.public_orders", event))
+	assert.NoError(t, p.Close())
+}
+
+func TestKafkaPublisher_PublishBatch(t *testing.T) {
+	messages := []Message{
+		{Topic: "wal.public_users", Event: &Event{Table: "users", Action: "INSERT", Key: "1"}},
+		{Topic: "wal.public_orders", Event: &Event{Table: "orders", Action: "DELETE", Key: "7", Tombstone: true}},
+		{Topic: "wal.public_users", Event: &Event{Table: "users", Action: "UPDATE", Key: "1"}},
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		producer := mocks.NewSyncProducer(t, nil)
+		producer.ExpectSendMessageAndSucceed()
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			if msg.Value != nil {
+				return errors.New("tombstone has a value")
+			}
+
+			return nil
+		})
+		producer.ExpectSendMessageAndSucceed()
+
+		p := NewKafkaPublisher(producer, JSONMarshaler{})
+
+		assert.NoError(t, p.PublishBatch(context.Background(), messages))
+		assert.NoError(t, p.Close())
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		producer := &failingBatchProducer{
+			SyncProducer: mocks.NewSyncProducer(t, nil),
+			errs:         map[int]error{2: sarama.ErrNotLeaderForPartition},
+		}
+
+		p := NewKafkaPublisher(producer, JSONMarshaler{})
+
+		err := p.PublishBatch(context.Background(), messages)
+
+		var batchErr *BatchError
+		require.ErrorAs(t, err, &batchErr)
+		require.Len(t, batchErr.Failed, 1)
+		assert.Equal(t, messages[2], batchErr.Failed[0].Message)
+		assert.ErrorIs(t, err, sarama.ErrNotLeaderForPartition)
+		assert.EqualError(t, err, "1 of 3 messages failed: "+sarama.ErrNotLeaderForPartition.Error())
+		assert.False(t, IsPermanent(err))
+		assert.NoError(t, p.Close())
+	})
+
+	t.Run("rejected message", func(t *testing.T) {
+		producer := &failingBatchProducer{
+			SyncProducer: mocks.NewSyncProducer(t, nil),
+			errs:         map[int]error{0: sarama.ErrMessageSizeTooLarge, 2: sarama.ErrNotLeaderForPartition},
+		}
+
+		p := NewKafkaPublisher(producer, JSONMarshaler{})
+
+		err := p.PublishBatch(context.Background(), messages)
+
+		var batchErr *BatchError
+		require.ErrorAs(t, err, &batchErr)
+		require.Len(t, batchErr.Failed, 2)
+		assert.True(t, IsPermanent(batchErr.Failed[0].Err), "fails again on retry")
+		assert.False(t, IsPermanent(err), "the other failed message is retried")
+
+		producer.errs = map[int]error{0: sarama.ErrMessageSizeTooLarge}
+		assert.True(t, IsPermanent(p.PublishBatch(context.Background(), messages)))
+		assert.NoError(t, p.Close())
+	})
+}
+
+// failingBatchProducer fails the batch messages at the indexes like the sarama producer, the mock returns plain errors.
+type failingBatchProducer struct {
+	sarama.SyncProducer
+	errs map[int]error
+}
+
+func (p *failingBatchProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+
+	for i, msg := range msgs {
+		if err := p.errs[i]; err != nil {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func TestKafkaPublisher_PublishDeadLetter(t *testing.T) {
+	dl := &DeadLetter{
+		Event: &Event{Table: "users", Action: "INSERT", Headers: map[string]string{"Trace-Id": "abc"}},
+		Topic: "wal.public_users",
+		Key:   "1",
+		Error: "missing required columns: email",
+	}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "wal.dlq" {
+			return errors.New("unexpected topic")
+		}
+
+		if len(msg.Headers) != 1 || string(msg.Headers[0].Key) != "Trace-Id" {
+			return errors.New("original headers are missing")
+		}
+
+		if msg.Metadata != dl.Event {
+			return errors.New("event is missing for the partitioner")
+		}
+
+		value, err := msg.Value.Encode()
+		if err != nil {
+			return err
+		}
+
+		var got DeadLetter
+
+		if err := json.Unmarshal(value, &got); err != nil {
+			return err
+		}
+
+		if got.Topic != dl.Topic || got.Error != dl.Error || got.Event.Table != "users" {
+			return errors.New("unexpected dead letter")
+		}
+
+		return nil
+	})
+
+	p := NewKafkaPublisher(producer, nil)
+
+	assert.NoError(t, p.PublishDeadLetter(context.Background(), "wal.dlq", dl))
+	assert.NoError(t, p.Close())
+}
+
+func TestKafkaPublisher_Publish_Headers(t *testing.T) {
+	event := &Event{
+		Schema:  "public",
+		Table:   "users",
+		Action:  "INSERT",
+		Headers: map[string]string{"Trace-Id": "abc", "Content-Encoding": "zstd"},
+	}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		headers := make(map[string]string)
+
+		for _, h := range msg.Headers {
+			headers[string(h.Key)] = string(h.Value)
+		}
+
+		if len(msg.Headers) != 2 || headers["Content-Encoding"] != "gzip" || headers["Trace-Id"] != "abc" {
+			return fmt.Errorf("unexpected headers: %v", headers)
+		}
+
+		return nil
+	})
+
+	m, err := NewMarshaler(config.FormatJSON, config.CompressionGzip)
+	require.NoError(t, err)
+
+	require.NoError(t, NewKafkaPublisher(producer, m).Publish(context.Background(), "wal.users", event))
+	require.NoError(t, producer.Close())
+}
+
+func TestKafkaTopicChecker_CheckTopics(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("wal.billing", 0, broker.BrokerID()),
+	})
+
+	checker, err := NewKafkaTopicChecker(&config.PublisherCfg{Address: broker.Addr()})
+	require.NoError(t, err)
+
+	defer checker.Close()
+
+	assert.NoError(t, checker.CheckTopics(context.Background(), []string{"wal.billing"}))
+	assert.EqualError(
+		t,
+		checker.CheckTopics(context.Background(), []string{"wal.billing", "wal.missing"}),
+		"unknown topics: wal.missing",
+	)
+}
+
+func TestKafkaPublisher_Publish_SchemaFingerprint(t *testing.T) {
+	event := &Event{Schema: "public", Table: "users", Action: "INSERT", SchemaFingerprint: "3f2a9c0d1e4b5a67"}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if len(msg.Headers) != 1 || string(msg.Headers[0].Key) != "Schema-Fingerprint" ||
+			string(msg.Headers[0].Value) != "3f2a9c0d1e4b5a67" {
+			return errors.New("schema fingerprint header is missing")
+		}
+
+		return nil
+	})
+
+	require.NoError(t, NewKafkaPublisher(producer, JSONMarshaler{}).Publish(context.Background(), "wal.users", event))
+	require.NoError(t, producer.Close())
+}
+
+func TestNewSaramaConfig_ClientID(t *testing.T) {
+	cfg, err := newSaramaConfig(&config.PublisherCfg{ClientID: "orders-listener", RackID: "eu-west-1a"})
+	require.NoError(t, err)
+	assert.Equal(t, "orders-listener", cfg.ClientID)
+	assert.Equal(t, "eu-west-1a", cfg.RackID)
+	require.NoError(t, cfg.Validate())
+
+	getenv := func(pod string) func(string) string {
+		return func(string) string { return pod }
+	}
+	hostname := func() (string, error) { return "db-host.local", nil }
+
+	assert.Equal(t, "wal-listener-db-host.local", kafkaClientID("", getenv(""), hostname))
+	assert.Equal(t, "wal-listener-orders-7d9f-x", kafkaClientID("", getenv("orders-7d9f:x"), hostname))
+	assert.Equal(t, "wal-listener", kafkaClientID("", getenv(""), func() (string, error) {
+		return "", errors.New("no host name")
+	}))
+}
+
+func TestNewSaramaConfig_SASL(t *testing.T) {
+	for _, mechanism := range []config.SASLMechanism{config.SASLPlain, config.SASLScramSHA256, config.SASLScramSHA512} {
+		cfg, err := newSaramaConfig(&config.PublisherCfg{
+			SASL: config.SASLCfg{Mechanism: mechanism, Username: "listener", Password: "secret"},
+		})
+		require.NoError(t, err)
+		assert.True(t, cfg.Net.SASL.Enable)
+		assert.Equal(t, sarama.SASLMechanism(mechanism), cfg.Net.SASL.Mechanism)
+		assert.Equal(t, mechanism != config.SASLPlain, cfg.Net.SASL.SCRAMClientGeneratorFunc != nil, mechanism)
+		require.NoError(t, cfg.Validate(), mechanism)
+	}
+
+	cfg, err := newSaramaConfig(&config.PublisherCfg{})
+	require.NoError(t, err)
+	assert.False(t, cfg.Net.SASL.Enable)
+}
+
+func TestNewProducerConfig_Compression(t *testing.T) {
+	tests := []struct {
+		codec config.KafkaCodec
+		want  sarama.CompressionCodec
+	}{
+		{codec: "", want: sarama.CompressionNone},
+		{codec: config.KafkaCodecNone, want: sarama.CompressionNone},
+		{codec: config.KafkaCodecGzip, want: sarama.CompressionGZIP},
+		{codec: config.KafkaCodecSnappy, want: sarama.CompressionSnappy},
+		{codec: config.KafkaCodecLZ4, want: sarama.CompressionLZ4},
+		{codec: config.KafkaCodecZstd, want: sarama.CompressionZSTD},
+	}
+
+	for _, tt := range tests {
+		cfg, err := newProducerConfig(&config.PublisherCfg{
+			ProducerCompression: config.ProducerCompressionCfg{Codec: tt.codec},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, cfg.Producer.Compression, tt.codec)
+		assert.Equal(t, sarama.CompressionLevelDefault, cfg.Producer.CompressionLevel, tt.codec)
+		require.NoError(t, cfg.Validate(), tt.codec)
+	}
+
+	cfg, err := newProducerConfig(&config.PublisherCfg{
+		ProducerCompression: config.ProducerCompressionCfg{Codec: config.KafkaCodecGzip, Level: 9},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 9, cfg.Producer.CompressionLevel)
+
+	_, err = newProducerConfig(&config.PublisherCfg{
+		ProducerCompression: config.ProducerCompressionCfg{Codec: "brotli"},
+	})
+	require.EqualError(t, err, "unknown producer compression codec: brotli")
+}
+
+func TestScramClient(t *testing.T) {
+	kf := scram.KeyFactors{Salt: "salt", Iters: 4096}
+
+	serverClient, err := scram.SHA512.NewClient("listener", "secret", "")
+	require.NoError(t, err)
+
+	stored := serverClient.GetStoredCredentials(kf)
+
+	server, err := scram.SHA512.NewServer(func(string) (scram.StoredCredentials, error) { return stored, nil })
+	require.NoError(t, err)
+
+	conv := server.NewConversation()
+	client := &scramClient{hash: scram.SHA512}
+	require.NoError(t, client.Begin("listener", "secret", ""))
+
+	var challenge string
+
+	for !client.Done() {
+		response, err := client.Step(challenge)
+		require.NoError(t, err)
+
+		if client.Done() {
+			break
+		}
+
+		challenge, err = conv.Step(response)
+		require.NoError(t, err)
+	}
+
+	assert.True(t, conv.Valid(), "authenticated by the server")
+}
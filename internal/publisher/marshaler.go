@@ -0,0 +1,331 @@
+package publisher
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// Marshaler serializes events before they are sent to the broker.
+type Marshaler interface {
+	Marshal(event *Event) ([]byte, error)
+	ContentType() string
+	// ContentEncoding returns the payload compression, empty for uncompressed payloads.
+	ContentEncoding() string
+}
+
+// eventMarshaler returns the marshaler of the event destination, the publisher marshaler by default.
+func eventMarshaler(event *Event, m Marshaler) Marshaler {
+	if event.Marshaler != nil {
+		return event.Marshaler
+	}
+
+	return m
+}
+
+// NewMarshaler returns the marshaler for the configured format and compression.
+func NewMarshaler(format config.FormatType, compression config.CompressionType) (Marshaler, error) {
+	return NewPublisherMarshaler(&config.PublisherCfg{Format: format, Compression: compression})
+}
+
+// NewPublisherMarshaler returns the marshaler for the format settings of the publisher.
+func NewPublisherMarshaler(pCfg *config.PublisherCfg) (Marshaler, error) {
+	var m Marshaler
+
+	switch pCfg.Format {
+	case "", config.FormatJSON:
+		m = JSONMarshaler{
+			DisableHTMLEscape: pCfg.DisableHTMLEscape,
+			EpochMillis:       pCfg.TimeFormat == config.TimeFormatEpochMillis,
+		}
+	case config.FormatMsgPack:
+		m = MsgPackMarshaler{}
+	case config.FormatFlat:
+		m = FlatJSONMarshaler{
+			Order:             pCfg.Flatten.Order,
+			Collision:         pCfg.Flatten.Collision,
+			DisableHTMLEscape: pCfg.DisableHTMLEscape,
+			EpochMillis:       pCfg.TimeFormat == config.TimeFormatEpochMillis,
+		}
+	case config.FormatCloudEvents:
+		m = CloudEventsMarshaler{
+			Source:            pCfg.CloudEvents.Source,
+			TypePrefix:        pCfg.CloudEvents.TypePrefix,
+			DisableHTMLEscape: pCfg.DisableHTMLEscape,
+			EpochMillis:       pCfg.TimeFormat == config.TimeFormatEpochMillis,
+		}
+	case config.FormatDebezium:
+		m = DebeziumMarshaler{
+			Name:              pCfg.Debezium.Name,
+			Database:          pCfg.Debezium.Database,
+			DisableHTMLEscape: pCfg.DisableHTMLEscape,
+			EpochMillis:       pCfg.TimeFormat == config.TimeFormatEpochMillis,
+		}
+	case config.FormatAvro:
+		m = NewAvroMarshaler(NewSchemaRegistry(pCfg.SchemaRegistry))
+	default:
+		return nil, fmt.Errorf("unknown format: %s", pCfg.Format)
+	}
+
+	return newCompressedMarshaler(m, pCfg.Compression)
+}
+
+// JSONMarshaler serializes events as JSON.
+type JSONMarshaler struct {
+	DisableHTMLEscape bool // string values are written verbatim
+	EpochMillis       bool // time values are written as milliseconds since the Unix epoch
+}
+
+// Marshal event to JSON.
+func (m JSONMarshaler) Marshal(event *Event) ([]byte, error) {
+	switch ordered := len(event.ColumnOrder) > 0; {
+	case ordered && m.EpochMillis:
+		millis := newMillisEvent(event)
+
+		return marshalJSON(orderedMillisEvent{
+			Event:      event,
+			Action:     millis.Action,
+			Data:       m.orderedColumns(event.ColumnOrder, millis.Data),
+			DataOld:    m.orderedColumns(event.ColumnOrder, millis.DataOld),
+			EventTime:  millis.EventTime,
+			Enrichment: millis.Enrichment,
+		}, m.DisableHTMLEscape)
+	case ordered:
+		return marshalJSON(orderedEvent{
+			Event:   event,
+			Action:  event.action(),
+			Data:    m.orderedColumns(event.ColumnOrder, event.Data),
+			DataOld: m.orderedColumns(event.ColumnOrder, event.DataOld),
+		}, m.DisableHTMLEscape)
+	case m.EpochMillis:
+		return marshalJSON(newMillisEvent(event), m.DisableHTMLEscape)
+	case event.opInstead():
+		return marshalJSON(opEvent{Event: event}, m.DisableHTMLEscape)
+	default:
+		return marshalJSON(event, m.DisableHTMLEscape)
+	}
+}
+
+func (m JSONMarshaler) orderedColumns(order []string, values map[string]any) orderedColumns {
+	return orderedColumns{order: order, values: values, disableHTMLEscape: m.DisableHTMLEscape}
+}
+
+// opEvent leaves out the action of the event published with the op instead of it.
+type opEvent struct {
+	*Event
+	Action *string `json:"action,omitempty"`
+}
+
+// orderedEvent shadows the data of the event with the columns in the table order.
+type orderedEvent struct {
+	*Event
+	Action  *string        `json:"action,omitempty"` // left out when published with the op instead
+	Data    orderedColumns `json:"data"`
+	DataOld orderedColumns `json:"dataOld"`
+}
+
+// orderedMillisEvent is the orderedEvent with epoch milliseconds. The fields of the millisEvent are repeated
+// rather than embedded, as the encoder drops the fields shadowed at more than one level.
+type orderedMillisEvent struct {
+	*Event
+	Action     *string        `json:"action,omitempty"`
+	Data       orderedColumns `json:"data"`
+	DataOld    orderedColumns `json:"dataOld"`
+	EventTime  int64          `json:"commitTime"`
+	Enrichment map[string]any `json:"enrichment,omitempty"`
+}
+
+// orderedColumns writes the column values as a JSON object in the given order.
+// The columns missing from the order follow alphabetically, nil values are null like the maps.
+type orderedColumns struct {
+	order             []string
+	values            map[string]any
+	disableHTMLEscape bool
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c orderedColumns) MarshalJSON() ([]byte, error) {
+	if c.values == nil {
+		return []byte("null"), nil
+	}
+
+	names := make([]string, 0, len(c.values))
+
+	for _, name := range c.order {
+		if _, ok := c.values[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) < len(c.values) {
+		for _, name := range slices.Sorted(maps.Keys(c.values)) {
+			if !slices.Contains(c.order, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := marshalJSON(name, c.disableHTMLEscape)
+		if err != nil {
+			return nil, err
+		}
+
+		val, err := marshalJSON(c.values[name], c.disableHTMLEscape)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// millisEvent shadows the time fields of the event with epoch milliseconds.
+type millisEvent struct {
+	*Event
+	Action     *string        `json:"action,omitempty"` // left out when published with the op instead
+	Data       map[string]any `json:"data"`
+	DataOld    map[string]any `json:"dataOld"`
+	EventTime  int64          `json:"commitTime"`
+	Enrichment map[string]any `json:"enrichment,omitempty"`
+}
+
+func newMillisEvent(event *Event) millisEvent {
+	return millisEvent{
+		Event:      event,
+		Action:     event.action(),
+		Data:       millisValues(event.Data),
+		DataOld:    millisValues(event.DataOld),
+		EventTime:  event.EventTime.UnixMilli(),
+		Enrichment: millisValues(event.Enrichment),
+	}
+}
+
+// millisValues returns the values with the time values replaced by epoch milliseconds.
+// The map is copied only if it holds time values, the event data stays untouched.
+func millisValues(values map[string]any) map[string]any {
+	converted := values
+	cloned := false
+
+	for k, v := range values {
+		t, ok := v.(time.Time)
+		if !ok {
+			continue
+		}
+
+		if !cloned {
+			converted = maps.Clone(values)
+			cloned = true
+		}
+
+		converted[k] = t.UnixMilli()
+	}
+
+	return converted
+}
+
+// marshalJSON encodes the value, HTML characters in strings are escaped unless disabled.
+func marshalJSON(v any, disableHTMLEscape bool) ([]byte, error) {
+	if disableHTMLEscape {
+		return json.MarshalWithOption(v, json.DisableHTMLEscape())
+	}
+
+	return json.Marshal(v)
+}
+
+// ContentType returns JSON MIME type.
+func (JSONMarshaler) ContentType() string {
+	return "application/json"
+}
+
+// ContentEncoding returns empty encoding, JSON is not compressed.
+func (JSONMarshaler) ContentEncoding() string {
+	return ""
+}
+
+// structTagJSON makes MessagePack use the JSON field names, so both formats share the event shape.
+const structTagJSON = "json"
+
+func init() {
+	// UUIDs are encoded as strings, the same way as in JSON.
+	msgpack.Register(
+		uuid.UUID{},
+		func(enc *msgpack.Encoder, v reflect.Value) error {
+			return enc.EncodeString(v.Interface().(uuid.UUID).String())
+		},
+		func(dec *msgpack.Decoder, v reflect.Value) error {
+			str, err := dec.DecodeString()
+			if err != nil {
+				return err
+			}
+
+			id, err := uuid.Parse(str)
+			if err != nil {
+				return err
+			}
+
+			v.Set(reflect.ValueOf(id))
+
+			return nil
+		},
+	)
+}
+
+// MsgPackMarshaler serializes events as MessagePack.
+type MsgPackMarshaler struct{}
+
+// Marshal event to MessagePack.
+func (MsgPackMarshaler) Marshal(event *Event) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag(structTagJSON)
+
+	if err := enc.Encode(event); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal MessagePack data into the event.
+func (MsgPackMarshaler) Unmarshal(data []byte, event *Event) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag(structTagJSON)
+	dec.UseLooseInterfaceDecoding(true)
+
+	return dec.Decode(event)
+}
+
+// ContentType returns MessagePack MIME type.
+func (MsgPackMarshaler) ContentType() string {
+	return "application/msgpack"
+}
+
+// ContentEncoding returns empty encoding, MessagePack is not compressed.
+func (MsgPackMarshaler) ContentEncoding() string {
+	return ""
+}
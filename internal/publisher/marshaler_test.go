@@ -0,0 +1,276 @@
+package publisher
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestMsgPackMarshaler_RoundTrip(t *testing.T) {
+	event := &Event{
+		ID:     uuid.MustParse("600f37ed-1d88-4262-8be4-c3360e833f50"),
+		Schema: "public",
+		Table:  "users",
+		Action: "UPDATE",
+		Data: map[string]any{
+			"id":     int64(1),
+			"name":   "john",
+			"active": true,
+		},
+		DataOld:   map[string]any{"id": int64(1), "name": "bob"},
+		EventTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Key:       "not serialized",
+	}
+
+	var m MsgPackMarshaler
+
+	data, err := m.Marshal(event)
+	require.NoError(t, err)
+
+	var got Event
+
+	require.NoError(t, m.Unmarshal(data, &got))
+
+	assert.Equal(t, event.ID, got.ID)
+	assert.Equal(t, event.Schema, got.Schema)
+	assert.Equal(t, event.Table, got.Table)
+	assert.Equal(t, event.Action, got.Action)
+	assert.Equal(t, event.Data, got.Data)
+	assert.Equal(t, event.DataOld, got.DataOld)
+	assert.True(t, event.EventTime.Equal(got.EventTime))
+	assert.Empty(t, got.Key)
+}
+
+func TestMsgPackMarshaler_SameShapeAsJSON(t *testing.T) {
+	event := &Event{
+		ID:     uuid.MustParse("600f37ed-1d88-4262-8be4-c3360e833f50"),
+		Schema: "public",
+		Table:  "users",
+		Action: "INSERT",
+		Data:   map[string]any{"id": 1},
+	}
+
+	jsonData, err := JSONMarshaler{}.Marshal(event)
+	require.NoError(t, err)
+
+	msgpackData, err := MsgPackMarshaler{}.Marshal(event)
+	require.NoError(t, err)
+
+	var fromJSON, fromMsgPack map[string]any
+
+	require.NoError(t, json.Unmarshal(jsonData, &fromJSON))
+	require.NoError(t, msgpack.Unmarshal(msgpackData, &fromMsgPack))
+
+	for key := range fromJSON {
+		assert.Contains(t, fromMsgPack, key)
+	}
+
+	assert.Len(t, fromMsgPack, len(fromJSON))
+	assert.Equal(t, fromJSON["id"], fromMsgPack["id"])
+}
+
+func TestNewMarshaler(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  config.FormatType
+		want    Marshaler
+		wantErr bool
+	}{
+		{name: "default", format: "", want: JSONMarshaler{}},
+		{name: "json", format: config.FormatJSON, want: JSONMarshaler{}},
+		{name: "msgpack", format: config.FormatMsgPack, want: MsgPackMarshaler{}},
+		{name: "flat", format: config.FormatFlat, want: FlatJSONMarshaler{}},
+		{name: "unknown", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewMarshaler(tt.format, "")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewMarshaler_Compression(t *testing.T) {
+	event := &Event{Schema: "public", Table: "users", Action: "INSERT", Data: map[string]any{"id": float64(1)}}
+
+	plain, err := JSONMarshaler{}.Marshal(event)
+	require.NoError(t, err)
+
+	tests := []struct {
+		compression config.CompressionType
+		decompress  func(data []byte) ([]byte, error)
+	}{
+		{compression: config.CompressionGzip, decompress: gunzip},
+		{compression: config.CompressionSnappy, decompress: func(data []byte) ([]byte, error) {
+			return snappy.Decode(nil, data)
+		}},
+		{compression: config.CompressionZstd, decompress: unzstd},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.compression), func(t *testing.T) {
+			m, err := NewMarshaler(config.FormatJSON, tt.compression)
+			require.NoError(t, err)
+			assert.Equal(t, "application/json", m.ContentType())
+			assert.Equal(t, string(tt.compression), m.ContentEncoding())
+
+			data, err := m.Marshal(event)
+			require.NoError(t, err)
+
+			got, err := tt.decompress(data)
+			require.NoError(t, err)
+			assert.Equal(t, plain, got)
+		})
+	}
+
+	_, err = NewMarshaler(config.FormatJSON, "brotli")
+	assert.Error(t, err)
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func unzstd(data []byte) ([]byte, error) {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer dec.Close()
+
+	return dec.DecodeAll(data, nil)
+}
+
+func TestJSONMarshaler_DisableHTMLEscape(t *testing.T) {
+	event := &Event{Table: "posts", Data: map[string]any{"body": "<script>a && b</script>"}}
+
+	escaped, err := JSONMarshaler{}.Marshal(event)
+	require.NoError(t, err)
+	assert.Contains(t, string(escaped), `"body":"\u003cscript\u003ea \u0026\u0026 b\u003c/script\u003e"`, "escaped by default")
+
+	m, err := NewPublisherMarshaler(&config.PublisherCfg{DisableHTMLEscape: true})
+	require.NoError(t, err)
+
+	verbatim, err := m.Marshal(event)
+	require.NoError(t, err)
+	assert.Contains(t, string(verbatim), `"body":"<script>a && b</script>"`)
+
+	flat, err := FlatJSONMarshaler{DisableHTMLEscape: true}.Marshal(event)
+	require.NoError(t, err)
+	assert.Contains(t, string(flat), `"new_body":"<script>a && b</script>"`)
+}
+
+func TestJSONMarshaler_EpochMillis(t *testing.T) {
+	commitTime := time.Date(2024, 3, 1, 12, 30, 15, 250_000_000, time.UTC)
+	createdAt := time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC)
+	event := &Event{
+		Table:     "orders",
+		Data:      map[string]any{"id": 1, "created_at": createdAt},
+		DataOld:   map[string]any{},
+		EventTime: commitTime,
+	}
+
+	m, err := NewPublisherMarshaler(&config.PublisherCfg{TimeFormat: config.TimeFormatEpochMillis})
+	require.NoError(t, err)
+
+	data, err := m.Marshal(event)
+	require.NoError(t, err)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+
+	assert.Equal(t, float64(1709296215250), got["commitTime"])
+	assert.Equal(t, map[string]any{"id": float64(1), "created_at": float64(1709193600000)}, got["data"])
+	assert.Equal(t, "orders", got["table"])
+	assert.Equal(t, createdAt, event.Data["created_at"], "event data is not modified")
+
+	flat, err := FlatJSONMarshaler{EpochMillis: true}.Marshal(event)
+	require.NoError(t, err)
+	assert.Contains(t, string(flat), `"commitTime":1709296215250`)
+	assert.Contains(t, string(flat), `"new_created_at":1709193600000`)
+}
+
+func TestJSONMarshaler_ColumnOrder(t *testing.T) {
+	createdAt := time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC)
+	event := &Event{
+		Table:       "orders",
+		Data:        map[string]any{"id": 1, "status": "<new>", "created_at": createdAt, "_deleted_by": nil},
+		ColumnOrder: []string{"status", "id", "created_at"},
+	}
+
+	data, err := JSONMarshaler{DisableHTMLEscape: true}.Marshal(event)
+	require.NoError(t, err)
+	assert.Contains(t, string(data),
+		`"data":{"status":"<new>","id":1,"created_at":"2024-02-29T08:00:00Z","_deleted_by":null},"dataOld":null`,
+		"table order, unknown columns last")
+
+	data, err = JSONMarshaler{EpochMillis: true}.Marshal(event)
+	require.NoError(t, err)
+	assert.Contains(t, string(data),
+		`"data":{"status":"\u003cnew\u003e","id":1,"created_at":1709193600000,"_deleted_by":null}`)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "orders", got["table"])
+}
+
+func TestJSONMarshaler_OpInstead(t *testing.T) {
+	marshalers := map[string]JSONMarshaler{
+		"default":      {},
+		"epoch millis": {EpochMillis: true},
+	}
+
+	for name, m := range marshalers {
+		t.Run(name, func(t *testing.T) {
+			for _, order := range [][]string{nil, {"id"}} {
+				decode := func(event *Event) map[string]any {
+					event.ColumnOrder = order
+
+					data, err := m.Marshal(event)
+					require.NoError(t, err)
+
+					var got map[string]any
+					require.NoError(t, json.Unmarshal(data, &got))
+
+					return got
+				}
+
+				got := decode(&Event{Table: "users", Op: "c", Data: map[string]any{"id": 1}})
+				assert.NotContains(t, got, "action", "published with the op instead")
+				assert.Equal(t, "c", got["op"])
+
+				got = decode(&Event{Table: "users", Data: map[string]any{"id": 1}})
+				assert.Contains(t, got, "action", "an empty action is still written")
+
+				got = decode(&Event{Table: "users", Action: "INSERT", Op: "c", Data: map[string]any{"id": 1}})
+				assert.Equal(t, "INSERT", got["action"])
+				assert.Contains(t, got, "commitTime")
+			}
+		})
+	}
+}
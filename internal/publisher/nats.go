@@ -4,26 +4,31 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"strings"
+	"time"
 
-	"github.com/goccy/go-json"
 	"github.com/nats-io/nats.go"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
 )
 
 // NatsPublisher represent event publisher.
 type NatsPublisher struct {
-	conn   *nats.Conn
-	js     nats.JetStreamContext
-	logger *slog.Logger
+	conn      *nats.Conn
+	js        nats.JetStreamContext
+	logger    *slog.Logger
+	marshaler Marshaler
 }
 
 // NewNatsPublisher return new NatsPublisher instance.
-func NewNatsPublisher(conn *nats.Conn, logger *slog.Logger) (*NatsPublisher, error) {
+func NewNatsPublisher(conn *nats.Conn, logger *slog.Logger, marshaler Marshaler) (*NatsPublisher, error) {
 	js, err := conn.JetStream()
 	if err != nil {
 		return nil, fmt.Errorf("jet stream: %w", err)
 	}
 
-	return &NatsPublisher{conn: conn, js: js, logger: logger}, nil
+	return &NatsPublisher{conn: conn, js: js, logger: logger, marshaler: marshaler}, nil
 }
 
 // Close connection.
@@ -34,12 +39,25 @@ func (n NatsPublisher) Close() error {
 
 // Publish serializes the event and publishes it on the bus.
 func (n NatsPublisher) Publish(_ context.Context, subject string, event *Event) error {
-	msg, err := json.Marshal(event)
+	marshaler := eventMarshaler(event, n.marshaler)
+
+	msg, err := marshaler.Marshal(event)
 	if err != nil {
-		return fmt.Errorf("marshal err: %w", err)
+		return Permanent(fmt.Errorf("marshal err: %w", err))
+	}
+
+	natsMsg := nats.NewMsg(subject)
+	natsMsg.Data = msg
+
+	if encoding := marshaler.ContentEncoding(); encoding != "" {
+		natsMsg.Header.Set(headerContentEncoding, encoding)
+	}
+
+	if event.SchemaFingerprint != "" {
+		natsMsg.Header.Set(headerSchemaFingerprint, event.SchemaFingerprint)
 	}
 
-	if _, err := n.js.Publish(subject, msg); err != nil {
+	if _, err := n.js.PublishMsg(natsMsg); err != nil {
 		return fmt.Errorf("failed to publish: %w", err)
 	}
 
@@ -47,24 +65,146 @@ func (n NatsPublisher) Publish(_ context.Context, subject string, event *Event)
 }
 
 // CreateStream creates a stream by using JetStreamContext. We can do it manually.
-func (n NatsPublisher) CreateStream(streamName string) error {
-	stream, err := n.js.StreamInfo(streamName)
+// The environment prefix is prepended to the stream subjects and name, so every environment has its own stream.
+func (n NatsPublisher) CreateStream(streamName, envPrefix string) error {
+	name := natsStreamName(envPrefix + streamName)
+
+	stream, err := n.js.StreamInfo(name)
 	if err != nil {
 		n.logger.Warn("failed to get stream info", "err", err)
 	}
 
 	if stream == nil {
-		streamSubjects := streamName + ".*"
+		streamSubjects := envPrefix + streamName + ".*"
 
 		if _, err = n.js.AddStream(&nats.StreamConfig{
-			Name:     streamName,
+			Name:     name,
 			Subjects: []string{streamSubjects},
 		}); err != nil {
 			return fmt.Errorf("add stream: %w", err)
 		}
 
-		n.logger.Info("stream not exists, created", slog.String("subjects", streamSubjects))
+		n.logger.Info("stream not exists, created", slog.String("name", name), slog.String("subjects", streamSubjects))
 	}
 
 	return nil
 }
+
+// natsStreamName replaces the characters not allowed in the stream names, e.g. prod.STREAM is prod_STREAM.
+func natsStreamName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '*', '>', '/', '\\':
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+}
+
+// NewNatsConnection connects to the NATS server using the configured authentication.
+func NewNatsConnection(cfg *config.PublisherCfg) (*nats.Conn, error) {
+	opts, err := natsAuthOptions(cfg.NatsAuth)
+	if err != nil {
+		return nil, fmt.Errorf("auth options: %w", err)
+	}
+
+	conn, err := nats.Connect(cfg.Address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	return conn, nil
+}
+
+// natsAuthOptions returns connection options for the configured authentication.
+// Credential files are read on every (re)connect, so rotated credentials are picked up.
+func natsAuthOptions(cfg config.NatsAuthCfg) ([]nats.Option, error) {
+	var opts []nats.Option
+
+	switch {
+	case cfg.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	case cfg.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(cfg.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("nkey from seed: %w", err)
+		}
+
+		opts = append(opts, opt)
+	}
+
+	switch {
+	case cfg.Token != "":
+		opts = append(opts, nats.Token(cfg.Token))
+	case cfg.TokenFile != "":
+		opts = append(opts, nats.TokenHandler(func() string {
+			token, err := os.ReadFile(cfg.TokenFile)
+			if err != nil {
+				return ""
+			}
+
+			return strings.TrimSpace(string(token))
+		}))
+	}
+
+	return opts, nil
+}
+
+// WatchCredentials periodically checks the credential files and forces
+// a reconnect when one of them changes, so the connection uses the rotated credentials.
+func (n NatsPublisher) WatchCredentials(ctx context.Context, cfg config.NatsAuthCfg) {
+	if cfg.RefreshInterval == 0 {
+		return
+	}
+
+	files := make(map[string]time.Time)
+
+	for _, file := range []string{cfg.CredsFile, cfg.NKeyFile, cfg.TokenFile} {
+		if file != "" {
+			files[file] = modTime(file)
+		}
+	}
+
+	if len(files) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var changed bool
+
+			for file, prev := range files {
+				if mt := modTime(file); !mt.Equal(prev) {
+					files[file] = mt
+					changed = true
+				}
+			}
+
+			if !changed {
+				continue
+			}
+
+			n.logger.Info("nats credentials were changed, reconnecting")
+
+			if err := n.conn.ForceReconnect(); err != nil {
+				n.logger.Error("force reconnect", "err", err)
+			}
+		}
+	}
+}
+
+func modTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
@@ -1,7 +1,19 @@
 package publisher
 
 import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ihippik/wal-listener/v2/internal/config"
 )
@@ -42,6 +54,62 @@ func TestEvent_GetSubjectName(t *testing.T) {
 			},
 			want: "STREAM.prefix_public_users",
 		},
+		{
+			name: "env prefix with topic map",
+			fields: fields{
+				Schema: "public",
+				Table:  "users",
+				Action: "insert",
+				Data:   nil,
+			},
+			args: args{
+				cfg: &config.Config{
+					Listener: &config.ListenerCfg{
+						TopicsMap: map[string]string{"public_users": "notifier"},
+					},
+					Publisher: &config.PublisherCfg{TopicPrefix: "prefix_", Topic: "STREAM", EnvPrefix: "prod."},
+				},
+			},
+			want: "prod.STREAM.prefix_notifier",
+		},
+		{
+			name: "topic template",
+			fields: fields{
+				Schema: "public",
+				Table:  "users",
+				Action: "INSERT",
+				Data:   nil,
+			},
+			args: args{
+				cfg: &config.Config{
+					Listener: &config.ListenerCfg{
+						TopicsMap:     map[string]string{"public_orders": "orders"},
+						TopicTemplate: "{schema}.{table}.{action}",
+					},
+					Publisher: &config.PublisherCfg{Topic: "STREAM"},
+				},
+			},
+			want: "STREAM.public.users.insert",
+		},
+		{
+			name: "topic map template overrides the default one",
+			fields: fields{
+				Schema: "public",
+				Table:  "users",
+				Action: "DELETE",
+				Data:   nil,
+			},
+			args: args{
+				cfg: &config.Config{
+					Listener: &config.ListenerCfg{
+						TopicsMap:     map[string]string{"public_users": "myprefix.{table}"},
+						TopicTemplate: "{schema}.{table}.{action}",
+					},
+					Publisher: &config.PublisherCfg{Topic: "STREAM"},
+				},
+			},
+			want: "STREAM.myprefix.users",
+		},
 	}
 
 	for _, tt := range tests {
@@ -59,3 +127,187 @@ func TestEvent_GetSubjectName(t *testing.T) {
 		})
 	}
 }
+
+func runNatsServer(t *testing.T, opts *server.Options) *server.Server {
+	t.Helper()
+
+	opts.Host = "127.0.0.1"
+	opts.Port = -1
+	opts.NoLog = true
+	opts.NoSigs = true
+
+	srv, err := server.NewServer(opts)
+	require.NoError(t, err)
+
+	go srv.Start()
+
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+
+	t.Cleanup(srv.Shutdown)
+
+	return srv
+}
+
+func TestNewNatsConnection_CredsFile(t *testing.T) {
+	operatorKP, err := nkeys.CreateOperator()
+	require.NoError(t, err)
+
+	operatorPub, err := operatorKP.PublicKey()
+	require.NoError(t, err)
+
+	operatorJWT, err := jwt.NewOperatorClaims(operatorPub).Encode(operatorKP)
+	require.NoError(t, err)
+
+	operatorClaims, err := jwt.DecodeOperatorClaims(operatorJWT)
+	require.NoError(t, err)
+
+	accountKP, err := nkeys.CreateAccount()
+	require.NoError(t, err)
+
+	accountPub, err := accountKP.PublicKey()
+	require.NoError(t, err)
+
+	accountJWT, err := jwt.NewAccountClaims(accountPub).Encode(operatorKP)
+	require.NoError(t, err)
+
+	userKP, err := nkeys.CreateUser()
+	require.NoError(t, err)
+
+	userPub, err := userKP.PublicKey()
+	require.NoError(t, err)
+
+	userJWT, err := jwt.NewUserClaims(userPub).Encode(accountKP)
+	require.NoError(t, err)
+
+	userSeed, err := userKP.Seed()
+	require.NoError(t, err)
+
+	creds, err := jwt.FormatUserConfig(userJWT, userSeed)
+	require.NoError(t, err)
+
+	credsFile := filepath.Join(t.TempDir(), "user.creds")
+	require.NoError(t, os.WriteFile(credsFile, creds, 0o600))
+
+	resolver := &server.MemAccResolver{}
+	require.NoError(t, resolver.Store(accountPub, accountJWT))
+
+	srv := runNatsServer(t, &server.Options{
+		TrustedOperators: []*jwt.OperatorClaims{operatorClaims},
+		AccountResolver:  resolver,
+	})
+
+	conn, err := NewNatsConnection(&config.PublisherCfg{
+		Address:  srv.ClientURL(),
+		NatsAuth: config.NatsAuthCfg{CredsFile: credsFile},
+	})
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	assert.True(t, conn.IsConnected())
+
+	_, err = NewNatsConnection(&config.PublisherCfg{Address: srv.ClientURL()})
+	assert.Error(t, err)
+}
+
+func TestNewNatsConnection_Token(t *testing.T) {
+	srv := runNatsServer(t, &server.Options{Authorization: "s3cr3t"})
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o600))
+
+	tests := []struct {
+		name    string
+		auth    config.NatsAuthCfg
+		wantErr bool
+	}{
+		{
+			name: "token",
+			auth: config.NatsAuthCfg{Token: "s3cr3t"},
+		},
+		{
+			name: "token file",
+			auth: config.NatsAuthCfg{TokenFile: tokenFile},
+		},
+		{
+			name:    "wrong token",
+			auth:    config.NatsAuthCfg{Token: "wrong"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := NewNatsConnection(&config.PublisherCfg{Address: srv.ClientURL(), NatsAuth: tt.auth})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			conn.Close()
+		})
+	}
+}
+
+func TestNatsPublisher_Publish_Encoding(t *testing.T) {
+	srv := runNatsServer(t, &server.Options{JetStream: true, StoreDir: t.TempDir()})
+
+	conn, err := NewNatsConnection(&config.PublisherCfg{Address: srv.ClientURL()})
+	require.NoError(t, err)
+
+	m, err := NewMarshaler(config.FormatJSON, config.CompressionZstd)
+	require.NoError(t, err)
+
+	pub, err := NewNatsPublisher(conn, slog.New(slog.NewJSONHandler(io.Discard, nil)), m)
+	require.NoError(t, err)
+
+	defer pub.Close()
+
+	require.NoError(t, pub.CreateStream("STREAM", ""))
+
+	sub, err := conn.SubscribeSync("STREAM.public_users")
+	require.NoError(t, err)
+
+	event := &Event{Schema: "public", Table: "users", Action: "INSERT", Data: map[string]any{"id": float64(1)}}
+	require.NoError(t, pub.Publish(context.Background(), "STREAM.public_users", event))
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "zstd", msg.Header.Get("Content-Encoding"))
+
+	data, err := unzstd(msg.Data)
+	require.NoError(t, err)
+
+	want, err := JSONMarshaler{}.Marshal(event)
+	require.NoError(t, err)
+	assert.Equal(t, want, data)
+}
+
+func TestNatsPublisher_CreateStream_EnvPrefix(t *testing.T) {
+	srv := runNatsServer(t, &server.Options{JetStream: true, StoreDir: t.TempDir()})
+
+	conn, err := NewNatsConnection(&config.PublisherCfg{Address: srv.ClientURL()})
+	require.NoError(t, err)
+
+	pub, err := NewNatsPublisher(conn, slog.New(slog.NewJSONHandler(io.Discard, nil)), JSONMarshaler{})
+	require.NoError(t, err)
+
+	defer pub.Close()
+
+	// two environments sharing the server get their own streams.
+	require.NoError(t, pub.CreateStream("STREAM", "prod."))
+	require.NoError(t, pub.CreateStream("STREAM", "stage."))
+
+	event := &Event{Schema: "public", Table: "users", Action: "INSERT", Data: map[string]any{"id": float64(1)}}
+	require.NoError(t, pub.Publish(context.Background(), "prod.STREAM.public_users", event))
+	require.NoError(t, pub.Publish(context.Background(), "stage.STREAM.public_users", event))
+
+	for _, name := range []string{"prod_STREAM", "stage_STREAM"} {
+		info, err := pub.js.StreamInfo(name)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), info.State.Msgs, name)
+	}
+}
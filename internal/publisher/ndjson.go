@@ -0,0 +1,255 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+const (
+	defaultNDJSONFlushSize = 1 << 20
+	defaultNDJSONFileSize  = 100 << 20
+	ndjsonContentType      = "application/x-ndjson"
+	ndjsonFileLayout       = "20060102T150405.000000000"
+)
+
+// NDJSONTarget receives the flushed batches of newline-delimited JSON.
+type NDJSONTarget interface {
+	Write(ctx context.Context, batch []byte) error
+	Close() error
+}
+
+// NDJSONPublisher buffers the events as newline-delimited JSON and flushes them to the target by size,
+// and by Flush before the WAL position of the buffered events is acknowledged.
+// The events of all topics share the stream, their schema and table tell them apart.
+type NDJSONPublisher struct {
+	target    NDJSONTarget
+	marshaler Marshaler
+	flushSize int
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// NewNDJSONTarget returns the target of the address: the bulk endpoint of an http(s) URL, otherwise the directory of files.
+func NewNDJSONTarget(address string, cfg config.NDJSONCfg) (NDJSONTarget, error) {
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		return &ndjsonHTTPTarget{
+			url:     address,
+			client:  NewWebhookClient(config.WebhookCfg{Timeout: cfg.Timeout}),
+			headers: cfg.Headers,
+		}, nil
+	}
+
+	if err := os.MkdirAll(address, 0o755); err != nil {
+		return nil, fmt.Errorf("create directory: %w", err)
+	}
+
+	fileSize := cfg.FileSize
+	if fileSize <= 0 {
+		fileSize = defaultNDJSONFileSize
+	}
+
+	return &ndjsonFileTarget{dir: address, maxSize: fileSize}, nil
+}
+
+// NewNDJSONPublisher return new NDJSONPublisher instance.
+func NewNDJSONPublisher(
+	target NDJSONTarget,
+	cfg config.NDJSONCfg,
+	marshaler Marshaler,
+) *NDJSONPublisher {
+	flushSize := cfg.FlushSize
+	if flushSize <= 0 {
+		flushSize = defaultNDJSONFlushSize
+	}
+
+	return &NDJSONPublisher{
+		target:    target,
+		marshaler: marshaler,
+		flushSize: flushSize,
+	}
+}
+
+// Publish appends the event line to the buffer and flushes the buffer once it reaches the flush size.
+// If the flush fails, the event is removed from the buffer, so it isn't written twice when it's published again.
+func (p *NDJSONPublisher) Publish(ctx context.Context, _ string, event *Event) error {
+	marshaler := eventMarshaler(event, p.marshaler)
+	if !isJSONLine(marshaler) {
+		return Permanent(fmt.Errorf("%s events can't be written as JSON lines", marshaler.ContentType()))
+	}
+
+	data, err := marshaler.Marshal(event)
+	if err != nil {
+		return Permanent(fmt.Errorf("marshal: %w", err))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size := p.buf.Len()
+
+	p.buf.Write(bytes.TrimRight(data, "\n"))
+	p.buf.WriteByte('\n')
+
+	if p.buf.Len() < p.flushSize {
+		return nil
+	}
+
+	if err := p.flush(ctx); err != nil {
+		p.buf.Truncate(size)
+		return err
+	}
+
+	return nil
+}
+
+// isJSONLine reports whether the marshaler writes uncompressed JSON objects.
+func isJSONLine(m Marshaler) bool {
+	ct := m.ContentType()
+	return (ct == "application/json" || ct == cloudEventsContentType) && m.ContentEncoding() == ""
+}
+
+// Flush writes the buffered events to the target, they stay buffered if the write fails.
+func (p *NDJSONPublisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.flush(ctx)
+}
+
+// Close flushes the buffered events and closes the target.
+func (p *NDJSONPublisher) Close() error {
+	return errors.Join(p.Flush(context.Background()), p.target.Close())
+}
+
+// flush writes the buffered events to the target, they stay buffered if the write fails. The caller holds the lock.
+func (p *NDJSONPublisher) flush(ctx context.Context) error {
+	if p.buf.Len() == 0 {
+		return nil
+	}
+
+	if err := p.target.Write(ctx, p.buf.Bytes()); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	p.buf.Reset()
+
+	return nil
+}
+
+// ndjsonFileTarget appends the batches to files of the directory, a new file is started once the file reaches its size.
+type ndjsonFileTarget struct {
+	dir     string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// Write appends the batch and syncs the file. A failed write leaves a partial line, so the next batch goes to a new file.
+func (t *ndjsonFileTarget) Write(_ context.Context, batch []byte) error {
+	if t.file == nil || t.size >= t.maxSize {
+		if err := t.rotate(); err != nil {
+			return fmt.Errorf("rotate: %w", err)
+		}
+	}
+
+	n, err := t.file.Write(batch)
+	t.size += int64(n)
+
+	if err == nil {
+		err = t.file.Sync()
+	}
+
+	if err != nil {
+		_ = t.file.Close()
+		t.file = nil
+
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+func (t *ndjsonFileTarget) rotate() error {
+	if err := t.Close(); err != nil {
+		return err
+	}
+
+	name := filepath.Join(t.dir, "events-"+time.Now().UTC().Format(ndjsonFileLayout)+".ndjson")
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+
+	t.file = file
+	t.size = 0
+
+	return nil
+}
+
+// Close closes the current file.
+func (t *ndjsonFileTarget) Close() error {
+	if t.file == nil {
+		return nil
+	}
+
+	err := t.file.Close()
+	t.file = nil
+
+	return err
+}
+
+// ndjsonHTTPTarget posts the batches to the bulk endpoint.
+type ndjsonHTTPTarget struct {
+	url     string
+	client  *http.Client
+	headers map[string]string
+}
+
+// Write posts the batch, responses other than 2xx are errors.
+func (t *ndjsonHTTPTarget) Write(ctx context.Context, batch []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(batch))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	req.Header.Set("Content-Type", ndjsonContentType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLimit))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+// Close releases the idle connections.
+func (t *ndjsonHTTPTarget) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
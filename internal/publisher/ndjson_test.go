@@ -0,0 +1,155 @@
+package publisher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestNDJSONPublisher_Publish(t *testing.T) {
+	newEvent := func(id int) *Event {
+		return &Event{Schema: "public", Table: "users", Action: "INSERT", Data: map[string]any{"id": id}}
+	}
+
+	var (
+		mu      sync.Mutex
+		batches [][]byte
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal(t, "key", r.Header.Get("X-Api-Key"))
+
+		mu.Lock()
+		batches = append(batches, body)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	line, err := JSONMarshaler{}.Marshal(newEvent(1))
+	require.NoError(t, err)
+
+	// the third line reaches the flush size.
+	cfg := config.NDJSONCfg{
+		FlushSize: 2*len(line) + 3,
+		Headers:   map[string]string{"X-Api-Key": "key"},
+	}
+
+	target, err := NewNDJSONTarget(srv.URL, cfg)
+	require.NoError(t, err)
+
+	pub := NewNDJSONPublisher(target, cfg, JSONMarshaler{})
+
+	for id := 1; id <= 4; id++ {
+		require.NoError(t, pub.Publish(context.Background(), "wal.public_users", newEvent(id)))
+	}
+
+	mu.Lock()
+	require.Len(t, batches, 1, "flushed on the size")
+	assert.Equal(t, []any{1.0, 2.0, 3.0}, ndjsonIDs(t, batches[0]))
+	mu.Unlock()
+
+	require.NoError(t, pub.Flush(context.Background()))
+	require.Len(t, batches, 2, "the rest is flushed before the acknowledgement")
+	assert.Equal(t, []any{4.0}, ndjsonIDs(t, batches[1]))
+
+	require.NoError(t, pub.Close())
+	assert.Len(t, batches, 2, "nothing is left to flush on close")
+}
+
+func TestNDJSONPublisher_Flush(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	event := &Event{Schema: "public", Table: "users", Action: "INSERT", Data: map[string]any{"id": 1}}
+
+	t.Run("flush and rotation", func(t *testing.T) {
+		cfg := config.NDJSONCfg{FileSize: 1}
+
+		target, err := NewNDJSONTarget(dir, cfg)
+		require.NoError(t, err)
+
+		pub := NewNDJSONPublisher(target, cfg, JSONMarshaler{})
+		require.NoError(t, pub.Publish(context.Background(), "wal.public_users", event))
+
+		files := func() []string {
+			names, err := filepath.Glob(filepath.Join(dir, "*.ndjson"))
+			require.NoError(t, err)
+
+			return names
+		}
+
+		assert.Empty(t, files(), "buffered until the flush")
+		require.NoError(t, pub.Flush(context.Background()))
+		require.Len(t, files(), 1)
+
+		require.NoError(t, pub.Publish(context.Background(), "wal.public_users", event))
+		require.NoError(t, pub.Close())
+
+		names := files()
+		require.Len(t, names, 2, "the full file is rotated")
+
+		for _, name := range names {
+			data, err := os.ReadFile(name)
+			require.NoError(t, err)
+			assert.Equal(t, []any{1.0}, ndjsonIDs(t, data))
+		}
+	})
+
+	t.Run("failed flush", func(t *testing.T) {
+		target := &failingTarget{}
+		pub := NewNDJSONPublisher(target, config.NDJSONCfg{FlushSize: 1}, JSONMarshaler{})
+		t.Cleanup(func() { _ = pub.Close() })
+
+		require.Error(t, pub.Publish(context.Background(), "wal.public_users", event))
+		assert.Zero(t, pub.buf.Len(), "the failed event is not buffered")
+
+		buffered := NewNDJSONPublisher(target, config.NDJSONCfg{}, JSONMarshaler{})
+		require.NoError(t, buffered.Publish(context.Background(), "wal.public_users", event))
+		require.Error(t, buffered.Flush(context.Background()))
+		assert.NotZero(t, buffered.buf.Len(), "the events stay buffered until a flush succeeds")
+
+		msgpack := &Event{Schema: "public", Table: "users", Marshaler: MsgPackMarshaler{}}
+		require.Error(t, pub.Publish(context.Background(), "wal.public_users", msgpack), "not written as lines")
+	})
+}
+
+type failingTarget struct{}
+
+func (*failingTarget) Write(context.Context, []byte) error { return io.ErrClosedPipe }
+
+func (*failingTarget) Close() error { return nil }
+
+// ndjsonIDs decodes the NDJSON batch, every line must be a JSON object, and returns the ids of the events.
+func ndjsonIDs(t *testing.T, batch []byte) []any {
+	t.Helper()
+
+	require.True(t, bytes.HasSuffix(batch, []byte("\n")), "the batch ends with a newline")
+
+	var got []any
+
+	scanner := bufio.NewScanner(bytes.NewReader(batch))
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event), "line %q", scanner.Text())
+
+		got = append(got, event.Data["id"])
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return got
+}
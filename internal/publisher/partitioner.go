@@ -0,0 +1,147 @@
+package publisher
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// Partitioner chooses the Kafka partition of the event.
+// Implementations can be registered with RegisterPartitioner and selected by name in the config.
+type Partitioner interface {
+	Partition(event *Event, numPartitions int32) (int32, error)
+}
+
+// PartitionerFunc is an adapter to use ordinary functions as partitioners.
+type PartitionerFunc func(event *Event, numPartitions int32) (int32, error)
+
+// Partition calls f(event, numPartitions).
+func (f PartitionerFunc) Partition(event *Event, numPartitions int32) (int32, error) {
+	return f(event, numPartitions)
+}
+
+// PartitionerFactory creates a partitioner for the topic.
+type PartitionerFactory func(topic string) Partitioner
+
+// built-in partitioners.
+const (
+	PartitionerHash       = "hash"
+	PartitionerRandom     = "random"
+	PartitionerRoundRobin = "roundRobin"
+)
+
+var (
+	partitionersMu sync.RWMutex
+	partitioners   = map[string]PartitionerFactory{
+		PartitionerHash: func(string) Partitioner {
+			return HashPartitioner{}
+		},
+		PartitionerRandom: func(string) Partitioner {
+			return RandomPartitioner{}
+		},
+		PartitionerRoundRobin: func(string) Partitioner {
+			return new(RoundRobinPartitioner)
+		},
+	}
+)
+
+// RegisterPartitioner makes the partitioner available by name, the built-in ones can be replaced.
+func RegisterPartitioner(name string, factory PartitionerFactory) {
+	partitionersMu.Lock()
+	defer partitionersMu.Unlock()
+
+	partitioners[name] = factory
+}
+
+// newSaramaPartitioner returns the sarama partitioner constructor for the registered partitioner.
+func newSaramaPartitioner(name string) (sarama.PartitionerConstructor, error) {
+	partitionersMu.RLock()
+	factory, ok := partitioners[name]
+	partitionersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown partitioner: %s", name)
+	}
+
+	return func(topic string) sarama.Partitioner {
+		return saramaPartitioner{partitioner: factory(topic)}
+	}, nil
+}
+
+// saramaPartitioner adapts the Partitioner to sarama, the event is passed in the message metadata.
+// The messages without an event are partitioned by the key hash.
+type saramaPartitioner struct {
+	partitioner Partitioner
+}
+
+// Partition implements sarama.Partitioner.
+func (p saramaPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	event, ok := msg.Metadata.(*Event)
+	if !ok {
+		return sarama.NewHashPartitioner(msg.Topic).Partition(msg, numPartitions)
+	}
+
+	partition, err := p.partitioner.Partition(event, numPartitions)
+	if err != nil {
+		return 0, err
+	}
+
+	if partition < 0 || partition >= numPartitions {
+		return 0, fmt.Errorf("partition %d out of range [0, %d)", partition, numPartitions)
+	}
+
+	return partition, nil
+}
+
+// RequiresConsistency keeps the partition of a key stable while some partitions are unavailable.
+func (p saramaPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// HashPartitioner sends events with the same key to the same partition, events without a key are random.
+type HashPartitioner struct{}
+
+// Partition by FNV-1a hash of the event key, the same partition as the sarama hash partitioner.
+func (HashPartitioner) Partition(event *Event, numPartitions int32) (int32, error) {
+	if event.Key == "" {
+		return RandomPartitioner{}.Partition(event, numPartitions)
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(event.Key))
+
+	partition := int32(h.Sum32()) % numPartitions
+	if partition < 0 {
+		partition = -partition
+	}
+
+	return partition, nil
+}
+
+// RandomPartitioner spreads events randomly.
+type RandomPartitioner struct{}
+
+// Partition randomly.
+func (RandomPartitioner) Partition(_ *Event, numPartitions int32) (int32, error) {
+	return rand.Int32N(numPartitions), nil
+}
+
+// RoundRobinPartitioner spreads events evenly in turn.
+type RoundRobinPartitioner struct {
+	mu   sync.Mutex
+	next int32
+}
+
+// Partition returns the next partition.
+func (p *RoundRobinPartitioner) Partition(_ *Event, numPartitions int32) (int32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	partition := p.next % numPartitions
+	p.next = partition + 1
+
+	return partition, nil
+}
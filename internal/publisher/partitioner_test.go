@@ -0,0 +1,124 @@
+package publisher
+
+import (
+	"errors"
+	"hash/fnv"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ringPartitioner pins tables to partitions, similar to a consistent hashing ring in user code.
+type ringPartitioner struct {
+	topic string
+}
+
+func (p ringPartitioner) Partition(event *Event, numPartitions int32) (int32, error) {
+	if event.Table == "" {
+		return 0, errors.New("event without table")
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(p.topic + "/" + event.Table))
+
+	return int32(h.Sum32() % uint32(numPartitions)), nil
+}
+
+func TestNewSaramaPartitioner_Custom(t *testing.T) {
+	RegisterPartitioner("ring", func(topic string) Partitioner {
+		return ringPartitioner{topic: topic}
+	})
+
+	constructor, err := newSaramaPartitioner("ring")
+	require.NoError(t, err)
+
+	partitioner := constructor("wal.public_users")
+	assert.True(t, partitioner.RequiresConsistency())
+
+	event := &Event{Table: "users"}
+	want, err := ringPartitioner{topic: "wal.public_users"}.Partition(event, 12)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		got, err := partitioner.Partition(&sarama.ProducerMessage{Topic: "wal.public_users", Metadata: event}, 12)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err = partitioner.Partition(&sarama.ProducerMessage{Metadata: &Event{}}, 12)
+	assert.EqualError(t, err, "event without table")
+
+	// the messages without an event, e.g. dead letters of a custom publisher, are partitioned by the key.
+	keyed := &sarama.ProducerMessage{Topic: "wal.dlq", Key: sarama.StringEncoder("42")}
+	want, err = sarama.NewHashPartitioner("wal.dlq").Partition(keyed, 12)
+	require.NoError(t, err)
+
+	got, err := partitioner.Partition(keyed, 12)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = newSaramaPartitioner("unknown")
+	assert.EqualError(t, err, "unknown partitioner: unknown")
+}
+
+func TestNewSaramaPartitioner_OutOfRange(t *testing.T) {
+	RegisterPartitioner("broken", func(string) Partitioner {
+		return PartitionerFunc(func(*Event, int32) (int32, error) {
+			return 5, nil
+		})
+	})
+
+	constructor, err := newSaramaPartitioner("broken")
+	require.NoError(t, err)
+
+	_, err = constructor("topic").Partition(&sarama.ProducerMessage{Metadata: &Event{}}, 3)
+	assert.EqualError(t, err, "partition 5 out of range [0, 3)")
+}
+
+func TestBuiltinPartitioners(t *testing.T) {
+	t.Run("hash", func(t *testing.T) {
+		first, err := HashPartitioner{}.Partition(&Event{Key: "42"}, 8)
+		require.NoError(t, err)
+
+		second, err := HashPartitioner{}.Partition(&Event{Key: "42"}, 8)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		// switching from the sarama hash partitioner keeps the partitions of the keys.
+		for _, key := range []string{"42", "user-1", "a", "ff7c1d"} {
+			want, err := sarama.NewHashPartitioner("topic").
+				Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(key)}, 7)
+			require.NoError(t, err)
+
+			got, err := HashPartitioner{}.Partition(&Event{Key: key}, 7)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, key)
+		}
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		p := new(RoundRobinPartitioner)
+
+		var got []int32
+
+		for i := 0; i < 5; i++ {
+			partition, err := p.Partition(&Event{}, 3)
+			require.NoError(t, err)
+
+			got = append(got, partition)
+		}
+
+		assert.Equal(t, []int32{0, 1, 2, 0, 1}, got)
+	})
+
+	t.Run("random", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			partition, err := RandomPartitioner{}.Partition(&Event{}, 3)
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, partition, int32(0))
+			assert.Less(t, partition, int32(3))
+		}
+	})
+}
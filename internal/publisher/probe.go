@@ -0,0 +1,77 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/api/iterator"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// ProbeKafka checks that the Kafka brokers are reachable and serve cluster metadata.
+// Nothing is produced, the probe only opens a short-lived client and fetches metadata.
+func ProbeKafka(ctx context.Context, pCfg *config.PublisherCfg) error {
+	cfg, err := newSaramaConfig(pCfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Metadata.Retry.Max = 0
+
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		cfg.Net.DialTimeout = timeout
+		cfg.Net.ReadTimeout = timeout
+		cfg.Net.WriteTimeout = timeout
+		cfg.Metadata.Timeout = timeout
+	}
+
+	client, err := sarama.NewClient([]string{pCfg.Address}, cfg)
+	if err != nil {
+		return fmt.Errorf("new client: %w", err)
+	}
+
+	defer client.Close()
+
+	if len(client.Brokers()) == 0 {
+		return errors.New("no brokers in cluster metadata")
+	}
+
+	return nil
+}
+
+// Probe checks that the connection is alive and JetStream is available, implements prober.
+func (n NatsPublisher) Probe(ctx context.Context) error {
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	if _, err := n.js.AccountInfo(nats.Context(ctx)); err != nil {
+		return fmt.Errorf("account info: %w", err)
+	}
+
+	return nil
+}
+
+// Probe lists the project topics to check access to Pub/Sub, implements prober.
+func (p *GooglePubSubPublisher) Probe(ctx context.Context) error {
+	if _, err := p.pubSubConnection.client.Topics(ctx).Next(); err != nil && !errors.Is(err, iterator.Done) {
+		return fmt.Errorf("list topics: %w", err)
+	}
+
+	return nil
+}
+
+// Probe pings the target database, implements prober.
+func (p *SQLPublisher) Probe(ctx context.Context) error {
+	if err := p.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package publisher
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// closedAddr returns an address nobody listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	return addr
+}
+
+func TestProbeKafka(t *testing.T) {
+	t.Run("reachable broker", func(t *testing.T) {
+		broker := sarama.NewMockBroker(t, 1)
+		defer broker.Close()
+
+		broker.SetHandlerByMap(map[string]sarama.MockResponse{
+			"MetadataRequest": sarama.NewMockMetadataResponse(t).
+				SetBroker(broker.Addr(), broker.BrokerID()).
+				SetController(broker.BrokerID()),
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.NoError(t, ProbeKafka(ctx, &config.PublisherCfg{Address: broker.Addr()}))
+	})
+
+	t.Run("unreachable broker", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		require.Error(t, ProbeKafka(ctx, &config.PublisherCfg{Address: closedAddr(t)}))
+	})
+}
+
+func TestNatsPublisher_Probe(t *testing.T) {
+	newPublisher := func(t *testing.T, opts *server.Options) *NatsPublisher {
+		srv := runNatsServer(t, opts)
+
+		conn, err := nats.Connect(srv.ClientURL())
+		require.NoError(t, err)
+
+		t.Cleanup(conn.Close)
+
+		m, err := NewMarshaler(config.FormatJSON, config.CompressionNone)
+		require.NoError(t, err)
+
+		pub, err := NewNatsPublisher(conn, slog.New(slog.NewJSONHandler(io.Discard, nil)), m)
+		require.NoError(t, err)
+
+		return pub
+	}
+
+	t.Run("reachable server", func(t *testing.T) {
+		pub := newPublisher(t, &server.Options{JetStream: true, StoreDir: t.TempDir()})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.NoError(t, pub.Probe(ctx))
+	})
+
+	t.Run("jetstream unavailable", func(t *testing.T) {
+		pub := newPublisher(t, &server.Options{})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.Error(t, pub.Probe(ctx))
+	})
+
+	t.Run("server gone", func(t *testing.T) {
+		pub := newPublisher(t, &server.Options{JetStream: true, StoreDir: t.TempDir()})
+		pub.conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.Error(t, pub.Probe(ctx))
+	})
+}
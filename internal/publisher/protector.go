@@ -0,0 +1,276 @@
+package publisher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-json"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+const defaultMaskValue = "***"
+
+// EncryptedValue replaces the value of an encrypted column.
+// Ciphertext is the base64-encoded AES-GCM nonce followed by the sealed JSON value.
+type EncryptedValue struct {
+	KeyID      string `json:"keyId"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// ColumnProtector masks and encrypts sensitive column values of the event.
+// A nil protector leaves events untouched.
+type ColumnProtector struct {
+	mask      map[string][]string
+	maskValue string
+	encrypt   map[string][]string
+	keyID     string
+	aead      cipher.AEAD
+}
+
+// NewColumnProtector create new ColumnProtector instance.
+// Returns nil if neither masking, encryption nor classification is configured.
+func NewColumnProtector(cfg config.ProtectionCfg) (*ColumnProtector, error) {
+	if len(cfg.Mask) == 0 && len(cfg.Encrypt) == 0 && !cfg.Classification.Enabled() {
+		return nil, nil
+	}
+
+	p := &ColumnProtector{
+		mask:      cfg.Mask,
+		maskValue: cfg.MaskValue,
+		encrypt:   cfg.Encrypt,
+		keyID:     cfg.Encryption.KeyID,
+	}
+
+	if p.maskValue == "" {
+		p.maskValue = defaultMaskValue
+	}
+
+	if len(cfg.Encrypt) == 0 {
+		return p, nil
+	}
+
+	key, err := loadEncryptionKey(cfg.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("load key: %w", err)
+	}
+
+	p.aead, err = newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func loadEncryptionKey(cfg config.EncryptionKeyCfg) ([]byte, error) {
+	encoded := cfg.Key
+
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read key file: %w", err)
+		}
+
+		encoded = strings.TrimSpace(string(data))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("new gcm: %w", err)
+	}
+
+	return aead, nil
+}
+
+// Apply masks and encrypts the configured columns in the new and old event data.
+func (p *ColumnProtector) Apply(event *Event) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, column := range p.mask[event.Table] {
+		maskValue(event.Data, column, p.maskValue)
+		maskValue(event.DataOld, column, p.maskValue)
+		maskValue(event.PrimaryKey, column, p.maskValue)
+		maskChange(event.Changes, column, p.maskValue)
+	}
+
+	for _, column := range p.encrypt[event.Table] {
+		if err := p.encryptValue(event.Data, column); err != nil {
+			return fmt.Errorf("encrypt %s: %w", column, err)
+		}
+
+		if err := p.encryptValue(event.DataOld, column); err != nil {
+			return fmt.Errorf("encrypt old %s: %w", column, err)
+		}
+
+		if err := p.encryptChange(event.Changes, column); err != nil {
+			return fmt.Errorf("encrypt change %s: %w", column, err)
+		}
+
+		if err := p.encryptValue(event.PrimaryKey, column); err != nil {
+			return fmt.Errorf("encrypt key %s: %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyClassified masks and removes the columns classified by their catalog tags in the new and old event data.
+func (p *ColumnProtector) ApplyClassified(event *Event, mask, exclude []string) {
+	if p == nil {
+		return
+	}
+
+	for _, column := range mask {
+		maskValue(event.Data, column, p.maskValue)
+		maskValue(event.DataOld, column, p.maskValue)
+		maskValue(event.PrimaryKey, column, p.maskValue)
+		maskChange(event.Changes, column, p.maskValue)
+	}
+
+	for _, column := range exclude {
+		delete(event.Data, column)
+		delete(event.DataOld, column)
+		delete(event.PrimaryKey, column)
+		delete(event.Changes, column)
+	}
+}
+
+// maskValue replaces non-null column value.
+func maskValue(data map[string]any, column, mask string) {
+	if val, ok := data[column]; ok && val != nil {
+		data[column] = mask
+	}
+}
+
+// maskChange replaces the non-null old and new values of the changed column.
+func maskChange(changes map[string]ColumnChange, column, mask string) {
+	change, ok := changes[column]
+	if !ok {
+		return
+	}
+
+	if change.Old != nil {
+		change.Old = mask
+	}
+
+	if change.New != nil {
+		change.New = mask
+	}
+
+	changes[column] = change
+}
+
+// encryptValue replaces non-null column value with its ciphertext.
+func (p *ColumnProtector) encryptValue(data map[string]any, column string) error {
+	val, ok := data[column]
+	if !ok || val == nil {
+		return nil
+	}
+
+	encrypted, err := p.seal(val)
+	if err != nil {
+		return err
+	}
+
+	data[column] = encrypted
+
+	return nil
+}
+
+// encryptChange replaces the non-null old and new values of the changed column with their ciphertexts.
+func (p *ColumnProtector) encryptChange(changes map[string]ColumnChange, column string) error {
+	change, ok := changes[column]
+	if !ok {
+		return nil
+	}
+
+	for _, val := range []*any{&change.Old, &change.New} {
+		if *val == nil {
+			continue
+		}
+
+		encrypted, err := p.seal(*val)
+		if err != nil {
+			return err
+		}
+
+		*val = encrypted
+	}
+
+	changes[column] = change
+
+	return nil
+}
+
+// seal returns the ciphertext of the JSON-encoded value.
+func (p *ColumnProtector) seal(val any) (EncryptedValue, error) {
+	plaintext, err := json.Marshal(val)
+	if err != nil {
+		return EncryptedValue{}, fmt.Errorf("marshal: %w", err)
+	}
+
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return EncryptedValue{}, fmt.Errorf("nonce: %w", err)
+	}
+
+	return EncryptedValue{
+		KeyID:      p.keyID,
+		Ciphertext: base64.StdEncoding.EncodeToString(p.aead.Seal(nonce, nonce, plaintext, nil)),
+	}, nil
+}
+
+var errCiphertextTooShort = errors.New("ciphertext too short")
+
+// Decrypt returns the original column value, JSON-decoded.
+func Decrypt(key []byte, value EncryptedValue) (any, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, errCiphertextTooShort
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	var val any
+
+	if err := json.Unmarshal(plaintext, &val); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return val, nil
+}
@@ -0,0 +1,83 @@
+package publisher
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestColumnProtector_Apply(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	p, err := NewColumnProtector(config.ProtectionCfg{
+		Mask:    map[string][]string{"users": {"phone"}},
+		Encrypt: map[string][]string{"users": {"email", "balance"}},
+		Encryption: config.EncryptionKeyCfg{
+			KeyID: "k1",
+			Key:   base64.StdEncoding.EncodeToString(key),
+		},
+	})
+	require.NoError(t, err)
+
+	event := &Event{
+		Table: "users",
+		Data: map[string]any{
+			"id":      1,
+			"email":   "john@doe.com",
+			"balance": 10.5,
+			"phone":   "+100000000",
+		},
+		DataOld: map[string]any{"email": nil},
+		Changes: map[string]ColumnChange{
+			"email": {Old: nil, New: "john@doe.com"},
+			"phone": {Old: "+200000000", New: "+100000000"},
+		},
+		PrimaryKey: map[string]any{"id": 1, "phone": "+100000000"},
+	}
+
+	require.NoError(t, p.Apply(event))
+
+	assert.Equal(t, 1, event.Data["id"])
+	assert.Equal(t, "***", event.Data["phone"])
+	assert.Nil(t, event.DataOld["email"])
+	assert.Equal(t, ColumnChange{Old: "***", New: "***"}, event.Changes["phone"])
+	assert.Equal(t, map[string]any{"id": 1, "phone": "***"}, event.PrimaryKey, "the key columns are protected too")
+	assert.Nil(t, event.Changes["email"].Old)
+
+	changed, ok := event.Changes["email"].New.(EncryptedValue)
+	require.True(t, ok)
+
+	got, err := Decrypt(key, changed)
+	require.NoError(t, err)
+	assert.Equal(t, "john@doe.com", got)
+
+	for column, want := range map[string]any{"email": "john@doe.com", "balance": 10.5} {
+		encrypted, ok := event.Data[column].(EncryptedValue)
+		require.True(t, ok, column)
+		assert.Equal(t, "k1", encrypted.KeyID)
+
+		got, err := Decrypt(key, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err = Decrypt([]byte("fedcba9876543210fedcba9876543210"), event.Data["email"].(EncryptedValue))
+	assert.Error(t, err)
+}
+
+func TestNewColumnProtector(t *testing.T) {
+	p, err := NewColumnProtector(config.ProtectionCfg{})
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	assert.NoError(t, p.Apply(&Event{}))
+
+	_, err = NewColumnProtector(config.ProtectionCfg{
+		Encrypt:    map[string][]string{"users": {"email"}},
+		Encryption: config.EncryptionKeyCfg{KeyID: "k1", Key: base64.StdEncoding.EncodeToString([]byte("short"))},
+	})
+	assert.ErrorContains(t, err, "new cipher")
+}
@@ -4,29 +4,72 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/goccy/go-json"
+	"cloud.google.com/go/pubsub"
+)
+
+// message attributes of the Pub/Sub, SQS and SNS events, e.g. for the subscription filters.
+const (
+	attrSchema = "schema"
+	attrTable  = "table"
+	attrAction = "action"
 )
 
 // GooglePubSubPublisher represent Pub/Sub publisher.
 type GooglePubSubPublisher struct {
 	pubSubConnection *PubSubConnection
+	marshaler        Marshaler
 }
 
 // NewGooglePubSubPublisher create new instance of GooglePubSubPublisher.
-func NewGooglePubSubPublisher(pubSubConnection *PubSubConnection) *GooglePubSubPublisher {
+func NewGooglePubSubPublisher(pubSubConnection *PubSubConnection, marshaler Marshaler) *GooglePubSubPublisher {
 	return &GooglePubSubPublisher{
 		pubSubConnection,
+		marshaler,
 	}
 }
 
 // Publish send events, implements eventPublisher.
 func (p *GooglePubSubPublisher) Publish(ctx context.Context, topic string, event *Event) error {
-	body, err := json.Marshal(event)
+	msg, err := pubSubMessage(eventMarshaler(event, p.marshaler), event, p.pubSubConnection.ordering)
 	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
+		return Permanent(err)
+	}
+
+	return p.pubSubConnection.Publish(ctx, topic, msg)
+}
+
+// pubSubMessage returns the message of the event, the schema, table and action are its attributes.
+// With ordering the events of a row share the ordering key, the values of its key columns.
+func pubSubMessage(marshaler Marshaler, event *Event, ordering bool) (*pubsub.Message, error) {
+	body, err := marshaler.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	attributes := map[string]string{
+		attrSchema: event.Schema,
+		attrTable:  event.Table,
+	}
+
+	if event.Action != "" {
+		attributes[attrAction] = event.Action
+	}
+
+	if encoding := marshaler.ContentEncoding(); encoding != "" {
+		attributes[headerContentEncoding] = encoding
+	}
+
+	if event.SchemaFingerprint != "" {
+		attributes[headerSchemaFingerprint] = event.SchemaFingerprint
+	}
+
+	msg := &pubsub.Message{Data: body, Attributes: attributes}
+
+	if ordering {
+		msg.OrderingKey = event.RowKey()
 	}
 
-	return p.pubSubConnection.Publish(ctx, topic, body)
+	return msg, nil
 }
 
 func (p *GooglePubSubPublisher) Close() error {
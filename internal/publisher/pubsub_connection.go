@@ -16,12 +16,19 @@ type PubSubConnection struct {
 	logger    *slog.Logger
 	client    *pubsub.Client
 	projectID string
+	ordering  bool // message ordering by the ordering key
 	topics    map[string]*pubsub.Topic
 	mu        sync.RWMutex
 }
 
 // NewPubSubConnection create new connection with specified project id.
-func NewPubSubConnection(ctx context.Context, logger *slog.Logger, pubSubProjectID string) (*PubSubConnection, error) {
+// With ordering the messages with the same ordering key are delivered in order.
+func NewPubSubConnection(
+	ctx context.Context,
+	logger *slog.Logger,
+	pubSubProjectID string,
+	ordering bool,
+) (*PubSubConnection, error) {
 	if pubSubProjectID == "" {
 		return nil, fmt.Errorf("project id is required for pub sub connection")
 	}
@@ -35,6 +42,7 @@ func NewPubSubConnection(ctx context.Context, logger *slog.Logger, pubSubProject
 		logger:    logger,
 		client:    cli,
 		projectID: pubSubProjectID,
+		ordering:  ordering,
 		topics:    make(map[string]*pubsub.Topic),
 	}, nil
 }
@@ -50,22 +58,26 @@ func (c *PubSubConnection) getTopic(topic string) *pubsub.Topic {
 	t := c.client.TopicInProject(topic, c.projectID)
 	t.PublishSettings.NumGoroutines = 1
 	t.PublishSettings.CountThreshold = 1
+	t.EnableMessageOrdering = c.ordering
 	c.topics[topic] = t
 
 	return t
 }
 
-func (c *PubSubConnection) Publish(ctx context.Context, topic string, data []byte) error {
+func (c *PubSubConnection) Publish(ctx context.Context, topic string, msg *pubsub.Message) error {
 	t := c.getTopic(topic)
 	defer t.Flush()
 
-	res := t.Publish(ctx, &pubsub.Message{
-		Data: data,
-	})
+	res := t.Publish(ctx, msg)
 
 	if _, err := res.Get(ctx); err != nil {
 		c.logger.Error("Failed to publish message", "err", err)
 
+		// the failed ordering key is paused, the retry of the message resumes it.
+		if msg.OrderingKey != "" {
+			t.ResumePublish(msg.OrderingKey)
+		}
+
 		if status.Code(err) == codes.NotFound {
 			return fmt.Errorf("topic not found %w", err)
 		}
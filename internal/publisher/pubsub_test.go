@@ -0,0 +1,58 @@
+package publisher
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestPubSubMessage(t *testing.T) {
+	event := &Event{
+		Schema:            "public",
+		Table:             "users",
+		Action:            "UPDATE",
+		Data:              map[string]any{"tenant": "acme", "id": 7},
+		KeyColumns:        []string{"tenant", "id"},
+		SchemaFingerprint: "abc",
+	}
+
+	t.Run("attributes", func(t *testing.T) {
+		msg, err := pubSubMessage(JSONMarshaler{}, event, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]string{
+			"schema":             "public",
+			"table":              "users",
+			"action":             "UPDATE",
+			"Schema-Fingerprint": "abc",
+		}, msg.Attributes)
+
+		var got Event
+
+		require.NoError(t, json.Unmarshal(msg.Data, &got))
+		assert.Equal(t, "users", got.Table)
+		assert.Empty(t, msg.OrderingKey)
+	})
+
+	t.Run("ordering by the row key", func(t *testing.T) {
+		msg, err := pubSubMessage(JSONMarshaler{}, event, true)
+		require.NoError(t, err)
+
+		assert.Equal(t, event.RowKey(), msg.OrderingKey)
+		assert.NotEmpty(t, msg.OrderingKey)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		m, err := NewMarshaler(config.FormatJSON, config.CompressionGzip)
+		require.NoError(t, err)
+
+		msg, err := pubSubMessage(m, event, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, "gzip", msg.Attributes["Content-Encoding"])
+	})
+}
@@ -5,42 +5,55 @@ import (
 	"fmt"
 	"github.com/ihippik/wal-listener/v2/internal/config"
 
-	"github.com/goccy/go-json"
 	"github.com/wagslane/go-rabbitmq"
 )
 
+const defaultRabbitExchangeKind = "topic"
+
 // RabbitPublisher represent event publisher for RabbitMQ.
 type RabbitPublisher struct {
 	pt        string
 	conn      *rabbitmq.Conn
 	publisher *rabbitmq.Publisher
+	marshaler Marshaler
 }
 
 // NewRabbitPublisher create new RabbitPublisher instance.
-func NewRabbitPublisher(pubTopic string, conn *rabbitmq.Conn, publisher *rabbitmq.Publisher) (*RabbitPublisher, error) {
+func NewRabbitPublisher(
+	pubTopic string,
+	conn *rabbitmq.Conn,
+	publisher *rabbitmq.Publisher,
+	marshaler Marshaler,
+) (*RabbitPublisher, error) {
 	return &RabbitPublisher{
 		pubTopic,
 		conn,
 		publisher,
+		marshaler,
 	}, nil
 }
 
 // Publish send events, implements eventPublisher.
 func (p *RabbitPublisher) Publish(ctx context.Context, topic string, event *Event) error {
-	const contentTypeJSON = "application/json"
+	marshaler := eventMarshaler(event, p.marshaler)
 
-	body, err := json.Marshal(event)
+	body, err := marshaler.Marshal(event)
 	if err != nil {
-		return err
+		return Permanent(err)
 	}
 
-	return p.publisher.PublishWithContext(
-		ctx,
-		body,
-		[]string{topic},
-		rabbitmq.WithPublishOptionsContentType(contentTypeJSON),
-		rabbitmq.WithPublishOptionsExchange(p.pt),
-	)
+	return p.publisher.PublishWithContext(ctx, body, []string{topic}, rabbitPublishOptions(p.pt, marshaler, event)...)
+}
+
+// rabbitPublishOptions returns the options of the event message: persistent, with the event ID as the message ID.
+func rabbitPublishOptions(exchange string, marshaler Marshaler, event *Event) []func(*rabbitmq.PublishOptions) {
+	return []func(*rabbitmq.PublishOptions){
+		rabbitmq.WithPublishOptionsContentType(marshaler.ContentType()),
+		rabbitmq.WithPublishOptionsContentEncoding(marshaler.ContentEncoding()),
+		rabbitmq.WithPublishOptionsExchange(exchange),
+		rabbitmq.WithPublishOptionsPersistentDelivery,
+		rabbitmq.WithPublishOptionsMessageID(event.ID.String()),
+	}
 }
 
 // Close represent finalization for RabbitMQ publisher.
@@ -64,14 +77,19 @@ func NewConnection(pCfg *config.PublisherCfg) (*rabbitmq.Conn, error) {
 	return conn, nil
 }
 
-// NewPublisher represent constructor for RabbitMQ publisher.
-func NewPublisher(topic string, conn *rabbitmq.Conn) (*rabbitmq.Publisher, error) {
+// NewPublisher represent constructor for RabbitMQ publisher, the durable exchange of the kind is declared.
+func NewPublisher(topic string, cfg config.RabbitMQCfg, conn *rabbitmq.Conn) (*rabbitmq.Publisher, error) {
+	kind := cfg.ExchangeKind
+	if kind == "" {
+		kind = defaultRabbitExchangeKind
+	}
+
 	publisher, err := rabbitmq.NewPublisher(
 		conn,
 		rabbitmq.WithPublisherOptionsLogging,
 		rabbitmq.WithPublisherOptionsExchangeName(topic),
 		rabbitmq.WithPublisherOptionsExchangeDeclare,
-		rabbitmq.WithPublisherOptionsExchangeKind("topic"),
+		rabbitmq.WithPublisherOptionsExchangeKind(kind),
 		rabbitmq.WithPublisherOptionsExchangeDurable,
 	)
 	if err != nil {
@@ -0,0 +1,24 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func TestRabbitPublishOptions(t *testing.T) {
+	event := &Event{ID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), Table: "users", Action: "INSERT"}
+
+	var opts rabbitmq.PublishOptions
+
+	for _, opt := range rabbitPublishOptions("wal", JSONMarshaler{}, event) {
+		opt(&opts)
+	}
+
+	assert.Equal(t, "wal", opts.Exchange)
+	assert.Equal(t, "application/json", opts.ContentType)
+	assert.Equal(t, rabbitmq.Persistent, opts.DeliveryMode)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", opts.MessageID)
+}
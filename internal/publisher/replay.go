@@ -0,0 +1,209 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/goccy/go-json"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// deadLetterSource reads dead-letter records.
+type deadLetterSource interface {
+	Read(ctx context.Context, handler func(*DeadLetter) error) error
+}
+
+// ReplayFilter selects dead-letter records for the replay.
+type ReplayFilter struct {
+	Tables []string  // empty means all tables
+	From   time.Time // dead-lettered at or after, zero means no lower bound
+	To     time.Time // dead-lettered before, zero means no upper bound
+}
+
+// Match checks whether the dead-letter record satisfies the filter.
+func (f ReplayFilter) Match(dl *DeadLetter) bool {
+	if len(f.Tables) > 0 && !slices.Contains(f.Tables, dl.Event.Table) {
+		return false
+	}
+
+	if !f.From.IsZero() && dl.Timestamp.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && !dl.Timestamp.Before(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// Replayer re-publishes dead-letter records to their original topics.
+type Replayer struct {
+	logger    *slog.Logger
+	source    deadLetterSource
+	publisher Publisher
+}
+
+// NewReplayer create new Replayer instance.
+func NewReplayer(logger *slog.Logger, source deadLetterSource, publisher Publisher) *Replayer {
+	return &Replayer{logger: logger, source: source, publisher: publisher}
+}
+
+var errEmptyDeadLetter = errors.New("dead letter without event")
+
+// Replay publishes the matched records and returns the number of replayed events.
+func (r *Replayer) Replay(ctx context.Context, filter ReplayFilter) (int, error) {
+	var replayed int
+
+	err := r.source.Read(ctx, func(dl *DeadLetter) error {
+		if dl.Event == nil {
+			return errEmptyDeadLetter
+		}
+
+		if !filter.Match(dl) {
+			return nil
+		}
+
+		dl.Event.Key = dl.Key
+
+		if err := r.publisher.Publish(ctx, dl.Topic, dl.Event); err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+
+		replayed++
+
+		r.logger.Info(
+			"dead letter was replayed",
+			slog.String("topic", dl.Topic),
+			slog.String("table", dl.Event.Table),
+			slog.String("id", dl.Event.ID.String()),
+		)
+
+		return nil
+	})
+	if err != nil {
+		return replayed, fmt.Errorf("read: %w", err)
+	}
+
+	return replayed, nil
+}
+
+// KafkaDeadLetterSource reads dead-letter records from a Kafka topic.
+type KafkaDeadLetterSource struct {
+	client sarama.Client
+	topic  string
+}
+
+// NewKafkaDeadLetterSource return new KafkaDeadLetterSource instance.
+// The topic is read from the dead-letter cluster if configured.
+func NewKafkaDeadLetterSource(pCfg *config.PublisherCfg) (*KafkaDeadLetterSource, error) {
+	cfg, err := newSaramaConfig(pCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := pCfg.Address
+	if pCfg.DeadLetter.Address != "" {
+		addr = pCfg.DeadLetter.Address
+	}
+
+	client, err := sarama.NewClient([]string{addr}, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new client: %w", err)
+	}
+
+	return &KafkaDeadLetterSource{client: client, topic: pCfg.DeadLetterTopic}, nil
+}
+
+// Read consumes every partition from the oldest offset up to the offset observed at start.
+func (s *KafkaDeadLetterSource) Read(ctx context.Context, handler func(*DeadLetter) error) error {
+	consumer, err := sarama.NewConsumerFromClient(s.client)
+	if err != nil {
+		return fmt.Errorf("new consumer: %w", err)
+	}
+
+	defer consumer.Close()
+
+	partitions, err := s.client.Partitions(s.topic)
+	if err != nil {
+		return fmt.Errorf("partitions: %w", err)
+	}
+
+	for _, partition := range partitions {
+		if err := s.readPartition(ctx, consumer, partition, handler); err != nil {
+			return fmt.Errorf("partition %d: %w", partition, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *KafkaDeadLetterSource) readPartition(
+	ctx context.Context,
+	consumer sarama.Consumer,
+	partition int32,
+	handler func(*DeadLetter) error,
+) error {
+	oldest, err := s.client.GetOffset(s.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return fmt.Errorf("oldest offset: %w", err)
+	}
+
+	newest, err := s.client.GetOffset(s.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return fmt.Errorf("newest offset: %w", err)
+	}
+
+	if oldest >= newest {
+		return nil
+	}
+
+	pc, err := consumer.ConsumePartition(s.topic, partition, oldest)
+	if err != nil {
+		return fmt.Errorf("consume partition: %w", err)
+	}
+
+	defer pc.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-pc.Errors():
+			return err
+		case msg := <-pc.Messages():
+			var dl DeadLetter
+
+			if err := json.Unmarshal(msg.Value, &dl); err != nil {
+				return fmt.Errorf("unmarshal offset %d: %w", msg.Offset, err)
+			}
+
+			if dl.Event != nil && len(msg.Headers) > 0 {
+				dl.Event.Headers = make(map[string]string, len(msg.Headers))
+
+				for _, h := range msg.Headers {
+					dl.Event.Headers[string(h.Key)] = string(h.Value)
+				}
+			}
+
+			if err := handler(&dl); err != nil {
+				return err
+			}
+
+			if msg.Offset >= newest-1 {
+				return nil
+			}
+		}
+	}
+}
+
+// Close Kafka client.
+func (s *KafkaDeadLetterSource) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,111 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceSource []*DeadLetter
+
+func (s sliceSource) Read(_ context.Context, handler func(*DeadLetter) error) error {
+	for _, dl := range s {
+		if err := handler(dl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type published struct {
+	topic string
+	event *Event
+}
+
+type publisherMock struct {
+	published []published
+	err       error
+}
+
+func (p *publisherMock) Publish(_ context.Context, topic string, event *Event) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	p.published = append(p.published, published{topic: topic, event: event})
+
+	return nil
+}
+
+func TestReplayer_Replay(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	newDeadLetter := func(table string, ts time.Time) *DeadLetter {
+		return &DeadLetter{
+			Event: &Event{
+				ID:     uuid.New(),
+				Schema: "public",
+				Table:  table,
+				Action: "INSERT",
+				Data:   map[string]any{"id": float64(1)},
+			},
+			Topic:     "wal_listener.public_" + table,
+			Key:       table + "-1",
+			Error:     "kafka: broker not available",
+			Attempts:  3,
+			Timestamp: ts,
+		}
+	}
+
+	t.Run("replay to target", func(t *testing.T) {
+		dl := newDeadLetter("users", now)
+		pub := new(publisherMock)
+
+		got, err := NewReplayer(logger, sliceSource{dl}, pub).Replay(context.Background(), ReplayFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, got)
+		require.Len(t, pub.published, 1)
+		assert.Equal(t, "wal_listener.public_users", pub.published[0].topic)
+		assert.Equal(t, dl.Event.ID, pub.published[0].event.ID)
+		assert.Equal(t, "users-1", pub.published[0].event.Key)
+	})
+
+	t.Run("filter by table and time", func(t *testing.T) {
+		source := sliceSource{
+			newDeadLetter("users", now.Add(-2*time.Hour)),
+			newDeadLetter("users", now),
+			newDeadLetter("orders", now),
+			newDeadLetter("users", now.Add(2*time.Hour)),
+		}
+		pub := new(publisherMock)
+		filter := ReplayFilter{
+			Tables: []string{"users"},
+			From:   now.Add(-time.Hour),
+			To:     now.Add(time.Hour),
+		}
+
+		got, err := NewReplayer(logger, source, pub).Replay(context.Background(), filter)
+		require.NoError(t, err)
+		assert.Equal(t, 1, got)
+		require.Len(t, pub.published, 1)
+		assert.Equal(t, source[1].Event.ID, pub.published[0].event.ID)
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		pub := &publisherMock{err: errors.New("some err")}
+
+		got, err := NewReplayer(logger, sliceSource{newDeadLetter("users", now)}, pub).
+			Replay(context.Background(), ReplayFilter{})
+		require.ErrorContains(t, err, "publish: some err")
+		assert.Equal(t, 0, got)
+	})
+}
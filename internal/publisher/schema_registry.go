@@ -0,0 +1,114 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+const (
+	defaultSchemaRegistryTimeout = 10 * time.Second
+	schemaRegistryContentType    = "application/vnd.schemaregistry.v1+json"
+)
+
+// SchemaRegistry registers the schemas in the Confluent Schema Registry and caches their IDs.
+type SchemaRegistry struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+
+	mu  sync.Mutex
+	ids map[string]int // subject and schema -> schema ID
+}
+
+// NewSchemaRegistry return new SchemaRegistry instance.
+func NewSchemaRegistry(cfg config.SchemaRegistryCfg) *SchemaRegistry {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultSchemaRegistryTimeout
+	}
+
+	return &SchemaRegistry{
+		url:      strings.TrimRight(cfg.URL, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   &http.Client{Timeout: timeout},
+		ids:      make(map[string]int),
+	}
+}
+
+// SchemaID returns the ID of the schema under the subject. The schema is registered on the first use,
+// the registry returns the ID of an already registered schema, so it's looked up the same way.
+func (r *SchemaRegistry) SchemaID(ctx context.Context, subject, schema string) (int, error) {
+	key := subject + "\x00" + schema
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id, ok := r.ids[key]; ok {
+		return id, nil
+	}
+
+	id, err := r.register(ctx, subject, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	r.ids[key] = id
+
+	return id, nil
+}
+
+func (r *SchemaRegistry) register(ctx context.Context, subject, schema string) (int, error) {
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, fmt.Errorf("marshal schema: %w", err)
+	}
+
+	endpoint := r.url + "/subjects/" + url.PathEscape(subject) + "/versions"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("new request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("register schema: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLimit))
+		return 0, fmt.Errorf("register schema of %s: unexpected status %s: %s",
+			subject, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var registered struct {
+		ID int `json:"id"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+
+	return registered.ID, nil
+}
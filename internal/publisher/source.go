@@ -0,0 +1,51 @@
+package publisher
+
+import (
+	"os"
+
+	scfg "github.com/ihippik/config"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+// EventSource identifies the listener instance which produced the event.
+type EventSource struct {
+	Version  string `json:"version"`
+	Hostname string `json:"hostname"`
+}
+
+// envPodName is set by the Kubernetes downward API.
+const envPodName = "POD_NAME"
+
+// NewEventSource returns the source metadata of the events, nil if disabled.
+// Values which are not configured are detected from the build info and the environment.
+func NewEventSource(cfg config.SourceCfg) *EventSource {
+	return newEventSource(cfg, scfg.GetVersion, os.Getenv, os.Hostname)
+}
+
+func newEventSource(
+	cfg config.SourceCfg,
+	version func() string,
+	getenv func(string) string,
+	hostname func() (string, error),
+) *EventSource {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	src := &EventSource{Version: cfg.Version, Hostname: cfg.Hostname}
+
+	if src.Version == "" {
+		src.Version = version()
+	}
+
+	if src.Hostname == "" {
+		src.Hostname = getenv(envPodName)
+	}
+
+	if src.Hostname == "" {
+		src.Hostname, _ = hostname()
+	}
+
+	return src
+}
@@ -0,0 +1,65 @@
+package publisher
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestNewEventSource(t *testing.T) {
+	version := func() string { return "a1b2" }
+	hostname := func() (string, error) { return "host-1", nil }
+
+	tests := []struct {
+		name     string
+		cfg      config.SourceCfg
+		env      map[string]string
+		hostname func() (string, error)
+		want     *EventSource
+	}{
+		{
+			name: "disabled",
+			cfg:  config.SourceCfg{Version: "1.0.0"},
+			want: nil,
+		},
+		{
+			name:     "auto-detected",
+			cfg:      config.SourceCfg{Enabled: true},
+			hostname: hostname,
+			want:     &EventSource{Version: "a1b2", Hostname: "host-1"},
+		},
+		{
+			name:     "pod name",
+			cfg:      config.SourceCfg{Enabled: true},
+			env:      map[string]string{"POD_NAME": "wal-listener-7d9f"},
+			hostname: hostname,
+			want:     &EventSource{Version: "a1b2", Hostname: "wal-listener-7d9f"},
+		},
+		{
+			name:     "configured",
+			cfg:      config.SourceCfg{Enabled: true, Version: "1.0.0", Hostname: "eu-1"},
+			env:      map[string]string{"POD_NAME": "wal-listener-7d9f"},
+			hostname: hostname,
+			want:     &EventSource{Version: "1.0.0", Hostname: "eu-1"},
+		},
+		{
+			name: "hostname error",
+			cfg:  config.SourceCfg{Enabled: true},
+			hostname: func() (string, error) {
+				return "", errors.New("some err")
+			},
+			want: &EventSource{Version: "a1b2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+
+			assert.Equal(t, tt.want, newEventSource(tt.cfg, version, getenv, tt.hostname))
+		})
+	}
+}
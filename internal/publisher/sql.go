@@ -0,0 +1,402 @@
+package publisher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-json"
+	_ "github.com/jackc/pgx/stdlib" // registers the pgx database/sql driver
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+const (
+	defaultSQLDriver = "pgx"
+	// sqlMaxParams is the limit of the bind parameters of a statement in the PostgreSQL protocol.
+	sqlMaxParams = 65535
+)
+
+// SQLPublisher applies events to tables of another SQL database: inserts and updates as upserts, deletes by key.
+// Statements use $n placeholders and ON CONFLICT upserts (PostgreSQL, SQLite).
+type SQLPublisher struct {
+	db     *sql.DB
+	tables map[string]sqlTable
+}
+
+// sqlTable the target table of the source table.
+type sqlTable struct {
+	target  string
+	columns map[string]string // source column -> target column, nil means the same names
+	key     []string          // conflict key, target columns
+}
+
+// NewSQLConnection opens the target database, the publisher address is the DSN.
+func NewSQLConnection(pCfg *config.PublisherCfg) (*sql.DB, error) {
+	driver := pCfg.SQL.Driver
+	if driver == "" {
+		driver = defaultSQLDriver
+	}
+
+	db, err := sql.Open(driver, pCfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	return db, nil
+}
+
+// NewSQLPublisher return new SQLPublisher instance.
+func NewSQLPublisher(db *sql.DB, cfg config.SQLSinkCfg) *SQLPublisher {
+	tables := make(map[string]sqlTable, len(cfg.Tables))
+
+	for source, t := range cfg.Tables {
+		tables[source] = sqlTable{target: t.Target, columns: t.Columns, key: t.ConflictKey}
+	}
+
+	return &SQLPublisher{db: db, tables: tables}
+}
+
+// targetTable returns the target of the event table, configured by the schema-qualified name
+// or by the bare table name.
+func (p *SQLPublisher) targetTable(event *Event) (sqlTable, bool) {
+	if table, ok := p.tables[event.Schema+"."+event.Table]; ok {
+		return table, true
+	}
+
+	table, ok := p.tables[event.Table]
+
+	return table, ok
+}
+
+// Publish applies the event, the topic is ignored. Implements eventPublisher.
+func (p *SQLPublisher) Publish(ctx context.Context, _ string, event *Event) error {
+	return p.PublishBatch(ctx, []Message{{Event: event}})
+}
+
+// PublishBatch applies the events in one transaction.
+// Consecutive upserts of a table with the same columns and distinct keys are sent as one multi-row insert.
+func (p *SQLPublisher) PublishBatch(ctx context.Context, messages []Message) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	var batch *upsertBatch
+
+	flush := func() error {
+		if batch == nil {
+			return nil
+		}
+
+		query, args := batch.statement()
+		batch = nil
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("upsert: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, msg := range messages {
+		event := msg.Event
+
+		table, ok := p.targetTable(event)
+		if !ok {
+			return fmt.Errorf("no target table for %s.%s", event.Schema, event.Table)
+		}
+
+		switch event.Action {
+		case "INSERT", "UPDATE":
+			columns, values, err := table.row(event.Data)
+			if err != nil {
+				return err
+			}
+
+			// the row with the old key is deleted, the upsert would leave it behind.
+			if event.Action == "UPDATE" && table.keyChanged(event) {
+				if err := flush(); err != nil {
+					return err
+				}
+
+				if err := execDelete(ctx, tx, table, event); err != nil {
+					return err
+				}
+			}
+
+			if batch != nil && batch.accepts(table, columns, values) {
+				batch.add(values)
+				continue
+			}
+
+			if err := flush(); err != nil {
+				return err
+			}
+
+			batch = newUpsertBatch(table, columns, values)
+		case "DELETE":
+			if err := flush(); err != nil {
+				return err
+			}
+
+			if err := execDelete(ctx, tx, table, event); err != nil {
+				return err
+			}
+		default:
+			// truncates and other actions are not mirrored.
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// execDelete deletes the row of the event by the key.
+func execDelete(ctx context.Context, tx *sql.Tx, table sqlTable, event *Event) error {
+	query, args, err := table.delete(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the database.
+func (p *SQLPublisher) Close() error {
+	return p.db.Close()
+}
+
+// row returns the sorted target columns and their values of the source row.
+func (t sqlTable) row(data map[string]any) ([]string, []any, error) {
+	names := make([]string, 0, len(data))
+
+	for source := range data {
+		if target := t.column(source); target != "" {
+			names = append(names, source)
+		}
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		return strings.Compare(t.column(a), t.column(b))
+	})
+
+	columns := make([]string, 0, len(names))
+	values := make([]any, 0, len(names))
+
+	for _, source := range names {
+		val, err := sqlValue(data[source])
+		if err != nil {
+			return nil, nil, fmt.Errorf("column %s: %w", source, err)
+		}
+
+		columns = append(columns, t.column(source))
+		values = append(values, val)
+	}
+
+	return columns, values, nil
+}
+
+// column returns the target column of the source column, empty if it isn't mapped.
+func (t sqlTable) column(source string) string {
+	if t.columns == nil {
+		return source
+	}
+
+	return t.columns[source]
+}
+
+// delete returns the statement deleting the row by the conflict key, taken from the old row if present.
+func (t sqlTable) delete(event *Event) (string, []any, error) {
+	conditions := make([]string, 0, len(t.key))
+	args := make([]any, 0, len(t.key))
+
+	for _, target := range t.key {
+		val, ok := t.keyValue(target, event)
+		if !ok {
+			return "", nil, fmt.Errorf("delete from %s: no value of key column %s", t.target, target)
+		}
+
+		args = append(args, val)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", quoteIdent(target), len(args)))
+	}
+
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", quoteIdent(t.target), strings.Join(conditions, " AND ")), args, nil
+}
+
+func (t sqlTable) keyValue(target string, event *Event) (any, bool) {
+	for _, data := range []map[string]any{event.DataOld, event.Data} {
+		if val, ok := t.targetValue(target, data); ok {
+			return val, true
+		}
+	}
+
+	return nil, false
+}
+
+// targetValue returns the value of the source column mapped to the target column.
+func (t sqlTable) targetValue(target string, data map[string]any) (any, bool) {
+	for source, val := range data {
+		if t.column(source) == target {
+			return val, true
+		}
+	}
+
+	return nil, false
+}
+
+// keyChanged reports whether the update changed the conflict key, the old key is in the old row.
+func (t sqlTable) keyChanged(event *Event) bool {
+	for _, target := range t.key {
+		oldVal, ok := t.targetValue(target, event.DataOld)
+		if !ok {
+			continue
+		}
+
+		newVal, ok := t.targetValue(target, event.Data)
+		if ok && fmt.Sprintf("%v", oldVal) != fmt.Sprintf("%v", newVal) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyValues returns the conflict key values of the row, used to keep a multi-row upsert free of duplicates.
+func (t sqlTable) keyValues(columns []string, values []any) string {
+	key := make([]string, 0, len(t.key))
+
+	for _, target := range t.key {
+		if i := slices.Index(columns, target); i >= 0 {
+			key = append(key, fmt.Sprintf("%v", values[i]))
+		}
+	}
+
+	return strings.Join(key, keySeparator)
+}
+
+// upsertBatch multi-row upsert into one table.
+type upsertBatch struct {
+	table   sqlTable
+	columns []string
+	rows    [][]any
+	keys    map[string]struct{}
+}
+
+func newUpsertBatch(table sqlTable, columns []string, values []any) *upsertBatch {
+	b := &upsertBatch{table: table, columns: columns, keys: make(map[string]struct{})}
+	b.add(values)
+
+	return b
+}
+
+// accepts reports whether the row can be added: the same table and columns, and a key not in the batch yet
+// (a multi-row upsert can't affect the same row twice). The statement is kept within the bind parameters limit.
+func (b *upsertBatch) accepts(table sqlTable, columns []string, values []any) bool {
+	if b.table.target != table.target || !slices.Equal(b.columns, columns) {
+		return false
+	}
+
+	if (len(b.rows)+1)*len(b.columns) > sqlMaxParams {
+		return false
+	}
+
+	_, exists := b.keys[table.keyValues(columns, values)]
+
+	return !exists
+}
+
+func (b *upsertBatch) add(values []any) {
+	b.rows = append(b.rows, values)
+	b.keys[b.table.keyValues(b.columns, values)] = struct{}{}
+}
+
+// statement returns the INSERT ... ON CONFLICT DO UPDATE statement of the batch.
+func (b *upsertBatch) statement() (string, []any) {
+	quoted := make([]string, 0, len(b.columns))
+	updates := make([]string, 0, len(b.columns))
+
+	for _, col := range b.columns {
+		quoted = append(quoted, quoteIdent(col))
+
+		if !slices.Contains(b.table.key, col) {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quoteIdent(col), quoteIdent(col)))
+		}
+	}
+
+	key := make([]string, 0, len(b.table.key))
+	for _, col := range b.table.key {
+		key = append(key, quoteIdent(col))
+	}
+
+	args := make([]any, 0, len(b.rows)*len(b.columns))
+	tuples := make([]string, 0, len(b.rows))
+
+	for _, row := range b.rows {
+		placeholders := make([]string, 0, len(row))
+
+		for _, val := range row {
+			args = append(args, val)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+
+		tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	conflict := "DO NOTHING"
+	if len(updates) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) %s",
+		quoteIdent(b.table.target),
+		strings.Join(quoted, ", "),
+		strings.Join(tuples, ", "),
+		strings.Join(key, ", "),
+		conflict,
+	)
+
+	return query, args
+}
+
+// sqlValue converts the event value to a driver value, composite values are stored as JSON.
+func sqlValue(val any) (any, error) {
+	switch val.(type) {
+	case map[string]any, []any:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, Permanent(fmt.Errorf("marshal: %w", err))
+		}
+
+		return string(data), nil
+	default:
+		return val, nil
+	}
+}
+
+// quoteIdent quotes the optionally schema-qualified identifier.
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,237 @@
+package publisher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func newSQLiteTarget(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file::memory:")
+	require.NoError(t, err)
+
+	// every connection of an in-memory database is a separate database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE mirror_users (user_id INTEGER PRIMARY KEY, name TEXT, tags TEXT)`)
+	require.NoError(t, err)
+
+	return db
+}
+
+type mirrorUser struct {
+	ID   int64
+	Name string
+	Tags sql.NullString
+}
+
+func readMirror(t *testing.T, db *sql.DB) []mirrorUser {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT user_id, name, tags FROM mirror_users ORDER BY user_id`)
+	require.NoError(t, err)
+
+	defer rows.Close()
+
+	var users []mirrorUser
+
+	for rows.Next() {
+		var u mirrorUser
+		require.NoError(t, rows.Scan(&u.ID, &u.Name, &u.Tags))
+		users = append(users, u)
+	}
+
+	require.NoError(t, rows.Err())
+
+	return users
+}
+
+func TestSQLPublisher_Publish(t *testing.T) {
+	db := newSQLiteTarget(t)
+	pub := NewSQLPublisher(db, config.SQLSinkCfg{
+		Tables: map[string]config.SQLTableCfg{
+			"users": {
+				Target:      "mirror_users",
+				Columns:     map[string]string{"id": "user_id", "name": "name", "tags": "tags"},
+				ConflictKey: []string{"user_id"},
+			},
+		},
+	})
+
+	ctx := context.Background()
+
+	require.NoError(t, pub.Publish(ctx, "wal.public_users", &Event{
+		Table:  "users",
+		Action: "INSERT",
+		Data:   map[string]any{"id": 1, "name": "john", "password": "secret"},
+	}))
+	assert.Equal(t, []mirrorUser{{ID: 1, Name: "john"}}, readMirror(t, db))
+
+	require.NoError(t, pub.Publish(ctx, "wal.public_users", &Event{
+		Table:  "users",
+		Action: "UPDATE",
+		Data:   map[string]any{"id": 1, "name": "johnny", "tags": []any{"admin"}},
+	}))
+	assert.Equal(t, []mirrorUser{
+		{ID: 1, Name: "johnny", Tags: sql.NullString{String: `["admin"]`, Valid: true}},
+	}, readMirror(t, db))
+
+	require.NoError(t, pub.Publish(ctx, "wal.public_users", &Event{
+		Table:   "users",
+		Action:  "DELETE",
+		Data:    map[string]any{},
+		DataOld: map[string]any{"id": 1},
+	}))
+	assert.Empty(t, readMirror(t, db))
+
+	err := pub.Publish(ctx, "wal.public_orders", &Event{Schema: "public", Table: "orders", Action: "INSERT"})
+	assert.EqualError(t, err, "no target table for public.orders")
+}
+
+func TestSQLPublisher_Publish_SchemaTable(t *testing.T) {
+	db := newSQLiteTarget(t)
+
+	_, err := db.Exec(`CREATE TABLE mirror_billing_users (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	pub := NewSQLPublisher(db, config.SQLSinkCfg{
+		Tables: map[string]config.SQLTableCfg{
+			"billing.users": {Target: "mirror_billing_users", ConflictKey: []string{"id"}},
+			"users": {
+				Target:      "mirror_users",
+				Columns:     map[string]string{"id": "user_id", "name": "name"},
+				ConflictKey: []string{"user_id"},
+			},
+		},
+	})
+
+	ctx := context.Background()
+
+	require.NoError(t, pub.Publish(ctx, "wal.billing_users", &Event{
+		Schema: "billing",
+		Table:  "users",
+		Action: "INSERT",
+		Data:   map[string]any{"id": 7, "name": "acme"},
+	}))
+	require.NoError(t, pub.Publish(ctx, "wal.public_users", &Event{
+		Schema: "public",
+		Table:  "users",
+		Action: "INSERT",
+		Data:   map[string]any{"id": 1, "name": "john"},
+	}))
+
+	assert.Equal(t, []mirrorUser{{ID: 1, Name: "john"}}, readMirror(t, db), "the bare table name of the other schemas")
+
+	var name string
+
+	require.NoError(t, db.QueryRow(`SELECT name FROM mirror_billing_users WHERE id = 7`).Scan(&name))
+	assert.Equal(t, "acme", name)
+}
+
+func TestSQLPublisher_PublishBatch(t *testing.T) {
+	db := newSQLiteTarget(t)
+	pub := NewSQLPublisher(db, config.SQLSinkCfg{
+		Tables: map[string]config.SQLTableCfg{
+			"mirror_users": {Target: "mirror_users", ConflictKey: []string{"user_id"}},
+		},
+	})
+
+	event := func(action string, id int, name string) Message {
+		return Message{Event: &Event{
+			Table:  "mirror_users",
+			Action: action,
+			Data:   map[string]any{"user_id": id, "name": name},
+		}}
+	}
+
+	require.NoError(t, pub.PublishBatch(context.Background(), []Message{
+		event("INSERT", 1, "john"),
+		event("INSERT", 2, "jane"),
+		event("UPDATE", 1, "johnny"), // same key, starts a new statement
+		event("INSERT", 3, "jim"),
+	}))
+
+	assert.Equal(t, []mirrorUser{
+		{ID: 1, Name: "johnny"},
+		{ID: 2, Name: "jane"},
+		{ID: 3, Name: "jim"},
+	}, readMirror(t, db))
+}
+
+func TestSQLPublisher_Publish_KeyChange(t *testing.T) {
+	db := newSQLiteTarget(t)
+	pub := NewSQLPublisher(db, config.SQLSinkCfg{
+		Tables: map[string]config.SQLTableCfg{
+			"users": {
+				Target:      "mirror_users",
+				Columns:     map[string]string{"id": "user_id", "name": "name"},
+				ConflictKey: []string{"user_id"},
+			},
+		},
+	})
+
+	ctx := context.Background()
+
+	require.NoError(t, pub.PublishBatch(ctx, []Message{
+		{Event: &Event{Table: "users", Action: "INSERT", Data: map[string]any{"id": 1, "name": "john"}}},
+		{Event: &Event{Table: "users", Action: "INSERT", Data: map[string]any{"id": 2, "name": "jane"}}},
+		{Event: &Event{
+			Table:   "users",
+			Action:  "UPDATE",
+			Data:    map[string]any{"id": 10, "name": "john"},
+			DataOld: map[string]any{"id": 1},
+		}},
+	}))
+
+	assert.Equal(t, []mirrorUser{{ID: 2, Name: "jane"}, {ID: 10, Name: "john"}}, readMirror(t, db))
+}
+
+func TestUpsertBatch_accepts_ParamsLimit(t *testing.T) {
+	table := sqlTable{target: "users", key: []string{"id"}}
+	columns := make([]string, 1000)
+	values := make([]any, 1000)
+
+	columns[0] = "id"
+
+	for i := 1; i < len(columns); i++ {
+		columns[i] = fmt.Sprintf("c%d", i)
+	}
+
+	row := func(id int) []any {
+		return append([]any{id}, values[1:]...)
+	}
+
+	batch := newUpsertBatch(table, columns, row(0))
+
+	for id := 1; batch.accepts(table, columns, row(id)); id++ {
+		batch.add(row(id))
+	}
+
+	assert.Equal(t, sqlMaxParams/1000, len(batch.rows))
+}
+
+func TestUpsertBatch_statement(t *testing.T) {
+	table := sqlTable{target: "public.users", key: []string{"id"}}
+	batch := newUpsertBatch(table, []string{"id", "name"}, []any{1, "john"})
+
+	require.True(t, batch.accepts(table, []string{"id", "name"}, []any{2, "jane"}))
+	batch.add([]any{2, "jane"})
+
+	assert.False(t, batch.accepts(table, []string{"id", "name"}, []any{1, "johnny"}))
+	assert.False(t, batch.accepts(table, []string{"id"}, []any{3}))
+
+	query, args := batch.statement()
+	assert.Equal(t, `INSERT INTO "public"."users" ("id", "name") VALUES ($1, $2), ($3, $4) `+
+		`ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name"`, query)
+	assert.Equal(t, []any{1, "john", 2, "jane"}, args)
+}
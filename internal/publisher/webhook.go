@@ -0,0 +1,110 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	webhookErrorBodyLimit = 512 // bytes of the response body kept in the error
+)
+
+// WebhookPublisher posts every event to an HTTP endpoint.
+type WebhookPublisher struct {
+	url       string
+	client    *http.Client
+	cfg       config.WebhookCfg
+	marshaler Marshaler
+}
+
+// NewWebhookClient returns the HTTP client with the configured request timeout.
+func NewWebhookClient(cfg config.WebhookCfg) *http.Client {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	return &http.Client{Timeout: timeout}
+}
+
+// NewWebhookPublisher return new WebhookPublisher instance.
+func NewWebhookPublisher(url string, client *http.Client, cfg config.WebhookCfg, marshaler Marshaler) *WebhookPublisher {
+	return &WebhookPublisher{url: url, client: client, cfg: cfg, marshaler: marshaler}
+}
+
+// Publish posts the serialized event, the topic is sent in the configured header or appended to the URL path.
+// Responses other than 2xx are errors, so the event is retried.
+func (p *WebhookPublisher) Publish(ctx context.Context, topic string, event *Event) error {
+	marshaler := eventMarshaler(event, p.marshaler)
+
+	data, err := marshaler.Marshal(event)
+	if err != nil {
+		return Permanent(fmt.Errorf("marshal: %w", err))
+	}
+
+	endpoint := p.url
+	if p.cfg.TopicHeader == "" {
+		if endpoint, err = url.JoinPath(p.url, topic); err != nil {
+			return fmt.Errorf("endpoint: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+
+	for name, value := range p.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	req.Header.Set("Content-Type", marshaler.ContentType())
+
+	if encoding := marshaler.ContentEncoding(); encoding != "" {
+		req.Header.Set(headerContentEncoding, encoding)
+	}
+
+	if event.SchemaFingerprint != "" {
+		req.Header.Set(headerSchemaFingerprint, event.SchemaFingerprint)
+	}
+
+	if p.cfg.TopicHeader != "" {
+		req.Header.Set(p.cfg.TopicHeader, topic)
+	}
+
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLimit))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	// drained, so the connection is reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+// Close releases the idle connections.
+func (p *WebhookPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,89 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ihippik/wal-listener/v2/internal/config"
+)
+
+func TestWebhookPublisher_Publish(t *testing.T) {
+	event := &Event{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Schema:    "public",
+		Table:     "users",
+		Action:    "INSERT",
+		Data:      map[string]any{"id": 1},
+		EventTime: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	type request struct {
+		path    string
+		headers http.Header
+		event   Event
+	}
+
+	newServer := func(t *testing.T, status int) (*httptest.Server, *request) {
+		var got request
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(body, &got.event))
+
+			got.path = r.URL.Path
+			got.headers = r.Header
+
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("slow down\n"))
+		}))
+		t.Cleanup(srv.Close)
+
+		return srv, &got
+	}
+
+	t.Run("topic in the path", func(t *testing.T) {
+		srv, got := newServer(t, http.StatusAccepted)
+		cfg := config.WebhookCfg{Token: "secret", Headers: map[string]string{"X-Api-Key": "key"}}
+
+		pub := NewWebhookPublisher(srv.URL+"/wal/", NewWebhookClient(cfg), cfg, JSONMarshaler{})
+		require.NoError(t, pub.Publish(context.Background(), "public_users", event))
+
+		assert.Equal(t, "/wal/public_users", got.path)
+		assert.Equal(t, "Bearer secret", got.headers.Get("Authorization"))
+		assert.Equal(t, "key", got.headers.Get("X-Api-Key"))
+		assert.Equal(t, "application/json", got.headers.Get("Content-Type"))
+		assert.Equal(t, event.ID, got.event.ID)
+		assert.Equal(t, "users", got.event.Table)
+	})
+
+	t.Run("topic in the header", func(t *testing.T) {
+		srv, got := newServer(t, http.StatusOK)
+		cfg := config.WebhookCfg{TopicHeader: "X-Topic"}
+
+		pub := NewWebhookPublisher(srv.URL+"/wal", NewWebhookClient(cfg), cfg, JSONMarshaler{})
+		require.NoError(t, pub.Publish(context.Background(), "public_users", event))
+
+		assert.Equal(t, "/wal", got.path)
+		assert.Equal(t, "public_users", got.headers.Get("X-Topic"))
+		assert.Empty(t, got.headers.Get("Authorization"))
+	})
+
+	t.Run("non-2xx response", func(t *testing.T) {
+		srv, _ := newServer(t, http.StatusTooManyRequests)
+		cfg := config.WebhookCfg{}
+
+		pub := NewWebhookPublisher(srv.URL, NewWebhookClient(cfg), cfg, JSONMarshaler{})
+		err := pub.Publish(context.Background(), "public_users", event)
+		require.EqualError(t, err, "unexpected status 429 Too Many Requests: slow down")
+	})
+}